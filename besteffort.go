@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// SuppressedErrors counts the errors hidden from callers by
+// Client.BestEffort.
+type SuppressedErrors struct {
+	Reads  uint64 // read errors returned as ErrCacheMiss
+	Writes uint64 // write errors swallowed
+}
+
+// suppressedErrors holds the counters behind SuppressedErrors.
+type suppressedErrors struct {
+	reads, writes atomic.Uint64
+}
+
+// SuppressedErrors returns the number of errors hidden by BestEffort so far.
+func (c *Client) SuppressedErrors() SuppressedErrors {
+	return SuppressedErrors{
+		Reads:  c.suppressed.reads.Load(),
+		Writes: c.suppressed.writes.Load(),
+	}
+}
+
+// suppressible reports whether BestEffort may hide err: it came from the
+// network or the server rather than being a cache result or a mistake of
+// the caller.
+func suppressible(err error) bool {
+	switch {
+	case err == nil, resumableError(err), errors.Is(err, ErrCacheMiss), errors.Is(err, ErrMalformedKey):
+		return false
+	case errors.Is(err, ErrClientClosed), errors.Is(err, context.Canceled), errors.Is(err, errors.ErrUnsupported):
+		return false
+	}
+	return true
+}
+
+// suppress applies BestEffort to the error *err of cl: errors of Get become
+// ErrCacheMiss and errors of Set and Delete are dropped.
+func (c *Client) suppress(cl *call, err *error) {
+	if !c.BestEffort || !suppressible(*err) {
+		return
+	}
+	switch cl.op {
+	case "get":
+		c.recordSuppressed(cl.op, *err)
+		*err = ErrCacheMiss
+	case "set", "delete":
+		c.recordSuppressed(cl.op, *err)
+		*err = nil
+	}
+}
+
+// recordSuppressed counts err, hidden from the caller of op, and reports it
+// to OnSuppressedError.
+func (c *Client) recordSuppressed(op string, err error) {
+	switch op {
+	case "get", "get_multi":
+		c.suppressed.reads.Add(1)
+	default:
+		c.suppressed.writes.Add(1)
+	}
+	if c.OnSuppressedError != nil {
+		c.OnSuppressedError(op, err)
+	}
+}
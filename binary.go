@@ -0,0 +1,232 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	binaryHeaderLen = 24
+	magicRequest    = 0x80
+	magicResponse   = 0x81
+)
+
+// Binary protocol opcodes.
+const (
+	opSet     byte = 0x01
+	opAdd     byte = 0x02
+	opReplace byte = 0x03
+	opDelete  byte = 0x04
+	opIncr    byte = 0x05
+	opDecr    byte = 0x06
+	opFlush   byte = 0x08
+	opNoop    byte = 0x0a
+	opVersion byte = 0x0b
+	opGetKQ   byte = 0x0d
+	opAppend  byte = 0x0e
+	opPrepend byte = 0x0f
+)
+
+// Binary protocol response statuses.
+const (
+	statusOK        uint16 = 0x00
+	statusNotFound  uint16 = 0x01
+	statusExists    uint16 = 0x02
+	statusNotStored uint16 = 0x05
+)
+
+// binaryStoreOps maps storage verbs to binary opcodes.
+var binaryStoreOps = map[string]byte{
+	"set":     opSet,
+	"add":     opAdd,
+	"replace": opReplace,
+	"append":  opAppend,
+	"prepend": opPrepend,
+	"cas":     opSet,
+}
+
+// binaryHeader is the fixed-size header of every binary protocol packet.
+type binaryHeader struct {
+	magic     byte
+	opcode    byte
+	keyLen    uint16
+	extrasLen uint8
+	status    uint16 // vbucket id in requests
+	bodyLen   uint32
+	opaque    uint32
+	cas       uint64
+}
+
+// appendBinaryRequest appends a request packet to b.
+func appendBinaryRequest(b []byte, opcode byte, key string, extras, value []byte) []byte {
+	var hdr [binaryHeaderLen]byte
+	hdr[0] = magicRequest
+	hdr[1] = opcode
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(len(key)))
+	hdr[4] = uint8(len(extras))
+	binary.BigEndian.PutUint32(hdr[8:12], uint32(len(extras)+len(key)+len(value)))
+
+	b = append(b, hdr[:]...)
+	b = append(b, extras...)
+	b = append(b, key...)
+	return append(b, value...)
+}
+
+// readBinaryResponse reads one response packet and returns its header,
+// extras, key and value.
+func readBinaryResponse(r *bufio.Reader) (h binaryHeader, extras, key, value []byte, err error) {
+	var hdr [binaryHeaderLen]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return h, nil, nil, nil, err
+	}
+	h = binaryHeader{
+		magic:     hdr[0],
+		opcode:    hdr[1],
+		keyLen:    binary.BigEndian.Uint16(hdr[2:4]),
+		extrasLen: hdr[4],
+		status:    binary.BigEndian.Uint16(hdr[6:8]),
+		bodyLen:   binary.BigEndian.Uint32(hdr[8:12]),
+		opaque:    binary.BigEndian.Uint32(hdr[12:16]),
+		cas:       binary.BigEndian.Uint64(hdr[16:24]),
+	}
+	if h.magic != magicResponse || int(h.extrasLen)+int(h.keyLen) > int(h.bodyLen) {
+		return h, nil, nil, nil, &ProtocolError{Reason: "malformed binary response"}
+	}
+
+	body := make([]byte, h.bodyLen)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return h, nil, nil, nil, err
+	}
+	extras = body[:h.extrasLen]
+	key = body[h.extrasLen : int(h.extrasLen)+int(h.keyLen)]
+	value = body[int(h.extrasLen)+int(h.keyLen):]
+	return h, extras, key, value, nil
+}
+
+// binaryStatusError maps the status of a response to a request of opcode
+// to an error. The binary protocol has no status for a failed add or
+// replace, which report the key existing or missing instead.
+func binaryStatusError(opcode byte, status uint16, value []byte) error {
+	switch status {
+	case statusOK:
+		return nil
+	case statusNotFound:
+		if opcode == opReplace || opcode == opAppend || opcode == opPrepend {
+			return ErrNotStored
+		}
+		return ErrCacheMiss
+	case statusExists:
+		if opcode == opAdd {
+			return ErrNotStored
+		}
+		return ErrCASConflict
+	case statusNotStored:
+		return ErrNotStored
+	}
+	return fmt.Errorf("%w: status %#x: %s", ErrServerError, status, value)
+}
+
+// appendBinaryGet appends quiet GETKQ requests for keys followed by a no-op,
+// so only hits are answered and the no-op marks the end of the response.
+func appendBinaryGet(b []byte, keys []string) []byte {
+	for _, key := range keys {
+		b = appendBinaryRequest(b, opGetKQ, key, nil, nil)
+	}
+	return appendBinaryRequest(b, opNoop, "", nil, nil)
+}
+
+// parseBinaryGet reads the response to a request built by appendBinaryGet.
+func parseBinaryGet(r *bufio.Reader, cb func(*Item)) error {
+	for {
+		h, extras, key, value, err := readBinaryResponse(r)
+		if err != nil {
+			return err
+		}
+		if h.opcode == opNoop {
+			return nil
+		}
+		if err := binaryStatusError(h.opcode, h.status, value); err != nil {
+			return err
+		}
+
+		it := &Item{Key: string(key), Value: value, casID: h.cas}
+		if len(extras) >= 4 {
+			it.Flags = binary.BigEndian.Uint32(extras)
+		}
+		cb(it)
+	}
+}
+
+// appendBinaryStore appends a storage request for it using the given verb.
+func appendBinaryStore(b []byte, verb string, it *Item) []byte {
+	opcode := binaryStoreOps[verb]
+	var extras []byte
+	if opcode != opAppend && opcode != opPrepend {
+		extras = make([]byte, 8)
+		binary.BigEndian.PutUint32(extras[0:4], it.Flags)
+		binary.BigEndian.PutUint32(extras[4:8], uint32(it.Expiration))
+	}
+	start := len(b)
+	b = appendBinaryRequest(b, opcode, it.Key, extras, it.Value)
+	if verb == "cas" {
+		binary.BigEndian.PutUint64(b[start+16:start+24], it.casID)
+	}
+	return b
+}
+
+// appendBinaryIncr appends an increment or decrement request for key that
+// fails if the key does not exist.
+func appendBinaryIncr(b []byte, verb, key string, delta uint64) []byte {
+	opcode := opIncr
+	if verb == "decr" {
+		opcode = opDecr
+	}
+	extras := make([]byte, 20)
+	binary.BigEndian.PutUint64(extras[0:8], delta)
+	binary.BigEndian.PutUint32(extras[16:20], 0xffffffff)
+	return appendBinaryRequest(b, opcode, key, extras, nil)
+}
+
+// parseBinaryIncr reads the response to a request built by
+// appendBinaryIncr and returns the new value.
+func parseBinaryIncr(r *bufio.Reader) (uint64, error) {
+	h, _, _, value, err := readBinaryResponse(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := binaryStatusError(h.opcode, h.status, value); err != nil {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return 0, &ProtocolError{Reason: "malformed binary counter value"}
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// parseBinaryStatus reads a single response and returns its status.
+func parseBinaryStatus(r *bufio.Reader) error {
+	h, _, _, value, err := readBinaryResponse(r)
+	if err != nil {
+		return err
+	}
+	return binaryStatusError(h.opcode, h.status, value)
+}
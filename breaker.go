@@ -0,0 +1,274 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for operations on a server whose circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("memcache: circuit breaker open")
+
+const (
+	// DefaultBreakerThreshold is the default number of consecutive
+	// failures that opens a circuit breaker.
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerCooldown is the default time a circuit breaker stays
+	// open before letting a probe through.
+	DefaultBreakerCooldown = 5 * time.Second
+)
+
+// BreakerState is the state of the circuit breaker of one server.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen fails requests fast with ErrCircuitOpen.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a single probe through once the cooldown has
+	// passed; its outcome closes or reopens the breaker.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "BreakerState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// CircuitBreaker tracks consecutive network failures per server. Once a
+// server fails Threshold times in a row, its breaker opens and requests to
+// it fail fast with ErrCircuitOpen, or are rerouted, instead of each waiting
+// for a full timeout. After Cooldown a single probe request is let through
+// and closes the breaker if it succeeds. Cache results such as ErrCacheMiss
+// and cancelled calls do not count as failures. The zero value is ready to
+// use and safe for concurrent use.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures that opens the
+	// breaker. If zero, DefaultBreakerThreshold is used.
+	Threshold int
+
+	// Cooldown is how long the breaker stays open before a probe. If
+	// zero, DefaultBreakerCooldown is used.
+	Cooldown time.Duration
+
+	// Reroute sends keys of a server whose breaker is open to the next
+	// server, if the selector implements FailoverSelector. Operations
+	// pinned with WithServer are never rerouted.
+	Reroute bool
+
+	// OnStateChange, if not nil, is called whenever the breaker of a server
+	// changes state. It must not block.
+	OnStateChange func(addr net.Addr, from, to BreakerState)
+
+	mu      sync.Mutex
+	servers map[string]*breakerServer
+}
+
+// breakerServer is the breaker state of a single server.
+type breakerServer struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool // a half-open probe is in flight
+}
+
+func (b *CircuitBreaker) threshold() int {
+	if b.Threshold > 0 {
+		return b.Threshold
+	}
+	return DefaultBreakerThreshold
+}
+
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown > 0 {
+		return b.Cooldown
+	}
+	return DefaultBreakerCooldown
+}
+
+// State returns the state of the breaker of the server at addr.
+func (b *CircuitBreaker) State(addr net.Addr) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := b.servers[addr.String()]; s != nil {
+		return s.state
+	}
+	return BreakerClosed
+}
+
+// server returns the state of addr, creating it. b.mu must be held.
+func (b *CircuitBreaker) server(addr net.Addr) *breakerServer {
+	if b.servers == nil {
+		b.servers = make(map[string]*breakerServer)
+	}
+	s := b.servers[addr.String()]
+	if s == nil {
+		s = &breakerServer{}
+		b.servers[addr.String()] = s
+	}
+	return s
+}
+
+// setState moves s to state, returning a function reporting the change to
+// OnStateChange once b.mu is released.
+func (b *CircuitBreaker) setState(addr net.Addr, s *breakerServer, state BreakerState) func() {
+	from := s.state
+	s.state = state
+	if from == state || b.OnStateChange == nil {
+		return func() {}
+	}
+	return func() { b.OnStateChange(addr, from, state) }
+}
+
+// open reports whether requests to addr would currently be rejected,
+// without claiming the half-open probe.
+func (b *CircuitBreaker) open(addr net.Addr) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.servers[addr.String()]
+	switch {
+	case s == nil:
+		return false
+	case s.state == BreakerOpen:
+		return time.Since(s.openedAt) < b.cooldown()
+	case s.state == BreakerHalfOpen:
+		return s.probing
+	}
+	return false
+}
+
+// allow returns ErrCircuitOpen if a request to addr must fail fast. When the
+// cooldown has passed, the caller becomes the half-open probe.
+func (b *CircuitBreaker) allow(addr net.Addr) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	s := b.servers[addr.String()]
+	if s == nil || s.state == BreakerClosed {
+		b.mu.Unlock()
+		return nil
+	}
+	if s.probing || (s.state == BreakerOpen && time.Since(s.openedAt) < b.cooldown()) {
+		b.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	s.probing = true
+	notify := b.setState(addr, s, BreakerHalfOpen)
+	b.mu.Unlock()
+	notify()
+	return nil
+}
+
+// record updates the breaker of addr with the outcome of a request.
+func (b *CircuitBreaker) record(addr net.Addr, err error) {
+	if b == nil || errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+	failed := isServerFailure(err)
+
+	b.mu.Lock()
+	s := b.servers[addr.String()]
+	if s == nil && !failed {
+		b.mu.Unlock()
+		return
+	}
+	if s == nil {
+		s = b.server(addr)
+	}
+
+	notify := func() {}
+	switch {
+	case !failed && err != nil && s.probing:
+		// The probe was cancelled or failed for its own reasons; let the
+		// next request probe instead.
+		s.probing = false
+	case !failed:
+		s.failures = 0
+		s.probing = false
+		notify = b.setState(addr, s, BreakerClosed)
+	default:
+		s.failures++
+		if s.probing || s.failures >= b.threshold() {
+			s.probing = false
+			s.openedAt = time.Now()
+			notify = b.setState(addr, s, BreakerOpen)
+		}
+	}
+	b.mu.Unlock()
+	notify()
+}
+
+// isServerFailure reports whether err means the server itself misbehaved:
+// it could not be reached, the connection broke or a deadline passed.
+func isServerFailure(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// reroute returns the server to use for key when the breaker of addr is
+// open and Reroute is set, and addr otherwise.
+func (c *Client) reroute(cl *call, key string, addr net.Addr) net.Addr {
+	b := c.Breaker
+	if b == nil || !b.Reroute || cl.server != nil || !b.open(addr) {
+		return addr
+	}
+	fs, ok := c.selector.(FailoverSelector)
+	if !ok {
+		return addr
+	}
+	for attempt := 1; attempt < c.serverCount(); attempt++ {
+		next, err := fs.SelectFailover(key, attempt)
+		if err != nil || next.String() == addr.String() {
+			return addr
+		}
+		if !b.open(next) {
+			return next
+		}
+	}
+	return addr
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{down}, false)
+	addr, _ := client.selector.Select("foo")
+
+	var mu sync.Mutex
+	var changes []string
+	client.Breaker = &CircuitBreaker{
+		Threshold: 2,
+		Cooldown:  50 * time.Millisecond,
+		OnStateChange: func(_ net.Addr, from, to BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+	}
+
+	var dials int
+	target := down
+	client.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		dials++
+		var d net.Dialer
+		return d.DialContext(ctx, network, target)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := client.Set(&Item{Key: "foo", Value: []byte("v")}); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected a dial error, got %v", err)
+		}
+	}
+	if err := client.Set(&Item{Key: "foo", Value: []byte("v")}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if dials != 2 {
+		t.Fatalf("expected 2 dials, got %d", dials)
+	}
+	if st := client.Breaker.State(addr); st != BreakerOpen {
+		t.Fatalf("expected the breaker to be open, got %v", st)
+	}
+
+	// After the cooldown, a successful probe closes the breaker.
+	time.Sleep(60 * time.Millisecond)
+	target = srv.addr
+	if err := client.Set(&Item{Key: "foo", Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if st := client.Breaker.State(addr); st != BreakerClosed {
+		t.Fatalf("expected the breaker to be closed, got %v", st)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := "[closed->open open->half-open half-open->closed]"
+	if got := fmt.Sprint(changes); got != want {
+		t.Fatalf("expected state changes %s, got %s", want, got)
+	}
+}
+
+func TestCircuitBreakerReroute(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{srv.addr, down}, false)
+	client.Breaker = &CircuitBreaker{Threshold: 1, Reroute: true}
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key%d", i)
+		if addr, _ := client.selector.Select(key); addr.String() == down {
+			break
+		}
+	}
+
+	if err := client.Set(&Item{Key: key, Value: []byte("v")}); err == nil {
+		t.Fatalf("expected a dial error")
+	}
+	if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if srv.item(key) == nil {
+		t.Fatalf("expected %q to be rerouted to the healthy server", key)
+	}
+}
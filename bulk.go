@@ -0,0 +1,287 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// WithNoReply asks the servers of DeleteMulti and SetMulti not to answer,
+// so that the requests are only written. Results then report nil for every key sent,
+// whatever happened to it. Only text connections honor it. Servers still
+// answer errors to noreply requests, so the batch ends with a version
+// request and the client discards any errors up to its answer.
+func WithNoReply() CallOption {
+	return func(o *callOptions) { o.noReply = true }
+}
+
+// DeleteMulti deletes keys, pipelining the requests to each server in one
+// round trip. Unlike Delete, it leaves the chunks of chunked values to
+// expire.
+//
+// The result maps every key to nil if it was deleted or ErrCacheMiss if it
+// was already gone. Keys of servers that failed are left out and reported
+// in a MultiError keyed by address.
+func (c *Client) DeleteMulti(keys []string, opts ...CallOption) (map[string]error, error) {
+	return c.DeleteMultiContext(context.Background(), keys, opts...)
+}
+
+// DeleteMultiContext is like DeleteMulti but bounded by ctx.
+func (c *Client) DeleteMultiContext(ctx context.Context, keys []string, opts ...CallOption) (results map[string]error, err error) {
+	err = c.run(ctx, &Operation{Name: "delete_multi", Keys: keys}, opts, func(cl *call, op *Operation) (err error) {
+		keys := op.Keys
+		tkeys := make([]string, len(keys))
+		for i, key := range keys {
+			if tkeys[i], err = c.transformKey(key); err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			if c.CoalesceWindow > 0 {
+				c.dropWrite(key)
+			}
+			c.Local.remove(key)
+		}
+
+		res, err := c.bulkWrite(cl, tkeys, func(p Protocol, b []byte, i int) []byte {
+			return p.appendDelete(b, tkeys[i])
+		}, Protocol.parseDelete)
+
+		results = make(map[string]error, len(keys))
+		for i, key := range keys {
+			if r, ok := res[i]; ok {
+				results[key] = r
+			}
+		}
+		return err
+	})
+	return results, err
+}
+
+// SetMulti writes items, pipelining the requests to each server in one
+// round trip, for jobs writing many items at once such as cache warming.
+// Items are jittered, encoded and chunked as by Set, but not coalesced.
+//
+// The result maps the key of every item to nil if it was stored or to the
+// error that prevented it. Keys of servers that failed are left out and
+// reported in a MultiError keyed by address. If items holds a key more
+// than once, its last item wins.
+func (c *Client) SetMulti(items []*Item, opts ...CallOption) (map[string]error, error) {
+	return c.SetMultiContext(context.Background(), items, opts...)
+}
+
+// SetMultiContext is like SetMulti but bounded by ctx.
+func (c *Client) SetMultiContext(ctx context.Context, items []*Item, opts ...CallOption) (map[string]error, error) {
+	results := make(map[string]error, len(items))
+	var pending []*Item
+	for _, item := range items {
+		item = c.jitterItem(item, opts)
+		if c.ChunkSize > 0 && len(item.Value) > c.ChunkSize {
+			results[item.Key] = c.setChunked(ctx, item, bytes.NewReader(item.Value), int64(len(item.Value)), c.ChunkSize, opts)
+			continue
+		}
+		pending = append(pending, item)
+	}
+
+	err := c.run(ctx, &Operation{Name: "set_multi", Items: pending}, opts, func(cl *call, op *Operation) error {
+		var keys []string
+		var encoded []Item
+		var original []string
+		for _, item := range op.Items {
+			if c.CoalesceWindow > 0 {
+				c.dropWrite(item.Key)
+			}
+			c.Local.remove(item.Key)
+			key, err := c.transformKey(item.Key)
+			if err != nil {
+				results[item.Key] = err
+				continue
+			}
+			c.ValueSizes.observe(item.Key, len(item.Value))
+			it, err := c.encodeItem(item.Key, *item)
+			if err != nil {
+				results[item.Key] = err
+				continue
+			}
+			it.Key = key
+			keys = append(keys, key)
+			encoded = append(encoded, it)
+			original = append(original, item.Key)
+		}
+
+		res, err := c.bulkWrite(cl, keys, func(p Protocol, b []byte, i int) []byte {
+			return p.appendStore(b, "set", &encoded[i])
+		}, Protocol.parseStore)
+		for i, key := range original {
+			if r, ok := res[i]; ok {
+				results[key] = r
+				if r == nil && c.Journal != nil {
+					c.Journal.Record(key)
+				}
+			}
+		}
+		return err
+	})
+	return results, err
+}
+
+// bulkWrite sends the requests built by req for the transformed keys to
+// their servers, pipelining those of each server in one round trip, and
+// reads their answers with parse. With replicas, a key is written to each
+// of them, and its result is nil if any replica succeeded, ErrCacheMiss if
+// every replica missed, or else the error of a replica.
+//
+// Keys are left out of the results when no replica answered for them or
+// the outcome is unknown because of a failed server. Server failures are
+// reported in a MultiError keyed by address.
+func (c *Client) bulkWrite(cl *call, keys []string, req func(p Protocol, b []byte, i int) []byte, parse func(Protocol, *bufio.Reader) error) (map[int]error, error) {
+	byAddr := make(map[net.Addr][]int)
+	replicas := make([]int, len(keys))
+	for i, key := range keys {
+		addrs, err := c.routeWrite(cl, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			byAddr[addr] = append(byAddr[addr], i)
+		}
+		replicas[i] = len(addrs)
+	}
+
+	var lk sync.Mutex
+	succeeded := make([]int, len(keys))
+	missed := make([]int, len(keys))
+	failed := make([]error, len(keys))
+	var merr MultiError
+	var wg sync.WaitGroup
+	for addr, idx := range byAddr {
+		wg.Add(1)
+		go func(addr net.Addr, idx []int) {
+			defer wg.Done()
+			var res []error
+			err := c.withRetry(cl, func(int, error) error {
+				var err error
+				res, err = c.bulkWriteTo(cl, addr, idx, req, parse)
+				return err
+			})
+
+			lk.Lock()
+			defer lk.Unlock()
+			if err != nil {
+				if merr == nil {
+					merr = make(MultiError)
+				}
+				merr[addr.String()] = err
+				return
+			}
+			for j, i := range idx {
+				switch {
+				case res[j] == nil:
+					succeeded[i]++
+				case errors.Is(res[j], ErrCacheMiss):
+					missed[i]++
+				default:
+					failed[i] = res[j]
+				}
+			}
+		}(addr, idx)
+	}
+	wg.Wait()
+
+	results := make(map[int]error, len(keys))
+	for i := range keys {
+		switch {
+		case succeeded[i] > 0:
+			results[i] = nil
+		case missed[i] == replicas[i]:
+			results[i] = ErrCacheMiss
+		case failed[i] != nil:
+			results[i] = failed[i]
+		}
+	}
+	if merr != nil {
+		return results, merr
+	}
+	return results, nil
+}
+
+// bulkWriteTo sends the requests of the keys at indexes idx to addr in one
+// pipeline and returns their results in order. Without replies, every
+// result is nil.
+func (c *Client) bulkWriteTo(cl *call, addr net.Addr, idx []int, req func(Protocol, []byte, int) []byte, parse func(Protocol, *bufio.Reader) error) ([]error, error) {
+	sp, err := c.callProtocol(cl, addr)
+	if err != nil {
+		return nil, err
+	}
+	noReply := cl.opts.noReply && sp.Protocol == ProtocolText
+
+	var b []byte
+	for _, i := range idx {
+		start := len(b)
+		b = req(sp.Protocol, b, i)
+		if noReply {
+			b = appendNoReply(b, start)
+		}
+	}
+	if noReply {
+		b = ProtocolText.appendVersion(b)
+	}
+	res := make([]error, len(idx))
+	err = c.roundTrip(cl.ctx, addr, sp.Protocol, false, b, func(r *bufio.Reader) error {
+		if noReply {
+			return skipNoReplyErrors(r)
+		}
+		for j := range idx {
+			err := parse(sp.Protocol, r)
+			if err != nil && !resumableError(err) {
+				return err
+			}
+			res[j] = err
+		}
+		return nil
+	})
+	return res, cl.opError(addr, "", err)
+}
+
+// skipNoReplyErrors reads the errors answered to noreply requests up to
+// the answer to the version request that ends them, leaving the connection
+// in sync for its next user.
+func skipNoReplyErrors(r *bufio.Reader) error {
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(line, versionPrefix) {
+			return nil
+		}
+	}
+}
+
+// appendNoReply marks the text request appended to b since start as not to
+// be answered, adding noreply to its command line.
+func appendNoReply(b []byte, start int) []byte {
+	i := start + bytes.Index(b[start:], crlf)
+	rest := append([]byte(" noreply"), b[i:]...)
+	return append(b[:i], rest...)
+}
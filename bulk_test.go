@@ -0,0 +1,164 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestDeleteMulti(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta, ProtocolBinary} {
+		a := newTestServer(t)
+		b := newTestServer(t)
+		client, _ := NewClient([]string{a.addr, b.addr}, false)
+
+		keys := []string{"k1", "k2", "k3", "k4", "k5", "k6"}
+		for _, key := range keys[:5] {
+			if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		res, err := client.DeleteMulti(keys, WithProtocol(p))
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		for _, key := range keys[:5] {
+			if err, ok := res[key]; !ok || err != nil {
+				t.Fatalf("%v: expected %s to be deleted, got %v", p, key, err)
+			}
+			if a.item(key) != nil || b.item(key) != nil {
+				t.Fatalf("%v: expected %s to be gone", p, key)
+			}
+		}
+		if res["k6"] != ErrCacheMiss {
+			t.Fatalf("%v: expected ErrCacheMiss for k6, got %v", p, res["k6"])
+		}
+	}
+}
+
+func TestDeleteMultiNoReply(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	for _, key := range []string{"k1", "k2"} {
+		if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	res, err := client.DeleteMulti([]string{"k1", "k2", "k3"}, WithNoReply())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(res) != 3 || res["k3"] != nil {
+		t.Fatalf("expected nil results for every key, got %v", res)
+	}
+	// The connection must still be usable for requests that are answered.
+	if _, err := client.Get("k1"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+	for _, cmd := range srv.commands() {
+		if strings.HasPrefix(cmd, "delete") && !strings.HasSuffix(cmd, " noreply") {
+			t.Fatalf("expected deletes without replies, got %q", cmd)
+		}
+	}
+}
+
+func TestDeleteMultiServerDown(t *testing.T) {
+	up := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{up.addr, down}, false)
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	res, err := client.DeleteMulti(keys)
+	merr, ok := err.(MultiError)
+	if !ok || merr[down] == nil {
+		t.Fatalf("expected a MultiError for %s, got %v", down, err)
+	}
+	for _, key := range keys {
+		addr, _ := client.SelectServer(key)
+		if _, ok := res[key]; ok != (addr == up.addr) {
+			t.Fatalf("expected results only for keys of %s, got %v", up.addr, res)
+		}
+	}
+}
+
+func TestSetMulti(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta, ProtocolBinary} {
+		a := newTestServer(t)
+		b := newTestServer(t)
+		client, _ := NewClient([]string{a.addr, b.addr}, false)
+
+		items := []*Item{
+			{Key: "k1", Value: []byte("v1"), Flags: 3, Expiration: 60},
+			{Key: "k2", Value: []byte("v2")},
+			{Key: "k3", Value: []byte("v3")},
+		}
+		res, err := client.SetMulti(items, WithProtocol(p))
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		for _, item := range items {
+			if err, ok := res[item.Key]; !ok || err != nil {
+				t.Fatalf("%v: expected %s to be stored, got %v", p, item.Key, err)
+			}
+			it, err := client.Get(item.Key)
+			if err != nil {
+				t.Fatalf("%v: expected no error, got %v", p, err)
+			}
+			if string(it.Value) != string(item.Value) || it.Flags != item.Flags {
+				t.Fatalf("%v: expected %+v, got %+v", p, item, it)
+			}
+		}
+		srv := a
+		if addr, _ := client.SelectServer("k1"); addr != a.addr {
+			srv = b
+		}
+		if exp := srv.item("k1").exp; exp != 60 {
+			t.Fatalf("%v: expected k1 to expire in 60s, got %d", p, exp)
+		}
+	}
+}
+
+func TestSetMultiNoReply(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	res, err := client.SetMulti([]*Item{{Key: "k1", Value: []byte("v1")}, {Key: "k2", Value: []byte("v2")}}, WithNoReply())
+	if err != nil || len(res) != 2 {
+		t.Fatalf("expected two results, got %v, %v", res, err)
+	}
+	for _, key := range []string{"k1", "k2"} {
+		if _, err := client.Get(key); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// Errors are answered anyway and must not be read by the next request.
+	srv.mu.Lock()
+	srv.itemSizeMax = 4
+	srv.mu.Unlock()
+	if _, err := client.SetMulti([]*Item{{Key: "big", Value: []byte("too large")}}, WithNoReply()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get("k1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
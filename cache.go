@@ -0,0 +1,154 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+)
+
+// Store is the backing store of a Cache, such as a database, holding the
+// values the cache is in front of.
+type Store[T any] interface {
+	// Load returns the value of key, or ErrNotFound if there is none.
+	Load(ctx context.Context, key string) (T, error)
+
+	// Save writes v as the value of key.
+	Save(ctx context.Context, key string, v T) error
+}
+
+// CachePolicy is the behavior of a Cache with a Store when the cache
+// fails. Errors of the Store are always returned.
+type CachePolicy int
+
+const (
+	// CacheBestEffort ignores errors of the cache: Get loads the value from
+	// the Store when it cannot read the cache, and Set saves it to the
+	// Store when it cannot write the cache, deleting the stale value it
+	// may hold.
+	CacheBestEffort CachePolicy = iota
+
+	// CacheRequired returns errors of the cache: Get does not load the
+	// value and Set does not save it.
+	CacheRequired
+)
+
+// Cache is a typed view of a Client caching values of type T, so that the
+// compiler checks what is stored and read back:
+//
+//	users := &gomcache.Cache[User]{Client: client}
+//	err := users.Set(ctx, "user:1", u, 3600)
+//	u, err := users.Get(ctx, "user:1")
+//
+// With a Store, it reads through to the Store on misses, like
+// Client.Fetch, and writes through to it on Set. It is safe for concurrent
+// use.
+type Cache[T any] struct {
+	// Client stores the values.
+	Client *Client
+
+	// Codec encodes the values. If nil, the Codec of Client is used.
+	Codec Codec
+
+	// Store, if not nil, is the backing store of the values: Get loads the
+	// values it misses from it, caching them for Expiration, and Set saves
+	// values to it once cached.
+	Store Store[T]
+
+	// Expiration is the expiration of the values loaded from Store, as
+	// Item.Expiration.
+	Expiration int32
+
+	// Policy is the behavior when the cache fails, with a Store.
+	Policy CachePolicy
+}
+
+// codec returns the Codec in effect.
+func (c *Cache[T]) codec() Codec {
+	if c.Codec != nil {
+		return c.Codec
+	}
+	return c.Client.codec()
+}
+
+// Get returns the value of key. It returns ErrCacheMiss if the key is not
+// cached, or, with a Store, loads it, sharing the load with concurrent
+// Gets of the key.
+func (c *Cache[T]) Get(ctx context.Context, key string, opts ...CallOption) (T, error) {
+	var v T
+	var item *Item
+	var err error
+	if c.Store != nil {
+		item, err = c.Client.fetch(ctx, key, c.Expiration, c.load(key), c.Policy == CacheRequired, opts)
+	} else {
+		item, err = c.Client.GetContext(ctx, key, opts...)
+	}
+	if err != nil {
+		return v, err
+	}
+	err = c.codec().Unmarshal(item.Value, item.Flags, &v)
+	return v, err
+}
+
+// load returns a loader of the value of key from the Store.
+func (c *Cache[T]) load(key string) func(context.Context) (*Item, error) {
+	return func(ctx context.Context) (*Item, error) {
+		v, err := c.Store.Load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		value, flags, err := c.codec().Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return &Item{Value: value, Flags: flags}, nil
+	}
+}
+
+// Set stores v under key, expiring as Item.Expiration, then, with a Store,
+// saves it there. If saving fails, the cached value is deleted again.
+func (c *Cache[T]) Set(ctx context.Context, key string, v T, expiration int32, opts ...CallOption) error {
+	value, flags, err := c.codec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = c.Client.SetContext(ctx, &Item{Key: key, Value: value, Flags: flags, Expiration: expiration}, opts...)
+	if c.Store == nil {
+		return err
+	}
+	if err != nil {
+		if c.Policy == CacheRequired {
+			return err
+		}
+		c.Client.DeleteContext(ctx, key, opts...)
+	}
+
+	if err := c.Store.Save(ctx, key, v); err != nil {
+		if derr := c.Client.DeleteContext(ctx, key, opts...); derr != nil && !errors.Is(derr, ErrCacheMiss) {
+			return errors.Join(err, derr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete deletes the value of key. It returns ErrCacheMiss if the key is
+// not cached.
+func (c *Cache[T]) Delete(ctx context.Context, key string, opts ...CallOption) error {
+	return c.Client.DeleteContext(ctx, key, opts...)
+}
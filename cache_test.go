@@ -0,0 +1,164 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// mapStore is a Store of users counting its loads.
+type mapStore struct {
+	mu      sync.Mutex
+	users   map[string]testUser
+	loads   int
+	saveErr error
+}
+
+func (m *mapStore) Load(ctx context.Context, key string) (testUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads++
+	u, ok := m.users[key]
+	if !ok {
+		return u, ErrNotFound
+	}
+	return u, nil
+}
+
+func (m *mapStore) Save(ctx context.Context, key string, u testUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	m.users[key] = u
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	users := &Cache[testUser]{Client: client, Codec: GobCodec()}
+	ctx := context.Background()
+
+	want := testUser{ID: 7, Name: "ada", Roles: []string{"admin"}}
+	if err := users.Set(ctx, "user", want, 60); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("user"); it.flags != FlagGob || it.exp != 60 {
+		t.Fatalf("expected flags %#x and expiration 60, got %#x and %d", FlagGob, it.flags, it.exp)
+	}
+	got, err := users.Get(ctx, "user")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if err := users.Delete(ctx, "user"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got, err := users.Get(ctx, "user"); !errors.Is(err, ErrCacheMiss) || !reflect.DeepEqual(got, testUser{}) {
+		t.Fatalf("expected the zero value and ErrCacheMiss, got %+v and %v", got, err)
+	}
+
+	// Without a Codec of its own, the cache uses that of the client.
+	counts := &Cache[map[string]int]{Client: client}
+	if err := counts.Set(ctx, "counts", map[string]int{"a": 1}, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("counts"); it.flags != FlagJSON || string(it.value) != `{"a":1}` {
+		t.Fatalf("expected JSON, got %q with flags %#x", it.value, it.flags)
+	}
+}
+
+func TestCacheStore(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	store := &mapStore{users: map[string]testUser{"ada": {ID: 1, Name: "ada"}}}
+	users := &Cache[testUser]{Client: client, Store: store, Expiration: 60}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		u, err := users.Get(ctx, "ada")
+		if err != nil || u.Name != "ada" {
+			t.Fatalf("expected ada, got %+v and %v", u, err)
+		}
+	}
+	if store.loads != 1 {
+		t.Fatalf("expected one load, got %d", store.loads)
+	}
+	if it := s.item("ada"); it == nil || it.exp != 60 {
+		t.Fatalf("expected the loaded value to be cached for 60s, got %+v", it)
+	}
+	if _, err := users.Get(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// Set writes through to the store, and takes the value out of the
+	// cache again if the store fails.
+	if err := users.Set(ctx, "bob", testUser{ID: 2, Name: "bob"}, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if store.users["bob"].ID != 2 || s.item("bob") == nil {
+		t.Fatalf("expected bob in the store and the cache")
+	}
+	store.saveErr = errors.New("database down")
+	if err := users.Set(ctx, "bob", testUser{ID: 3, Name: "bob"}, 0); !errors.Is(err, store.saveErr) {
+		t.Fatalf("expected the store error, got %v", err)
+	}
+	if s.item("bob") != nil {
+		t.Fatalf("expected the value to be deleted from the cache")
+	}
+}
+
+func TestCacheStorePolicy(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+	client, _ := NewClient([]string{down}, false)
+	store := &mapStore{users: map[string]testUser{"ada": {ID: 1, Name: "ada"}}}
+	users := &Cache[testUser]{Client: client, Store: store}
+	ctx := context.Background()
+
+	// Best effort, the store answers while the cache is down.
+	if u, err := users.Get(ctx, "ada"); err != nil || u.Name != "ada" {
+		t.Fatalf("expected ada, got %+v and %v", u, err)
+	}
+	if err := users.Set(ctx, "bob", testUser{ID: 2}, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	users.Policy = CacheRequired
+	loads := store.loads
+	if _, err := users.Get(ctx, "ada"); err == nil {
+		t.Fatalf("expected an error with the cache down")
+	}
+	if err := users.Set(ctx, "carl", testUser{ID: 3}, 0); err == nil {
+		t.Fatalf("expected an error with the cache down")
+	}
+	if store.loads != loads || store.users["carl"].ID != 0 {
+		t.Fatalf("expected the store not to be used")
+	}
+}
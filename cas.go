@@ -0,0 +1,180 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+)
+
+// The operations here talk to the primary server of a key only, without
+// replicas, hedging or the Local cache: CAS values are assigned by each
+// server, so a value read from one server can only be compared on that
+// server.
+
+// Update changes the value of key to the result of fn applied to its
+// current value, with a gets and a cas, so that a concurrent write is never
+// lost: if the key changes in between, fn runs again on the new value, up
+// to maxRetries more times, after which ErrCASConflict is returned. A
+// missing key is passed to fn as nil and added. An error of fn is returned
+// as is and leaves the key alone.
+//
+// The flags of the item are kept, but memcached does not report the
+// expiration of items, so the updated value never expires. Only the primary
+// server of key is involved.
+func (c *Client) Update(key string, fn func(old []byte) ([]byte, error), maxRetries int, opts ...CallOption) error {
+	return c.UpdateContext(context.Background(), key, fn, maxRetries, opts...)
+}
+
+// UpdateContext is like Update but bounded by ctx.
+func (c *Client) UpdateContext(ctx context.Context, key string, fn func(old []byte) ([]byte, error), maxRetries int, opts ...CallOption) error {
+	for attempt := 0; ; attempt++ {
+		it, err := c.gets(ctx, key, opts)
+		verb := "cas"
+		if errors.Is(err, ErrCacheMiss) {
+			it, verb = &Item{Key: key}, "add"
+		} else if err != nil {
+			return err
+		}
+		if it.Value, err = fn(it.Value); err != nil {
+			return err
+		}
+		err = c.storePrimary(ctx, verb, it, opts)
+		switch {
+		case err == ErrCASConflict, err == ErrCacheMiss, err == ErrNotStored:
+			if attempt >= maxRetries {
+				return ErrCASConflict
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// gets fetches key from its primary server together with its CAS value.
+func (c *Client) gets(ctx context.Context, key string, opts []CallOption) (item *Item, err error) {
+	err = c.run(ctx, &Operation{Name: "gets", Key: key}, opts, func(cl *call, op *Operation) error {
+		tkey, err := c.transformKey(op.Key)
+		if err != nil {
+			return err
+		}
+		addr, err := c.route(cl, tkey)
+		if err != nil {
+			return err
+		}
+		err = c.withRetry(cl, func(n int, prev error) error {
+			addr = c.failover(cl, tkey, addr, n, prev)
+			sp, err := c.callProtocol(cl, addr)
+			if err != nil {
+				return err
+			}
+			item = nil
+			return cl.opError(addr, tkey, c.roundTrip(cl.ctx, addr, sp.Protocol, false, sp.Protocol.appendGets(nil, []string{tkey}), func(r *bufio.Reader) error {
+				return sp.Protocol.parseGet(r, func(it *Item) {
+					item = it
+				})
+			}))
+		})
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrCacheMiss
+		}
+		item.Key = op.Key
+		return c.decodeItem(item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrCacheMiss // a middleware skipped the gets
+	}
+	// The item goes back to cas under the key the caller knows it by.
+	item.Key = key
+	return item, nil
+}
+
+// storePrimary is like store, but writes item to the primary server of its
+// key only. With the verb "cas", item must come from gets.
+func (c *Client) storePrimary(ctx context.Context, verb string, item *Item, opts []CallOption) error {
+	return c.run(ctx, &Operation{Name: verb, Key: item.Key, Item: item}, opts, func(cl *call, op *Operation) error {
+		item := op.item()
+		defer c.Local.remove(item.Key)
+
+		key, err := c.transformKey(item.Key)
+		if err != nil {
+			return err
+		}
+		it, err := c.encodeItem(item.Key, *item)
+		if err != nil {
+			return err
+		}
+		it.Key = key
+		return c.primaryRoundTrip(cl, key, func(p Protocol) []byte {
+			return p.appendStore(nil, verb, &it)
+		}, Protocol.parseStore)
+	})
+}
+
+// deleteCAS deletes key from its primary server if its CAS value is still
+// cas, returning ErrCASConflict if not. It is named "delete_cas" rather
+// than "delete" so that BestEffort does not hide its errors: releasing a
+// lock must not report success while the lock is still held.
+func (c *Client) deleteCAS(ctx context.Context, key string, cas uint64, opts []CallOption) error {
+	return c.run(ctx, &Operation{Name: "delete_cas", Key: key}, opts, func(cl *call, op *Operation) error {
+		key := op.Key
+		defer c.Local.remove(key)
+
+		tkey, err := c.transformKey(key)
+		if err != nil {
+			return err
+		}
+		// Every dialect answers a conditional delete like a storage command.
+		return c.primaryRoundTrip(cl, tkey, func(p Protocol) []byte {
+			return p.appendDeleteCAS(nil, tkey, cas)
+		}, Protocol.parseStore)
+	})
+}
+
+// primaryRoundTrip sends the request built by req to the primary server of
+// the transformed key and reads the response with parse. The requests sent
+// this way are not idempotent, so they are tried once and never fail over:
+// a retried add or incr may apply twice, and one on another server would
+// not see the key at all.
+func (c *Client) primaryRoundTrip(cl *call, key string, req func(Protocol) []byte, parse func(Protocol, *bufio.Reader) error) error {
+	addr, err := c.route(cl, key)
+	if err != nil {
+		return err
+	}
+	return c.roundTripOnce(cl, addr, key, req, parse)
+}
+
+// roundTripOnce is primaryRoundTrip to addr, the primary server of the
+// requests built by req. Errors are reported for key, if not empty.
+func (c *Client) roundTripOnce(cl *call, addr net.Addr, key string, req func(Protocol) []byte, parse func(Protocol, *bufio.Reader) error) error {
+	sp, err := c.callProtocol(cl, addr)
+	if err != nil {
+		return err
+	}
+	return cl.opError(addr, key, c.roundTrip(cl.ctx, addr, sp.Protocol, false, req(sp.Protocol), func(r *bufio.Reader) error {
+		return parse(sp.Protocol, r)
+	}))
+}
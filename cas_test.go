@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta} {
+		srv := newTestServer(t)
+		client, _ := NewClient([]string{srv.addr}, false)
+
+		appendX := func(old []byte) ([]byte, error) {
+			return append(old, 'x'), nil
+		}
+		if err := client.Update("k", appendX, 0, WithProtocol(p)); err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		if err := client.Update("k", appendX, 0, WithProtocol(p)); err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		if v := string(srv.item("k").value); v != "xx" {
+			t.Fatalf("%v: expected xx, got %q", p, v)
+		}
+
+		errStop := errors.New("stop")
+		err := client.Update("k", func([]byte) ([]byte, error) { return nil, errStop }, 0, WithProtocol(p))
+		if err != errStop {
+			t.Fatalf("%v: expected the error of fn, got %v", p, err)
+		}
+
+		// A write racing with every attempt exhausts the retries.
+		calls := 0
+		err = client.Update("k", func(old []byte) ([]byte, error) {
+			calls++
+			if err := client.Set(&Item{Key: "k", Value: []byte("other")}); err != nil {
+				t.Fatalf("%v: expected no error, got %v", p, err)
+			}
+			return old, nil
+		}, 2, WithProtocol(p))
+		if err != ErrCASConflict || calls != 3 {
+			t.Fatalf("%v: expected ErrCASConflict after 3 calls, got %v after %d", p, err, calls)
+		}
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := client.Update("n", func(old []byte) ([]byte, error) {
+				n, _ := strconv.Atoi(string(old))
+				return []byte(strconv.Itoa(n + 1)), nil
+			}, 100)
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := string(srv.item("n").value); v != "10" {
+		t.Fatalf("expected 10, got %q", v)
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+// Child returns a client named name that shares the servers, connection
+// pools, per-server settings and circuit breaker of c, so subsystems of one
+// process can be observed independently without opening connections of
+// their own. The child records its metrics apart from c: it has its own
+// SuppressedErrors and ClientStats counters, and a TimeoutHistogram and
+// ValueSizes of its own, configured like those of c, if c has them.
+// Settings changed on the child do not affect c, but closing either one
+// closes the shared connections of both.
+func (c *Client) Child(name string) *Client {
+	child := *c
+	if c.name != "" {
+		name = c.name + "." + name
+	}
+	child.name = name
+	child.coalescer = newCoalescer()
+	child.fetches = newFetchGroup()
+	child.suppressed = new(suppressedErrors)
+	child.counters = new(opCounters)
+	child.latencies = new(serverLatencies)
+	if c.TimeoutHistogram != nil {
+		child.TimeoutHistogram = new(TimeoutHistogram)
+	}
+	child.ValueSizes = c.ValueSizes.clone()
+	child.KeyTransformers = append([]KeyTransformer(nil), c.KeyTransformers...)
+	child.middleware = append([]func(OpFunc) OpFunc(nil), c.middleware...)
+	return &child
+}
+
+// Name returns the name of a client created by Child, dot-separated after
+// the names of its parents, or "" for other clients.
+func (c *Client) Name() string {
+	return c.name
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"net"
+	"testing"
+)
+
+func TestChild(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	defer client.Close()
+	client.TimeoutHistogram = &TimeoutHistogram{}
+
+	sessions := client.Child("sessions")
+	if name := sessions.Child("users").Name(); name != "sessions.users" {
+		t.Fatalf("expected name sessions.users, got %q", name)
+	}
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := sessions.Get("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n := srv.accepted(); n != 1 {
+		t.Fatalf("expected the connection to be shared, got %d connections", n)
+	}
+
+	parent, child := client.TimeoutHistogram.Report(), sessions.TimeoutHistogram.Report()
+	if len(parent) != 1 || parent[0].Op != "set" || len(child) != 1 || child[0].Op != "get" {
+		t.Fatalf("expected separate timeout histograms, got %+v and %+v", parent, child)
+	}
+
+	// Suppressed errors are counted per client.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+	client, _ = NewClient([]string{down}, false)
+	client.BestEffort = true
+	sessions = client.Child("sessions")
+	if _, err := sessions.Get("foo"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+	if st := client.SuppressedErrors(); st.Reads != 0 {
+		t.Fatalf("expected no errors suppressed by the parent, got %+v", st)
+	}
+	if st := sessions.SuppressedErrors(); st.Reads != 1 {
+		t.Fatalf("expected 1 read suppressed by the child, got %+v", st)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+)
+
+// FlagChunked marks the manifest of a value stored in chunks by a client
+// with ChunkSize set.
+const FlagChunked uint32 = 1 << 23
+
+// DefaultChunkSize is the size of the chunks written by SetReader when the
+// ChunkSize of the client is zero, leaving room under the default 1 MB item
+// size limit of memcached for the key and item header.
+const DefaultChunkSize = 1000 * 1000
+
+// chunkManifest describes a value stored in chunks: the chunks are the keys
+// chunkKey(key, 0) to chunkKey(key, n-1), holding size bytes in all.
+type chunkManifest struct {
+	gen  string // distinguishes the chunks of successive writes
+	n    int
+	size int
+	crc  uint32
+}
+
+// String encodes m as the value of the manifest item.
+func (m chunkManifest) String() string {
+	return fmt.Sprintf("chunks %s %d %d %d", m.gen, m.n, m.size, m.crc)
+}
+
+// parseChunkManifest decodes the value of a manifest item.
+func parseChunkManifest(b []byte) (chunkManifest, error) {
+	var m chunkManifest
+	_, err := fmt.Sscanf(string(b), "chunks %s %d %d %d", &m.gen, &m.n, &m.size, &m.crc)
+	if err != nil || m.n < 1 || m.size < 0 {
+		return m, errors.New("memcache: malformed chunk manifest")
+	}
+	return m, nil
+}
+
+// chunkKey returns the key of chunk i of the value of key.
+func (m chunkManifest) chunkKey(key string, i int) string {
+	return key + "~" + m.gen + "~" + strconv.Itoa(i)
+}
+
+// setChunked stores the value of item, the size bytes read from r, in
+// chunks of chunkSize bytes, then the manifest under the key of item, so
+// that readers never see a manifest whose chunks are not all written. Only
+// one chunk is held in memory at a time.
+func (c *Client) setChunked(ctx context.Context, item *Item, r io.Reader, size int64, chunkSize int, opts []CallOption) error {
+	return c.intercept(ctx, &Operation{Name: "set", Key: item.Key, Item: item}, func(ctx context.Context, op *Operation) error {
+		item := op.item()
+		var gen [4]byte
+		if _, err := rand.Read(gen[:]); err != nil {
+			return err
+		}
+		m := chunkManifest{
+			gen:  hex.EncodeToString(gen[:]),
+			n:    int((size + int64(chunkSize) - 1) / int64(chunkSize)),
+			size: int(size),
+		}
+		h := crc32.NewIEEE()
+		for i := 0; i < m.n; i++ {
+			// Chunks are not reused, as a replica written asynchronously may
+			// still hold the previous one.
+			chunk := make([]byte, min(int64(chunkSize), size-int64(i*chunkSize)))
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return err
+			}
+			h.Write(chunk)
+			if err := c.set(ctx, &Item{Key: m.chunkKey(item.Key, i), Value: chunk, Expiration: item.Expiration}, opts); err != nil {
+				return err
+			}
+		}
+		m.crc = h.Sum32()
+		return c.set(ctx, &Item{
+			Key:        item.Key,
+			Value:      []byte(m.String()),
+			Flags:      item.Flags | FlagChunked,
+			Expiration: item.Expiration,
+		}, opts)
+	})
+}
+
+// getChunked returns the value whose manifest is item, reading its chunks.
+// A missing chunk, evicted or expired, makes the whole value a miss.
+func (c *Client) getChunked(ctx context.Context, item *Item, opts []CallOption) (*Item, error) {
+	m, err := parseChunkManifest(item.Value)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, m.n)
+	for i := range keys {
+		keys[i] = m.chunkKey(item.Key, i)
+	}
+	chunks, err := c.getMulti(ctx, keys, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, 0, m.size)
+	for _, key := range keys {
+		chunk, ok := chunks[key]
+		if !ok {
+			return nil, ErrCacheMiss
+		}
+		value = append(value, chunk.Value...)
+	}
+	if len(value) != m.size || crc32.ChecksumIEEE(value) != m.crc {
+		return nil, chunkMismatch(item.Key)
+	}
+	return &Item{Key: item.Key, Value: value, Flags: item.Flags &^ FlagChunked, Expiration: item.Expiration}, nil
+}
+
+// chunkMismatch returns the error for chunks of key not adding up to the
+// value described by their manifest.
+func chunkMismatch(key string) error {
+	return errors.New("memcache: chunks of " + strconv.Quote(key) + " do not match their manifest")
+}
+
+// getChunkedMulti replaces the manifests in items by their values, leaving
+// out those that cannot be read.
+func (c *Client) getChunkedMulti(ctx context.Context, items map[string]*Item, opts []CallOption) {
+	for key, it := range items {
+		if it.Flags&FlagChunked == 0 {
+			continue
+		}
+		full, err := c.getChunked(ctx, it, opts)
+		if err != nil {
+			delete(items, key)
+			continue
+		}
+		items[key] = full
+	}
+}
+
+// deleteChunked deletes the chunks of the value of key, if it is chunked,
+// after its manifest. Chunks that cannot be deleted are left to expire.
+func (c *Client) deleteChunked(ctx context.Context, key string, opts []CallOption) error {
+	return c.intercept(ctx, &Operation{Name: "delete", Key: key}, func(ctx context.Context, op *Operation) error {
+		key := op.Key
+		manifest, err := c.get(ctx, key, append(opts, withRawChunks()))
+		if err != nil || manifest.Flags&FlagChunked == 0 {
+			return c.delete(ctx, key, opts)
+		}
+		m, perr := parseChunkManifest(manifest.Value)
+		if err := c.delete(ctx, key, opts); err != nil || perr != nil {
+			return err
+		}
+		for i := 0; i < m.n; i++ {
+			c.delete(ctx, m.chunkKey(key, i), opts)
+		}
+		return nil
+	})
+}
+
+// withRawChunks makes Get return the manifests of chunked values rather
+// than the values.
+func withRawChunks() CallOption {
+	return func(o *callOptions) { o.rawChunks = true }
+}
+
+// SetReader stores the size bytes read from r under key, like Set, without
+// holding them all in memory: values longer than the ChunkSize of the
+// client, or DefaultChunkSize if it is zero, are read and stored a chunk at
+// a time. It fails if r holds fewer than size bytes.
+func (c *Client) SetReader(key string, r io.Reader, size int64, expiration int32, opts ...CallOption) error {
+	return c.SetReaderContext(context.Background(), key, r, size, expiration, opts...)
+}
+
+// SetReaderContext is like SetReader, but gives up when ctx is done.
+func (c *Client) SetReaderContext(ctx context.Context, key string, r io.Reader, size int64, expiration int32, opts ...CallOption) error {
+	if size < 0 {
+		return errors.New("memcache: negative size")
+	}
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	item := c.jitterItem(&Item{Key: key, Expiration: expiration}, opts)
+	if size > int64(chunkSize) {
+		return c.setChunked(ctx, item, r, size, chunkSize, opts)
+	}
+	item.Value = make([]byte, size)
+	if _, err := io.ReadFull(r, item.Value); err != nil {
+		return err
+	}
+	return c.set(ctx, item, opts)
+}
+
+// GetWriter writes the value of key to w, like Get, without holding it all
+// in memory: chunked values are read and written a chunk at a time. As
+// chunks are checked against their manifest only at the end, w may have
+// been written to when it fails, for instance with ErrCacheMiss if a chunk
+// was evicted.
+func (c *Client) GetWriter(key string, w io.Writer, opts ...CallOption) error {
+	return c.GetWriterContext(context.Background(), key, w, opts...)
+}
+
+// GetWriterContext is like GetWriter, but gives up when ctx is done.
+func (c *Client) GetWriterContext(ctx context.Context, key string, w io.Writer, opts ...CallOption) error {
+	return c.intercept(ctx, &Operation{Name: "get", Key: key}, func(ctx context.Context, op *Operation) error {
+		key := op.Key
+		item, err := c.GetContext(ctx, key, append(opts, withRawChunks())...)
+		if err != nil {
+			return err
+		}
+		if item.Flags&FlagChunked == 0 {
+			_, err := w.Write(item.Value)
+			return err
+		}
+		m, err := parseChunkManifest(item.Value)
+		if err != nil {
+			return err
+		}
+
+		h := crc32.NewIEEE()
+		size := 0
+		for i := 0; i < m.n; i++ {
+			chunk, err := c.GetContext(ctx, m.chunkKey(key, i), opts...)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(chunk.Value); err != nil {
+				return err
+			}
+			h.Write(chunk.Value)
+			size += len(chunk.Value)
+		}
+		if size != m.size || h.Sum32() != m.crc {
+			return chunkMismatch(key)
+		}
+		return nil
+	})
+}
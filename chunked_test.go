@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChunking(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.ChunkSize = 100
+
+	big := bytes.Repeat([]byte("0123456789"), 25)
+	if err := client.Set(&Item{Key: "big", Value: big, Flags: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	manifest := s.item("big")
+	if manifest.flags != 1|FlagChunked {
+		t.Fatalf("expected a manifest with flags %#x, got %#x", 1|FlagChunked, manifest.flags)
+	}
+	m, err := parseChunkManifest(manifest.value)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if m.n != 3 || m.size != len(big) {
+		t.Fatalf("expected 3 chunks of %d bytes in all, got %d of %d", len(big), m.n, m.size)
+	}
+	for i := 0; i < m.n; i++ {
+		if s.item(m.chunkKey("big", i)) == nil {
+			t.Fatalf("expected chunk %d to be stored", i)
+		}
+	}
+
+	// Chunked values are read back whole, even by clients not chunking.
+	client.ChunkSize = 0
+	it, err := client.Get("big")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Equal(it.Value, big) || it.Flags != 1 {
+		t.Fatalf("expected the original value and flags, got %d bytes with flags %#x", len(it.Value), it.Flags)
+	}
+	if err := client.Set(&Item{Key: "small", Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	items, err := client.GetMulti([]string{"big", "small"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(items) != 2 || !bytes.Equal(items["big"].Value, big) {
+		t.Fatalf("expected both values, got %v", items)
+	}
+
+	// Delete removes the chunks along with the manifest.
+	client.ChunkSize = 100
+	if err := client.Delete("big"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	s.mu.Lock()
+	left := len(s.items)
+	s.mu.Unlock()
+	if left != 1 {
+		t.Fatalf("expected only the small value to be left, got %d items", left)
+	}
+}
+
+func TestChunkingMissingChunk(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.ChunkSize = 10
+
+	if err := client.Set(&Item{Key: "big", Value: []byte(strings.Repeat("x", 35))}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	m, _ := parseChunkManifest(s.item("big").value)
+	s.mu.Lock()
+	delete(s.items, m.chunkKey("big", 2))
+	s.mu.Unlock()
+
+	if _, err := client.Get("big"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected a miss when a chunk was evicted, got %v", err)
+	}
+	items, err := client.GetMulti([]string{"big"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected no items, got %v", items)
+	}
+}
+
+func TestSetReaderGetWriter(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.ChunkSize = 64
+
+	big := bytes.Repeat([]byte("abcdefghij"), 50)
+	if err := client.SetReader("big", bytes.NewReader(big), int64(len(big)), 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("big"); it.flags != FlagChunked {
+		t.Fatalf("expected a manifest, got flags %#x", it.flags)
+	}
+	var buf bytes.Buffer
+	if err := client.GetWriter("big", &buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), big) {
+		t.Fatalf("expected the original value, got %d bytes", buf.Len())
+	}
+
+	// Short values are stored as a single item.
+	if err := client.SetReader("small", strings.NewReader("value"), 5, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("small"); it.flags != 0 || string(it.value) != "value" {
+		t.Fatalf("expected a plain item, got %q with flags %#x", it.value, it.flags)
+	}
+	buf.Reset()
+	if err := client.GetWriter("small", &buf); err != nil || buf.String() != "value" {
+		t.Fatalf("expected value, got %q and %v", buf.String(), err)
+	}
+
+	// A reader shorter than announced stores nothing under the key.
+	if err := client.SetReader("short", bytes.NewReader(big[:100]), 200, 0); err == nil {
+		t.Fatalf("expected an error for a short reader")
+	}
+	if s.item("short") != nil {
+		t.Fatalf("expected no manifest for a short reader")
+	}
+	if err := client.GetWriter("missing", &buf); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import "sync/atomic"
+
+// ClientStats holds the cumulative counters of the operations of a client,
+// kept whether or not Metrics is set.
+type ClientStats struct {
+	Ops      uint64 // operations run
+	Gets     uint64 // reads: Get, GetMulti and the reads of Update
+	Hits     uint64 // reads that found their keys
+	Misses   uint64 // reads that did not
+	Sets     uint64 // writes: Set, SetMulti and the stores of Update, locks and the like
+	Deletes  uint64 // deletions
+	Errors   uint64 // operations that failed, before BestEffort hid the error
+	Timeouts uint64 // operations that failed because a deadline expired
+	BytesIn  uint64 // bytes received from servers
+	BytesOut uint64 // bytes sent to servers
+
+	// Servers holds the latency percentiles of the recent round trips to
+	// each server, keyed by address, to tell a slow server from the others.
+	Servers map[string]ServerLatency
+}
+
+// opCounters holds the counters behind ClientStats.
+type opCounters struct {
+	ops, gets, hits, misses, sets, deletes atomic.Uint64
+	errors, timeouts, bytesIn, bytesOut    atomic.Uint64
+}
+
+// ClientStats returns the counters of the operations of c so far. A read of
+// several keys, such as GetMulti, is a hit if it found any of them.
+func (c *Client) ClientStats() ClientStats {
+	return ClientStats{
+		Ops:      c.counters.ops.Load(),
+		Gets:     c.counters.gets.Load(),
+		Hits:     c.counters.hits.Load(),
+		Misses:   c.counters.misses.Load(),
+		Sets:     c.counters.sets.Load(),
+		Deletes:  c.counters.deletes.Load(),
+		Errors:   c.counters.errors.Load(),
+		Timeouts: c.counters.timeouts.Load(),
+		BytesIn:  c.counters.bytesIn.Load(),
+		BytesOut: c.counters.bytesOut.Load(),
+		Servers:  c.latencies.percentiles(),
+	}
+}
+
+// count counts the operation of cl, which ended with err.
+func (c *Client) count(cl *call, err error) {
+	c.counters.ops.Add(1)
+	read := false
+	switch cl.op {
+	case "get", "gets", "get_multi":
+		read = true
+		c.counters.gets.Add(1)
+	case "set", "add", "replace", "append", "prepend", "cas", "set_multi":
+		c.counters.sets.Add(1)
+	case "delete", "delete_cas", "delete_multi", "invalidate":
+		c.counters.deletes.Add(1)
+	}
+
+	switch o := outcomeOf(err); {
+	case o == OutcomeError:
+		c.counters.errors.Add(1)
+		if isTimeout(err) {
+			c.counters.timeouts.Add(1)
+		}
+	case !read:
+	case o == OutcomeHit:
+		c.counters.hits.Add(1)
+	default:
+		c.counters.misses.Add(1)
+	}
+}
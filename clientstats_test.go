@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClientStats(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.Set(&Item{Key: "k", Value: []byte("v")})
+	client.Get("k")
+	client.GetMulti([]string{"k", "missing"})
+	client.Get("missing")
+	client.Get("k", WithServer(down))
+	client.Delete("k")
+	client.Child("jobs").Get("k")
+
+	want := ClientStats{Ops: 6, Gets: 4, Hits: 2, Misses: 1, Sets: 1, Deletes: 1, Errors: 1}
+	want.BytesOut = uint64(len("set k 0 0 1\r\nv\r\nget k\r\nget k missing\r\nget missing\r\ndelete k\r\n"))
+	want.BytesIn = uint64(len("STORED\r\nVALUE k 0 1\r\nv\r\nEND\r\nVALUE k 0 1\r\nv\r\nEND\r\nEND\r\nDELETED\r\n"))
+	got := client.ClientStats()
+	lat := got.Servers[srv.addr]
+	if len(got.Servers) != 1 || lat.Samples != 5 || lat.P50 <= 0 || lat.P50 > lat.P95 || lat.P95 > lat.P99 {
+		t.Fatalf("expected the latencies of 5 round trips to %s, got %+v", srv.addr, got.Servers)
+	}
+	got.Servers = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestServerLatencyPercentiles(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 11211}
+	var l serverLatencies
+	for i := 1; i <= latencyWindow+100; i++ {
+		d := time.Duration(i) * time.Millisecond
+		if i <= 100 {
+			d = time.Hour // rolled out of the window
+		}
+		l.observe(addr, d)
+	}
+
+	got := l.percentiles()[addr.String()]
+	want := ServerLatency{P50: 612 * time.Millisecond, P95: 1073 * time.Millisecond, P99: 1114 * time.Millisecond, Samples: latencyWindow}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
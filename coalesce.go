@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// coalescer collapses Sets of the same key issued within CoalesceWindow.
+type coalescer struct {
+	mu      sync.Mutex
+	pending map[string]*pendingWrite
+}
+
+// pendingWrite is a coalesced Set waiting for its window to end.
+type pendingWrite struct {
+	item *Item
+	opts []CallOption
+
+	done chan struct{} // closed once err is set
+	err  error
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{pending: make(map[string]*pendingWrite)}
+}
+
+// coalesceSet queues item to be written when the window opened by the first
+// pending Set of its key ends, replacing any value queued since. It waits
+// for that write, or for ctx, and returns its error.
+func (c *Client) coalesceSet(ctx context.Context, item *Item, opts []CallOption) error {
+	co := c.coalescer
+	co.mu.Lock()
+	pw, ok := co.pending[item.Key]
+	if !ok {
+		pw = &pendingWrite{done: make(chan struct{})}
+		co.pending[item.Key] = pw
+		time.AfterFunc(c.CoalesceWindow, func() { c.flushWrite(item.Key, pw) })
+	}
+	pw.item, pw.opts = item, opts
+	co.mu.Unlock()
+
+	select {
+	case <-pw.done:
+		return pw.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flushWrite writes the latest value of pw, unless it was dropped.
+func (c *Client) flushWrite(key string, pw *pendingWrite) {
+	co := c.coalescer
+	co.mu.Lock()
+	if co.pending[key] != pw {
+		co.mu.Unlock()
+		return
+	}
+	delete(co.pending, key)
+	item, opts := pw.item, pw.opts
+	co.mu.Unlock()
+
+	// The Sets coalesced into this write already ran the middleware.
+	pw.err = c.set(partOfOp(context.Background()), item, opts)
+	close(pw.done)
+}
+
+// dropWrite discards the pending write of key, so that a Delete is not
+// undone by a Set issued before it. Callers waiting on it succeed, as their
+// value was superseded.
+func (c *Client) dropWrite(key string) {
+	co := c.coalescer
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	if pw, ok := co.pending[key]; ok {
+		delete(co.pending, key)
+		close(pw.done)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setCount returns the number of set commands srv received.
+func setCount(srv *testServer) int {
+	n := 0
+	for _, cmd := range srv.commands() {
+		if strings.HasPrefix(cmd, "set ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCoalesceWindow(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.CoalesceWindow = 200 * time.Millisecond
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for _, v := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(v string) {
+			defer wg.Done()
+			errs <- client.Set(&Item{Key: "foo", Value: []byte(v)})
+		}(v)
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if n := setCount(srv); n != 1 {
+		t.Fatalf("expected 1 write, got %d", n)
+	}
+	if it := srv.item("foo"); it == nil || string(it.value) != "c" {
+		t.Fatalf("expected the latest value to be written, got %+v", it)
+	}
+}
+
+func TestCoalesceDeleteDropsPendingWrite(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.CoalesceWindow = 200 * time.Millisecond
+
+	done := make(chan error)
+	go func() { done <- client.Set(&Item{Key: "foo", Value: []byte("bar")}) }()
+	time.Sleep(10 * time.Millisecond)
+	client.Delete("foo")
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if n := setCount(srv); n != 0 || srv.item("foo") != nil {
+		t.Fatalf("expected the pending write to be dropped, got %d writes", n)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"sync"
+)
+
+// Codec converts Go values to and from the values and flags of items, for
+// SetValue and GetValue.
+type Codec interface {
+	// Marshal encodes v into the value and flags of an item.
+	Marshal(v any) ([]byte, uint32, error)
+
+	// Unmarshal decodes the value and flags of an item into v, which must
+	// be a pointer.
+	Unmarshal(data []byte, flags uint32, v any) error
+}
+
+// Flags set by the built-in codecs. They use bits 16 to 19 of Item.Flags,
+// leaving the lower bits, which other clients use for their own formats,
+// alone.
+const (
+	FlagJSON    uint32 = 1 << 16
+	FlagGob     uint32 = 2 << 16
+	FlagMsgpack uint32 = 3 << 16 // set by the codec/msgpack package
+	FlagProto   uint32 = 4 << 16 // set by the codec/protobuf package
+
+	// CodecMask covers the flag bits of the built-in codecs.
+	CodecMask uint32 = 0xf << 16
+)
+
+// jsonCodec encodes values with encoding/json.
+type jsonCodec struct{}
+
+// JSONCodec returns a Codec encoding values as JSON, readable by clients in
+// any language.
+func JSONCodec() Codec {
+	return jsonCodec{}
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, uint32, error) {
+	b, err := json.Marshal(v)
+	return b, FlagJSON, err
+}
+
+func (jsonCodec) Unmarshal(data []byte, flags uint32, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// gobCodec encodes values with encoding/gob.
+type gobCodec struct{}
+
+// GobCodec returns a Codec encoding values with encoding/gob, which is
+// faster and more compact than JSON for Go-only caches. Every value is
+// encoded on its own, with the description of its type.
+func GobCodec() Codec {
+	return gobCodec{}
+}
+
+func (gobCodec) Marshal(v any) ([]byte, uint32, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), FlagGob, nil
+}
+
+func (gobCodec) Unmarshal(data []byte, flags uint32, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// CodecRegistry is a Codec decoding every item with the codec registered
+// for its flags, for caches shared by producers writing different formats.
+// It encodes with Default. Compression and encryption are undone before
+// codecs see the values, so they need no registration. It is safe for
+// concurrent use.
+type CodecRegistry struct {
+	// Default encodes values, and decodes items matching no registered
+	// codec. If nil, JSONCodec is used.
+	Default Codec
+
+	mu      sync.RWMutex
+	entries []codecEntry
+}
+
+// codecEntry is a codec decoding the items whose flags, masked, are flags.
+type codecEntry struct {
+	mask, flags uint32
+	codec       Codec
+}
+
+// NewCodecRegistry returns a CodecRegistry encoding with def, with the JSON
+// and gob codecs registered for FlagJSON and FlagGob.
+func NewCodecRegistry(def Codec) *CodecRegistry {
+	r := &CodecRegistry{Default: def}
+	r.Register(CodecMask, FlagJSON, JSONCodec())
+	r.Register(CodecMask, FlagGob, GobCodec())
+	return r
+}
+
+// Register decodes the items whose flags, masked with mask, equal flags
+// with codec. Codecs registered later take precedence, so that a pattern
+// can be overridden.
+func (r *CodecRegistry) Register(mask, flags uint32, codec Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, codecEntry{mask: mask, flags: flags & mask, codec: codec})
+}
+
+// Lookup returns the codec decoding items of the given flags.
+func (r *CodecRegistry) Lookup(flags uint32) Codec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if e := r.entries[i]; flags&e.mask == e.flags {
+			return e.codec
+		}
+	}
+	return r.defaultCodec()
+}
+
+// defaultCodec returns the Default codec in effect.
+func (r *CodecRegistry) defaultCodec() Codec {
+	if r.Default != nil {
+		return r.Default
+	}
+	return JSONCodec()
+}
+
+// Marshal encodes v with the Default codec.
+func (r *CodecRegistry) Marshal(v any) ([]byte, uint32, error) {
+	return r.defaultCodec().Marshal(v)
+}
+
+// Unmarshal decodes data with the codec registered for flags.
+func (r *CodecRegistry) Unmarshal(data []byte, flags uint32, v any) error {
+	return r.Lookup(flags).Unmarshal(data, flags, v)
+}
+
+// codec returns the Codec in effect.
+func (c *Client) codec() Codec {
+	if c.Codec != nil {
+		return c.Codec
+	}
+	return JSONCodec()
+}
+
+// SetValue encodes v with the client Codec and stores it under key,
+// expiring as Item.Expiration.
+func (c *Client) SetValue(key string, v any, expiration int32, opts ...CallOption) error {
+	return c.SetValueContext(context.Background(), key, v, expiration, opts...)
+}
+
+// SetValueContext is like SetValue, but gives up when ctx is done.
+func (c *Client) SetValueContext(ctx context.Context, key string, v any, expiration int32, opts ...CallOption) error {
+	value, flags, err := c.codec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.SetContext(ctx, &Item{Key: key, Value: value, Flags: flags, Expiration: expiration}, opts...)
+}
+
+// GetValue gets the item of key and decodes its value into v, which must
+// be a pointer, with the client Codec. It returns ErrCacheMiss if the key
+// is not cached.
+func (c *Client) GetValue(key string, v any, opts ...CallOption) error {
+	return c.GetValueContext(context.Background(), key, v, opts...)
+}
+
+// GetValueContext is like GetValue, but gives up when ctx is done.
+func (c *Client) GetValueContext(ctx context.Context, key string, v any, opts ...CallOption) error {
+	item, err := c.GetContext(ctx, key, opts...)
+	if err != nil {
+		return err
+	}
+	return c.codec().Unmarshal(item.Value, item.Flags, v)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package msgpack provides a gomcache.Codec encoding values as MessagePack,
+// a compact binary format with libraries for most languages. It is a
+// package of its own so that only its users depend on the MessagePack
+// library.
+package msgpack
+
+import (
+	"github.com/nihankhan/gomcache"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// codec encodes values with github.com/vmihailenco/msgpack.
+type codec struct{}
+
+// Codec returns a Codec encoding values as MessagePack, setting
+// gomcache.FlagMsgpack. Struct fields are named by their msgpack tags, as
+// in the msgpack library.
+func Codec() gomcache.Codec {
+	return codec{}
+}
+
+func (codec) Marshal(v any) ([]byte, uint32, error) {
+	b, err := msgpack.Marshal(v)
+	return b, gomcache.FlagMsgpack, err
+}
+
+func (codec) Unmarshal(data []byte, flags uint32, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msgpack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	type user struct {
+		ID    int      `msgpack:"id"`
+		Name  string   `msgpack:"name"`
+		Roles []string `msgpack:"roles"`
+	}
+	want := user{ID: 7, Name: "ada", Roles: []string{"admin"}}
+
+	c := Codec()
+	b, flags, err := c.Marshal(want)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if flags != 3<<16 {
+		t.Fatalf("expected the msgpack flag, got %#x", flags)
+	}
+	var got user
+	if err := c.Unmarshal(b, flags, &got); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	// Other languages read the fields by name.
+	var m map[string]any
+	if err := c.Unmarshal(b, flags, &m); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if m["name"] != "ada" {
+		t.Fatalf("expected the name field, got %v", m)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package protobuf provides a gomcache.Codec encoding protocol buffer
+// messages. It is a package of its own so that only its users depend on
+// the protobuf library.
+package protobuf
+
+import (
+	"errors"
+	"hash/crc32"
+
+	"github.com/nihankhan/gomcache"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ErrNotMessage is returned when a value given to the codec is not a
+// protocol buffer message.
+var ErrNotMessage = errors.New("protobuf: value is not a proto.Message")
+
+// typeMask selects the bits of Item.Flags identifying the message type.
+const typeMask = 0xffff
+
+// codec encodes values with google.golang.org/protobuf/proto.
+type codec struct{}
+
+// Codec returns a Codec encoding proto.Message values in the protobuf wire
+// format. The flags of items are gomcache.FlagProto with the lower 16 bits
+// set from the full name of the message type, so that decoding an item
+// into a message of another type, which the wire format cannot detect,
+// fails instead of producing garbage.
+func Codec() gomcache.Codec {
+	return codec{}
+}
+
+func (codec) Marshal(v any) ([]byte, uint32, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, 0, ErrNotMessage
+	}
+	b, err := proto.Marshal(m)
+	return b, gomcache.FlagProto | typeFlags(m.ProtoReflect().Descriptor().FullName()), err
+}
+
+func (codec) Unmarshal(data []byte, flags uint32, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotMessage
+	}
+	if flags&^typeMask != gomcache.FlagProto {
+		return errors.New("protobuf: item does not hold a protobuf message")
+	}
+	name := m.ProtoReflect().Descriptor().FullName()
+	if flags&typeMask != typeFlags(name) {
+		return errors.New("protobuf: item does not hold a " + string(name))
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// typeFlags returns the flags identifying the message type name.
+func typeFlags(name protoreflect.FullName) uint32 {
+	return crc32.ChecksumIEEE([]byte(name)) & typeMask
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protobuf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nihankhan/gomcache"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec(t *testing.T) {
+	c := Codec()
+	b, flags, err := c.Marshal(wrapperspb.String("ada"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if flags&^typeMask != gomcache.FlagProto {
+		t.Fatalf("expected the protobuf flag, got %#x", flags)
+	}
+
+	var got wrapperspb.StringValue
+	if err := c.Unmarshal(b, flags, &got); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.GetValue() != "ada" {
+		t.Fatalf("expected ada, got %q", got.GetValue())
+	}
+
+	// Messages of another type are refused rather than misread.
+	if err := c.Unmarshal(b, flags, &wrapperspb.Int64Value{}); err == nil {
+		t.Fatalf("expected an error decoding into another message type")
+	}
+	if err := c.Unmarshal(b, gomcache.FlagJSON, &got); err == nil {
+		t.Fatalf("expected an error decoding an item of another codec")
+	}
+	if _, _, err := c.Marshal("ada"); !errors.Is(err, ErrNotMessage) {
+		t.Fatalf("expected ErrNotMessage, got %v", err)
+	}
+}
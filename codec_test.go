@@ -0,0 +1,111 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testUser is a value cached by the codec tests.
+type testUser struct {
+	ID    int
+	Name  string
+	Roles []string
+}
+
+func TestCodecs(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	want := testUser{ID: 7, Name: "ada", Roles: []string{"admin"}}
+
+	for _, tt := range []struct {
+		name  string
+		codec Codec
+		flags uint32
+	}{
+		{"default", nil, FlagJSON},
+		{"json", JSONCodec(), FlagJSON},
+		{"gob", GobCodec(), FlagGob},
+	} {
+		client.Codec = tt.codec
+		if err := client.SetValue("user", want, 60); err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		if it := s.item("user"); it.flags != tt.flags || it.exp != 60 {
+			t.Fatalf("%s: expected flags %#x and expiration 60, got %#x and %d", tt.name, tt.flags, it.flags, it.exp)
+		}
+		var got testUser
+		if err := client.GetValue("user", &got); err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: expected %+v, got %+v", tt.name, want, got)
+		}
+	}
+
+	var got testUser
+	if err := client.GetValue("nobody", &got); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+	if err := client.SetValue("bad", make(chan int), 0); err == nil {
+		t.Fatalf("expected an error for a value the codec cannot encode")
+	}
+}
+
+func TestCodecRegistry(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	want := testUser{ID: 7, Name: "ada", Roles: []string{"admin"}}
+
+	// Producers writing different formats.
+	for key, codec := range map[string]Codec{"json": JSONCodec(), "gob": GobCodec()} {
+		client.Codec = codec
+		if err := client.SetValue(key, want, 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	// A legacy producer writing JSON with flags of its own.
+	if err := client.Set(&Item{Key: "legacy", Value: []byte(`{"ID":7,"Name":"ada","Roles":["admin"]}`), Flags: 2}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	reg := NewCodecRegistry(GobCodec())
+	reg.Register(0xffff, 2, JSONCodec())
+	client.Codec = reg
+	for _, key := range []string{"json", "gob", "legacy"} {
+		var got testUser
+		if err := client.GetValue(key, &got); err != nil {
+			t.Fatalf("%s: expected no error, got %v", key, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: expected %+v, got %+v", key, want, got)
+		}
+	}
+
+	if err := client.SetValue("new", want, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("new"); it.flags != FlagGob {
+		t.Fatalf("expected the default codec to encode, got flags %#x", it.flags)
+	}
+	if c := reg.Lookup(FlagMsgpack); c != reg.Default {
+		t.Fatalf("expected unregistered flags to decode with the default codec, got %T", c)
+	}
+}
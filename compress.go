@@ -0,0 +1,155 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// DefaultCompressThreshold is the default size from which values are
+// compressed when Client.Compressor is set.
+const DefaultCompressThreshold = 1024
+
+// Flags marking compressed values. They use bits 20 to 22 of Item.Flags,
+// apart from those of other clients and of the codecs.
+const (
+	FlagGzip   uint32 = 1 << 20
+	FlagSnappy uint32 = 2 << 20 // set by the compress/snappy package
+	FlagZstd   uint32 = 3 << 20 // reserved for zstd compressors
+
+	compressionMask uint32 = 0x7 << 20
+)
+
+// Compressor compresses the values of items for Client.Compressor.
+type Compressor interface {
+	// Flag returns the flag marking the values it compressed, such as
+	// FlagGzip.
+	Flag() uint32
+
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// funcCompressor is a Compressor made of functions.
+type funcCompressor struct {
+	flag       uint32
+	compress   func([]byte) ([]byte, error)
+	decompress func([]byte) ([]byte, error)
+}
+
+// NewCompressor returns a Compressor marking values with flag, which must
+// be within bits 20 to 22 of Item.Flags, and compressing them with the
+// given functions, for algorithms this package does not provide.
+func NewCompressor(flag uint32, compress, decompress func([]byte) ([]byte, error)) Compressor {
+	return &funcCompressor{flag: flag, compress: compress, decompress: decompress}
+}
+
+func (f *funcCompressor) Flag() uint32                          { return f.flag }
+func (f *funcCompressor) Compress(src []byte) ([]byte, error)   { return f.compress(src) }
+func (f *funcCompressor) Decompress(src []byte) ([]byte, error) { return f.decompress(src) }
+
+// gzipCompressor compresses values with compress/gzip.
+type gzipCompressor struct {
+	writers sync.Pool
+}
+
+var defaultGzip = GzipCompressor()
+
+// GzipCompressor returns a Compressor using gzip at the default
+// compression level, which every memcached client library can read.
+func GzipCompressor() Compressor {
+	return &gzipCompressor{}
+}
+
+func (g *gzipCompressor) Flag() uint32 { return FlagGzip }
+
+func (g *gzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, _ := g.writers.Get().(*gzip.Writer)
+	if zw == nil {
+		zw = gzip.NewWriter(&buf)
+	} else {
+		zw.Reset(&buf)
+	}
+	defer g.writers.Put(zw)
+	if _, err := zw.Write(src); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *gzipCompressor) Decompress(src []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+// compressItem returns it with its value compressed if the client
+// compresses values and the value is at least CompressThreshold bytes long
+// and shrinks.
+func (c *Client) compressItem(it Item) (Item, error) {
+	threshold := c.CompressThreshold
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	if c.Compressor == nil || len(it.Value) < threshold {
+		return it, nil
+	}
+	z, err := c.Compressor.Compress(it.Value)
+	if err != nil {
+		return it, err
+	}
+	if len(z) < len(it.Value) {
+		it.Value = z
+		it.Flags = it.Flags&^compressionMask | c.Compressor.Flag()
+	}
+	return it, nil
+}
+
+// decompressItem decompresses the value of it in place if its flags mark it
+// compressed, with Client.Compressor or, for gzip, the built-in one.
+func (c *Client) decompressItem(it *Item) error {
+	flag := it.Flags & compressionMask
+	if flag == 0 {
+		return nil
+	}
+	z := c.Compressor
+	if z == nil || z.Flag() != flag {
+		if flag != FlagGzip {
+			return errors.New("memcache: value of " + strconv.Quote(it.Key) + " has an unknown compression " + strconv.FormatUint(uint64(flag), 16))
+		}
+		z = defaultGzip
+	}
+	v, err := z.Decompress(it.Value)
+	if err != nil {
+		return err
+	}
+	it.Value = v
+	it.Flags &^= compressionMask
+	return nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package snappy provides a gomcache.Compressor using Snappy, which
+// compresses less than gzip but many times faster. It is a package of its
+// own so that only its users depend on the Snappy library.
+package snappy
+
+import (
+	"github.com/golang/snappy"
+	"github.com/nihankhan/gomcache"
+)
+
+// compressor compresses values with the Snappy block format.
+type compressor struct{}
+
+// Compressor returns a Compressor using the Snappy block format and
+// gomcache.FlagSnappy.
+func Compressor() gomcache.Compressor {
+	return compressor{}
+}
+
+func (compressor) Flag() uint32 { return gomcache.FlagSnappy }
+
+func (compressor) Compress(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func (compressor) Decompress(src []byte) ([]byte, error) {
+	return snappy.Decode(nil, src)
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snappy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	src := bytes.Repeat([]byte("memcached "), 1000)
+	z := Compressor()
+	b, err := z.Compress(src)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(b) >= len(src) {
+		t.Fatalf("expected the value to shrink, got %d bytes from %d", len(b), len(src))
+	}
+	got, err := z.Decompress(b)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Equal(got, src) {
+		t.Fatalf("expected the original value back")
+	}
+	if _, err := z.Decompress([]byte("not snappy")); err == nil {
+		t.Fatalf("expected an error for corrupt data")
+	}
+}
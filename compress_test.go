@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.Compressor = GzipCompressor()
+
+	big := bytes.Repeat([]byte("memcached "), 200)
+	if err := client.Set(&Item{Key: "big", Value: big, Flags: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("big"); it.flags != 1|FlagGzip || len(it.value) >= len(big) {
+		t.Fatalf("expected a compressed value with flags %#x, got %d bytes with flags %#x", 1|FlagGzip, len(it.value), it.flags)
+	}
+	if err := client.Set(&Item{Key: "small", Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("small"); it.flags != 0 {
+		t.Fatalf("expected a value under the threshold to be stored as is, got flags %#x", it.flags)
+	}
+
+	// Compressed values are read back transparently, even by clients not
+	// compressing themselves.
+	client.Compressor = nil
+	it, err := client.Get("big")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Equal(it.Value, big) || it.Flags != 1 {
+		t.Fatalf("expected the original value and flags, got %d bytes with flags %#x", len(it.Value), it.Flags)
+	}
+	items, err := client.GetMulti([]string{"big", "small"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(items) != 2 || !bytes.Equal(items["big"].Value, big) {
+		t.Fatalf("expected both values, got %v", items)
+	}
+
+	// Values of an unknown compression are an error rather than garbage.
+	if err := client.Set(&Item{Key: "odd", Value: []byte("v"), Flags: FlagZstd}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get("odd"); err == nil {
+		t.Fatalf("expected an error for an unknown compression")
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Target is a kind of server or proxy whose limitations Client.Conformance
+// enforces.
+type Target int
+
+const (
+	// TargetAny places no restriction on commands.
+	TargetAny Target = iota
+
+	// TargetMemcached15 is memcached before 1.6, which lacks the meta
+	// protocol.
+	TargetMemcached15
+
+	// TargetMcrouter is mcrouter, which only speaks the text protocol over
+	// TCP and answers stats about itself rather than the servers.
+	TargetMcrouter
+
+	// TargetTwemproxy is twemproxy (nutcracker), which only proxies the
+	// text protocol storage and retrieval commands over TCP.
+	TargetTwemproxy
+)
+
+// targetNames are the names accepted by ParseTarget.
+var targetNames = map[Target]string{
+	TargetAny:         "any",
+	TargetMemcached15: "memcached<1.6",
+	TargetMcrouter:    "mcrouter",
+	TargetTwemproxy:   "twemproxy",
+}
+
+func (t Target) String() string {
+	if name, ok := targetNames[t]; ok {
+		return name
+	}
+	return "Target(" + strconv.Itoa(int(t)) + ")"
+}
+
+// ParseTarget returns the Target named s, such as "mcrouter", "twemproxy"
+// or "memcached<1.6".
+func ParseTarget(s string) (Target, error) {
+	for t, name := range targetNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	return TargetAny, fmt.Errorf("memcache: unknown target %q", s)
+}
+
+// Features checked against a Target.
+const (
+	featureMeta     = "the meta protocol"
+	featureBinary   = "the binary protocol"
+	featureUDP      = "UDP"
+	featureFlush    = "flush_all"
+	featureStats    = "stats"
+	featureMetadump = "lru_crawler metadump"
+	featureWatch    = "watch"
+)
+
+// unsupported lists the features each target lacks.
+var unsupported = map[Target][]string{
+	TargetMemcached15: {featureMeta},
+	TargetMcrouter:    {featureMeta, featureBinary, featureUDP, featureStats, featureMetadump, featureWatch},
+	TargetTwemproxy:   {featureMeta, featureBinary, featureUDP, featureFlush, featureStats, featureMetadump, featureWatch},
+}
+
+// ConformanceError is returned, before anything is sent, by operations that
+// need a feature the Client.Conformance target does not support. It matches
+// errors.ErrUnsupported.
+type ConformanceError struct {
+	Target  Target
+	Feature string
+}
+
+func (e *ConformanceError) Error() string {
+	return "memcache: " + e.Feature + " is not supported by " + e.Target.String()
+}
+
+func (e *ConformanceError) Unwrap() error { return errors.ErrUnsupported }
+
+// conformFeature returns a *ConformanceError if the Conformance target
+// lacks feature.
+func (c *Client) conformFeature(feature string) error {
+	for _, f := range unsupported[c.Conformance] {
+		if f == feature {
+			return &ConformanceError{Target: c.Conformance, Feature: feature}
+		}
+	}
+	return nil
+}
+
+// conform checks the protocol and transport of a request against the
+// Conformance target.
+func (c *Client) conform(sp ServerProtocol, udp bool) error {
+	switch sp.Protocol {
+	case ProtocolMeta:
+		if err := c.conformFeature(featureMeta); err != nil {
+			return err
+		}
+	case ProtocolBinary:
+		if err := c.conformFeature(featureBinary); err != nil {
+			return err
+		}
+	}
+	if udp {
+		return c.conformFeature(featureUDP)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.Conformance = TargetTwemproxy
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, err := client.Get("foo", WithProtocol(ProtocolMeta))
+	var ce *ConformanceError
+	if !errors.As(err, &ce) || ce.Feature != featureMeta || !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected a ConformanceError for the meta protocol, got %v", err)
+	}
+	if err := client.FlushServer(srv.addr); !errors.As(err, &ce) || ce.Feature != featureFlush {
+		t.Fatalf("expected a ConformanceError for flush_all, got %v", err)
+	}
+	if _, err := client.Stats(); !errors.As(err, &ce) || ce.Feature != featureStats {
+		t.Fatalf("expected a ConformanceError for stats, got %v", err)
+	}
+	client.UseUDP = true
+	if _, err := client.Get("foo"); !errors.As(err, &ce) || ce.Feature != featureUDP {
+		t.Fatalf("expected a ConformanceError for UDP, got %v", err)
+	}
+
+	if n := len(srv.commands()); n != 1 {
+		t.Fatalf("expected only the set to reach the server, got %q", srv.commands())
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	for _, want := range []Target{TargetAny, TargetMemcached15, TargetMcrouter, TargetTwemproxy} {
+		got, err := ParseTarget(want.String())
+		if err != nil || got != want {
+			t.Fatalf("ParseTarget(%q) = %v, %v", want.String(), got, err)
+		}
+	}
+	if _, err := ParseTarget("redis"); err == nil {
+		t.Fatalf("expected an error for an unknown target")
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConsulWait is the default time a lookup of a ConsulSource waits
+// for a change.
+const DefaultConsulWait = 5 * time.Minute
+
+// ConsulSource is a ServerSource reading the instances of a Consul service
+// that pass their health checks. Instances failing a check or deregistered
+// drop out of the servers.
+//
+// After the first lookup, every lookup is a blocking query waiting up to
+// Wait for the instances to change, so that a Discovery follows them as
+// they change. A ConsulSource must not be used by several Discoveries at
+// once.
+type ConsulSource struct {
+	// Service is the name of the service.
+	Service string
+
+	// Tag, if not empty, keeps the instances with this tag only.
+	Tag string
+
+	// Datacenter is the datacenter to query. If empty, the datacenter of
+	// the agent is used.
+	Datacenter string
+
+	// Address is the URL of the Consul agent. If empty, the
+	// CONSUL_HTTP_ADDR environment variable is used, and then
+	// http://127.0.0.1:8500.
+	Address string
+
+	// Token is the ACL token to send. If empty, the CONSUL_HTTP_TOKEN
+	// environment variable is used, if set.
+	Token string
+
+	// Wait is the longest time a lookup waits for a change. If zero,
+	// DefaultConsulWait is used.
+	Wait time.Duration
+
+	// HTTPClient sends the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	index uint64 // X-Consul-Index of the last answer
+}
+
+// consulServiceEntry is the part of an entry of /v1/health/service the
+// source reads.
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// Servers returns the address and port of every passing instance.
+func (s *ConsulSource) Servers(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addr := s.Address
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	wait := s.Wait
+	if wait <= 0 {
+		wait = DefaultConsulWait
+	}
+
+	q := url.Values{"passing": {"1"}}
+	if s.Tag != "" {
+		q.Set("tag", s.Tag)
+	}
+	if s.Datacenter != "" {
+		q.Set("dc", s.Datacenter)
+	}
+	if s.index > 0 {
+		q.Set("index", strconv.FormatUint(s.index, 10))
+		q.Set("wait", strconv.Itoa(int(wait/time.Second))+"s")
+	}
+	u := strings.TrimSuffix(addr, "/") + "/v1/health/service/" + url.PathEscape(s.Service) + "?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	token := s.Token
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("memcache: consul: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if index < s.index {
+		// The index went backwards, as after a restore of the servers;
+		// start over.
+		index = 0
+	}
+	s.index = index
+
+	servers := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		servers = append(servers, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	return servers, nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestConsulSource(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/memcached" || r.Header.Get("X-Consul-Token") != "secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		queries = append(queries, r.URL.RawQuery)
+		if r.URL.Query().Get("index") == "" {
+			w.Header().Set("X-Consul-Index", "42")
+			fmt.Fprint(w, `[
+				{"Node": {"Address": "10.2.0.1"}, "Service": {"Address": "", "Port": 11211}},
+				{"Node": {"Address": "10.2.0.2"}, "Service": {"Address": "10.2.1.2", "Port": 11212}}
+			]`)
+			return
+		}
+		// The second instance fails its health check.
+		w.Header().Set("X-Consul-Index", "43")
+		fmt.Fprint(w, `[{"Node": {"Address": "10.2.0.1"}, "Service": {"Port": 11211}}]`)
+	}))
+	defer srv.Close()
+
+	src := &ConsulSource{Service: "memcached", Tag: "primary", Address: srv.URL, Token: "secret"}
+	got, err := src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.2.0.1:11211", "10.2.1.2:11212"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	got, err = src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.2.0.1:11211"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if want := []string{"passing=1&tag=primary", "index=42&passing=1&tag=primary&wait=300s"}; !slices.Equal(queries, want) {
+		t.Fatalf("expected queries %v, got %v", want, queries)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"strconv"
+)
+
+// counterAttempts bounds the incr and add round trips of one IncrBy, which
+// only repeat while other clients race to create or delete the counter.
+const counterAttempts = 5
+
+// Counter is a decimal counter stored under one key, created on first use.
+// Counters are kept on the primary server of their key only, and their
+// values bypass the codecs, compression and encryption of the client so
+// that the server can do the arithmetic.
+type Counter struct {
+	// Expiration is the expiration of the counter, set when it is
+	// created. Zero means it never expires.
+	Expiration int32
+
+	client *Client
+	key    string
+}
+
+// Counter returns the counter stored under key.
+func (c *Client) Counter(key string) *Counter {
+	return &Counter{client: c, key: key}
+}
+
+// IncrBy adds n to the counter, creating it with the value n if it does not
+// exist, and returns the new value.
+func (k *Counter) IncrBy(ctx context.Context, n uint64, opts ...CallOption) (uint64, error) {
+	return k.apply(ctx, "incr", n, n, opts)
+}
+
+// DecrBy subtracts n from the counter, stopping at zero, creating it with
+// the value zero if it does not exist, and returns the new value.
+func (k *Counter) DecrBy(ctx context.Context, n uint64, opts ...CallOption) (uint64, error) {
+	return k.apply(ctx, "decr", n, 0, opts)
+}
+
+// Value returns the value of the counter, or ErrCacheMiss if it does not
+// exist.
+func (k *Counter) Value(ctx context.Context, opts ...CallOption) (uint64, error) {
+	return k.client.incr(ctx, "incr", k.key, 0, opts)
+}
+
+// apply runs verb against the counter. If the counter is missing, it is
+// added with the value initial, and verb is run again if another client
+// added it first.
+func (k *Counter) apply(ctx context.Context, verb string, n, initial uint64, opts []CallOption) (uint64, error) {
+	var err error
+	for i := 0; i < counterAttempts; i++ {
+		var v uint64
+		if v, err = k.client.incr(ctx, verb, k.key, n, opts); err != ErrCacheMiss {
+			return v, err
+		}
+		it := &Item{Key: k.key, Value: strconv.AppendUint(nil, initial, 10), Expiration: k.Expiration}
+		if err = k.client.addRaw(ctx, it, opts); err != ErrNotStored {
+			return initial, err
+		}
+	}
+	return 0, err
+}
+
+// incr runs an incr or decr of key on its primary server.
+func (c *Client) incr(ctx context.Context, verb, key string, delta uint64, opts []CallOption) (n uint64, err error) {
+	err = c.run(ctx, &Operation{Name: verb, Key: key}, opts, func(cl *call, op *Operation) error {
+		defer c.Local.remove(op.Key)
+
+		tkey, err := c.transformKey(op.Key)
+		if err != nil {
+			return err
+		}
+		return c.primaryRoundTrip(cl, tkey, func(p Protocol) []byte {
+			return p.appendIncr(nil, verb, tkey, delta)
+		}, func(p Protocol, r *bufio.Reader) error {
+			v, err := p.parseIncr(r)
+			n = v
+			return err
+		})
+	})
+	return n, err
+}
+
+// addRaw adds item to the primary server of its key as is, without encoding
+// it.
+func (c *Client) addRaw(ctx context.Context, item *Item, opts []CallOption) error {
+	return c.run(ctx, &Operation{Name: "add", Key: item.Key, Item: item}, opts, func(cl *call, op *Operation) (err error) {
+		defer c.Local.remove(op.Key)
+
+		it := *op.item()
+		if it.Key, err = c.transformKey(op.Key); err != nil {
+			return err
+		}
+		return c.primaryRoundTrip(cl, it.Key, func(p Protocol) []byte {
+			return p.appendStore(nil, "add", &it)
+		}, Protocol.parseStore)
+	})
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta, ProtocolBinary} {
+		srv := newTestServer(t)
+		client, _ := NewClient([]string{srv.addr}, false)
+		ctx := context.Background()
+
+		hits := client.Counter("hits")
+		hits.Expiration = 60
+		if _, err := hits.Value(ctx, WithProtocol(p)); err != ErrCacheMiss {
+			t.Fatalf("%v: expected ErrCacheMiss, got %v", p, err)
+		}
+		if n, err := hits.IncrBy(ctx, 5, WithProtocol(p)); err != nil || n != 5 {
+			t.Fatalf("%v: expected 5, got %d, %v", p, n, err)
+		}
+		if exp := srv.item("hits").exp; exp != 60 {
+			t.Fatalf("%v: expected the counter to expire in 60s, got %d", p, exp)
+		}
+		if n, err := hits.IncrBy(ctx, 2, WithProtocol(p)); err != nil || n != 7 {
+			t.Fatalf("%v: expected 7, got %d, %v", p, n, err)
+		}
+		if n, err := hits.DecrBy(ctx, 10, WithProtocol(p)); err != nil || n != 0 {
+			t.Fatalf("%v: expected 0, got %d, %v", p, n, err)
+		}
+		if n, err := client.Counter("misses").DecrBy(ctx, 1, WithProtocol(p)); err != nil || n != 0 {
+			t.Fatalf("%v: expected 0, got %d, %v", p, n, err)
+		}
+	}
+}
+
+func TestCounterConcurrentInit(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Counter("hits").IncrBy(ctx, 1); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := string(srv.item("hits").value); v != "20" {
+		t.Fatalf("expected 20, got %q", v)
+	}
+}
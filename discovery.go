@@ -0,0 +1,291 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDiscoveryInterval is the default interval between two lookups of
+// a Discovery.
+const DefaultDiscoveryInterval = 30 * time.Second
+
+// errNoDiscoveredServers is returned by Discovery.Refresh when the source
+// finds no servers.
+var errNoDiscoveredServers = errors.New("memcache: discovery found no servers")
+
+// ServerSource looks up the current servers of a cluster, in any form
+// SetServers accepts.
+type ServerSource interface {
+	Servers(ctx context.Context) ([]string, error)
+}
+
+// ServerSourceFunc adapts a function to a ServerSource.
+type ServerSourceFunc func(ctx context.Context) ([]string, error)
+
+// Servers calls f(ctx).
+func (f ServerSourceFunc) Servers(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// ServerSetter is implemented by selectors whose servers can be replaced,
+// such as ServerList, HashRing and JumpHash.
+type ServerSetter interface {
+	SetServers(servers ...string) error
+}
+
+// Discovery keeps the servers of Selector in sync with Source, so that a
+// client follows a cluster registered in service discovery without a list
+// of hosts in its configuration. Clients built on the selector keep the
+// connections to the servers that stay.
+type Discovery struct {
+	Source   ServerSource
+	Selector ServerSetter
+
+	// Interval is the time between two lookups. Sources that wait for a
+	// change before answering need a small one only. If zero,
+	// DefaultDiscoveryInterval is used.
+	Interval time.Duration
+
+	// OnError, if not nil, is called with the errors of the lookups made
+	// by Run. The selector keeps its servers meanwhile.
+	OnError func(err error)
+
+	mu   sync.Mutex
+	last []string // sorted servers last set
+}
+
+// Run looks up the servers every Interval until ctx is done, then returns
+// ctx.Err().
+func (d *Discovery) Run(ctx context.Context) error {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultDiscoveryInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := d.Refresh(ctx); err != nil && ctx.Err() == nil && d.OnError != nil {
+			d.OnError(err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Refresh looks up the servers once and sets them on the selector if they
+// changed. An empty answer is reported as an error rather than applied, as
+// it more likely comes from a broken registry than from an empty cluster.
+func (d *Discovery) Refresh(ctx context.Context) error {
+	servers, err := d.Source.Servers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return errNoDiscoveredServers
+	}
+	sorted := slices.Clone(servers)
+	sort.Strings(sorted)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if slices.Equal(sorted, d.last) {
+		return nil
+	}
+	if err := d.Selector.SetServers(servers...); err != nil {
+		return err
+	}
+	d.last = sorted
+	return nil
+}
+
+// SRVResolver looks up DNS SRV records. *net.Resolver implements it.
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// SRVSource is a ServerSource reading the servers from the DNS SRV records
+// of a name, such as _memcache._tcp.cache.example.com. Only the records of
+// the lowest priority are used; their weights are ignored.
+type SRVSource struct {
+	// Service and Proto, if not empty, make the looked up name
+	// _Service._Proto.Name. Otherwise Name is looked up as is.
+	Service string
+	Proto   string
+	Name    string
+
+	// Resolver looks up the records. If nil, net.DefaultResolver is used.
+	Resolver SRVResolver
+}
+
+// Servers returns the target and port of every SRV record of the lowest
+// priority.
+func (s *SRVSource) Servers(ctx context.Context) ([]string, error) {
+	var r SRVResolver = net.DefaultResolver
+	if s.Resolver != nil {
+		r = s.Resolver
+	}
+	_, records, err := r.LookupSRV(ctx, s.Service, s.Proto, s.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var servers []string
+	prio := minPriority(records)
+	for _, rec := range records {
+		if rec.Priority != prio {
+			continue
+		}
+		host := strings.TrimSuffix(rec.Target, ".")
+		servers = append(servers, net.JoinHostPort(host, strconv.Itoa(int(rec.Port))))
+	}
+	return servers, nil
+}
+
+// minPriority returns the lowest priority of records.
+func minPriority(records []*net.SRV) uint16 {
+	p := records[0].Priority
+	for _, rec := range records[1:] {
+		p = min(p, rec.Priority)
+	}
+	return p
+}
+
+// HostResolver looks up the addresses of host names. *net.Resolver
+// implements it.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// HostSource is a ServerSource resolving the host names of Hosts at every
+// lookup. SetServers resolves names only once; a Discovery with a
+// HostSource re-resolves them every Interval instead, so that a DNS change,
+// such as the failover of a virtual IP, moves the client to the new
+// address.
+type HostSource struct {
+	// Hosts are the servers, in any form SetServers accepts.
+	Hosts []string
+
+	// Resolver looks up the names. If nil, net.DefaultResolver is used.
+	Resolver HostResolver
+}
+
+// Servers returns Hosts with every host name replaced by its first
+// address, IPv4 ones first.
+func (s *HostSource) Servers(ctx context.Context) ([]string, error) {
+	var r HostResolver = net.DefaultResolver
+	if s.Resolver != nil {
+		r = s.Resolver
+	}
+
+	servers := make([]string, len(s.Hosts))
+	for i, server := range s.Hosts {
+		servers[i] = server
+		hostport, opts, hasOpts := strings.Cut(server, "?")
+		if strings.Contains(hostport, "/") {
+			continue
+		}
+		host, port, err := net.SplitHostPort(hostport)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		ips, err := r.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		servers[i] = net.JoinHostPort(preferIPv4(ips), port)
+		if hasOpts {
+			servers[i] += "?" + opts
+		}
+	}
+	return servers, nil
+}
+
+// preferIPv4 returns the first IPv4 address of ips, or the first address
+// if there is none, as SetServers would pick.
+func preferIPv4(ips []string) string {
+	for _, ip := range ips {
+		if p := net.ParseIP(ip); p != nil && p.To4() != nil {
+			return ip
+		}
+	}
+	return ips[0]
+}
+
+// FileSource is a ServerSource reading the servers from a file, so that
+// configuration management can change them at run time; a Discovery
+// re-reads it every Interval and applies changes. The file lists one
+// server per line, in any form SetServers accepts, or is a YAML list of
+// them, optionally under a key:
+//
+//	servers:
+//	  - 10.0.0.1:11211
+//	  - "10.0.0.2:11211?weight=2"
+//
+// Blank lines and comments starting with # are ignored.
+type FileSource struct {
+	Path string
+}
+
+// Servers reads the servers from the file.
+func (s *FileSource) Servers(ctx context.Context) ([]string, error) {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.Index(line, "#"); i == 0 || i > 0 && line[i-1] == ' ' {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if item, ok := strings.CutPrefix(line, "-"); ok {
+			line = strings.Trim(strings.TrimSpace(item), `"'`)
+		} else if strings.HasSuffix(line, ":") {
+			// A YAML key, such as servers:.
+			continue
+		}
+		if line != "" {
+			servers = append(servers, line)
+		}
+	}
+	return servers, nil
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testSRVResolver answers every lookup with its records.
+type testSRVResolver struct {
+	records []*net.SRV
+	err     error
+}
+
+func (r *testSRVResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return "", r.records, r.err
+}
+
+// testHostResolver resolves the names of its map.
+type testHostResolver map[string][]string
+
+func (r testHostResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ips, ok := r[host]; ok {
+		return ips, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestDiscovery(t *testing.T) {
+	res := &testSRVResolver{records: []*net.SRV{
+		{Target: "127.0.0.1.", Port: 11211, Priority: 10},
+		{Target: "127.0.0.2.", Port: 11211, Priority: 10},
+		{Target: "127.0.0.3.", Port: 11211, Priority: 20},
+	}}
+	changes := 0
+	sl := &ServerList{OnChange: func(added, removed []net.Addr) { changes++ }}
+	d := &Discovery{
+		Source:   &SRVSource{Service: "memcache", Proto: "tcp", Name: "cache.example.com", Resolver: res},
+		Selector: sl,
+	}
+
+	ctx := context.Background()
+	if err := d.Refresh(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var got []string
+	sl.Each(func(addr net.Addr) error {
+		got = append(got, addr.String())
+		return nil
+	})
+	if want := []string{"127.0.0.1:11211", "127.0.0.2:11211"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// Unchanged answers and failed lookups keep the servers.
+	if err := d.Refresh(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	res.records = nil
+	if err := d.Refresh(ctx); err == nil {
+		t.Fatalf("expected an error for an empty answer")
+	}
+	res.err = errors.New("lookup failed")
+	if err := d.Refresh(ctx); err != res.err {
+		t.Fatalf("expected %v, got %v", res.err, err)
+	}
+	if changes != 1 {
+		t.Fatalf("expected 1 change, got %d", changes)
+	}
+
+	res.err = nil
+	res.records = []*net.SRV{{Target: "127.0.0.3.", Port: 11212}}
+	if err := d.Refresh(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if addr, err := sl.Select("k"); err != nil || addr.String() != "127.0.0.3:11212" {
+		t.Fatalf("expected 127.0.0.3:11212, got %v, %v", addr, err)
+	}
+	if changes != 2 {
+		t.Fatalf("expected 2 changes, got %d", changes)
+	}
+}
+
+func TestHostSource(t *testing.T) {
+	res := testHostResolver{"cache.internal": {"::1", "10.0.0.1"}}
+	src := &HostSource{
+		Hosts:    []string{"cache.internal:11211?weight=2", "10.0.0.9:11211", "/tmp/memcached.sock"},
+		Resolver: res,
+	}
+	got, err := src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.0.0.1:11211?weight=2", "10.0.0.9:11211", "/tmp/memcached.sock"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// The virtual IP fails over.
+	res["cache.internal"] = []string{"10.0.0.2"}
+	if got, _ = src.Servers(context.Background()); got[0] != "10.0.0.2:11211?weight=2" {
+		t.Fatalf("expected the new address, got %v", got[0])
+	}
+
+	delete(res, "cache.internal")
+	if _, err := src.Servers(context.Background()); err == nil {
+		t.Fatalf("expected an error for an unknown host")
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers")
+	write := func(content string) {
+		// Replace the file atomically, as configuration management does.
+		if err := os.WriteFile(path+".tmp", []byte(content), 0o644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	src := &FileSource{Path: path}
+
+	write("# memcached fleet\n10.0.0.1:11211\n\n10.0.0.2:11211?weight=2 # big\n")
+	got, err := src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.0.0.1:11211", "10.0.0.2:11211?weight=2"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	write("servers:\n  - 10.0.0.1:11211\n  - \"10.0.0.3:11211\"\n")
+	got, err = src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.0.0.1:11211", "10.0.0.3:11211"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// A running Discovery picks up changes of the file.
+	changed := make(chan []net.Addr, 10)
+	sl := &ServerList{OnChange: func(added, removed []net.Addr) { changed <- added }}
+	d := &Discovery{Source: src, Selector: sl, Interval: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+	<-changed
+
+	write("10.0.0.4:11211\n")
+	select {
+	case added := <-changed:
+		if len(added) != 1 || added[0].String() != "10.0.0.4:11211" {
+			t.Fatalf("expected 10.0.0.4:11211 to be added, got %v", added)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the change of the file to be applied")
+	}
+}
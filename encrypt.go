@@ -0,0 +1,133 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"strconv"
+)
+
+// Encrypted values are marked by the ID of their key in bits 24 to 27 of
+// Item.Flags.
+const (
+	encryptionShift = 24
+	encryptionMask  = uint32(0xf) << encryptionShift
+)
+
+// ErrDecrypt is returned for values that cannot be decrypted: their key is
+// unknown, or they were tampered with or stored under another key.
+var ErrDecrypt = errors.New("memcache: cannot decrypt value")
+
+// Encryption encrypts values with AES-GCM for Client.Encryption, so that
+// shared clusters never hold them in plaintext. Every value is bound to its
+// key: a value copied under another key fails to decrypt.
+type Encryption struct {
+	keyID uint8
+	aeads map[uint8]cipher.AEAD
+}
+
+// NewEncryption returns an Encryption encrypting new values with the key
+// of ID keyID and decrypting values with any of keys. IDs range from 1 to
+// 15 and are stored in the flags of the items, so that keys can be rotated
+// by adding a new key, switching keyID to it and removing the old key once
+// the values it encrypted have expired. Keys are 16, 24 or 32 bytes long,
+// for AES-128, AES-192 or AES-256.
+func NewEncryption(keyID uint8, keys map[uint8][]byte) (*Encryption, error) {
+	e := &Encryption{keyID: keyID, aeads: make(map[uint8]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id < 1 || id > 15 {
+			return nil, errors.New("memcache: encryption key ID " + strconv.Itoa(int(id)) + " out of range 1-15")
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		e.aeads[id], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e.aeads[keyID] == nil {
+		return nil, errors.New("memcache: no encryption key with ID " + strconv.Itoa(int(keyID)))
+	}
+	return e, nil
+}
+
+// seal encrypts value, stored under key, with the current key and returns
+// the nonce followed by the ciphertext.
+func (e *Encryption) seal(key string, value []byte) ([]byte, error) {
+	aead := e.aeads[e.keyID]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, value, []byte(key)), nil
+}
+
+// open decrypts value, stored under key and encrypted with the key of ID
+// id.
+func (e *Encryption) open(id uint8, key string, value []byte) ([]byte, error) {
+	aead := e.aeads[id]
+	if aead == nil || len(value) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	n := aead.NonceSize()
+	v, err := aead.Open(nil, value[:n], value[n:], []byte(key))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return v, nil
+}
+
+// encodeItem prepares it, stored under the untransformed key, for storage:
+// its value is compressed, then encrypted, as configured. Tombstones and
+// not-found markers are stored as is, so reads recognize them before
+// decoding.
+func (c *Client) encodeItem(key string, it Item) (Item, error) {
+	if it.Flags&FlagTombstone != 0 {
+		return it, nil
+	}
+	it, err := c.compressItem(it)
+	if err != nil || c.Encryption == nil {
+		return it, err
+	}
+	it.Value, err = c.Encryption.seal(key, it.Value)
+	it.Flags = it.Flags&^encryptionMask | uint32(c.Encryption.keyID)<<encryptionShift
+	return it, err
+}
+
+// decodeItem undoes encodeItem in place, once the key of it is the
+// untransformed one. Encrypted values need Client.Encryption; plaintext
+// ones are returned as is.
+func (c *Client) decodeItem(it *Item) error {
+	if id := uint8(it.Flags & encryptionMask >> encryptionShift); id != 0 {
+		if c.Encryption == nil {
+			return ErrDecrypt
+		}
+		v, err := c.Encryption.open(id, it.Key, it.Value)
+		if err != nil {
+			return err
+		}
+		it.Value = v
+		it.Flags &^= encryptionMask
+	}
+	return c.decompressItem(it)
+}
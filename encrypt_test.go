@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncryption(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+
+	enc, err := NewEncryption(1, map[uint8][]byte{1: oldKey})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client.Encryption = enc
+	if err := client.Set(&Item{Key: "ssn", Value: []byte("078-05-1120"), Flags: 5}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("ssn"); bytes.Contains(it.value, []byte("078-05-1120")) || it.flags != 5|1<<24 {
+		t.Fatalf("expected an encrypted value with flags %#x, got %q with flags %#x", 5|1<<24, it.value, it.flags)
+	}
+
+	// After a rotation, values encrypted with the old key still decrypt.
+	client.Encryption, err = NewEncryption(2, map[uint8][]byte{1: oldKey, 2: newKey})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	it, err := client.Get("ssn")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(it.Value) != "078-05-1120" || it.Flags != 5 {
+		t.Fatalf("expected the plaintext and original flags, got %q with flags %#x", it.Value, it.Flags)
+	}
+	if err := client.Set(&Item{Key: "ssn", Value: []byte("078-05-1120")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := s.item("ssn"); it.flags != 2<<24 {
+		t.Fatalf("expected the new key ID, got flags %#x", it.flags)
+	}
+
+	// Values copied under another key do not decrypt.
+	s.mu.Lock()
+	s.items["copy"] = s.items["ssn"]
+	s.mu.Unlock()
+	if _, err := client.Get("copy"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt, got %v", err)
+	}
+
+	client.Encryption = nil
+	if _, err := client.Get("ssn"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt without the keys, got %v", err)
+	}
+	if _, err := NewEncryption(16, map[uint8][]byte{16: newKey}); err == nil {
+		t.Fatalf("expected an error for a key ID out of range")
+	}
+}
+
+func TestEncryptionDeleteSoft(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.Encryption, _ = NewEncryption(1, map[uint8][]byte{1: bytes.Repeat([]byte{1}, 32)})
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.DeleteSoft("foo", 30); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get("foo"); !errors.Is(err, ErrTombstone) {
+		t.Fatalf("expected ErrTombstone, got %v", err)
+	}
+	if items, err := client.GetMulti([]string{"foo"}); err != nil || len(items) != 0 {
+		t.Fatalf("expected no items, got %v and %v", items, err)
+	}
+}
+
+func TestEncryptionNegativeTTL(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.Encryption, _ = NewEncryption(1, map[uint8][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	client.NegativeTTL = 30 * time.Second
+	ctx := context.Background()
+
+	loads := 0
+	loader := func(context.Context) ([]byte, error) {
+		loads++
+		return nil, ErrNotFound
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.Fetch(ctx, "nobody", 60, loader); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected the miss to be cached after one load, got %d loads", loads)
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EtcdSource is a ServerSource reading the servers from the keys under a
+// prefix in etcd, one server, in any form SetServers accepts, in the value
+// of every key, so that operators change the servers of every client by
+// writing to etcd. It uses the JSON gateway of the etcd v3 API.
+//
+// After the first lookup, every lookup watches the prefix and answers at
+// the first change, so that a Discovery applies changes as they are made.
+// An EtcdSource must not be used by several Discoveries at once.
+type EtcdSource struct {
+	// Endpoints are the URLs of the etcd members, such as
+	// http://10.0.0.1:2379, tried in order.
+	Endpoints []string
+
+	// Prefix is the prefix of the keys, such as /memcached/servers/.
+	Prefix string
+
+	// Username and Password, if set, authenticate the requests.
+	Username string
+	Password string
+
+	// HTTPClient sends the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	mu       sync.Mutex
+	revision int64 // of the last range
+	token    string
+}
+
+// etcdKeyValue is an mvccpb.KeyValue in the JSON gateway encoding, where
+// bytes are base64.
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// etcdHeader is the header of every response.
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+// Servers returns the values of the keys under Prefix. Every call but the
+// first waits for a change first.
+func (s *EtcdSource) Servers(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.Endpoints) == 0 {
+		return nil, errors.New("memcache: no etcd endpoints")
+	}
+	var err error
+	for _, ep := range s.Endpoints {
+		var servers []string
+		servers, err = s.lookup(ctx, strings.TrimSuffix(ep, "/"))
+		if err == nil || ctx.Err() != nil {
+			return servers, err
+		}
+	}
+	return nil, err
+}
+
+// lookup waits for a change, if there was a previous lookup, and reads the
+// keys from the member at ep.
+func (s *EtcdSource) lookup(ctx context.Context, ep string) ([]string, error) {
+	key, end := []byte(s.Prefix), etcdPrefixEnd(s.Prefix)
+	if s.revision > 0 {
+		if err := s.watch(ctx, ep, key, end); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp struct {
+		Header etcdHeader     `json:"header"`
+		Kvs    []etcdKeyValue `json:"kvs"`
+	}
+	req := map[string]any{"key": key, "range_end": end}
+	if err := s.post(ctx, ep, "/v3/kv/range", req, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&resp)
+	}); err != nil {
+		return nil, err
+	}
+	s.revision = resp.Header.Revision
+
+	var servers []string
+	for _, kv := range resp.Kvs {
+		for _, line := range strings.Split(string(kv.Value), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				servers = append(servers, line)
+			}
+		}
+	}
+	return servers, nil
+}
+
+// watch waits for the first change under the prefix after the last range.
+func (s *EtcdSource) watch(ctx context.Context, ep string, key, end []byte) error {
+	req := map[string]any{"create_request": map[string]any{
+		"key":            key,
+		"range_end":      end,
+		"start_revision": strconv.FormatInt(s.revision+1, 10),
+	}}
+	return s.post(ctx, ep, "/v3/watch", req, func(r io.Reader) error {
+		dec := json.NewDecoder(r)
+		for {
+			var resp struct {
+				Result struct {
+					Events          []json.RawMessage `json:"events"`
+					Canceled        bool              `json:"canceled"`
+					CompactRevision int64             `json:"compact_revision,string"`
+				} `json:"result"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := dec.Decode(&resp); err != nil {
+				return err
+			}
+			switch {
+			case resp.Error != nil:
+				return errors.New("memcache: etcd watch: " + resp.Error.Message)
+			case resp.Result.Canceled || resp.Result.CompactRevision > 0:
+				// The revision was compacted away; reading the keys
+				// again is all there is to do.
+				return nil
+			case len(resp.Result.Events) > 0:
+				return nil
+			}
+			// The confirmation of the watch or a progress notification.
+		}
+	})
+}
+
+// post sends req to the path of the member at ep, authenticating first if
+// needed, and passes the response body to read.
+func (s *EtcdSource) post(ctx context.Context, ep, path string, req any, read func(io.Reader) error) error {
+	if s.Username != "" && s.token == "" {
+		var auth struct {
+			Token string `json:"token"`
+		}
+		creds := map[string]string{"name": s.Username, "password": s.Password}
+		if err := s.send(ctx, ep, "/v3/auth/authenticate", creds, func(r io.Reader) error {
+			return json.NewDecoder(r).Decode(&auth)
+		}); err != nil {
+			return err
+		}
+		s.token = auth.Token
+	}
+	err := s.send(ctx, ep, path, req, read)
+	if err != nil && s.token != "" {
+		// The token may have expired; authenticate again next time.
+		s.token = ""
+	}
+	return err
+}
+
+// send posts req as JSON to the path of the member at ep.
+func (s *EtcdSource) send(ctx context.Context, ep, path string, req any, read func(io.Reader) error) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, ep+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		hr.Header.Set("Authorization", s.token)
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(hr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("memcache: etcd: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return read(resp.Body)
+}
+
+// etcdPrefixEnd returns the end of the range of keys starting with prefix.
+func etcdPrefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Every key is after the prefix.
+	return []byte{0}
+}
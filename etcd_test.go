@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestEtcdSource(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+	values := []string{"10.3.0.1:11211", "10.3.0.2:11211?weight=2"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.URL.Path {
+		case "/v3/auth/authenticate":
+			if req["name"] != "root" || req["password"] != "pw" {
+				http.Error(w, "bad credentials", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token": "tok"}`)
+		case "/v3/kv/range":
+			if r.Header.Get("Authorization") != "tok" || req["key"] != b64([]byte("/mc/")) || req["range_end"] != b64([]byte("/mc0")) {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			var kvs []map[string]string
+			for i, v := range values {
+				kvs = append(kvs, map[string]string{"key": b64([]byte(fmt.Sprint("/mc/", i))), "value": b64([]byte(v))})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"header": map[string]string{"revision": "5"}, "kvs": kvs})
+		case "/v3/watch":
+			create := req["create_request"].(map[string]any)
+			if create["start_revision"] != "6" {
+				http.Error(w, "bad revision", http.StatusBadRequest)
+				return
+			}
+			// An operator removes a server.
+			values = values[:1]
+			fmt.Fprint(w, `{"result": {"created": true}}`+"\n")
+			fmt.Fprint(w, `{"result": {"events": [{"type": "DELETE"}]}}`+"\n")
+		}
+	}))
+	defer srv.Close()
+
+	src := &EtcdSource{Endpoints: []string{"http://127.0.0.1:1", srv.URL}, Prefix: "/mc/", Username: "root", Password: "pw"}
+	got, err := src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.3.0.1:11211", "10.3.0.2:11211?weight=2"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	got, err = src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.3.0.1:11211"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import "expvar"
+
+// PublishExpvar publishes the live counters of c, a subset of ClientStats,
+// under name with the expvar package, so that they are served on
+// /debug/vars with the other variables of the process:
+//
+//	ops       operations run
+//	hits      reads that found their keys
+//	misses    reads that did not
+//	errors    operations that failed, before BestEffort hid the error
+//	timeouts  operations that failed because a deadline expired
+//	open      connections open to all servers, idle or in use
+//
+// Like expvar.Publish, PublishExpvar panics if name is already in use.
+func (c *Client) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		var open int
+		for _, st := range c.PoolStats() {
+			open += st.Open
+		}
+		st := c.ClientStats()
+		return map[string]uint64{
+			"ops":      st.Ops,
+			"hits":     st.Hits,
+			"misses":   st.Misses,
+			"errors":   st.Errors,
+			"timeouts": st.Timeouts,
+			"open":     uint64(open),
+		}
+	}))
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"encoding/json"
+	"expvar"
+	"net"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.PublishExpvar("gomcache_test")
+
+	client.Set(&Item{Key: "k", Value: []byte("v")})
+	client.Get("k")
+	client.GetMulti([]string{"k", "missing"})
+	client.Get("missing")
+	client.Get("k", WithServer(down))
+	client.Child("jobs").Get("k")
+
+	var got map[string]uint64
+	if err := json.Unmarshal([]byte(expvar.Get("gomcache_test").String()), &got); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := map[string]uint64{"ops": 5, "hits": 2, "misses": 1, "errors": 1, "timeouts": 0, "open": 1}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("expected %s=%d, got %v", k, v, got)
+		}
+	}
+}
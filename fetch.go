@@ -0,0 +1,261 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FlagEnvelope marks values stored by Fetch with StaleWhileRevalidate or
+// EarlyRefreshBeta set, which start with the time they expire and the time
+// they took to load. Get and GetMulti remove it.
+const FlagEnvelope uint32 = 1 << 28
+
+// envelopeLen is the length of the expiration time, in Unix milliseconds,
+// and of the load time, in milliseconds, ahead of a value marked with
+// FlagEnvelope.
+const envelopeLen = 12
+
+// maxRelativeExpiration is the largest expiration memcached takes as
+// relative to now rather than as a Unix time.
+const maxRelativeExpiration = 60 * 60 * 24 * 30
+
+// errLoaderPanicked is returned to the callers of Fetch waiting on a loader
+// that panicked in another goroutine.
+var errLoaderPanicked = errors.New("memcache: loader panicked")
+
+// fetchGroup runs at most one loader at a time per key for Fetch.
+type fetchGroup struct {
+	mu    sync.Mutex
+	calls map[string]*fetchCall
+}
+
+// fetchCall is a loader running for a key.
+type fetchCall struct {
+	done chan struct{} // closed once item and err are set
+	item *Item
+	err  error
+}
+
+func newFetchGroup() *fetchGroup {
+	return &fetchGroup{calls: make(map[string]*fetchCall)}
+}
+
+// start runs fn for key in a new goroutine unless it is already running.
+func (g *fetchGroup) start(key string, fn func() (*Item, error)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.calls[key]; ok {
+		return
+	}
+	fc := &fetchCall{done: make(chan struct{}), err: errLoaderPanicked}
+	g.calls[key] = fc
+	go g.run(key, fc, fn)
+}
+
+// do runs fn for key unless it is already running, in which case it waits
+// for that call, or for ctx, and returns its result.
+func (g *fetchGroup) do(ctx context.Context, key string, fn func() (*Item, error)) (*Item, error) {
+	g.mu.Lock()
+	if fc, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-fc.done:
+			return fc.item, fc.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	fc := &fetchCall{done: make(chan struct{}), err: errLoaderPanicked}
+	g.calls[key] = fc
+	g.mu.Unlock()
+	return g.run(key, fc, fn)
+}
+
+// run sets the result of fc by calling fn, then ends it.
+func (g *fetchGroup) run(key string, fc *fetchCall, fn func() (*Item, error)) (*Item, error) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(fc.done)
+	}()
+	fc.item, fc.err = fn()
+	return fc.item, fc.err
+}
+
+// Fetch returns the value of key, or, if it is not cached, calls loader to
+// produce it and stores it, expiring as Item.Expiration. Concurrent Fetches
+// of a key missing from the cache share a single call of loader, made with
+// the context of the first of them, and all get its result, which they
+// must not modify. Errors of loader are returned and not cached, except
+// ErrNotFound with NegativeTTL set.
+//
+// With StaleWhileRevalidate set, values are kept past their expiration,
+// and Fetch returns them once expired while calling loader in the
+// background, without the deadline of ctx, to replace them. With
+// EarlyRefreshBeta set, Fetch also does so before they expire, with a
+// probability growing as expiration nears, so that the callers of a hot
+// key do not all miss it at once when it expires.
+//
+// The cache is best effort: if reading the key fails, loader is called as
+// for a miss, and if storing its value fails, the value is still returned.
+func (c *Client) Fetch(ctx context.Context, key string, expiration int32, loader func(context.Context) ([]byte, error), opts ...CallOption) ([]byte, error) {
+	it, err := c.fetch(ctx, key, expiration, func(ctx context.Context) (*Item, error) {
+		value, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Item{Value: value}, nil
+	}, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	return it.Value, nil
+}
+
+// fetch is Fetch for loaders returning the value and flags of an item. If
+// strict, errors reading or storing the key are returned rather than
+// ignored.
+func (c *Client) fetch(ctx context.Context, key string, expiration int32, loader func(context.Context) (*Item, error), strict bool, opts []CallOption) (*Item, error) {
+	load := func(ctx context.Context) func() (*Item, error) {
+		return func() (*Item, error) {
+			start := time.Now()
+			loaded, err := loader(ctx)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) && c.NegativeTTL > 0 {
+					c.SetContext(ctx, &Item{
+						Key:        key,
+						Value:      notFoundValue,
+						Flags:      FlagTombstone,
+						Expiration: int32((c.NegativeTTL + time.Second - 1) / time.Second),
+					}, opts...)
+				}
+				return nil, err
+			}
+			it := &Item{Key: key, Value: loaded.Value, Flags: loaded.Flags}
+			err = c.SetContext(ctx, c.fetchedItem(it, expiration, time.Since(start)), opts...)
+			if err != nil && strict {
+				return nil, err
+			}
+			return it, nil
+		}
+	}
+
+	it, err := c.GetContext(ctx, key, append(opts, withRawEnvelope())...)
+	if err == nil {
+		env, err := openEnvelope(it)
+		if err == nil {
+			if c.refreshDue(env) {
+				c.fetches.start(key, load(context.WithoutCancel(ctx)))
+			}
+			return it, nil
+		}
+	}
+	if err == ErrNotFound || err != nil && strict && !errors.Is(err, ErrCacheMiss) {
+		return nil, err
+	}
+	return c.fetches.do(ctx, key, load(ctx))
+}
+
+// refreshDue reports whether Fetch should refresh the value in env: once
+// it expired, or, with EarlyRefreshBeta set, at a time drawn before its
+// expiration following the XFetch algorithm, which refreshes earlier
+// values that are slower to load.
+func (c *Client) refreshDue(env envelope) bool {
+	if env.expires.IsZero() {
+		return false
+	}
+	now := time.Now()
+	if c.EarlyRefreshBeta > 0 {
+		gap := -float64(env.delta) * c.EarlyRefreshBeta * math.Log(1-rand.Float64())
+		now = now.Add(time.Duration(gap))
+	}
+	return !now.Before(env.expires)
+}
+
+// fetchedItem returns the item storing it, loaded by Fetch in delta, in an
+// envelope kept StaleWhileRevalidate past expiration if Fetch needs one.
+func (c *Client) fetchedItem(it *Item, expiration int32, delta time.Duration) *Item {
+	stale := int32((c.StaleWhileRevalidate + time.Second - 1) / time.Second)
+	if stale <= 0 && c.EarlyRefreshBeta <= 0 || expiration == 0 {
+		return &Item{Key: it.Key, Value: it.Value, Flags: it.Flags, Expiration: expiration}
+	}
+	expires := time.Unix(int64(expiration), 0)
+	if expiration <= maxRelativeExpiration {
+		expires = time.Now().Add(time.Duration(expiration) * time.Second)
+	}
+	b := make([]byte, envelopeLen, envelopeLen+len(it.Value))
+	binary.BigEndian.PutUint64(b, uint64(expires.UnixMilli()))
+	binary.BigEndian.PutUint32(b[8:], uint32(min(delta.Milliseconds(), math.MaxUint32)))
+	// Past 30 days memcached reads the expiration as a Unix timestamp, so
+	// a relative one pushed over it by stale is made absolute.
+	exp := expiration + max(stale, 0)
+	if expiration <= maxRelativeExpiration && exp > maxRelativeExpiration {
+		exp = int32(expires.Unix()) + max(stale, 0)
+	}
+	return &Item{
+		Key:        it.Key,
+		Value:      append(b, it.Value...),
+		Flags:      it.Flags | FlagEnvelope,
+		Expiration: exp,
+	}
+}
+
+// envelope is the envelope of a value stored by Fetch.
+type envelope struct {
+	expires time.Time     // zero if the value has no envelope
+	delta   time.Duration // time the value took to load
+}
+
+// openEnvelope removes the envelope of it, if it has one, and returns it.
+func openEnvelope(it *Item) (envelope, error) {
+	if it.Flags&FlagEnvelope == 0 {
+		return envelope{}, nil
+	}
+	if len(it.Value) < envelopeLen {
+		return envelope{}, errors.New("memcache: malformed envelope of " + it.Key)
+	}
+	env := envelope{
+		expires: time.UnixMilli(int64(binary.BigEndian.Uint64(it.Value))),
+		delta:   time.Duration(binary.BigEndian.Uint32(it.Value[8:])) * time.Millisecond,
+	}
+	it.Value = it.Value[envelopeLen:]
+	it.Flags &^= FlagEnvelope
+	return env, nil
+}
+
+// openEnvelopes removes the envelopes of items, leaving out malformed ones.
+func openEnvelopes(items map[string]*Item) {
+	for key, it := range items {
+		if _, err := openEnvelope(it); err != nil {
+			delete(items, key)
+		}
+	}
+}
+
+// withRawEnvelope makes Get leave the envelopes of values stored by Fetch.
+func withRawEnvelope() CallOption {
+	return func(o *callOptions) { o.rawEnvelope = true }
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	ctx := context.Background()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := func(context.Context) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return []byte("loaded"), nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := client.Fetch(ctx, "key", 60, loader)
+			if err == nil && string(v) != "loaded" {
+				err = errors.New("unexpected value " + string(v))
+			}
+			errs <- err
+		}()
+	}
+	// Let the callers miss and queue behind the first loader.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("expected the loader to run once, got %d calls", n)
+	}
+	if it := s.item("key"); it == nil || string(it.value) != "loaded" || it.exp != 60 {
+		t.Fatalf("expected the loaded value to be cached for 60s, got %+v", it)
+	}
+
+	// Hits do not call the loader.
+	before := loads.Load()
+	if v, err := client.Fetch(ctx, "key", 60, loader); err != nil || string(v) != "loaded" {
+		t.Fatalf("expected loaded, got %q and %v", v, err)
+	}
+	if loads.Load() != before {
+		t.Fatalf("expected a hit not to call the loader")
+	}
+
+	// Errors of the loader are returned and not cached.
+	boom := errors.New("boom")
+	if _, err := client.Fetch(ctx, "other", 60, func(context.Context) ([]byte, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Fatalf("expected the loader error, got %v", err)
+	}
+	if s.item("other") != nil {
+		t.Fatalf("expected a failed load not to be cached")
+	}
+}
+
+func TestFetchStaleWhileRevalidate(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.StaleWhileRevalidate = time.Hour
+	ctx := context.Background()
+
+	v, err := client.Fetch(ctx, "key", 60, func(context.Context) ([]byte, error) { return []byte("v1"), nil })
+	if err != nil || string(v) != "v1" {
+		t.Fatalf("expected v1, got %q and %v", v, err)
+	}
+	if it := s.item("key"); it.flags != FlagEnvelope || it.exp != 60+3600 {
+		t.Fatalf("expected an envelope kept an hour past expiration, got flags %#x and expiration %d", it.flags, it.exp)
+	}
+	if it, err := client.Get("key"); err != nil || string(it.Value) != "v1" || it.Flags != 0 {
+		t.Fatalf("expected Get to remove the envelope, got %+v and %v", it, err)
+	}
+
+	// Once expired, the stale value is returned while it is refreshed.
+	stale := client.fetchedItem(&Item{Key: "key", Value: []byte("stale")}, 60, 0)
+	binary.BigEndian.PutUint64(stale.Value, uint64(time.Now().Add(-time.Second).UnixMilli()))
+	if err := client.Set(stale); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	refreshed := make(chan struct{})
+	v, err = client.Fetch(ctx, "key", 60, func(context.Context) ([]byte, error) {
+		defer close(refreshed)
+		return []byte("v2"), nil
+	})
+	if err != nil || string(v) != "stale" {
+		t.Fatalf("expected the stale value, got %q and %v", v, err)
+	}
+	<-refreshed
+	for deadline := time.Now().Add(time.Second); ; {
+		if it, err := client.Get("key"); err == nil && string(it.Value) == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the value to be refreshed in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFetchStaleExpirationBoundary(t *testing.T) {
+	client, _ := NewClient([]string{"127.0.0.1:1"}, false)
+	client.StaleWhileRevalidate = time.Hour
+	it := &Item{Key: "key", Value: []byte("v")}
+
+	if exp := client.fetchedItem(it, maxRelativeExpiration-3600, 0).Expiration; exp != maxRelativeExpiration {
+		t.Fatalf("expected a relative expiration of %d, got %d", maxRelativeExpiration, exp)
+	}
+	now := time.Now().Unix()
+	exp := client.fetchedItem(it, maxRelativeExpiration-3599, 0).Expiration
+	if want := now + maxRelativeExpiration + 1; int64(exp) < want || int64(exp) > want+1 {
+		t.Fatalf("expected an absolute expiration of %d, got %d", want, exp)
+	}
+	abs := int32(now + 7200)
+	if exp := client.fetchedItem(it, abs, 0).Expiration; exp != abs+3600 {
+		t.Fatalf("expected an absolute expiration of %d, got %d", abs+3600, exp)
+	}
+}
+
+func TestFetchEarlyRefresh(t *testing.T) {
+	client := &Client{}
+	env := envelope{expires: time.Now().Add(time.Second), delta: 10 * time.Second}
+	if client.refreshDue(env) {
+		t.Fatalf("expected no early refresh without EarlyRefreshBeta")
+	}
+	if !client.refreshDue(envelope{expires: time.Now().Add(-time.Second)}) {
+		t.Fatalf("expected a refresh once expired")
+	}
+
+	// With a load time of 10s and 1s left, XFetch refreshes with a
+	// probability of exp(-0.1/beta), about 90% for a beta of 1.
+	client.EarlyRefreshBeta = 1
+	due := 0
+	for i := 0; i < 1000; i++ {
+		if client.refreshDue(env) {
+			due++
+		}
+	}
+	if due < 800 || due > 980 {
+		t.Fatalf("expected about 905 early refreshes out of 1000, got %d", due)
+	}
+	if client.refreshDue(envelope{expires: time.Now().Add(time.Hour), delta: time.Millisecond}) {
+		t.Fatalf("expected no refresh of a fast value far from expiring")
+	}
+
+	item := client.fetchedItem(&Item{Key: "key", Value: []byte("v")}, 60, 1500*time.Millisecond)
+	env, err := openEnvelope(item)
+	if err != nil || env.delta != 1500*time.Millisecond || item.Expiration != 60 {
+		t.Fatalf("expected an envelope with the load time and no stale window, got %+v, %d and %v", env, item.Expiration, err)
+	}
+}
+
+func TestFetchNegativeTTL(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.NegativeTTL = 30 * time.Second
+	ctx := context.Background()
+
+	loads := 0
+	loader := func(context.Context) ([]byte, error) {
+		loads++
+		return nil, ErrNotFound
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := client.Fetch(ctx, "nobody", 60, loader); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected the miss to be cached after one load, got %d loads", loads)
+	}
+	if it := s.item("nobody"); it == nil || it.exp != 30 {
+		t.Fatalf("expected a marker cached for 30s, got %+v", it)
+	}
+	if _, err := client.Get("nobody"); !errors.Is(err, ErrNotFound) || !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected ErrNotFound matching ErrCacheMiss, got %v", err)
+	}
+	if items, err := client.GetMulti([]string{"nobody"}); err != nil || len(items) != 0 {
+		t.Fatalf("expected no items, got %v and %v", items, err)
+	}
+}
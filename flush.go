@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FlushServer invalidates every item held by the server at addr, leaving
+// the other servers untouched. Combine it with RehashAway to reset a single
+// node, for instance after slab corruption, without sending its traffic to
+// a cold cache.
+func (c *Client) FlushServer(addr string, opts ...CallOption) error {
+	return c.FlushServerContext(context.Background(), addr, opts...)
+}
+
+// FlushServerContext is like FlushServer but bounded by ctx.
+func (c *Client) FlushServerContext(ctx context.Context, addr string, opts ...CallOption) error {
+	if err := c.conformFeature(featureFlush); err != nil {
+		return err
+	}
+	opts = append(opts[:len(opts):len(opts)], WithServer(addr))
+	return c.run(ctx, &Operation{Name: "flush"}, opts, func(cl *call, _ *Operation) error {
+		if c.Local != nil {
+			defer c.Local.Purge()
+		}
+
+		return c.withRetry(cl, func(n int, prev error) error {
+			sp, err := c.callProtocol(cl, cl.server)
+			if err != nil {
+				return err
+			}
+			return cl.opError(cl.server, "", c.roundTrip(cl.ctx, cl.server, sp.Protocol, c.useUDP(cl.server, sp), sp.Protocol.appendFlush(nil), sp.Protocol.parseFlush))
+		})
+	})
+}
+
+// RehashAway stops selecting the server at addr, moving its keys to other
+// servers, for d or until the returned restore function is called. If d is
+// zero, the server stays away until restore is called. The selector must
+// implement EjectingSelector.
+func (c *Client) RehashAway(addr string, d time.Duration) (restore func(), err error) {
+	es, ok := c.selector.(EjectingSelector)
+	if !ok {
+		return nil, errNoEjection
+	}
+	a, err := c.pinnedServer(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	es.Eject(a)
+	var once sync.Once
+	restore = func() { once.Do(func() { es.Restore(a) }) }
+	if d > 0 {
+		time.AfterFunc(d, restore)
+	}
+	return restore, nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFlushServer(t *testing.T) {
+	a := newTestServer(t)
+	b := newTestServer(t)
+	client, _ := NewClient([]string{a.addr, b.addr}, false)
+
+	for i := 0; i < 20; i++ {
+		if err := client.Set(&Item{Key: fmt.Sprintf("key%d", i), Value: []byte("v")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := client.FlushServer(a.addr); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		addr, _ := client.selector.Select(key)
+		_, err := client.Get(key)
+		if addr.String() == a.addr && err != ErrCacheMiss {
+			t.Fatalf("expected %q to be flushed, got %v", key, err)
+		}
+		if addr.String() == b.addr && err != nil {
+			t.Fatalf("expected %q to survive, got %v", key, err)
+		}
+	}
+}
+
+func TestRehashAway(t *testing.T) {
+	a := newTestServer(t)
+	b := newTestServer(t)
+	client, _ := NewClient([]string{a.addr, b.addr}, false)
+
+	restore, err := client.RehashAway(a.addr, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if addr, _ := client.selector.Select(fmt.Sprintf("key%d", i)); addr.String() != b.addr {
+			t.Fatalf("expected every key on %s, got %s", b.addr, addr)
+		}
+	}
+	restore()
+	restore()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		addr, _ := client.selector.Select(fmt.Sprintf("key%d", i))
+		seen[addr.String()] = true
+	}
+	if !seen[a.addr] || !seen[b.addr] {
+		t.Fatalf("expected keys on both servers after restore, got %v", seen)
+	}
+
+	if _, err := client.RehashAway(a.addr, 10*time.Millisecond); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; ; i++ {
+		if i == 1000 {
+			t.Fatalf("expected %s to be selected again after the duration", a.addr)
+		}
+		if addr, _ := client.selector.Select(fmt.Sprintf("key%d", i)); addr.String() == a.addr {
+			break
+		}
+	}
+}
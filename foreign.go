@@ -0,0 +1,381 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// The codecs below read and write values like client libraries in other
+// languages, which use Item.Flags for their own type and compression bits,
+// so that a Go service can share keys with services written with them.
+// They replace the flags of this package, and so cannot be combined with
+// Client.Compressor or Client.Encryption. Values they cannot represent,
+// such as PHP-serialized or pickled objects, are an error, both ways.
+
+// php-memcached flags: the type in bits 0 to 3, compression in bits 4 to 7.
+const (
+	phpTypeMask       uint32 = 0xf
+	phpString         uint32 = 0
+	phpLong           uint32 = 1
+	phpDouble         uint32 = 2
+	phpBool           uint32 = 3
+	phpJSON           uint32 = 6
+	phpCompressed     uint32 = 1 << 4
+	phpCompressFastLZ uint32 = 1 << 6
+)
+
+// phpMemcachedCodec is the Codec of PHPMemcachedCodec.
+type phpMemcachedCodec struct{}
+
+// PHPMemcachedCodec returns a Codec compatible with the memcached extension
+// of PHP. Strings, byte slices, integers, floats and booleans are stored as
+// the PHP scalars, and other values as JSON, which the extension decodes
+// with its JSON serializer. It reads values compressed with zlib, but not
+// fastlz, and never compresses itself.
+func PHPMemcachedCodec() Codec {
+	return phpMemcachedCodec{}
+}
+
+func (phpMemcachedCodec) Marshal(v any) ([]byte, uint32, error) {
+	switch x := scalarOf(v).(type) {
+	case string:
+		return []byte(x), phpString, nil
+	case []byte:
+		return x, phpString, nil
+	case int64:
+		return strconv.AppendInt(nil, x, 10), phpLong, nil
+	case uint64:
+		return strconv.AppendUint(nil, x, 10), phpLong, nil
+	case float64:
+		return strconv.AppendFloat(nil, x, 'g', -1, 64), phpDouble, nil
+	case bool:
+		if x {
+			return []byte("1"), phpBool, nil
+		}
+		return nil, phpBool, nil
+	}
+	b, err := json.Marshal(v)
+	return b, phpJSON, err
+}
+
+func (phpMemcachedCodec) Unmarshal(data []byte, flags uint32, v any) error {
+	if flags&phpCompressed != 0 {
+		if flags&phpCompressFastLZ != 0 {
+			return errors.New("memcache: php-memcached fastlz compression is not supported")
+		}
+		// zlib data follows the length of the uncompressed value.
+		if len(data) < 4 {
+			return errors.New("memcache: truncated php-memcached value")
+		}
+		size := binary.LittleEndian.Uint32(data)
+		var err error
+		if data, err = zlibDecompress(data[4:]); err != nil {
+			return err
+		}
+		if len(data) != int(size) {
+			return errors.New("memcache: php-memcached value of the wrong length")
+		}
+	}
+
+	switch t := flags & phpTypeMask; t {
+	case phpString:
+		return assignValue(v, data)
+	case phpLong:
+		n, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return err
+		}
+		return assignValue(v, n)
+	case phpDouble:
+		f, err := strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return err
+		}
+		return assignValue(v, f)
+	case phpBool:
+		return assignValue(v, string(data) == "1")
+	case phpJSON:
+		return json.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("memcache: php-memcached value type %d is not supported", t)
+	}
+}
+
+// python-memcache flags.
+const (
+	pyPickle     uint32 = 1 << 0
+	pyInteger    uint32 = 1 << 1
+	pyLong       uint32 = 1 << 2
+	pyCompressed uint32 = 1 << 3
+	pyText       uint32 = 1 << 4
+)
+
+// pythonMemcacheCodec is the Codec of PythonMemcacheCodec.
+type pythonMemcacheCodec struct{}
+
+// PythonMemcacheCodec returns a Codec compatible with the python-memcache
+// (python-memcached) library. Strings are stored as text, byte slices as
+// bytes, and integers and booleans as integers; anything else would have
+// to be pickled. It reads values compressed with zlib, but never
+// compresses itself.
+func PythonMemcacheCodec() Codec {
+	return pythonMemcacheCodec{}
+}
+
+func (pythonMemcacheCodec) Marshal(v any) ([]byte, uint32, error) {
+	switch x := scalarOf(v).(type) {
+	case string:
+		return []byte(x), pyText, nil
+	case []byte:
+		return x, 0, nil
+	case int64:
+		return strconv.AppendInt(nil, x, 10), pyInteger, nil
+	case uint64:
+		return strconv.AppendUint(nil, x, 10), pyInteger, nil
+	case bool:
+		if x {
+			return []byte("1"), pyInteger, nil
+		}
+		return []byte("0"), pyInteger, nil
+	}
+	return nil, 0, fmt.Errorf("memcache: python-memcache cannot store %T without pickling", v)
+}
+
+func (pythonMemcacheCodec) Unmarshal(data []byte, flags uint32, v any) error {
+	if flags&pyCompressed != 0 {
+		var err error
+		if data, err = zlibDecompress(data); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case flags&pyPickle != 0:
+		return errors.New("memcache: pickled python-memcache values are not supported")
+	case flags&(pyInteger|pyLong) != 0:
+		n, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return err
+		}
+		return assignValue(v, n)
+	case flags&pyText != 0:
+		return assignValue(v, string(data))
+	}
+	return assignValue(v, data)
+}
+
+// spymemcached flags of its SerializingTranscoder: the type of special
+// values in bits 8 to 15.
+const (
+	spySerialized uint32 = 1
+	spyCompressed uint32 = 2
+	spyTypeMask   uint32 = 0xff00
+	spyString     uint32 = 0
+	spyBoolean    uint32 = 1 << 8
+	spyInt        uint32 = 2 << 8
+	spyLong       uint32 = 3 << 8
+	spyDate       uint32 = 4 << 8
+	spyByte       uint32 = 5 << 8
+	spyFloat      uint32 = 6 << 8
+	spyDouble     uint32 = 7 << 8
+	spyByteArray  uint32 = 8 << 8
+)
+
+// spymemcachedCodec is the Codec of SpymemcachedCodec.
+type spymemcachedCodec struct{}
+
+// SpymemcachedCodec returns a Codec compatible with the default
+// SerializingTranscoder of the Java spymemcached library. Strings, byte
+// slices, booleans, integers, floats and time.Time values are stored as
+// the matching Java types: int8 as Byte, int16 and int32 as Integer and
+// other integers as Long. Anything else would have to use Java
+// serialization. It reads values compressed with gzip, but never
+// compresses itself.
+func SpymemcachedCodec() Codec {
+	return spymemcachedCodec{}
+}
+
+func (spymemcachedCodec) Marshal(v any) ([]byte, uint32, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return spyEncodeNum(uint64(x.UnixMilli()), 8), spyDate, nil
+	case int8:
+		return []byte{byte(x)}, spyByte, nil
+	case int16:
+		return spyEncodeNum(uint64(uint32(x)), 4), spyInt, nil
+	case int32:
+		return spyEncodeNum(uint64(uint32(x)), 4), spyInt, nil
+	case float32:
+		return spyEncodeNum(uint64(math.Float32bits(x)), 4), spyFloat, nil
+	}
+	switch x := scalarOf(v).(type) {
+	case string:
+		return []byte(x), spyString, nil
+	case []byte:
+		return x, spyByteArray, nil
+	case bool:
+		if x {
+			return []byte("1"), spyBoolean, nil
+		}
+		return []byte("0"), spyBoolean, nil
+	case int64:
+		return spyEncodeNum(uint64(x), 8), spyLong, nil
+	case uint64:
+		return spyEncodeNum(x, 8), spyLong, nil
+	case float64:
+		return spyEncodeNum(math.Float64bits(x), 8), spyDouble, nil
+	}
+	return nil, 0, fmt.Errorf("memcache: spymemcached cannot store %T without Java serialization", v)
+}
+
+func (spymemcachedCodec) Unmarshal(data []byte, flags uint32, v any) error {
+	if flags&spyCompressed != 0 {
+		var err error
+		if data, err = defaultGzip.Decompress(data); err != nil {
+			return err
+		}
+	}
+	if flags&spySerialized != 0 {
+		return errors.New("memcache: Java-serialized spymemcached values are not supported")
+	}
+
+	switch t := flags & spyTypeMask; t {
+	case spyString:
+		return assignValue(v, string(data))
+	case spyByteArray:
+		return assignValue(v, data)
+	case spyBoolean:
+		return assignValue(v, len(data) > 0 && data[0] == '1')
+	case spyByte:
+		if len(data) != 1 {
+			return errors.New("memcache: malformed spymemcached byte")
+		}
+		return assignValue(v, int64(int8(data[0])))
+	case spyInt:
+		return assignValue(v, int64(int32(spyDecodeNum(data))))
+	case spyLong:
+		return assignValue(v, int64(spyDecodeNum(data)))
+	case spyFloat:
+		return assignValue(v, float64(math.Float32frombits(uint32(spyDecodeNum(data)))))
+	case spyDouble:
+		return assignValue(v, math.Float64frombits(spyDecodeNum(data)))
+	case spyDate:
+		return assignValue(v, time.UnixMilli(int64(spyDecodeNum(data))))
+	default:
+		return fmt.Errorf("memcache: spymemcached value type %#x is not supported", t)
+	}
+}
+
+// spyEncodeNum encodes the low n bytes of x big-endian, without leading
+// zero bytes, as spymemcached does.
+func spyEncodeNum(x uint64, n int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, x)
+	b = b[8-n:]
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// spyDecodeNum decodes a number encoded by spyEncodeNum.
+func spyDecodeNum(b []byte) uint64 {
+	var x uint64
+	for _, c := range b {
+		x = x<<8 | uint64(c)
+	}
+	return x
+}
+
+// zlibDecompress decompresses data in the zlib format.
+func zlibDecompress(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// scalarOf returns v as a string, []byte, int64, uint64, float64 or bool,
+// according to its kind, or nil if it is none of them.
+func scalarOf(v any) any {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes()
+		}
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return nil
+}
+
+// assignValue stores x, decoded by one of the codecs above, in the value v
+// points to, converting between numeric kinds, between strings and byte
+// slices, and from numbers to booleans.
+func assignValue(v any, x any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("memcache: cannot decode into %T, which is not a pointer", v)
+	}
+	e, xv := rv.Elem(), reflect.ValueOf(x)
+	switch {
+	case xv.Type().AssignableTo(e.Type()):
+		e.Set(xv)
+		return nil
+	case isNumber(xv.Kind()) && isNumber(e.Kind()),
+		isText(xv.Type()) && isText(e.Type()):
+		e.Set(xv.Convert(e.Type()))
+		return nil
+	case isNumber(xv.Kind()) && e.Kind() == reflect.Bool:
+		e.SetBool(!xv.IsZero())
+		return nil
+	}
+	return fmt.Errorf("memcache: cannot decode %T into %T", x, v)
+}
+
+// isNumber reports whether k is a numeric kind.
+func isNumber(k reflect.Kind) bool {
+	return reflect.Int <= k && k <= reflect.Float64
+}
+
+// isText reports whether t is a string or byte slice type.
+func isText(t reflect.Type) bool {
+	return t.Kind() == reflect.String || t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestForeignCodecs(t *testing.T) {
+	date := time.UnixMilli(1700000000123)
+	for _, tt := range []struct {
+		name  string
+		codec Codec
+		in    any
+		value string
+		flags uint32
+		out   any // decoded into a value of the same type
+	}{
+		{"php string", PHPMemcachedCodec(), "hello", "hello", 0, ""},
+		{"php long", PHPMemcachedCodec(), -42, "-42", 1, 0},
+		{"php double", PHPMemcachedCodec(), 1.5, "1.5", 2, 0.0},
+		{"php true", PHPMemcachedCodec(), true, "1", 3, false},
+		{"php false", PHPMemcachedCodec(), false, "", 3, true},
+		{"php json", PHPMemcachedCodec(), testUser{ID: 1}, `{"ID":1,"Name":"","Roles":null}`, 6, testUser{}},
+		{"python text", PythonMemcacheCodec(), "hello", "hello", 16, ""},
+		{"python bytes", PythonMemcacheCodec(), []byte("hi"), "hi", 0, []byte(nil)},
+		{"python int", PythonMemcacheCodec(), int64(7), "7", 2, int64(0)},
+		{"python bool", PythonMemcacheCodec(), true, "1", 2, false},
+		{"spy string", SpymemcachedCodec(), "hello", "hello", 0, ""},
+		{"spy bytes", SpymemcachedCodec(), []byte("hi"), "hi", 0x800, []byte(nil)},
+		{"spy boolean", SpymemcachedCodec(), true, "1", 0x100, false},
+		{"spy byte", SpymemcachedCodec(), int8(-1), "\xff", 0x500, int8(0)},
+		{"spy int", SpymemcachedCodec(), int32(258), "\x01\x02", 0x200, int32(0)},
+		{"spy negative int", SpymemcachedCodec(), int32(-2), "\xff\xff\xff\xfe", 0x200, int32(0)},
+		{"spy long", SpymemcachedCodec(), int64(1), "\x01", 0x300, int64(0)},
+		{"spy zero", SpymemcachedCodec(), int64(0), "", 0x300, int64(0)},
+		{"spy double", SpymemcachedCodec(), 2.0, "\x40\x00\x00\x00\x00\x00\x00\x00", 0x700, 0.0},
+		{"spy float", SpymemcachedCodec(), float32(2), "\x40\x00\x00\x00", 0x600, float32(0)},
+		{"spy date", SpymemcachedCodec(), date, "\x01\x8b\xcf\xe5\x68\x7b", 0x400, time.Time{}},
+	} {
+		value, flags, err := tt.codec.Marshal(tt.in)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		if string(value) != tt.value || flags != tt.flags {
+			t.Fatalf("%s: expected %q with flags %#x, got %q with flags %#x", tt.name, tt.value, tt.flags, value, flags)
+		}
+		out := reflect.New(reflect.TypeOf(tt.out))
+		if err := tt.codec.Unmarshal(value, flags, out.Interface()); err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		got, want := out.Elem().Interface(), reflect.ValueOf(tt.in).Convert(out.Elem().Type()).Interface()
+		if tm, ok := got.(time.Time); ok {
+			if !tm.Equal(date) {
+				t.Fatalf("%s: expected %v, got %v", tt.name, date, tm)
+			}
+		} else if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: expected %#v, got %#v", tt.name, want, got)
+		}
+	}
+
+	if _, _, err := PythonMemcacheCodec().Marshal(testUser{}); err == nil {
+		t.Fatalf("expected an error for a value python-memcache would pickle")
+	}
+	var s string
+	if err := SpymemcachedCodec().Unmarshal([]byte{0xac, 0xed}, 1, &s); err == nil {
+		t.Fatalf("expected an error for a Java-serialized value")
+	}
+}
+
+func TestForeignCodecsCompressed(t *testing.T) {
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write([]byte("compressed"))
+	zw.Close()
+
+	var got string
+	if err := PythonMemcacheCodec().Unmarshal(zbuf.Bytes(), 8|16, &got); err != nil || got != "compressed" {
+		t.Fatalf("expected compressed, got %q and %v", got, err)
+	}
+
+	php := binary.LittleEndian.AppendUint32(nil, uint32(len("compressed")))
+	php = append(php, zbuf.Bytes()...)
+	if err := PHPMemcachedCodec().Unmarshal(php, 1<<4|1<<5, &got); err != nil || got != "compressed" {
+		t.Fatalf("expected compressed, got %q and %v", got, err)
+	}
+	if err := PHPMemcachedCodec().Unmarshal(php, 1<<4|1<<6, &got); err == nil {
+		t.Fatalf("expected an error for fastlz compression")
+	}
+
+	gz, _ := GzipCompressor().Compress([]byte("compressed"))
+	if err := SpymemcachedCodec().Unmarshal(gz, 2, &got); err != nil || got != "compressed" {
+		t.Fatalf("expected compressed, got %q and %v", got, err)
+	}
+}
@@ -20,10 +20,15 @@ package gomcache
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -36,34 +41,423 @@ var (
 	ErrCASConflict  = errors.New("memcache: compare-and-swap conflict")
 	ErrMalformedKey = errors.New("malformed: key is too long or contains invalid characters")
 	ErrNoServers    = errors.New("memcache: no servers configured or available")
+	ErrClientClosed = errors.New("memcache: client is closed")
+
+	// ErrBadDataChunk is matched by errors.Is for every *BadDataChunkError.
+	ErrBadDataChunk = errors.New("memcache: bad data chunk")
+
+	// ErrProtocol is matched by errors.Is for every *ProtocolError.
+	ErrProtocol = errors.New("memcache: protocol error")
+
+	// ErrTombstone is returned by Get when the item was recently invalidated
+	// with DeleteSoft. It matches ErrCacheMiss under errors.Is, so callers
+	// that do not care about the distinction can keep treating it as a miss.
+	ErrTombstone error = tombstoneError{}
+
+	// ErrNotFound is returned by loaders passed to Fetch when the value
+	// does not exist, and by Get and Fetch when that was cached because of
+	// NegativeTTL. It matches ErrCacheMiss under errors.Is.
+	ErrNotFound error = notFoundError{}
 )
 
+type tombstoneError struct{}
+
+func (tombstoneError) Error() string        { return "memcache: item was recently deleted" }
+func (tombstoneError) Is(target error) bool { return target == ErrCacheMiss }
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string        { return "memcache: item not found" }
+func (notFoundError) Is(target error) bool { return target == ErrCacheMiss }
+
+// BadDataChunkError is returned when the server answers a store with
+// "CLIENT_ERROR bad data chunk", meaning the data block it read did not
+// match the length declared on the command line. The server then treats
+// the rest of the value as new commands, so the connection is discarded.
+type BadDataChunkError struct {
+	Key  string
+	Size int // declared value length
+}
+
+func (e *BadDataChunkError) Error() string {
+	return fmt.Sprintf("memcache: bad data chunk storing %q (%d bytes): the server read a value that did not match "+
+		"its declared length and the connection was discarded; check that the value was not modified after the "+
+		"request was built, that the connection is not shared by concurrent writers, and that no proxy rewrites "+
+		"line endings in the payload", e.Key, e.Size)
+}
+
+func (e *BadDataChunkError) Unwrap() error { return ErrBadDataChunk }
+
+// ProtocolError reports a response the client could not make sense of.
+// The connection it arrived on is discarded.
+type ProtocolError struct {
+	Reason   string
+	Response string // the offending response, if any
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Response == "" {
+		return "memcache: " + e.Reason
+	}
+	return fmt.Sprintf("memcache: %s: %q", e.Reason, e.Response)
+}
+
+func (e *ProtocolError) Unwrap() error { return ErrProtocol }
+
+// unexpectedResponse returns the error for a response line that does not
+// belong to the request.
+func unexpectedResponse(line []byte) error {
+	return &ProtocolError{Reason: "unexpected response", Response: string(bytes.TrimSpace(line))}
+}
+
+// OpError describes an operation that failed on a server: it could not be
+// reached, timed out, broke the protocol or reported an error. It wraps the
+// underlying error, so errors.Is and errors.As see through it, for instance
+// to ErrServerError, ErrProtocol or a net.Error. Cache results such as
+// ErrCacheMiss, as well as ErrClientClosed, ErrPoolExhausted and context
+// errors, are returned as they are.
+type OpError struct {
+	Op   string   // operation, such as "get" or "set"
+	Addr net.Addr // server the operation was sent to
+	Key  string   // key as sent to the server, empty for batch operations
+	Err  error
+}
+
+func (e *OpError) Error() string {
+	s := "memcache: " + e.Op
+	if e.Key != "" {
+		s += " " + strconv.Quote(e.Key)
+	}
+	return s + " on " + e.Addr.String() + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error { return e.Err }
+
+// opError wraps err, returned by addr for an operation of cl on key, in an
+// *OpError, unless it is nil, a cache result or a state of the client or
+// the call rather than of the server.
+func (cl *call) opError(addr net.Addr, key string, err error) error {
+	var oe *OpError
+	switch {
+	case err == nil, resumableError(err), errors.Is(err, ErrCacheMiss), errors.As(err, &oe):
+		return err
+	case err == ErrClientClosed, err == ErrPoolExhausted, err == context.Canceled, err == context.DeadlineExceeded:
+		return err
+	}
+	return &OpError{Op: cl.op, Addr: addr, Key: key, Err: err}
+}
+
+// errorResponse returns the error reported by a CLIENT_ERROR or SERVER_ERROR
+// response line, or nil if line is neither.
+func errorResponse(line []byte) error {
+	msg := string(bytes.TrimSpace(line))
+	switch {
+	case msg == "CLIENT_ERROR bad data chunk":
+		return ErrBadDataChunk
+	case strings.HasPrefix(msg, "CLIENT_ERROR "), strings.HasPrefix(msg, "SERVER_ERROR "):
+		return fmt.Errorf("%w: %s", ErrServerError, msg)
+	}
+	return nil
+}
+
 const (
 	// DefaultTimeout is the default socket read/write timeout.
 	DefaultTimeout = 500 * time.Millisecond
 
+	// DefaultKeepAlive is the default interval between TCP keep-alive
+	// probes.
+	DefaultKeepAlive = 15 * time.Second
+
 	// DefaultMaxIdleConns is the default maximum number of idle connections
 	// kept for any single address.
 	DefaultMaxIdleConns = 2
+
+	// DefaultMaxBatchKeys is the default maximum number of keys sent in a
+	// single get command by GetMulti.
+	DefaultMaxBatchKeys = 100
+
+	// DefaultMaxBatchLineLength is the default maximum length in bytes of a
+	// single get command line sent by GetMulti.
+	DefaultMaxBatchLineLength = 8192
+
+	// FlagTombstone marks an item written by DeleteSoft, or by Fetch for a
+	// value not found. Flag bits from
+	// 1<<16 upwards are reserved for use by this package: codecs use bits
+	// 16 to 19, compression bits 20 to 22, chunking bit 23, encryption
+	// bits 24 to 27 and Fetch bit 28.
+	FlagTombstone uint32 = 1 << 31
 )
 
+// pipelineWriteThreshold is the request size above which roundTrip writes
+// concurrently with reading the response.
+const pipelineWriteThreshold = 64 << 10
+
 var (
-	crlf           = []byte("\r\n")
-	resultStored   = []byte("STORED\r\n")
-	resultNotFound = []byte("NOT_FOUND\r\n")
-	resultDeleted  = []byte("DELETED\r\n")
-	resultEnd      = []byte("END\r\n")
-	versionPrefix  = []byte("VERSION")
+	crlf            = []byte("\r\n")
+	resultStored    = []byte("STORED\r\n")
+	resultNotStored = []byte("NOT_STORED\r\n")
+	resultExists    = []byte("EXISTS\r\n")
+	resultNotFound  = []byte("NOT_FOUND\r\n")
+	resultDeleted   = []byte("DELETED\r\n")
+	resultEnd       = []byte("END\r\n")
+	resultOK        = []byte("OK\r\n")
+	versionPrefix   = []byte("VERSION")
+
+	// tombstoneValue is the placeholder value stored by DeleteSoft.
+	tombstoneValue = []byte("\x00tombstone")
+
+	// notFoundValue is the placeholder value stored by Fetch for values
+	// its loader did not find.
+	notFoundValue = []byte("\x00notfound")
 )
 
-// Client represents a Memcached client.
+// Client represents a Memcached client. It is safe for concurrent use by
+// multiple goroutines: operations only share the connection pool, so calls
+// to different servers never wait on each other. Exported fields must not be
+// changed once the client is in use.
 type Client struct {
 	selector ServerSelector
 	UseUDP   bool
 
 	// Timeout specifies the socket read/write timeout. If zero, DefaultTimeout is used.
 	Timeout time.Duration
-	mu      sync.Mutex
+
+	// MaxBatchKeys caps the number of keys GetMulti sends in a single get
+	// command; larger batches are split into several commands pipelined on
+	// the same connection. If zero, DefaultMaxBatchKeys is used.
+	MaxBatchKeys int
+
+	// MaxBatchLineLength caps the length in bytes of a single get command
+	// line sent by GetMulti, since very long lines can hit server limits. If
+	// zero, DefaultMaxBatchLineLength is used.
+	MaxBatchLineLength int
+
+	// MultiGetPolicy decides what GetMulti returns when some servers fail.
+	// The zero value is MultiGetPartial.
+	MultiGetPolicy MultiGetPolicy
+
+	// MaxIdleConns specifies the maximum number of idle connections that
+	// will be maintained per address and protocol family. If zero,
+	// DefaultMaxIdleConns is used.
+	MaxIdleConns int
+
+	// MaxOpenConns caps the number of open connections per address and
+	// protocol family (text and meta, or binary). When
+	// the limit is reached operations wait up to PoolTimeout for a
+	// connection to be released and then fail with ErrPoolExhausted. If
+	// zero, the number of connections is not limited.
+	MaxOpenConns int
+
+	// PoolTimeout is how long an operation waits for a connection when
+	// MaxOpenConns is reached. The wait also counts against Timeout, so
+	// only a shorter PoolTimeout has an effect. If zero, Timeout is used.
+	PoolTimeout time.Duration
+
+	// MaxConnIdleTime closes pooled connections that have been idle for
+	// longer than this. If zero, idle connections are kept indefinitely.
+	MaxConnIdleTime time.Duration
+
+	// MaxConnLifetime closes connections once they have been open for longer
+	// than this. If zero, connections are not closed due to age.
+	MaxConnLifetime time.Duration
+
+	// DrainTimeout bounds how long operations in flight on connections to
+	// a server removed from the selector may take to finish. Idle
+	// connections to the server are closed at once and the others as soon
+	// as their operation ends; those still in use after DrainTimeout are
+	// closed, failing their operation. If zero, operations are left to
+	// finish or time out.
+	DrainTimeout time.Duration
+
+	// TLSConfig, if not nil, enables TLS on stream connections.
+	TLSConfig *tls.Config
+
+	// Credentials, if not nil, are used to authenticate new connections.
+	Credentials *Credentials
+
+	// HandshakeTimeout bounds TLS negotiation and authentication on a new
+	// connection, separately from the operation's Timeout. If zero,
+	// DefaultHandshakeTimeout is used.
+	HandshakeTimeout time.Duration
+
+	// DialContext, if not nil, is used to open connections to servers
+	// instead of net.Dialer, for example to go through a proxy or to wrap
+	// connections for instrumentation. network is "tcp", "unix" or "udp".
+	// The context carries the dial deadline derived from Timeout.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// KeepAlive is the interval between TCP keep-alive probes on stream
+	// connections, which keeps idle pooled connections from being dropped
+	// by NAT devices and firewalls. If zero, DefaultKeepAlive is used; if
+	// negative, keep-alives are disabled.
+	KeepAlive time.Duration
+
+	// DisableNoDelay enables Nagle's algorithm on TCP connections. By
+	// default TCP_NODELAY is set so small requests are sent immediately.
+	DisableNoDelay bool
+
+	// ReadBufferSize and WriteBufferSize set the socket receive and send
+	// buffer sizes of TCP connections. If zero, the system defaults are
+	// kept.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// Conformance, if set, declares the kind of server or proxy behind
+	// the selector. Operations needing a command, protocol or transport it
+	// does not support fail with a *ConformanceError before anything is
+	// sent, instead of producing confusing errors from the proxy.
+	Conformance Target
+
+	// BestEffort makes the cache strictly optional for the application:
+	// network and server errors of Get are returned as ErrCacheMiss, those
+	// of GetMulti drop the affected keys, and those of Set and Delete are
+	// swallowed. Hidden errors are counted by SuppressedErrors and passed
+	// to OnSuppressedError.
+	BestEffort bool
+
+	// OnSuppressedError, if not nil, is called with every error hidden by
+	// BestEffort and the operation that failed. It must not block.
+	OnSuppressedError func(op string, err error)
+
+	// KeyTransformers rewrite every key, in order, before it is used to
+	// select a server, for example to add a namespace prefix or shorten
+	// long keys. Items returned to the caller carry the original keys.
+	KeyTransformers []KeyTransformer
+
+	// Codec encodes the values of SetValue and decodes those of GetValue.
+	// If nil, JSONCodec is used.
+	Codec Codec
+
+	// Compressor, if not nil, compresses the values written by Set that
+	// are at least CompressThreshold bytes long, when that makes them
+	// smaller, and marks them with its flag. Values marked by it, or by
+	// GzipCompressor, are decompressed by Get and GetMulti whatever the
+	// setting; GetMulti leaves out those it fails to decompress.
+	Compressor Compressor
+
+	// CompressThreshold is the size from which values are compressed. If
+	// zero, DefaultCompressThreshold is used.
+	CompressThreshold int
+
+	// ChunkSize, if positive, stores values longer than ChunkSize bytes,
+	// which memcached would reject above its item size limit, in chunks of
+	// ChunkSize bytes under derived keys, with a manifest under the key of
+	// the item. Get and GetMulti reassemble them, whatever the setting, and
+	// Delete deletes the chunks as well. The derived keys are the key
+	// followed by about 15 bytes, which must keep them valid. Chunks of a
+	// value overwritten are left to expire.
+	ChunkSize int
+
+	// StaleWhileRevalidate, if positive, keeps the values stored by Fetch
+	// cached for this long past their expiration, which is kept in the
+	// value. Fetch returns such stale values at once while refreshing them
+	// in the background.
+	StaleWhileRevalidate time.Duration
+
+	// NegativeTTL, if positive, makes Fetch cache for this long that its
+	// loader returned ErrNotFound, so that looking up values that do not
+	// exist does not call the loader every time.
+	NegativeTTL time.Duration
+
+	// EarlyRefreshBeta, if positive, makes Fetch refresh values in the
+	// background before they expire, at random, following the XFetch
+	// algorithm: the slower a value was to load and the larger the beta,
+	// the earlier it tends to be refreshed. 1 is a good default.
+	EarlyRefreshBeta float64
+
+	// ExpirationJitter, if positive, spreads the relative expirations of
+	// the items written by Set randomly by up to this fraction of them
+	// either way, 0.1 for ±10%, so that keys filled together do not all
+	// expire, and have to be recomputed, together.
+	ExpirationJitter float64
+
+	// Local, if not nil, is an in-process cache consulted by Get and
+	// GetMulti before the servers and invalidated by Set and Delete.
+	Local *LocalCache
+
+	// Encryption, if not nil, encrypts the values written by Set, after
+	// compressing them, and decrypts encrypted values read by Get and
+	// GetMulti. Values stored in plaintext are still read as is.
+	Encryption *Encryption
+
+	// CoalesceWindow, if positive, delays every Set by up to this long and
+	// collapses further Sets of the same key issued meanwhile into a single
+	// write of the latest value, which suits keys rewritten at a high rate
+	// such as presence or progress. All the collapsed Sets return the result
+	// of that write. A Delete discards the pending write of its key. Gets
+	// issued within the window may still see the previous value.
+	CoalesceWindow time.Duration
+
+	// Retry, if not nil, retries idempotent operations that fail with a
+	// transient error.
+	Retry *RetryPolicy
+
+	// HedgeDelay, if positive, sends a second Get to another replica, or
+	// to the next server of a FailoverSelector, when the first server has
+	// not answered within this delay. The first hit wins; a miss or error
+	// is only returned once both have answered.
+	HedgeDelay time.Duration
+
+	// Zone is the availability zone the client runs in. With a selector
+	// that is both a ReplicaSelector and a ZoneSelector, reads go to a
+	// replica in this zone when there is one, and Get falls back to a
+	// replica in another zone if that read fails, cutting cross-zone
+	// latency and traffic.
+	Zone string
+
+	// NodeFailurePolicy decides what operations do when their server cannot
+	// be reached. With NodeFailureRehash, GetMulti treats keys left without
+	// a reachable server as misses.
+	NodeFailurePolicy NodeFailurePolicy
+
+	// Breaker, if not nil, fails requests to a server fast after repeated
+	// network failures instead of letting each one wait for a timeout.
+	Breaker *CircuitBreaker
+
+	// TimeoutHistogram, if not nil, records how much of its deadline every
+	// operation consumed, to help tune Timeout.
+	TimeoutHistogram *TimeoutHistogram
+
+	// ValueSizes, if not nil, records the sizes of the values stored and
+	// fetched and alerts when they approach the server item size limit.
+	ValueSizes *SizeHistogram
+
+	// Journal, if not nil, records the key of every successful Set so a
+	// restarted process can re-warm its most recently written keys.
+	// Journaling is best effort and never fails a Set.
+	Journal *Journal
+
+	// Metrics, if not nil, receives the op name, server, duration and
+	// outcome of every operation. Clients created by Child share it.
+	Metrics MetricsRecorder
+
+	// Tracer, if not nil, traces every operation. Clients created by Child
+	// share it.
+	Tracer Tracer
+
+	// SlowOpThreshold, if positive, is the duration past which operations
+	// are reported to OnSlowOp, to help track down tail latency.
+	SlowOpThreshold time.Duration
+
+	// OnSlowOp, if not nil, is called with the metrics of every operation
+	// that took SlowOpThreshold or longer. If nil, they are logged with
+	// the log package. It must not block.
+	OnSlowOp func(OpMetrics)
+
+	// pool holds idle connections per server.
+	pool *connPool
+
+	// servers holds per-server overrides.
+	servers *serverSettings
+
+	// coalescer holds Sets waiting for CoalesceWindow to end.
+	coalescer  *coalescer
+	fetches    *fetchGroup // loaders running for Fetch
+	suppressed *suppressedErrors
+	counters   *opCounters
+	latencies  *serverLatencies
+	middleware []func(next OpFunc) OpFunc // added by Use
+	name       string                     // set by Child
 }
 
 // Item represents a Memcached item.
@@ -72,6 +466,8 @@ type Item struct {
 	Value      []byte
 	Flags      uint32
 	Expiration int32
+
+	casID uint64 // read by gets, checked by the cas verb
 }
 
 // NewClient creates a new Client with the specified servers and UDP mode.
@@ -94,212 +490,901 @@ func (c *Client) SelectServer(key string) (string, error) {
 	return addr.String(), nil
 }
 
-// connect establishes a TCP connection to the selected Memcached server.
-func (c *Client) connect(key string) (net.Conn, error) {
-	addr, err := c.SelectServer(key)
-	if err != nil {
-		return nil, err
+// aLongTimeAgo is a non-zero time in the past, used to interrupt blocked I/O
+// by expiring its deadline.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// netTimeout returns the socket read/write timeout in effect.
+func (c *Client) netTimeout() time.Duration {
+	if c.Timeout != 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+// opDeadlineKey is the context key of the deadline fixed by withDeadline.
+type opDeadlineKey struct{}
+
+// withDeadline fixes the deadline of an operation attempt, so that waiting
+// for a pooled connection, dialing and the request itself all share one
+// budget instead of each getting Timeout of its own.
+func (c *Client) withDeadline(ctx context.Context) context.Context {
+	return context.WithValue(ctx, opDeadlineKey{}, c.deadline(ctx))
+}
+
+// deadline returns the deadline of the current operation: the one fixed by
+// withDeadline if any, and otherwise Timeout from now or the deadline of ctx
+// if that is earlier.
+func (c *Client) deadline(ctx context.Context) time.Time {
+	if d, ok := ctx.Value(opDeadlineKey{}).(time.Time); ok {
+		return d
+	}
+	d := time.Now().Add(c.netTimeout())
+	if cd, ok := ctx.Deadline(); ok && cd.Before(d) {
+		return cd
 	}
-	conn, err := net.DialTimeout("tcp", addr, c.Timeout)
+	return d
+}
+
+// connect establishes a stream connection to the Memcached server at addr
+// for requests in protocol p and performs the TLS and authentication
+// handshake, if configured.
+func (c *Client) connect(ctx context.Context, addr net.Addr, p Protocol) (net.Conn, error) {
+	if c.pool.isClosed() {
+		return nil, ErrClientClosed
+	}
+	network := "tcp"
+	if addr.Network() == "unix" {
+		network = "unix"
+	}
+	nc, err := c.dial(ctx, network, addr.String())
 	if err != nil {
+		return nil, connectTimeout(addr, err)
+	}
+	if err := c.setSocketOptions(nc); err != nil {
+		nc.Close()
 		return nil, err
 	}
 
-	err = conn.SetDeadline(time.Now().Add(c.Timeout))
+	conn, err := c.handshake(nc, addr, p)
 	if err != nil {
-		return nil, err
+		nc.Close()
+		return nil, connectTimeout(addr, err)
 	}
 
 	return conn, nil
 }
 
-// connectUDP establishes a UDP connection to the selected Memcached server.
-func (c *Client) connectUDP(key string) (*net.UDPConn, error) {
-	addr, err := c.SelectServer(key)
-	if err != nil {
-		return nil, err
+// dial opens a connection with DialContext, or net.Dialer if it is nil,
+// within the operation deadline.
+func (c *Client) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithDeadline(ctx, c.deadline(ctx))
+	defer cancel()
+
+	if c.DialContext != nil {
+		return c.DialContext(ctx, network, addr)
 	}
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
-	if err != nil {
-		return nil, err
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+// setSocketOptions applies the keep-alive, TCP_NODELAY and buffer settings
+// to nc. Connections that are not TCP, such as those wrapped by a custom
+// DialContext, are left alone.
+func (c *Client) setSocketOptions(nc net.Conn) error {
+	tc, ok := nc.(*net.TCPConn)
+	if !ok {
+		return nil
 	}
-	conn, err := net.DialUDP("udp", nil, udpAddr)
+
+	if c.KeepAlive < 0 {
+		if err := tc.SetKeepAlive(false); err != nil {
+			return err
+		}
+	} else {
+		period := c.KeepAlive
+		if period == 0 {
+			period = DefaultKeepAlive
+		}
+		if err := tc.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tc.SetKeepAlivePeriod(period); err != nil {
+			return err
+		}
+	}
+	if err := tc.SetNoDelay(!c.DisableNoDelay); err != nil {
+		return err
+	}
+	if c.ReadBufferSize > 0 {
+		if err := tc.SetReadBuffer(c.ReadBufferSize); err != nil {
+			return err
+		}
+	}
+	if c.WriteBufferSize > 0 {
+		if err := tc.SetWriteBuffer(c.WriteBufferSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectUDP establishes a UDP connection to the Memcached server at addr.
+func (c *Client) connectUDP(ctx context.Context, addr net.Addr) (net.Conn, error) {
+	if c.pool.isClosed() {
+		return nil, ErrClientClosed
+	}
+	conn, err := c.dial(ctx, "udp", addr.String())
 	if err != nil {
-		return nil, err
+		return nil, connectTimeout(addr, err)
 	}
 
 	// Set the read and write deadline based on the timeout
-	err = conn.SetDeadline(time.Now().Add(c.Timeout))
+	err = conn.SetDeadline(c.deadline(ctx))
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
 	return conn, nil
 }
 
-// Set adds or updates an item in the Memcached server using TCP.
-func (c *Client) Set(item *Item) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// Establish a TCP connection to the server
-	conn, err := c.connect(item.Key)
-	if err != nil {
+// roundTrip sends req, written in protocol p, to addr and hands the
+// response to parse. The request goes over UDP when udp is set and over a
+// pooled stream connection otherwise. The deadline of ctx bounds the
+// whole exchange; hitting it fails with a ConnectTimeoutError or an
+// OpTimeoutError.
+func (c *Client) roundTrip(ctx context.Context, addr net.Addr, p Protocol, udp bool, req []byte, parse func(*bufio.Reader) error) (err error) {
+	if err := c.Breaker.allow(addr); err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer func() { c.Breaker.record(addr, err) }()
+	defer func() { err = opTimeout(addr, err) }()
+	defer func() {
+		// The socket deadline may expire before the context notices its
+		// own; either way the caller gave up.
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else if d, ok := ctx.Deadline(); ok && isTimeout(err) && !time.Now().Before(d) {
+			err = context.DeadlineExceeded
+		}
+	}()
+
+	ctx = c.withDeadline(ctx)
+	if udp {
+		conn, err := c.connectUDP(ctx, addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		stop := context.AfterFunc(ctx, func() { conn.SetDeadline(aLongTimeAgo) })
+		defer stop()
+
+		start := time.Now()
+		resp, err := roundTripUDP(conn, req)
+		c.latencies.observe(addr, time.Since(start))
+		c.counters.bytesOut.Add(uint64(len(req)))
+		c.counters.bytesIn.Add(uint64(len(resp)))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		return parse(bufio.NewReader(bytes.NewReader(resp)))
+	}
 
-	// Create and send the 'set' command
-	req := fmt.Sprintf("set %s %d %d %d\r\n%s\r\n", item.Key, item.Flags, item.Expiration, len(item.Value), string(item.Value))
-	_, err = conn.Write([]byte(req))
+	cn, err := c.getConn(ctx, addr, p)
 	if err != nil {
 		return err
 	}
+	defer cn.condRelease(&err)
+	c.counters.bytesOut.Add(uint64(len(req)))
+	start, read := time.Now(), cn.read.n
+	defer func() {
+		c.counters.bytesIn.Add(cn.read.n - read)
+		c.latencies.observe(addr, time.Since(start))
+	}()
 
-	// Read the response
-	resp, err := bufio.NewReader(conn).ReadBytes('\n')
-	if err != nil {
-		return ErrServerError
+	// Cancellation interrupts blocked I/O by expiring the deadline. The
+	// connection goes back to the pool only once that cannot happen anymore.
+	if ctx.Done() != nil {
+		interrupted := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			cn.nc.SetDeadline(aLongTimeAgo)
+			close(interrupted)
+		})
+		defer func() {
+			if !stop() {
+				<-interrupted
+				if err != nil {
+					err = ctx.Err()
+				}
+			}
+		}()
 	}
 
-	// Compare the response with predefined byte slices
-	switch {
-	case bytes.Equal(resp, resultStored):
-		return nil
-	case bytes.Equal(resp, resultNotFound):
-		return ErrCacheMiss
-	default:
-		return fmt.Errorf("unexpected response: %s", resp)
+	if len(req) <= pipelineWriteThreshold {
+		if _, err = cn.rw.Write(req); err != nil {
+			return err
+		}
+		if err = cn.rw.Flush(); err != nil {
+			return err
+		}
+		return parse(cn.rw.Reader)
+	}
+
+	// Write large pipelined requests concurrently with reading the
+	// responses, so we cannot deadlock against a server blocked on writing
+	// responses we have not read yet.
+	errc := make(chan error, 1)
+	go func() {
+		_, err := cn.nc.Write(req)
+		errc <- err
+	}()
+	err = parse(cn.rw.Reader)
+	if err != nil && !resumableError(err) {
+		// Unblock the writer; condRelease closes the connection for good.
+		cn.nc.Close()
 	}
+	if werr := <-errc; werr != nil && err == nil {
+		err = werr
+	}
+	return err
+}
+
+// Set adds or updates an item in the Memcached server, using UDP when
+// enabled for the server and TCP otherwise.
+func (c *Client) Set(item *Item, opts ...CallOption) error {
+	return c.SetContext(context.Background(), item, opts...)
+}
+
+// SetContext is like Set, but gives up when ctx is done.
+func (c *Client) SetContext(ctx context.Context, item *Item, opts ...CallOption) error {
+	return c.intercept(ctx, &Operation{Name: "set", Key: item.Key, Item: item}, func(ctx context.Context, op *Operation) error {
+		item := op.Item
+		if op.Key != item.Key {
+			it := *item
+			it.Key = op.Key
+			item = &it
+		}
+		return c.setItem(ctx, item, opts)
+	})
 }
 
-// Get retrieves an item from the Memcached server using UDP.
-func (c *Client) Get(key string) (*Item, error) {
-	if !c.UseUDP {
-		return nil, fmt.Errorf("UDP mode is not enabled")
+// setItem is SetContext without the middleware.
+func (c *Client) setItem(ctx context.Context, item *Item, opts []CallOption) error {
+	item = c.jitterItem(item, opts)
+	if c.ChunkSize > 0 && len(item.Value) > c.ChunkSize {
+		return c.setChunked(ctx, item, bytes.NewReader(item.Value), int64(len(item.Value)), c.ChunkSize, opts)
+	}
+	if c.CoalesceWindow > 0 {
+		return c.coalesceSet(ctx, item, opts)
 	}
+	return c.set(ctx, item, opts)
+}
+
+// set writes item right away.
+func (c *Client) set(ctx context.Context, item *Item, opts []CallOption) error {
+	return c.store(ctx, "set", item, opts)
+}
+
+// store writes item right away with the given storage verb.
+func (c *Client) store(ctx context.Context, verb string, item *Item, opts []CallOption) error {
+	return c.run(ctx, &Operation{Name: verb, Key: item.Key, Item: item}, opts, func(cl *call, op *Operation) (err error) {
+		item := op.item()
+		defer c.Local.remove(item.Key)
+
+		key, err := c.transformKey(item.Key)
+		if err != nil {
+			return err
+		}
+		c.ValueSizes.observe(item.Key, len(item.Value))
+		addrs, err := c.routeWrite(cl, key)
+		if err != nil {
+			return err
+		}
+
+		it, err := c.encodeItem(item.Key, *item)
+		if err != nil {
+			return err
+		}
+		it.Key = key
+		err = c.writeReplicas(cl, addrs, func(cl *call, addr net.Addr) error {
+			return c.withRetry(cl, func(n int, prev error) error {
+				addr = c.failover(cl, key, addr, n, prev)
+				sp, err := c.callProtocol(cl, addr)
+				if err != nil {
+					return err
+				}
+				err = c.roundTrip(cl.ctx, addr, sp.Protocol, c.useUDP(addr, sp), sp.Protocol.appendStore(nil, verb, &it), sp.Protocol.parseStore)
+				if err == ErrBadDataChunk {
+					err = &BadDataChunkError{Key: item.Key, Size: len(item.Value)}
+				}
+				return cl.opError(addr, key, err)
+			})
+		})
+		if err == nil && c.Journal != nil {
+			c.Journal.Record(item.Key)
+		}
+		return err
+	})
+}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Get retrieves an item from the Memcached server, using UDP when enabled
+// for the server and TCP otherwise.
+func (c *Client) Get(key string, opts ...CallOption) (*Item, error) {
+	return c.GetContext(context.Background(), key, opts...)
+}
 
-	conn, err := c.connectUDP(key)
+// GetContext is like Get, but gives up when ctx is done.
+func (c *Client) GetContext(ctx context.Context, key string, opts ...CallOption) (item *Item, err error) {
+	err = c.intercept(ctx, &Operation{Name: "get", Key: key}, func(ctx context.Context, op *Operation) error {
+		item, err = c.get(ctx, op.Key, opts)
+		return err
+	})
+	if item == nil && err == nil {
+		err = ErrCacheMiss // a middleware skipped the get
+	}
+	return item, err
+}
+
+// get is GetContext for callers within the package.
+func (c *Client) get(ctx context.Context, key string, opts []CallOption) (item *Item, err error) {
+	err = c.run(ctx, &Operation{Name: "get", Key: key}, opts, func(cl *call, op *Operation) (err error) {
+		it, ok := c.Local.get(op.Key)
+		if !ok || cl.opts.rawChunks {
+			if it, err = c.getRemote(cl, op.Key, opts); err != nil {
+				return err
+			}
+		}
+		if it.Flags&(FlagEnvelope|FlagChunked) == FlagEnvelope && !cl.opts.rawEnvelope {
+			if _, err := openEnvelope(it); err != nil {
+				return err
+			}
+		}
+		item = it
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-
-	// Create the request frame header
-	frameHeader := make([]byte, 8)
-	binary.BigEndian.PutUint16(frameHeader[0:2], 0) // Request ID
-	binary.BigEndian.PutUint16(frameHeader[2:4], 0) // Sequence number
-	binary.BigEndian.PutUint16(frameHeader[4:6], 1) // Total number of datagrams
-	binary.BigEndian.PutUint16(frameHeader[6:8], 0) // Reserved
+	if item == nil {
+		return nil, ErrCacheMiss // a middleware skipped the get
+	}
+	return item, nil
+}
 
-	// Prepare the Get command
-	getCommand := append(frameHeader, []byte("get "+key)...)
+// getRemote fetches key from the servers for cl, keeping it in the Local
+// cache.
+func (c *Client) getRemote(cl *call, key string, opts []CallOption) (*Item, error) {
+	gen := c.Local.generation()
+	tkey, err := c.transformKey(key)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := c.routeRead(cl, tkey)
+	if err != nil {
+		return nil, err
+	}
 
-	// Send the Get command
-	_, err = conn.Write(append(getCommand, crlf...))
+	var item *Item
+	if backup := c.hedgeAddr(cl, tkey, addr); backup != nil {
+		item, err = c.hedgedGet(cl, tkey, addr, backup)
+	} else {
+		item, err = c.getFrom(cl, tkey, addr)
+	}
+	item, err = c.getFallback(cl, tkey, addr, item, err)
 	if err != nil {
-		return nil, fmt.Errorf("error writing to UDP: %v", err)
+		return nil, err
+	}
+	if item, err = c.resolveItem(cl, key, item, opts); err != nil {
+		return nil, err
 	}
+	if item.Flags&FlagChunked != 0 {
+		return item, nil
+	}
+	c.ValueSizes.observe(key, len(item.Value))
+	c.Local.add(item, gen)
+	return item, nil
+}
 
-	// Read the response
-	buffer := make([]byte, 90000) // Buffer size for UDP
-	var responseBuffer bytes.Buffer
-	for {
-		n, err := conn.Read(buffer)
+// resolveItem turns item, the answer of a server to a get of key, into the
+// item Get returns: it maps misses, tombstones and cached not-found answers
+// to errors, decodes the value and reassembles chunked values. Chunked
+// values are left as they are with withRawChunks.
+func (c *Client) resolveItem(cl *call, key string, item *Item, opts []CallOption) (*Item, error) {
+	if item == nil {
+		return nil, ErrCacheMiss
+	}
+	if isTombstone(item) {
+		return nil, ErrTombstone
+	}
+	if isNotFound(item) {
+		return nil, ErrNotFound
+	}
+	item.Key = key
+	if err := c.decodeItem(item); err != nil {
+		return nil, err
+	}
+	if item.Flags&FlagChunked != 0 && !cl.opts.rawChunks {
+		return c.getChunked(cl.ctx, item, opts)
+	}
+	return item, nil
+}
+
+// getFrom fetches the transformed key from addr, returning a nil item on a
+// miss.
+func (c *Client) getFrom(cl *call, key string, addr net.Addr) (item *Item, err error) {
+	err = c.withRetry(cl, func(n int, prev error) error {
+		addr = c.failover(cl, key, addr, n, prev)
+		sp, err := c.callProtocol(cl, addr)
 		if err != nil {
-			return nil, fmt.Errorf("error reading from UDP: %v", err)
+			return err
 		}
+		item = nil
+		return cl.opError(addr, key, c.roundTrip(cl.ctx, addr, sp.Protocol, c.useUDP(addr, sp), sp.Protocol.appendGet(nil, []string{key}), func(r *bufio.Reader) error {
+			return sp.Protocol.parseGet(r, func(it *Item) {
+				item = it
+			})
+		}))
+	})
+	return item, err
+}
 
-		// Append the data to the response buffer
-		responseBuffer.Write(buffer[8:n])
+// MultiGetPolicy is the behavior of GetMulti when some servers fail.
+type MultiGetPolicy int
 
-		// Check for the end of the response
-		if bytes.Contains(responseBuffer.Bytes(), resultEnd) {
-			break
-		}
+const (
+	// MultiGetPartial returns the items fetched from the servers that
+	// answered together with a MultiError describing the ones that failed.
+	MultiGetPartial MultiGetPolicy = iota
+
+	// MultiGetFailFast returns no items and a MultiError if any server
+	// failed.
+	MultiGetFailFast
+
+	// MultiGetMissOnError treats the keys of failed servers as cache misses
+	// and returns no error, for callers that fall back to the backing store
+	// anyway.
+	MultiGetMissOnError
+)
+
+// MultiError reports the servers that failed during a batch operation,
+// keyed by address.
+type MultiError map[string]error
+
+func (m MultiError) Error() string {
+	addrs := make([]string, 0, len(m))
+	for addr := range m {
+		addrs = append(addrs, addr)
 	}
+	sort.Strings(addrs)
 
-	// Parse the response
-	rawResponse := responseBuffer.Bytes()
-	if bytes.HasPrefix(rawResponse, []byte("VALUE")) {
-		lines := bytes.Split(rawResponse, crlf)
-		if len(lines) >= 2 {
-			value := lines[1] // Extract the value part
-			return &Item{
-				Key:   key,
-				Value: value,
-			}, nil
+	var b strings.Builder
+	fmt.Fprintf(&b, "memcache: %d server(s) failed", len(m))
+	for i, addr := range addrs {
+		sep := "; "
+		if i == 0 {
+			sep = ": "
 		}
-	} else if bytes.HasPrefix(rawResponse, resultNotFound) {
-		return nil, ErrCacheMiss
+		fmt.Fprintf(&b, "%s%s: %v", sep, addr, m[addr])
 	}
+	return b.String()
+}
 
-	return nil, fmt.Errorf("unexpected response: %s", rawResponse)
+// Unwrap returns the individual server errors, so errors.Is and errors.As
+// match any of them.
+func (m MultiError) Unwrap() []error {
+	errs := make([]error, 0, len(m))
+	for _, err := range m {
+		errs = append(errs, err)
+	}
+	return errs
 }
 
-// Delete removes an item from the Memcached server using TCP.
-func (c *Client) Delete(key string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// GetMulti is a batch version of Get. The returned map from keys to items may
+// have fewer elements than the input slice, due to cache misses. Keys are
+// grouped by server and each server is queried concurrently; batches larger
+// than MaxBatchKeys or MaxBatchLineLength are split into several pipelined
+// commands. Server failures are handled according to MultiGetPolicy.
+func (c *Client) GetMulti(keys []string, opts ...CallOption) (map[string]*Item, error) {
+	return c.GetMultiContext(context.Background(), keys, opts...)
+}
 
-	conn, err := c.connect(key)
-	if err != nil {
+// GetMultiContext is like GetMulti, but gives up when ctx is done.
+func (c *Client) GetMultiContext(ctx context.Context, keys []string, opts ...CallOption) (items map[string]*Item, err error) {
+	err = c.intercept(ctx, &Operation{Name: "get_multi", Keys: keys}, func(ctx context.Context, op *Operation) error {
+		items, err = c.getMultiWithLocal(ctx, op.Keys, opts)
 		return err
+	})
+	if items == nil && err == nil {
+		items = make(map[string]*Item) // a middleware skipped the get
+	}
+	return items, err
+}
+
+// getMultiWithLocal is GetMultiContext without the middleware.
+func (c *Client) getMultiWithLocal(ctx context.Context, keys []string, opts []CallOption) (map[string]*Item, error) {
+	gen := c.Local.generation()
+	var local map[string]*Item
+	if c.Local != nil {
+		local = make(map[string]*Item)
+		missing := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if it, ok := c.Local.get(key); ok {
+				local[key] = it
+			} else {
+				missing = append(missing, key)
+			}
+		}
+		keys = missing
 	}
-	defer conn.Close()
 
-	req := fmt.Sprintf("delete %s\r\n", key)
-	_, err = conn.Write([]byte(req))
+	var m map[string]*Item
+	var err error
+	if len(keys) > 0 || local == nil {
+		m, err = c.getMulti(ctx, keys, opts)
+		c.getChunkedMulti(ctx, m, opts)
+		for _, it := range m {
+			c.Local.add(it, gen)
+		}
+	}
+	if m == nil {
+		if err != nil {
+			return nil, err
+		}
+		m = make(map[string]*Item, len(local))
+	}
+	for key, it := range local {
+		m[key] = it
+	}
+	openEnvelopes(m)
+	return m, err
+}
+
+// getMulti fetches keys, leaving chunked values as their manifests.
+func (c *Client) getMulti(ctx context.Context, keys []string, opts []CallOption) (m map[string]*Item, err error) {
+	err = c.run(ctx, &Operation{Name: "get_multi", Keys: keys}, opts, func(cl *call, op *Operation) error {
+		keyMap := make(map[net.Addr][]string)
+		original := make(map[string]string, len(op.Keys))
+		for _, key := range op.Keys {
+			tkey, err := c.transformKey(key)
+			if err != nil {
+				return err
+			}
+			addr, err := c.routeRead(cl, tkey)
+			if err != nil {
+				return err
+			}
+			keyMap[addr] = append(keyMap[addr], tkey)
+			original[tkey] = key
+		}
+
+		var lk sync.Mutex
+		m = make(map[string]*Item)
+		addItemToMap := func(it *Item) {
+			if isTombstone(it) || isNotFound(it) {
+				return
+			}
+			key, ok := original[it.Key]
+			if !ok {
+				return
+			}
+			it.Key = key
+			if c.decodeItem(it) != nil {
+				// Left out as a miss, as there is no error per key.
+				return
+			}
+			c.ValueSizes.observe(key, len(it.Value))
+			lk.Lock()
+			defer lk.Unlock()
+			m[key] = it
+		}
+
+		type result struct {
+			addr net.Addr
+			err  error
+		}
+		ch := make(chan result, len(keyMap))
+		for addr, keys := range keyMap {
+			go func(addr net.Addr, keys []string) {
+				err := c.withRetry(cl, func(n int, prev error) error {
+					if n == 1 {
+						return c.getFromAddr(cl, addr, keys, addItemToMap)
+					}
+					// Keys of an unreachable server may fail over to
+					// different servers.
+					groups := make(map[net.Addr][]string)
+					for _, key := range keys {
+						a := c.failover(cl, key, addr, n, prev)
+						groups[a] = append(groups[a], key)
+					}
+					for a, keys := range groups {
+						if err := c.getFromAddr(cl, a, keys, addItemToMap); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if c.rehash(cl, err) {
+					err = nil
+				}
+				ch <- result{addr, err}
+			}(addr, keys)
+		}
+
+		var merr MultiError
+		for range keyMap {
+			if r := <-ch; r.err != nil {
+				if merr == nil {
+					merr = make(MultiError)
+				}
+				merr[r.addr.String()] = r.err
+			}
+		}
+		if merr == nil {
+			return nil
+		}
+
+		if c.BestEffort {
+			for _, err := range merr {
+				if !suppressible(err) {
+					return merr
+				}
+			}
+			c.recordSuppressed(cl.op, merr)
+			return nil
+		}
+
+		switch c.MultiGetPolicy {
+		case MultiGetFailFast:
+			m = nil
+			return merr
+		case MultiGetMissOnError:
+			return nil
+		}
+		return merr
+	})
+	if m == nil && err == nil {
+		m = make(map[string]*Item) // a middleware skipped the get
+	}
+	return m, err
+}
+
+// getFromAddr fetches keys from the server at addr in chunks, calling cb
+// for every item found. Over TCP all chunks are pipelined on one connection.
+func (c *Client) getFromAddr(cl *call, addr net.Addr, keys []string, cb func(*Item)) error {
+	sp, err := c.callProtocol(cl, addr)
 	if err != nil {
 		return err
 	}
+	chunks := c.chunkKeys(keys)
 
-	resp, err := bufio.NewReader(conn).ReadBytes('\n')
-	if err != nil {
-		return ErrServerError
+	if c.useUDP(addr, sp) {
+		for _, chunk := range chunks {
+			err := c.roundTrip(cl.ctx, addr, sp.Protocol, true, sp.Protocol.appendGet(nil, chunk), func(r *bufio.Reader) error {
+				return sp.Protocol.parseGet(r, cb)
+			})
+			if err != nil {
+				return cl.opError(addr, "", err)
+			}
+		}
+		return nil
 	}
 
-	// Compare the response with predefined byte slices
-	switch {
-	case bytes.Equal(resp, resultDeleted):
+	var req []byte
+	for _, chunk := range chunks {
+		req = sp.Protocol.appendGet(req, chunk)
+	}
+	return cl.opError(addr, "", c.roundTrip(cl.ctx, addr, sp.Protocol, false, req, func(r *bufio.Reader) error {
+		for range chunks {
+			if err := sp.Protocol.parseGet(r, cb); err != nil {
+				return err
+			}
+		}
 		return nil
-	case bytes.Equal(resp, resultNotFound):
-		return fmt.Errorf("item not found")
-	default:
-		return fmt.Errorf("unexpected response: %s", resp)
+	}))
+}
+
+// chunkKeys splits keys into batches honoring MaxBatchKeys and
+// MaxBatchLineLength.
+func (c *Client) chunkKeys(keys []string) [][]string {
+	maxKeys := c.MaxBatchKeys
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxBatchKeys
+	}
+	maxLine := c.MaxBatchLineLength
+	if maxLine <= 0 {
+		maxLine = DefaultMaxBatchLineLength
 	}
+
+	var chunks [][]string
+	start, lineLen := 0, len("get\r\n")
+	for i, key := range keys {
+		n := len(key) + 1
+		if i > start && (i-start == maxKeys || lineLen+n > maxLine) {
+			chunks = append(chunks, keys[start:i])
+			start, lineLen = i, len("get\r\n")
+		}
+		lineLen += n
+	}
+	if start < len(keys) {
+		chunks = append(chunks, keys[start:])
+	}
+	return chunks
 }
 
-// Ping checks if the server is responsive by sending a "version" command.
-func (c *Client) Ping(key string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// parseGetResponse reads a sequence of VALUE responses terminated by END,
+// calling cb for every item found.
+func parseGetResponse(r *bufio.Reader, cb func(*Item)) error {
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(line, resultEnd) {
+			return nil
+		}
 
-	conn, err := c.connect(key)
-	if err != nil {
-		return err
+		it := new(Item)
+		size, err := scanGetResponseLine(line, it)
+		if err != nil {
+			return err
+		}
+		it.Value = make([]byte, size+2)
+		if _, err := io.ReadFull(r, it.Value); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(it.Value, crlf) {
+			return &ProtocolError{Reason: "corrupt get result read"}
+		}
+		it.Value = it.Value[:size]
+		cb(it)
 	}
-	defer conn.Close()
+}
 
-	// Send the "version" command
-	_, err = conn.Write(append(versionPrefix, crlf...))
-	if err != nil {
-		return err
+// scanGetResponseLine populates it from a "VALUE <key> <flags> <bytes>
+// [<cas unique>]" line and returns the value size.
+func scanGetResponseLine(line []byte, it *Item) (size int, err error) {
+	fields := strings.Fields(string(line))
+	if len(fields) < 4 || len(fields) > 5 || fields[0] != "VALUE" {
+		return -1, unexpectedResponse(line)
 	}
 
-	// Read the response
-	resp, err := bufio.NewReader(conn).ReadBytes('\n')
+	flags, err := strconv.ParseUint(fields[2], 10, 32)
 	if err != nil {
-		return ErrServerError
+		return -1, unexpectedResponse(line)
+	}
+	size, err = strconv.Atoi(fields[3])
+	if err != nil || size < 0 {
+		return -1, unexpectedResponse(line)
 	}
 
-	// Check if the response starts with "VERSION"
-	if bytes.HasPrefix(resp, versionPrefix) {
-		return nil
+	it.Key = fields[1]
+	it.Flags = uint32(flags)
+	if len(fields) == 5 {
+		if it.casID, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+			return -1, unexpectedResponse(line)
+		}
 	}
+	return size, nil
+}
+
+// Delete removes an item from the Memcached server, using UDP when enabled
+// for the server and TCP otherwise. It returns ErrCacheMiss if the item was
+// not present.
+func (c *Client) Delete(key string, opts ...CallOption) error {
+	return c.DeleteContext(context.Background(), key, opts...)
+}
+
+// DeleteContext is like Delete, but gives up when ctx is done.
+func (c *Client) DeleteContext(ctx context.Context, key string, opts ...CallOption) error {
+	return c.intercept(ctx, &Operation{Name: "delete", Key: key}, func(ctx context.Context, op *Operation) error {
+		return c.deleteKey(ctx, op.Key, opts)
+	})
+}
+
+// deleteKey is DeleteContext without the middleware.
+func (c *Client) deleteKey(ctx context.Context, key string, opts []CallOption) error {
+	if c.ChunkSize > 0 {
+		return c.deleteChunked(ctx, key, opts)
+	}
+	return c.delete(ctx, key, opts)
+}
+
+// delete deletes key, leaving the chunks of a chunked value alone.
+func (c *Client) delete(ctx context.Context, key string, opts []CallOption) error {
+	return c.run(ctx, &Operation{Name: "delete", Key: key}, opts, func(cl *call, op *Operation) (err error) {
+		key := op.Key
+		defer c.Local.remove(key)
+
+		if c.CoalesceWindow > 0 {
+			c.dropWrite(key)
+		}
+
+		key, err = c.transformKey(key)
+		if err != nil {
+			return err
+		}
+		addrs, err := c.routeWrite(cl, key)
+		if err != nil {
+			return err
+		}
+
+		return c.writeReplicas(cl, addrs, func(cl *call, addr net.Addr) error {
+			return c.withRetry(cl, func(n int, prev error) error {
+				addr = c.failover(cl, key, addr, n, prev)
+				sp, err := c.callProtocol(cl, addr)
+				if err != nil {
+					return err
+				}
+				return cl.opError(addr, key, c.roundTrip(cl.ctx, addr, sp.Protocol, c.useUDP(addr, sp), sp.Protocol.appendDelete(nil, key), sp.Protocol.parseDelete))
+			})
+		})
+	})
+}
+
+// DeleteSoft invalidates key by replacing its value with a tombstone that
+// lives for graceTTL seconds. Until the tombstone expires Get returns
+// ErrTombstone instead of ErrCacheMiss, which lets readers tell a recently
+// invalidated key from one that was never cached and hold off backfilling it.
+func (c *Client) DeleteSoft(key string, graceTTL int32, opts ...CallOption) error {
+	return c.DeleteSoftContext(context.Background(), key, graceTTL, opts...)
+}
+
+// DeleteSoftContext is like DeleteSoft, but gives up when ctx is done.
+func (c *Client) DeleteSoftContext(ctx context.Context, key string, graceTTL int32, opts ...CallOption) error {
+	return c.SetContext(ctx, &Item{
+		Key:        key,
+		Value:      tombstoneValue,
+		Flags:      FlagTombstone,
+		Expiration: graceTTL,
+	}, opts...)
+}
+
+// isTombstone reports whether it was written by DeleteSoft.
+func isTombstone(it *Item) bool {
+	return it.Flags&FlagTombstone != 0 && bytes.Equal(it.Value, tombstoneValue)
+}
+
+// isNotFound reports whether it was written by Fetch for a value its
+// loader did not find.
+func isNotFound(it *Item) bool {
+	return it.Flags&FlagTombstone != 0 && bytes.Equal(it.Value, notFoundValue)
+}
+
+// Ping checks if the server responsible for key is responsive by sending
+// a "version" command.
+func (c *Client) Ping(key string, opts ...CallOption) error {
+	return c.PingContext(context.Background(), key, opts...)
+}
+
+// PingContext is like Ping, but gives up when ctx is done.
+func (c *Client) PingContext(ctx context.Context, key string, opts ...CallOption) error {
+	return c.run(ctx, &Operation{Name: "ping", Key: key}, opts, func(cl *call, op *Operation) (err error) {
+		key := op.Key
+		// The key only selects the server, so it is not needed with WithServer.
+		if cl.server == nil {
+			if key, err = c.transformKey(key); err != nil {
+				return err
+			}
+		}
+		addr, err := c.route(cl, key)
+		if err != nil {
+			return err
+		}
 
-	return fmt.Errorf("unexpected response: %s", resp)
+		return c.withRetry(cl, func(n int, prev error) error {
+			addr = c.failover(cl, key, addr, n, prev)
+			sp, err := c.callProtocol(cl, addr)
+			if err != nil {
+				return err
+			}
+			return cl.opError(addr, "", c.roundTrip(cl.ctx, addr, sp.Protocol, c.useUDP(addr, sp), sp.Protocol.appendVersion(nil), sp.Protocol.parseVersion))
+		})
+	})
 }
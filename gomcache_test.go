@@ -18,8 +18,14 @@ limitations under the License.
 package gomcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // MockServer simulates a Memcached server for testing purposes.
@@ -105,3 +111,377 @@ func TestDelete(t *testing.T) {
 		t.Fatalf("expected an error, got nil")
 	}
 }
+
+// TestDeleteSoft tests that a soft-deleted key reads back as a tombstone.
+func TestDeleteSoft(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, true)
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.DeleteSoft("foo", 30); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := srv.item("foo"); it == nil || it.exp != 30 {
+		t.Fatalf("expected a tombstone expiring in 30s, got %+v", it)
+	}
+
+	_, err := client.Get("foo")
+	if err != ErrTombstone {
+		t.Fatalf("expected ErrTombstone, got %v", err)
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected ErrTombstone to match ErrCacheMiss")
+	}
+
+	if _, err := client.Get("never_cached"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+}
+
+// TestGetMultiChunking tests that large GetMulti batches are split.
+func TestGetMultiChunking(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.MaxBatchKeys = 2
+
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys[:4] {
+		if err := client.Set(&Item{Key: key, Value: []byte("v" + key)}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	items, err := client.GetMulti(keys)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(items) != 4 || string(items["d"].Value) != "vd" {
+		t.Fatalf("unexpected items %v", items)
+	}
+
+	var gets []string
+	for _, cmd := range srv.commands() {
+		if strings.HasPrefix(cmd, "get ") {
+			gets = append(gets, cmd)
+		}
+	}
+	want := []string{"get a b", "get c d", "get e"}
+	if !reflect.DeepEqual(gets, want) {
+		t.Fatalf("expected commands %q, got %q", want, gets)
+	}
+}
+
+// TestChunkKeysLineLength tests that chunks respect MaxBatchLineLength.
+func TestChunkKeysLineLength(t *testing.T) {
+	client := &Client{MaxBatchLineLength: len("get aaa bbb\r\n")}
+
+	chunks := client.chunkKeys([]string{"aaa", "bbb", "ccc", "dddddddddddd"})
+	want := [][]string{{"aaa", "bbb"}, {"ccc"}, {"dddddddddddd"}}
+	if !reflect.DeepEqual(chunks, want) {
+		t.Fatalf("expected chunks %q, got %q", want, chunks)
+	}
+}
+
+// TestDialContext tests that connections are opened with a custom dialer.
+func TestDialContext(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	var dials []string
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("expected the dial context to carry a deadline")
+		}
+		dials = append(dials, network+" "+addr)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client.UseUDP = true
+	if _, err := client.Get("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []string{"tcp " + srv.addr, "udp " + srv.addr}
+	if !reflect.DeepEqual(dials, want) {
+		t.Fatalf("expected dials %q, got %q", want, dials)
+	}
+}
+
+// corruptingConn rewrites outgoing data, simulating a proxy that alters
+// values in transit.
+type corruptingConn struct {
+	net.Conn
+	old, new string
+}
+
+func (c *corruptingConn) Write(b []byte) (int, error) {
+	if _, err := c.Conn.Write([]byte(strings.ReplaceAll(string(b), c.old, c.new))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// TestBadDataChunk tests that a bad data chunk is reported with a typed
+// error and that the connection is discarded.
+func TestBadDataChunk(t *testing.T) {
+	srv := newTestServer(t)
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta} {
+		client, _ := NewClient([]string{srv.addr}, false)
+		client.SetServerProtocol(srv.addr, ServerProtocol{Protocol: p})
+		client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			nc, err := d.DialContext(ctx, network, addr)
+			return &corruptingConn{Conn: nc, old: "bar\r\n", new: "barr\n"}, err
+		}
+
+		err := client.Set(&Item{Key: "foo", Value: []byte("bar")})
+		var bdc *BadDataChunkError
+		if !errors.Is(err, ErrBadDataChunk) || !errors.As(err, &bdc) || bdc.Key != "foo" || bdc.Size != 3 {
+			t.Fatalf("%v: expected a BadDataChunkError for foo, got %v", p, err)
+		}
+
+		addr, _ := client.selector.Select("foo")
+		if open, idle := client.pool.stats(addr); open != 0 || idle != 0 {
+			t.Fatalf("%v: expected the connection to be discarded, got open=%d idle=%d", p, open, idle)
+		}
+	}
+}
+
+// TestSocketOptions tests that socket options are applied to new
+// connections.
+func TestSocketOptions(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.KeepAlive = -1
+	client.DisableNoDelay = true
+	client.ReadBufferSize = 64 << 10
+	client.WriteBufferSize = 64 << 10
+
+	var tcp bool
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		nc, err := d.DialContext(ctx, network, addr)
+		_, tcp = nc.(*net.TCPConn)
+		return nc, err
+	}
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !tcp {
+		t.Fatalf("expected a TCP connection")
+	}
+	if err := client.setSocketOptions(&corruptingConn{}); err != nil {
+		t.Fatalf("expected wrapped connections to be left alone, got %v", err)
+	}
+}
+
+// TestGetMultiPolicy tests the GetMulti policies when one server is down.
+func TestGetMultiPolicy(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{srv.addr, down}, false)
+	var keys []string
+	var up int
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		keys = append(keys, key)
+		if addr, _ := client.selector.Select(key); addr.String() == srv.addr {
+			client.Set(&Item{Key: key, Value: []byte("v")})
+			up++
+		}
+	}
+	if up == 0 || up == len(keys) {
+		t.Fatalf("expected keys on both servers, got %d of %d on %s", up, len(keys), srv.addr)
+	}
+
+	items, err := client.GetMulti(keys)
+	var merr MultiError
+	if !errors.As(err, &merr) || len(merr) != 1 || merr[down] == nil {
+		t.Fatalf("expected a MultiError for %s, got %v", down, err)
+	}
+	if len(items) != up {
+		t.Fatalf("expected %d partial results, got %d", up, len(items))
+	}
+
+	client.MultiGetPolicy = MultiGetFailFast
+	if items, err := client.GetMulti(keys); !errors.As(err, &merr) || items != nil {
+		t.Fatalf("expected no items and a MultiError, got %d items and %v", len(items), err)
+	}
+
+	client.MultiGetPolicy = MultiGetMissOnError
+	if items, err := client.GetMulti(keys); err != nil || len(items) != up {
+		t.Fatalf("expected %d items and no error, got %d items and %v", up, len(items), err)
+	}
+}
+
+// TestConcurrentOperations tests that a slow server does not hold up
+// operations on other servers.
+func TestConcurrentOperations(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	accepted := make(chan struct{})
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer nc.Close()
+		close(accepted)
+		nc.Read(make([]byte, 1024)) // never answers
+	}()
+
+	client, _ := NewClient([]string{srv.addr, ln.Addr().String()}, false)
+	client.Timeout = 5 * time.Second
+	go client.Get("foo", WithServer(ln.Addr().String()), WithTimeout(2*time.Second))
+	<-accepted
+
+	start := time.Now()
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}, WithServer(srv.addr)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the Set not to wait for the slow Get, took %v", elapsed)
+	}
+}
+
+// TestContextCancellation tests that cancelling the context interrupts an
+// operation blocked on a server.
+func TestContextCancellation(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer nc.Close()
+		}
+	}()
+
+	client, _ := NewClient([]string{ln.Addr().String()}, false)
+	client.Timeout = 5 * time.Second
+	addr, _ := client.selector.Select("foo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := client.GetContext(ctx, "foo"); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the cancellation to interrupt the read, took %v", elapsed)
+	}
+	if open, idle := client.pool.stats(addr); open != 0 || idle != 0 {
+		t.Fatalf("expected the interrupted connection to be discarded, got open=%d idle=%d", open, idle)
+	}
+
+	if err := client.SetContext(ctx, &Item{Key: "foo", Value: []byte("bar")}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled for a done context, got %v", err)
+	}
+}
+
+// TestContextReleasesConn tests that a completed operation returns its
+// connection to the pool with a usable deadline.
+func TestContextReleasesConn(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.SetContext(ctx, &Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cancel()
+	if _, err := client.Get("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n := srv.accepted(); n != 1 {
+		t.Fatalf("expected the connection to be reused, got %d connections", n)
+	}
+}
+
+func TestBestEffort(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{down}, false)
+	client.BestEffort = true
+	var ops []string
+	client.OnSuppressedError = func(op string, err error) { ops = append(ops, op) }
+
+	if _, err := client.Get("foo"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+	if items, err := client.GetMulti([]string{"foo", "bar"}); err != nil || len(items) != 0 {
+		t.Fatalf("expected no items and no error, got %v, %v", items, err)
+	}
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Delete("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Mistakes of the caller are still reported.
+	if err := client.Set(&Item{Key: "a b", Value: []byte("bar")}); err != ErrMalformedKey {
+		t.Fatalf("expected ErrMalformedKey, got %v", err)
+	}
+
+	if st := client.SuppressedErrors(); st.Reads != 2 || st.Writes != 2 {
+		t.Fatalf("expected 2 reads and 2 writes suppressed, got %+v", st)
+	}
+	if got := strings.Join(ops, ","); got != "get,get_multi,set,delete" {
+		t.Fatalf("unexpected suppressed operations %q", got)
+	}
+}
+
+// TestOpError tests that failures carry the operation, server and key, and
+// still match the underlying errors.
+func TestOpError(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{down}, false)
+	_, err := client.Get("foo")
+	var oe *OpError
+	if !errors.As(err, &oe) || oe.Op != "get" || oe.Key != "foo" || oe.Addr.String() != down {
+		t.Fatalf("expected an OpError for get foo on %s, got %v", down, err)
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) {
+		t.Fatalf("expected a net.Error, got %v", err)
+	}
+
+	// A server answering garbage is a protocol error.
+	ln, _ = net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			nc.Write([]byte("BOGUS\r\n"))
+			defer nc.Close()
+		}
+	}()
+	client, _ = NewClient([]string{ln.Addr().String()}, false)
+	err = client.Set(&Item{Key: "foo", Value: []byte("bar")})
+	var pe *ProtocolError
+	if !errors.Is(err, ErrProtocol) || !errors.As(err, &pe) || pe.Response != "BOGUS" || !errors.As(err, &oe) || oe.Op != "set" {
+		t.Fatalf("expected a protocol error for set, got %v", err)
+	}
+}
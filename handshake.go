@@ -0,0 +1,165 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultHandshakeTimeout is the default time allowed for TLS negotiation
+// and authentication on a new connection.
+const DefaultHandshakeTimeout = time.Second
+
+// ErrAuthFailed is returned when the server rejects the client credentials.
+var ErrAuthFailed = errors.New("memcache: authentication failed")
+
+// opSASLAuth is the binary protocol SASL authentication opcode.
+const opSASLAuth byte = 0x21
+
+// Credentials authenticate new connections. Text and meta connections use
+// memcached's ASCII authentication; binary connections use SASL PLAIN.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// ServerAuth holds the TLS and authentication settings of a single server.
+type ServerAuth struct {
+	// TLSConfig, if not nil, enables TLS on connections to the server.
+	TLSConfig *tls.Config
+
+	// Credentials, if not nil, authenticate connections to the server.
+	Credentials *Credentials
+}
+
+// SetServerAuth sets the TLS configuration and credentials used for new
+// connections to the server at addr, replacing Client.TLSConfig and
+// Client.Credentials for it entirely; a nil field disables TLS or
+// authentication for that server. This serves clusters that span accounts
+// or providers with different secrets. Pooled connections keep the
+// settings they were established with.
+func (c *Client) SetServerAuth(addr string, auth ServerAuth) error {
+	a, err := resolveServer(addr)
+	if err != nil {
+		return err
+	}
+
+	c.servers.mu.Lock()
+	defer c.servers.mu.Unlock()
+	c.servers.auth[a.String()] = auth
+	return nil
+}
+
+// serverAuth returns the TLS and authentication settings in effect for addr.
+func (c *Client) serverAuth(addr net.Addr) ServerAuth {
+	c.servers.mu.RLock()
+	defer c.servers.mu.RUnlock()
+	if auth, ok := c.servers.auth[addr.String()]; ok {
+		return auth
+	}
+	return ServerAuth{TLSConfig: c.TLSConfig, Credentials: c.Credentials}
+}
+
+// handshakeTimeout returns the handshake timeout in effect.
+func (c *Client) handshakeTimeout() time.Duration {
+	if c.HandshakeTimeout != 0 {
+		return c.HandshakeTimeout
+	}
+	return DefaultHandshakeTimeout
+}
+
+// handshake negotiates TLS and authenticates a freshly dialed connection to
+// addr that will carry requests in protocol p. It runs under its own
+// deadline, HandshakeTimeout, which may be longer than Timeout; the
+// operation that triggered the dial still fails if its own deadline passes
+// meanwhile.
+func (c *Client) handshake(nc net.Conn, addr net.Addr, p Protocol) (net.Conn, error) {
+	auth := c.serverAuth(addr)
+	if auth.TLSConfig == nil && auth.Credentials == nil {
+		return nc, nil
+	}
+
+	if err := nc.SetDeadline(time.Now().Add(c.handshakeTimeout())); err != nil {
+		return nil, err
+	}
+
+	if auth.TLSConfig != nil {
+		cfg := auth.TLSConfig
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+				cfg.ServerName = host
+			}
+		}
+		tc := tls.Client(nc, cfg)
+		if err := tc.Handshake(); err != nil {
+			return nil, err
+		}
+		nc = tc
+	}
+
+	if auth.Credentials != nil {
+		if err := authenticate(nc, p, auth.Credentials); err != nil {
+			return nil, err
+		}
+	}
+	return nc, nil
+}
+
+// authenticate sends creds over nc using the mechanism suited to p.
+func authenticate(nc net.Conn, p Protocol, creds *Credentials) error {
+	r := bufio.NewReader(nc)
+
+	if p == ProtocolBinary {
+		mech := "PLAIN"
+		value := []byte("\x00" + creds.Username + "\x00" + creds.Password)
+		if _, err := nc.Write(appendBinaryRequest(nil, opSASLAuth, mech, nil, value)); err != nil {
+			return err
+		}
+		h, _, _, _, err := readBinaryResponse(r)
+		if err != nil {
+			return err
+		}
+		if h.status != statusOK {
+			return ErrAuthFailed
+		}
+		return nil
+	}
+
+	// ASCII authentication is a set of any key whose value holds the
+	// username and password separated by a space.
+	token := creds.Username + " " + creds.Password
+	req := fmt.Sprintf("set auth 0 0 %d\r\n%s\r\n", len(token), token)
+	if _, err := nc.Write([]byte(req)); err != nil {
+		return err
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(line, resultStored) {
+		return ErrAuthFailed
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshakeTimeout(t *testing.T) {
+	// A server that accepts connections but never completes a TLS handshake.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer nc.Close()
+		}
+	}()
+
+	client, _ := NewClient([]string{ln.Addr().String()}, false)
+	client.Timeout = 5 * time.Second
+	client.HandshakeTimeout = 50 * time.Millisecond
+	client.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	start := time.Now()
+	err = client.Set(&Item{Key: "foo", Value: []byte("bar")})
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the handshake timeout to apply, took %v", elapsed)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolBinary} {
+		t.Run(p.String(), func(t *testing.T) {
+			srv := newTestServer(t)
+			srv.setAuth("user secret")
+
+			client, _ := NewClient([]string{srv.addr}, false)
+			client.SetServerProtocol(srv.addr, ServerProtocol{Protocol: p})
+
+			client.Credentials = &Credentials{Username: "user", Password: "wrong"}
+			if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); !errors.Is(err, ErrAuthFailed) {
+				t.Fatalf("expected ErrAuthFailed, got %v", err)
+			}
+
+			client.Credentials = &Credentials{Username: "user", Password: "secret"}
+			if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if _, err := client.Get("foo"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPerServerAuthentication(t *testing.T) {
+	srv1 := newTestServer(t)
+	srv1.setAuth("alice secret1")
+	srv2 := newTestServer(t)
+	srv2.setAuth("bob secret2")
+
+	client, _ := NewClient([]string{srv1.addr, srv2.addr}, false)
+	client.Credentials = &Credentials{Username: "alice", Password: "secret1"}
+	client.SetServerAuth(srv2.addr, ServerAuth{Credentials: &Credentials{Username: "bob", Password: "secret2"}})
+
+	for _, srv := range []*testServer{srv1, srv2} {
+		if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}, WithServer(srv.addr)); err != nil {
+			t.Fatalf("expected no error from %s, got %v", srv.addr, err)
+		}
+	}
+}
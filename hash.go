@@ -0,0 +1,138 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"math/bits"
+)
+
+// Hasher hashes keys for a selector. Choosing the hash used by other
+// clients of a cluster gives the same key distribution; choosing a cheaper
+// one saves time on every operation.
+type Hasher interface {
+	Hash(key string) uint32
+}
+
+// HasherFunc adapts a function to a Hasher.
+type HasherFunc func(key string) uint32
+
+// Hash calls f(key).
+func (f HasherFunc) Hash(key string) uint32 {
+	return f(key)
+}
+
+// CRC32Hasher returns a Hasher computing the IEEE CRC-32 of keys, the
+// default of the selectors.
+func CRC32Hasher() Hasher {
+	return HasherFunc(keyHash)
+}
+
+// FNV1aHasher returns a Hasher computing the 32-bit FNV-1a hash of keys.
+func FNV1aHasher() Hasher {
+	return HasherFunc(func(key string) uint32 {
+		h := uint32(2166136261)
+		for i := 0; i < len(key); i++ {
+			h ^= uint32(key[i])
+			h *= 16777619
+		}
+		return h
+	})
+}
+
+// XXHasher returns a Hasher computing the 32-bit xxHash of keys, with seed
+// 0.
+func XXHasher() Hasher {
+	return HasherFunc(xxh32)
+}
+
+// MD5Hasher returns a Hasher taking the first four bytes of the MD5 digest
+// of keys in little-endian order, as ketama does.
+func MD5Hasher() Hasher {
+	return HasherFunc(md5Hash)
+}
+
+func md5Hash(key string) uint32 {
+	sum := md5.Sum([]byte(key))
+	return binary.LittleEndian.Uint32(sum[:4])
+}
+
+// hashKey hashes key with h, or with CRC-32 if h is nil.
+func hashKey(h Hasher, key string) uint32 {
+	if h == nil {
+		return keyHash(key)
+	}
+	return h.Hash(key)
+}
+
+const (
+	xxPrime1 uint32 = 2654435761
+	xxPrime2 uint32 = 2246822519
+	xxPrime3 uint32 = 3266489917
+	xxPrime4 uint32 = 668265263
+	xxPrime5 uint32 = 374761393
+)
+
+// xxh32 returns the XXH32 hash of s with seed 0.
+func xxh32(s string) uint32 {
+	n := len(s)
+	var h uint32
+	i := 0
+	if n >= 16 {
+		// The seed terms wrap around, which constant arithmetic rejects.
+		v1, v2, v3, v4 := xxPrime1, xxPrime2, uint32(0), uint32(0)
+		v1 += xxPrime2
+		v4 -= xxPrime1
+		for ; i+16 <= n; i += 16 {
+			v1 = xxRound(v1, le32(s[i:]))
+			v2 = xxRound(v2, le32(s[i+4:]))
+			v3 = xxRound(v3, le32(s[i+8:]))
+			v4 = xxRound(v4, le32(s[i+12:]))
+		}
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) + bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = xxPrime5
+	}
+	h += uint32(n)
+
+	for ; i+4 <= n; i += 4 {
+		h += le32(s[i:]) * xxPrime3
+		h = bits.RotateLeft32(h, 17) * xxPrime4
+	}
+	for ; i < n; i++ {
+		h += uint32(s[i]) * xxPrime5
+		h = bits.RotateLeft32(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 15
+	h *= xxPrime2
+	h ^= h >> 13
+	h *= xxPrime3
+	h ^= h >> 16
+	return h
+}
+
+func xxRound(acc, input uint32) uint32 {
+	return bits.RotateLeft32(acc+input*xxPrime2, 13) * xxPrime1
+}
+
+// le32 decodes the little-endian uint32 at the start of s.
+func le32(s string) uint32 {
+	return uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"hash/crc32"
+	"hash/fnv"
+	"testing"
+)
+
+func TestHashers(t *testing.T) {
+	keys := []string{"", "a", "abc", "0123456789abcdefghij", "memcached key with more than thirty-two bytes"}
+	xx := []uint32{0x02cc5d05, 0x550d7456, 0x32d153ff, 0x35600916, 0xc34612a6}
+	for i, key := range keys {
+		if got := CRC32Hasher().Hash(key); got != crc32.ChecksumIEEE([]byte(key)) {
+			t.Errorf("CRC32(%q): got %#x", key, got)
+		}
+		f := fnv.New32a()
+		f.Write([]byte(key))
+		if got := FNV1aHasher().Hash(key); got != f.Sum32() {
+			t.Errorf("FNV-1a(%q): expected %#x, got %#x", key, f.Sum32(), got)
+		}
+		if got := XXHasher().Hash(key); got != xx[i] {
+			t.Errorf("xxHash(%q): expected %#x, got %#x", key, xx[i], got)
+		}
+	}
+	// The first word of MD5("") is d41d8cd9.
+	if got := MD5Hasher().Hash(""); got != 0xd98c1dd4 {
+		t.Errorf("MD5(\"\"): expected 0xd98c1dd4, got %#x", got)
+	}
+}
+
+func TestServerListHasher(t *testing.T) {
+	servers := []string{"10.0.0.1:11211", "10.0.0.2:11211", "10.0.0.3:11211"}
+	ss := &ServerList{Hasher: HasherFunc(func(key string) uint32 { return uint32(len(key)) })}
+	ss.SetServers(servers...)
+	for _, key := range []string{"a", "bb", "ccc", "dddd"} {
+		addr, err := ss.Select(key)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if want := servers[len(key)%len(servers)]; addr.String() != want {
+			t.Fatalf("expected %q on %s, got %s", key, want, addr)
+		}
+	}
+}
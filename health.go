@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthReport is the JSON document served by HealthHandler.
+type HealthReport struct {
+	// Status is "ok" when every server answered, "degraded" when some did
+	// and "down" when none did.
+	Status  string         `json:"status"`
+	Servers []ServerHealth `json:"servers"`
+}
+
+// ServerHealth is the health of a single server.
+type ServerHealth struct {
+	Addr      string  `json:"addr"`
+	Healthy   bool    `json:"healthy"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthHandler returns an http.Handler that pings every server of c and
+// reports the result as a HealthReport. It answers 200 OK unless no server
+// is reachable, in which case it answers 503 Service Unavailable, so it can
+// be mounted directly as a readiness endpoint. Pings are bounded by the
+// request context and the client Timeout.
+func HealthHandler(c *Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var lk sync.Mutex
+		report := HealthReport{Servers: []ServerHealth{}}
+		err := c.eachServer(func(addr net.Addr) error {
+			sh := ServerHealth{Addr: addr.String()}
+			start := time.Now()
+			err := c.PingContext(r.Context(), "", WithServer(addr.String()))
+			sh.LatencyMS = float64(time.Since(start)) / float64(time.Millisecond)
+			if err != nil {
+				sh.Error = err.Error()
+			} else {
+				sh.Healthy = true
+			}
+
+			lk.Lock()
+			defer lk.Unlock()
+			report.Servers = append(report.Servers, sh)
+			return nil
+		})
+		sort.Slice(report.Servers, func(i, j int) bool { return report.Servers[i].Addr < report.Servers[j].Addr })
+
+		healthy := 0
+		for _, sh := range report.Servers {
+			if sh.Healthy {
+				healthy++
+			}
+		}
+		code := http.StatusOK
+		switch {
+		case err != nil || healthy == 0:
+			report.Status = "down"
+			code = http.StatusServiceUnavailable
+		case healthy < len(report.Servers):
+			report.Status = "degraded"
+		default:
+			report.Status = "ok"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	for _, tc := range []struct {
+		servers []string
+		code    int
+		status  string
+	}{
+		{[]string{srv.addr}, http.StatusOK, "ok"},
+		{[]string{srv.addr, down}, http.StatusOK, "degraded"},
+		{[]string{down}, http.StatusServiceUnavailable, "down"},
+	} {
+		client, _ := NewClient(tc.servers, false)
+		rec := httptest.NewRecorder()
+		HealthHandler(client).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+		var report HealthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if rec.Code != tc.code || report.Status != tc.status || len(report.Servers) != len(tc.servers) {
+			t.Fatalf("%v: expected %d %q, got %d %+v", tc.servers, tc.code, tc.status, rec.Code, report)
+		}
+	}
+}
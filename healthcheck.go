@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// errNoEjection is returned by HealthChecker for selectors that cannot eject
+// servers.
+var errNoEjection = errors.New("memcache: selector does not support ejecting servers")
+
+const (
+	// DefaultHealthCheckInterval is the default interval between two
+	// rounds of health checks.
+	DefaultHealthCheckInterval = 5 * time.Second
+
+	// DefaultHealthCheckFailures is the default number of consecutive
+	// failed pings that ejects a server.
+	DefaultHealthCheckFailures = 2
+)
+
+// HealthChecker periodically pings every server of Client and ejects
+// servers that stop answering from selection, restoring them as soon as a
+// ping succeeds again. The client selector must implement
+// EjectingSelector, as ServerList does.
+type HealthChecker struct {
+	Client *Client
+
+	// Interval is the time between two rounds of pings. If zero,
+	// DefaultHealthCheckInterval is used.
+	Interval time.Duration
+
+	// Failures is the number of consecutive failed pings that ejects a
+	// server. If zero, DefaultHealthCheckFailures is used.
+	Failures int
+
+	// OnChange, if not nil, is called when a server is ejected, with the
+	// error of its last ping, and when it is restored, with a nil error.
+	OnChange func(addr net.Addr, healthy bool, err error)
+
+	mu       sync.Mutex
+	failures map[string]int
+	ejected  map[string]net.Addr
+}
+
+// Run checks the servers every Interval until ctx is done or Client is
+// closed, then restores the servers it ejected and returns ctx.Err() or
+// ErrClientClosed.
+func (h *HealthChecker) Run(ctx context.Context) error {
+	es, ok := h.Client.selector.(EjectingSelector)
+	if !ok {
+		return errNoEjection
+	}
+	defer func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for s, addr := range h.ejected {
+			es.Restore(addr)
+			delete(h.ejected, s)
+		}
+	}()
+
+	interval := h.Interval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		h.Check(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-h.Client.pool.done:
+			return ErrClientClosed
+		}
+	}
+}
+
+// Check pings every server once, ejecting and restoring servers as needed.
+func (h *HealthChecker) Check(ctx context.Context) error {
+	c := h.Client
+	es, ok := c.selector.(EjectingSelector)
+	if !ok {
+		return errNoEjection
+	}
+	threshold := h.Failures
+	if threshold <= 0 {
+		threshold = DefaultHealthCheckFailures
+	}
+
+	return c.eachServer(func(addr net.Addr) error {
+		err := c.PingContext(ctx, "", WithServer(addr.String()))
+		if ctx.Err() != nil || err == ErrClientClosed {
+			// Pings cut short by the caller or by Close say nothing about
+			// the server.
+			return nil
+		}
+
+		h.mu.Lock()
+		if h.failures == nil {
+			h.failures = make(map[string]int)
+			h.ejected = make(map[string]net.Addr)
+		}
+		s := addr.String()
+		_, wasEjected := h.ejected[s]
+		changed := false
+		if err == nil {
+			delete(h.failures, s)
+			if wasEjected {
+				delete(h.ejected, s)
+				es.Restore(addr)
+				changed = true
+			}
+		} else {
+			h.failures[s]++
+			if !wasEjected && h.failures[s] >= threshold {
+				h.ejected[s] = addr
+				es.Eject(addr)
+				changed = true
+			}
+		}
+		h.mu.Unlock()
+
+		if changed && h.OnChange != nil {
+			h.OnChange(addr, err == nil, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckerEjectsServers(t *testing.T) {
+	srv := newTestServer(t)
+	flaky := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr, flaky.addr}, false)
+
+	var down atomic.Bool
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == flaky.addr && down.Load() {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("connection refused")}
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	var mu sync.Mutex
+	var changes []string
+	h := &HealthChecker{
+		Client:   client,
+		Failures: 2,
+		OnChange: func(addr net.Addr, healthy bool, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, fmt.Sprintf("%s=%v", addr, healthy))
+		},
+	}
+
+	down.Store(true)
+	for i := 0; i < 2; i++ {
+		if err := h.Check(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		addr, err := client.selector.Select(fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if addr.String() != srv.addr {
+			t.Fatalf("expected every key on %s, got %s", srv.addr, addr)
+		}
+	}
+
+	down.Store(false)
+	if err := h.Check(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		addr, _ := client.selector.Select(fmt.Sprintf("key%d", i))
+		seen[addr.String()] = true
+	}
+	if !seen[flaky.addr] {
+		t.Fatalf("expected %s to be selected again", flaky.addr)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := fmt.Sprintf("[%s=false %s=true]", flaky.addr, flaky.addr)
+	if got := fmt.Sprint(changes); got != want {
+		t.Fatalf("expected changes %s, got %s", want, got)
+	}
+}
+
+func TestHealthCheckerRestoresOnExit(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{down}, false)
+	h := &HealthChecker{Client: client, Failures: 1}
+	if err := h.Check(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.selector.Select("foo"); err != ErrNoServers {
+		t.Fatalf("expected ErrNoServers, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Run(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := client.selector.Select("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestHealthCheckerStopsOnClose(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	h := &HealthChecker{Client: client, Interval: time.Hour}
+
+	done := make(chan error)
+	go func() { done <- h.Run(context.Background()) }()
+	client.Close()
+	select {
+	case err := <-done:
+		if err != ErrClientClosed {
+			t.Fatalf("expected ErrClientClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected Run to return once the client is closed")
+	}
+	if _, err := client.selector.Select("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// hedgeAddr returns the server to send a hedged Get of key to, or nil if
+// the Get should not be hedged.
+func (c *Client) hedgeAddr(cl *call, key string, primary net.Addr) net.Addr {
+	if c.HedgeDelay <= 0 || cl.server != nil {
+		return nil
+	}
+	if rs, ok := c.selector.(ReplicaSelector); ok {
+		addrs, err := rs.SelectReplicas(key)
+		if err != nil {
+			return nil
+		}
+		for _, addr := range addrs {
+			if addr.String() != primary.String() {
+				return addr
+			}
+		}
+		return nil
+	}
+	if fs, ok := c.selector.(FailoverSelector); ok {
+		if addr, err := fs.SelectFailover(key, 1); err == nil && addr.String() != primary.String() {
+			return addr
+		}
+	}
+	return nil
+}
+
+// hedgedGet fetches key from primary and, if it has not answered within
+// HedgeDelay, from backup as well. It returns the first hit, and otherwise a
+// miss if either server missed, or an error. The request still in flight is
+// cancelled.
+func (c *Client) hedgedGet(cl *call, key string, primary, backup net.Addr) (*Item, error) {
+	ctx, cancel := context.WithCancel(cl.ctx)
+	defer cancel()
+	hcl := *cl
+	hcl.ctx = ctx
+
+	type result struct {
+		item *Item
+		err  error
+	}
+	results := make(chan result, 2)
+	fetch := func(addr net.Addr) {
+		item, err := c.getFrom(&hcl, key, addr)
+		results <- result{item, err}
+	}
+	go fetch(primary)
+
+	t := time.NewTimer(c.HedgeDelay)
+	defer t.Stop()
+	pending := 1
+	select {
+	case r := <-results:
+		return r.item, r.err
+	case <-t.C:
+		go fetch(backup)
+		pending++
+	case <-cl.ctx.Done():
+		r := <-results
+		return r.item, r.err
+	}
+
+	var best *result
+	for ; pending > 0; pending-- {
+		r := <-results
+		if r.err == nil && r.item != nil {
+			return r.item, nil
+		}
+		if best == nil || best.err != nil && r.err == nil {
+			best = &r
+		}
+	}
+	return best.item, best.err
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// slowConn delays every read, simulating an overloaded server.
+type slowConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c *slowConn) Read(b []byte) (int, error) {
+	time.Sleep(c.delay)
+	return c.Conn.Read(b)
+}
+
+func TestHedgedGet(t *testing.T) {
+	slow := newTestServer(t)
+	fast := newTestServer(t)
+	client, _ := NewClient([]string{slow.addr, fast.addr}, false)
+	client.Timeout = time.Second
+	key := keyOn(t, client, slow.addr)
+
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		nc, err := d.DialContext(ctx, network, addr)
+		if err != nil || addr != slow.addr {
+			return nc, err
+		}
+		return &slowConn{Conn: nc, delay: 300 * time.Millisecond}, nil
+	}
+	for _, addr := range []string{slow.addr, fast.addr} {
+		if err := client.Set(&Item{Key: key, Value: []byte("v")}, WithServer(addr)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	client.HedgeDelay = 20 * time.Millisecond
+	start := time.Now()
+	if _, err := client.Get(key); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected the hedged request to answer first, took %v", elapsed)
+	}
+
+	// A miss from the backup does not beat a hit from the primary.
+	if err := client.Delete(key, WithServer(fast.addr)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get(key); err != nil {
+		t.Fatalf("expected the primary's hit, got %v", err)
+	}
+}
+
+// keyOn returns a key that client routes to addr.
+func keyOn(t *testing.T, client *Client, addr string) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if a, _ := client.selector.Select(key); a.String() == addr {
+			return key
+		}
+	}
+	t.Fatalf("no key routes to %s", addr)
+	return ""
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// InvalidateIfUnchanged deletes every key of cas whose CAS value still
+// equals the given one, so that a cleanup job working from an earlier scan,
+// such as Metadump, never deletes a value rewritten since. Requests are
+// pipelined per server.
+//
+// The result maps every key to nil if it was deleted, ErrCASConflict if it
+// was rewritten or ErrCacheMiss if it was already gone. Keys of servers that
+// failed are left out and reported in a MultiError keyed by address.
+func (c *Client) InvalidateIfUnchanged(cas map[string]uint64, opts ...CallOption) (map[string]error, error) {
+	return c.InvalidateIfUnchangedContext(context.Background(), cas, opts...)
+}
+
+// InvalidateIfUnchangedContext is like InvalidateIfUnchanged but bounded by
+// ctx.
+func (c *Client) InvalidateIfUnchangedContext(ctx context.Context, cas map[string]uint64, opts ...CallOption) (results map[string]error, err error) {
+	keys := make([]string, 0, len(cas))
+	for key := range cas {
+		keys = append(keys, key)
+	}
+	err = c.run(ctx, &Operation{Name: "invalidate", Keys: keys}, opts, func(cl *call, _ *Operation) error {
+		keyMap := make(map[net.Addr][]string)
+		original := make(map[string]string, len(cas))
+		for key := range cas {
+			tkey, err := c.transformKey(key)
+			if err != nil {
+				return err
+			}
+			addr, err := c.route(cl, tkey)
+			if err != nil {
+				return err
+			}
+			keyMap[addr] = append(keyMap[addr], tkey)
+			original[tkey] = key
+		}
+
+		var lk sync.Mutex
+		results = make(map[string]error, len(cas))
+		var merr MultiError
+		var wg sync.WaitGroup
+		for addr, keys := range keyMap {
+			wg.Add(1)
+			go func(addr net.Addr, keys []string) {
+				defer wg.Done()
+				res, err := c.invalidateFromAddr(cl, addr, keys, cas, original)
+
+				lk.Lock()
+				defer lk.Unlock()
+				if err != nil {
+					if merr == nil {
+						merr = make(MultiError)
+					}
+					merr[addr.String()] = err
+					return
+				}
+				for i, key := range keys {
+					results[original[key]] = res[i]
+				}
+			}(addr, keys)
+		}
+		wg.Wait()
+
+		if merr != nil {
+			return merr
+		}
+		return nil
+	})
+	return results, err
+}
+
+// invalidateFromAddr sends the conditional deletes of the transformed keys
+// to addr in one pipeline and returns their results in order. Like every
+// conditional write, the pipeline is sent once: retried, it would report
+// the keys it already deleted as misses.
+func (c *Client) invalidateFromAddr(cl *call, addr net.Addr, keys []string, cas map[string]uint64, original map[string]string) ([]error, error) {
+	res := make([]error, len(keys))
+	err := c.roundTripOnce(cl, addr, "", func(p Protocol) []byte {
+		var req []byte
+		for _, key := range keys {
+			req = p.appendDeleteCAS(req, key, cas[original[key]])
+		}
+		return req
+	}, func(p Protocol, r *bufio.Reader) error {
+		for i := range keys {
+			// Every dialect answers like a storage command.
+			err := p.parseStore(r)
+			if err != nil && !resumableError(err) {
+				return err
+			}
+			res[i] = err
+		}
+		return nil
+	})
+	return res, err
+}
+
+// appendDeleteCAS appends a request deleting key only if its CAS value is
+// cas. The text protocol has no conditional delete, so it stores an empty
+// value that expires immediately with the cas command instead.
+func (p Protocol) appendDeleteCAS(b []byte, key string, cas uint64) []byte {
+	switch p {
+	case ProtocolMeta:
+		b = append(b, "md "...)
+		b = append(b, key...)
+		b = append(b, " C"...)
+		b = strconv.AppendUint(b, cas, 10)
+		return append(b, crlf...)
+	case ProtocolBinary:
+		start := len(b)
+		b = appendBinaryRequest(b, opDelete, key, nil, nil)
+		binary.BigEndian.PutUint64(b[start+16:start+24], cas)
+		return b
+	}
+	b = append(b, "cas "...)
+	b = append(b, key...)
+	b = append(b, " 0 -1 0 "...)
+	b = strconv.AppendUint(b, cas, 10)
+	b = append(b, crlf...)
+	return append(b, crlf...)
+}
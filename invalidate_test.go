@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestInvalidateIfUnchanged(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta} {
+		srv := newTestServer(t)
+		client, _ := NewClient([]string{srv.addr}, false)
+
+		cas := make(map[string]uint64)
+		for _, key := range []string{"same", "rewritten"} {
+			if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			cas[key] = srv.item(key).cas
+		}
+		if err := client.Set(&Item{Key: "rewritten", Value: []byte("v2")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cas["gone"] = 1
+
+		res, err := client.InvalidateIfUnchanged(cas, WithProtocol(p))
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		if res["same"] != nil || res["rewritten"] != ErrCASConflict || res["gone"] != ErrCacheMiss {
+			t.Fatalf("%v: unexpected results %v", p, res)
+		}
+		if srv.item("same") != nil {
+			t.Fatalf("%v: expected the unchanged key to be deleted", p)
+		}
+		if srv.item("rewritten") == nil {
+			t.Fatalf("%v: expected the rewritten key to survive", p)
+		}
+	}
+}
+
+func TestInvalidateIfUnchangedSendsOnce(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	var dials int
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("connection refused")}
+	}
+	if _, err := client.InvalidateIfUnchanged(map[string]uint64{"foo": 1}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if dials != 1 {
+		t.Fatalf("expected the deletes to be sent once, got %d attempts", dials)
+	}
+}
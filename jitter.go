@@ -0,0 +1,54 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"math"
+	"math/rand"
+)
+
+// jitterItem returns item, or a copy of it with its expiration spread by
+// the jitter in effect for opts.
+func (c *Client) jitterItem(item *Item, opts []CallOption) *Item {
+	fraction := c.ExpirationJitter
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.hasJitter {
+		fraction = o.jitter
+	}
+	exp := jitterExpiration(item.Expiration, fraction)
+	if exp == item.Expiration {
+		return item
+	}
+	it := *item
+	it.Expiration = exp
+	return &it
+}
+
+// jitterExpiration spreads the relative expiration exp by up to fraction
+// of it either way, keeping it relative and at least a second. Items that
+// never expire, or expire at a Unix time, are left alone.
+func jitterExpiration(exp int32, fraction float64) int32 {
+	if fraction <= 0 || exp <= 0 || exp > maxRelativeExpiration {
+		return exp
+	}
+	d := int32(math.Round(float64(exp) * fraction * (2*rand.Float64() - 1)))
+	return max(1, min(exp+d, maxRelativeExpiration))
+}
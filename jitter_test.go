@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestExpirationJitter(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.ExpirationJitter = 0.1
+
+	seen := make(map[int32]bool)
+	for i := 0; i < 50; i++ {
+		item := &Item{Key: "k" + strconv.Itoa(i), Value: []byte("v"), Expiration: 1000}
+		if err := client.Set(item); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if item.Expiration != 1000 {
+			t.Fatalf("expected the item of the caller to be left alone, got %d", item.Expiration)
+		}
+		exp := s.item(item.Key).exp
+		if exp < 900 || exp > 1100 {
+			t.Fatalf("expected an expiration within 10%% of 1000, got %d", exp)
+		}
+		seen[exp] = true
+	}
+	if len(seen) < 10 {
+		t.Fatalf("expected spread expirations, got %d distinct ones", len(seen))
+	}
+
+	// Items never expiring or expiring at a Unix time are left alone, and
+	// calls can override the setting.
+	for _, exp := range []int32{0, 1900000000} {
+		client.Set(&Item{Key: "fixed", Value: []byte("v"), Expiration: exp})
+		if got := s.item("fixed").exp; got != exp {
+			t.Fatalf("expected expiration %d, got %d", exp, got)
+		}
+	}
+	client.Set(&Item{Key: "exact", Value: []byte("v"), Expiration: 1000}, WithExpirationJitter(0))
+	if got := s.item("exact").exp; got != 1000 {
+		t.Fatalf("expected no jitter, got %d", got)
+	}
+	ns := client.Namespace("ns")
+	ns.ExpirationJitter = -1
+	ns.Set(context.Background(), &Item{Key: "exact", Value: []byte("v"), Expiration: 1000})
+	nkey, _ := ns.Key(context.Background(), "exact")
+	if got := s.item(nkey).exp; got != 1000 {
+		t.Fatalf("expected the namespace to disable jitter, got %d", got)
+	}
+}
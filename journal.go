@@ -0,0 +1,191 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DefaultJournalKeys is the default number of keys kept by a Journal.
+const DefaultJournalKeys = 10000
+
+// Journal is an append-only file of recently written keys. Values are not
+// recorded. A process that restarts can read the keys back with Keys and
+// re-warm the cache from its backing store before taking traffic.
+//
+// Every key is appended with a single write, so a crashed process loses at
+// most a partially written last line, which is ignored when the journal is
+// reopened. The file is compacted once it holds twice as many lines as the
+// keys it keeps.
+type Journal struct {
+	path    string
+	maxKeys int
+
+	mu    sync.Mutex
+	f     *os.File
+	seq   uint64
+	keys  map[string]uint64 // key to the sequence number of its last write
+	lines int
+}
+
+// OpenJournal opens or creates the journal at path, keeping the maxKeys most
+// recently written keys. If maxKeys is zero, DefaultJournalKeys is used.
+func OpenJournal(path string, maxKeys int) (*Journal, error) {
+	if maxKeys <= 0 {
+		maxKeys = DefaultJournalKeys
+	}
+	j := &Journal{path: path, maxKeys: maxKeys, keys: make(map[string]uint64)}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// load reads the keys recorded in an existing journal file.
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			// A final line without a newline was cut short by a crash.
+			return nil
+		}
+		if key := line[:len(line)-1]; key != "" {
+			j.seq++
+			j.keys[key] = j.seq
+		}
+	}
+}
+
+// Record appends key to the journal.
+func (j *Journal) Record(key string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return os.ErrClosed
+	}
+	if _, err := j.f.WriteString(key + "\n"); err != nil {
+		return err
+	}
+	j.seq++
+	j.keys[key] = j.seq
+	j.lines++
+	if j.lines >= 2*j.maxKeys {
+		return j.compact()
+	}
+	return nil
+}
+
+// Keys returns the journaled keys, most recently written first.
+func (j *Journal) Keys() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	keys := j.sortedKeys()
+	return keys[:min(len(keys), j.maxKeys)]
+}
+
+// sortedKeys returns the keys, most recently written first. j.mu must be
+// held or j not yet shared.
+func (j *Journal) sortedKeys() []string {
+	keys := make([]string, 0, len(j.keys))
+	for key := range j.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool { return j.keys[keys[a]] > j.keys[keys[b]] })
+	return keys
+}
+
+// compact drops all but the maxKeys most recent keys and rewrites the file
+// with one line per key, replacing it atomically.
+func (j *Journal) compact() error {
+	keys := j.sortedKeys()
+	if len(keys) > j.maxKeys {
+		for _, key := range keys[j.maxKeys:] {
+			delete(j.keys, key)
+		}
+		keys = keys[:j.maxKeys]
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for i := len(keys) - 1; i >= 0; i-- {
+		w.WriteString(keys[i])
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), j.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if j.f != nil {
+		j.f.Close()
+	}
+	j.f = f
+	j.lines = len(keys)
+	return nil
+}
+
+// Close flushes the journal to stable storage and closes it.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return os.ErrClosed
+	}
+	err := j.f.Sync()
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	j.f = nil
+	return err
+}
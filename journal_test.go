@@ -0,0 +1,85 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJournalRecordsSets(t *testing.T) {
+	srv := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := OpenJournal(path, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.Journal = j
+	for _, key := range []string{"a", "b", "a", "c"} {
+		if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Simulate a crash in the middle of a write.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString("partial")
+	f.Close()
+
+	j, err = OpenJournal(path, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer j.Close()
+	want := []string{"c", "a", "b"}
+	if got := j.Keys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected keys %q, got %q", want, got)
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := OpenJournal(path, 2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer j.Close()
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if err := j.Record(key); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines > 4 {
+		t.Fatalf("expected the journal to be compacted, got %d lines", lines)
+	}
+	want := []string{"e", "d"}
+	if got := j.Keys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected keys %q, got %q", want, got)
+	}
+}
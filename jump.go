@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"net"
+	"sync"
+)
+
+// JumpHash is a ServerSelector using jump consistent hashing, for
+// deployments of numbered shards. It needs no ring and does not allocate,
+// so it stays fast with many servers. Servers are numbered in the order
+// given to SetServers: appending a server moves only the keys it takes
+// over, but removing one other than the last remaps the keys of every
+// shard after it, so keep the order stable. It implements FailoverSelector
+// and EjectingSelector and is safe for concurrent use.
+type JumpHash struct {
+	// OnChange, if not nil, is called after SetServers changes the
+	// shards, with the shards added and removed. It must be set before
+	// the selector is first used.
+	OnChange func(added, removed []net.Addr)
+
+	notifier
+
+	mu      sync.RWMutex
+	addrs   []net.Addr
+	ejected ejections
+}
+
+// SetServers sets the shards, numbered from 0 in order, resolving their
+// addresses as ServerList.SetServers does. Weights are not supported.
+func (jh *JumpHash) SetServers(servers ...string) error {
+	naddr := make([]net.Addr, len(servers))
+	for i, server := range servers {
+		addr, err := resolveServer(server)
+		if err != nil {
+			return err
+		}
+		naddr[i] = addr
+	}
+
+	jh.mu.Lock()
+	prev := jh.addrs
+	jh.addrs = naddr
+	jh.ejected.prune(naddr)
+	jh.mu.Unlock()
+
+	jh.notify(jh.OnChange, prev, naddr)
+	return nil
+}
+
+// Each iterates over each server calling the given function.
+func (jh *JumpHash) Each(f func(net.Addr) error) error {
+	jh.mu.RLock()
+	defer jh.mu.RUnlock()
+	for _, a := range jh.addrs {
+		if err := f(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Select returns the shard of key, or the next healthy one if it is
+// ejected.
+func (jh *JumpHash) Select(key string) (net.Addr, error) {
+	return jh.SelectFailover(key, 0)
+}
+
+// SelectFailover returns the healthy shard attempt positions after the one
+// Select picks for key.
+func (jh *JumpHash) SelectFailover(key string, attempt int) (net.Addr, error) {
+	jh.mu.RLock()
+	defer jh.mu.RUnlock()
+
+	n := len(jh.addrs)
+	healthy := n
+	if len(jh.ejected) > 0 {
+		for _, addr := range jh.addrs {
+			if jh.ejected.has(addr) {
+				healthy--
+			}
+		}
+	}
+	if healthy == 0 {
+		return nil, ErrNoServers
+	}
+	attempt %= healthy
+	i := jump(fnv64a(key), n)
+	for k := 0; k < n; k++ {
+		addr := jh.addrs[(i+k)%n]
+		if jh.ejected.has(addr) {
+			continue
+		}
+		if attempt == 0 {
+			return addr, nil
+		}
+		attempt--
+	}
+	return nil, ErrNoServers
+}
+
+// Eject stops selecting the shard at addr. Its keys move to the next
+// healthy shard.
+func (jh *JumpHash) Eject(addr net.Addr) {
+	jh.mu.Lock()
+	defer jh.mu.Unlock()
+	jh.ejected.add(addr)
+}
+
+// Restore undoes one Eject of the shard at addr.
+func (jh *JumpHash) Restore(addr net.Addr) {
+	jh.mu.Lock()
+	defer jh.mu.Unlock()
+	jh.ejected.remove(addr)
+}
+
+// jump maps key onto one of n buckets with the jump consistent hash of
+// Lamping and Veach.
+func jump(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// fnv64a returns the 64-bit FNV-1a hash of s.
+func fnv64a(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
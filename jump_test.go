@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestJump(t *testing.T) {
+	// Growing from n to n+1 buckets moves a key to the new bucket or not
+	// at all.
+	for k := 0; k < 1000; k++ {
+		key := fnv64a(strconv.Itoa(k))
+		prev := jump(key, 1)
+		if prev != 0 {
+			t.Fatalf("expected bucket 0 of 1, got %d", prev)
+		}
+		for n := 2; n <= 100; n++ {
+			b := jump(key, n)
+			if b != prev && b != n-1 {
+				t.Fatalf("key %d: expected bucket %d or %d of %d, got %d", k, prev, n-1, n, b)
+			}
+			prev = b
+		}
+	}
+}
+
+func TestJumpHashGrowth(t *testing.T) {
+	before, after := new(JumpHash), new(JumpHash)
+	before.SetServers(ringServers...)
+	after.SetServers(append(ringServers, "10.0.0.5:11211")...)
+
+	const keys = 10000
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := "key" + strconv.Itoa(i)
+		a, _ := before.Select(key)
+		b, _ := after.Select(key)
+		if a.String() != b.String() {
+			if b.String() != "10.0.0.5:11211" {
+				t.Fatalf("expected %s to stay on %s or move to the new shard, got %s", key, a, b)
+			}
+			moved++
+		}
+	}
+	if moved < keys*15/100 || moved > keys*25/100 {
+		t.Fatalf("expected a fifth of the keys to move, got %d of %d", moved, keys)
+	}
+}
+
+func TestJumpHashFailoverAndEject(t *testing.T) {
+	jh := new(JumpHash)
+	jh.SetServers(ringServers...)
+
+	primary, _ := jh.Select("foo")
+	next, _ := jh.SelectFailover("foo", 1)
+	if next.String() == primary.String() {
+		t.Fatalf("expected failover to another shard, got %s", next)
+	}
+	jh.Eject(primary)
+	if addr, _ := jh.Select("foo"); addr.String() != next.String() {
+		t.Fatalf("expected foo to move to %s, got %s", next, addr)
+	}
+	if addr, _ := jh.SelectFailover("foo", 3); addr.String() != next.String() {
+		t.Fatalf("expected failover to wrap around to %s, got %s", next, addr)
+	}
+	jh.Restore(primary)
+	if addr, _ := jh.Select("foo"); addr.String() != primary.String() {
+		t.Fatalf("expected foo back on %s, got %s", primary, addr)
+	}
+}
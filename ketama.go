@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"math"
+	"net"
+	"strconv"
+)
+
+// RingCompat selects how a HashRing places servers and hashes keys.
+type RingCompat int
+
+const (
+	// RingNative places VirtualNodes points per server and hashes keys
+	// with the Hasher of the ring.
+	RingNative RingCompat = iota
+
+	// RingLibmemcached builds the ring like libmemcached's weighted ketama
+	// distribution with MD5 hashing, as used by php-memcached with
+	// libketama_compatible. Servers are named "host", or "host:port" when
+	// the port is not 11211, as they were given to SetServers.
+	RingLibmemcached
+
+	// RingSpymemcached builds the ring like spymemcached's
+	// KetamaNodeLocator with the KETAMA_HASH algorithm. Servers are named
+	// like Java's InetSocketAddress, "ip:port" or "host/ip:port". Weights
+	// are ignored.
+	RingSpymemcached
+)
+
+// ketamaPointsPerServer is the number of points of a server of average
+// weight on a ketama ring.
+const ketamaPointsPerServer = 160
+
+// ketamaPoints returns the points of servers, resolved to addrs, placed as
+// the client selected by compat does.
+func ketamaPoints(compat RingCompat, servers []WeightedServer, addrs []net.Addr) []ringPoint {
+	total := 0
+	for _, s := range servers {
+		total += s.Weight
+	}
+
+	var points []ringPoint
+	for i, s := range servers {
+		n := ketamaPointsPerServer
+		if compat == RingLibmemcached {
+			// libmemcached computes the share in single precision.
+			pct := float32(s.Weight) / float32(total)
+			n = int(math.Floor(float64(pct*ketamaPointsPerServer/4*float32(len(servers)))+0.0000000001)) * 4
+		}
+		name := ketamaName(compat, s.Addr, addrs[i])
+		for d := 0; d < n/4; d++ {
+			sum := md5.Sum([]byte(name + "-" + strconv.Itoa(d)))
+			for h := 0; h < 4; h++ {
+				points = append(points, ringPoint{hash: binary.LittleEndian.Uint32(sum[h*4:]), server: i})
+			}
+		}
+	}
+	return points
+}
+
+// ketamaName returns the name under which compat places the server given
+// as server and resolved to addr.
+func ketamaName(compat RingCompat, server string, addr net.Addr) string {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		// Unix sockets and hosts without a port.
+		return server
+	}
+	if compat == RingSpymemcached {
+		if net.ParseIP(host) != nil {
+			return addr.String()
+		}
+		return host + "/" + addr.String()
+	}
+	if port == "11211" {
+		return host
+	}
+	return host + ":" + port
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// maxKeyLength is the longest key memcached accepts.
+const maxKeyLength = 250
+
+// KeyTransformer rewrites a key before it is used to select a server and
+// sent on the wire. Returning an error fails the operation, which lets a
+// step reject keys, for example ones that do not belong to the caller's
+// tenant.
+type KeyTransformer interface {
+	TransformKey(key string) (string, error)
+}
+
+// KeyTransformerFunc adapts a function to a KeyTransformer.
+type KeyTransformerFunc func(key string) (string, error)
+
+// TransformKey calls f(key).
+func (f KeyTransformerFunc) TransformKey(key string) (string, error) {
+	return f(key)
+}
+
+// PrefixKeys returns a KeyTransformer that prepends prefix to every key.
+func PrefixKeys(prefix string) KeyTransformer {
+	return KeyTransformerFunc(func(key string) (string, error) {
+		return prefix + key, nil
+	})
+}
+
+// RequireKeyPrefix returns a KeyTransformer that rejects keys not starting
+// with prefix with ErrMalformedKey, as a guard against crossing tenants.
+func RequireKeyPrefix(prefix string) KeyTransformer {
+	return KeyTransformerFunc(func(key string) (string, error) {
+		if !strings.HasPrefix(key, prefix) {
+			return "", fmt.Errorf("%w: %q lacks prefix %q", ErrMalformedKey, key, prefix)
+		}
+		return key, nil
+	})
+}
+
+// EscapeKeys returns a KeyTransformer that percent-encodes the whitespace
+// and control characters memcached does not allow in keys, as well as '%'
+// itself.
+func EscapeKeys() KeyTransformer {
+	return KeyTransformerFunc(func(key string) (string, error) {
+		var b strings.Builder
+		for i := 0; i < len(key); i++ {
+			ch := key[i]
+			if ch <= ' ' || ch == 0x7f || ch == '%' {
+				fmt.Fprintf(&b, "%%%02X", ch)
+			} else {
+				b.WriteByte(ch)
+			}
+		}
+		return b.String(), nil
+	})
+}
+
+// HashLongKeys returns a KeyTransformer that shortens keys longer than
+// maxLen by replacing their tail with the hex SHA-256 of the whole key. If
+// maxLen is zero, memcached's limit of 250 bytes is used; it is never less
+// than the 64 bytes of the hash.
+func HashLongKeys(maxLen int) KeyTransformer {
+	if maxLen <= 0 {
+		maxLen = maxKeyLength
+	}
+	maxLen = max(maxLen, sha256.Size*2)
+	return KeyTransformerFunc(func(key string) (string, error) {
+		if len(key) <= maxLen {
+			return key, nil
+		}
+		sum := sha256.Sum256([]byte(key))
+		return key[:maxLen-sha256.Size*2] + hex.EncodeToString(sum[:]), nil
+	})
+}
+
+// transformKey runs key through KeyTransformers in order and rejects the
+// result with ErrMalformedKey if it cannot be sent on the wire.
+func (c *Client) transformKey(key string) (string, error) {
+	for _, t := range c.KeyTransformers {
+		var err error
+		if key, err = t.TransformKey(key); err != nil {
+			return "", err
+		}
+	}
+	if !legalKey(key) {
+		return "", ErrMalformedKey
+	}
+	return key, nil
+}
+
+// legalKey reports whether key can be sent on the wire: it is at most
+// maxKeyLength bytes long and holds no spaces or control characters, which
+// would end the key early and let the rest run as another command.
+func legalKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyTransformers(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.KeyTransformers = []KeyTransformer{
+		RequireKeyPrefix("acme:"),
+		EscapeKeys(),
+		PrefixKeys("v2:"),
+		HashLongKeys(0),
+	}
+
+	long := "acme:" + strings.Repeat("x", 300)
+	for _, key := range []string{"acme:a b", long} {
+		if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		it, err := client.Get(key)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if it.Key != key {
+			t.Fatalf("expected the original key %q, got %q", key, it.Key)
+		}
+	}
+	if srv.item("v2:acme:a%20b") == nil {
+		t.Fatalf("expected the key to be escaped and prefixed, got commands %q", srv.commands())
+	}
+
+	items, err := client.GetMulti([]string{"acme:a b", long, "acme:missing"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(items) != 2 || items["acme:a b"] == nil || items[long].Key != long {
+		t.Fatalf("expected items keyed by the original keys, got %v", items)
+	}
+
+	if err := client.Delete("other:a"); !errors.Is(err, ErrMalformedKey) {
+		t.Fatalf("expected ErrMalformedKey, got %v", err)
+	}
+}
+
+func TestHashLongKeys(t *testing.T) {
+	h := HashLongKeys(100)
+	key := strings.Repeat("k", 101)
+	got, _ := h.TransformKey(key)
+	if len(got) != 100 || !strings.HasPrefix(got, "kkkk") {
+		t.Fatalf("expected a 100 byte key keeping its prefix, got %q", got)
+	}
+	if other, _ := h.TransformKey(key + "x"); other == got {
+		t.Fatalf("expected distinct keys to hash differently")
+	}
+	if short, _ := h.TransformKey("short"); short != "short" {
+		t.Fatalf("expected short keys to be unchanged, got %q", short)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Paths of the service account credentials mounted in every pod.
+const (
+	serviceAccountDir       = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	serviceAccountToken     = serviceAccountDir + "token"
+	serviceAccountCA        = serviceAccountDir + "ca.crt"
+	serviceAccountNamespace = serviceAccountDir + "namespace"
+)
+
+// KubernetesSource is a ServerSource reading the ready endpoints of a
+// Kubernetes Service, typically the headless Service of a StatefulSet of
+// memcached pods, from its EndpointSlices. It talks to the API server
+// directly, with the service account of the pod by default, which needs
+// permission to list and watch endpointslices in the namespace.
+//
+// After the first lookup, every lookup waits for the endpoints to change
+// before answering, so that a Discovery follows scaling as it happens. A
+// KubernetesSource must not be used by several Discoveries at once.
+type KubernetesSource struct {
+	// Service is the name of the Service.
+	Service string
+
+	// Namespace is the namespace of the Service. If empty, the namespace
+	// of the pod is used.
+	Namespace string
+
+	// Port is the name of the port of the Service to use. If empty, the
+	// first port of the endpoints is used.
+	Port string
+
+	// APIServer is the URL of the API server. If empty, the in-cluster
+	// address is used.
+	APIServer string
+
+	// Token is the bearer token to authenticate with. If empty, the token
+	// of the service account is read for every request, as it rotates.
+	Token string
+
+	// HTTPClient sends the requests. If nil, a client trusting the CA of
+	// the service account is used.
+	HTTPClient *http.Client
+
+	mu              sync.Mutex
+	client          *http.Client
+	resourceVersion string // of the last list
+}
+
+// endpointSliceList is the part of a discovery.k8s.io/v1 EndpointSliceList
+// the source reads.
+type endpointSliceList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// Servers returns the ready endpoints of the Service. Every call but the
+// first waits for a change first, or until the API server ends the watch.
+func (s *KubernetesSource) Servers(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resourceVersion != "" {
+		if err := s.waitChange(ctx); err != nil {
+			return nil, err
+		}
+	}
+	var list endpointSliceList
+	if err := s.get(ctx, nil, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&list)
+	}); err != nil {
+		return nil, err
+	}
+	s.resourceVersion = list.Metadata.ResourceVersion
+
+	var servers []string
+	for _, item := range list.Items {
+		port := 0
+		for _, p := range item.Ports {
+			if s.Port == "" || p.Name == s.Port {
+				port = p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, ep := range item.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, a := range ep.Addresses {
+				servers = append(servers, net.JoinHostPort(a, strconv.Itoa(port)))
+			}
+		}
+	}
+	return servers, nil
+}
+
+// waitChange watches the EndpointSlices from the last list until the
+// first event.
+func (s *KubernetesSource) waitChange(ctx context.Context) error {
+	q := url.Values{"watch": {"1"}, "resourceVersion": {s.resourceVersion}}
+	return s.get(ctx, q, func(r io.Reader) error {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		err := json.NewDecoder(r).Decode(&event)
+		if err == io.EOF {
+			// The watch timed out without a change.
+			return nil
+		}
+		if err == nil && event.Type == "ERROR" {
+			// Usually 410 Gone for an expired resource version, which
+			// listing again fixes.
+			s.resourceVersion = ""
+		}
+		return err
+	})
+}
+
+// get requests the EndpointSlices of the Service with the extra query q
+// and passes the response body to read.
+func (s *KubernetesSource) get(ctx context.Context, q url.Values, read func(io.Reader) error) error {
+	base, ns, err := s.config()
+	if err != nil {
+		return err
+	}
+	if q == nil {
+		q = url.Values{}
+	}
+	q.Set("labelSelector", "kubernetes.io/service-name="+s.Service)
+	u := strings.TrimSuffix(base, "/") + "/apis/discovery.k8s.io/v1/namespaces/" + url.PathEscape(ns) + "/endpointslices?" + q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	token := s.Token
+	if token == "" {
+		b, err := os.ReadFile(serviceAccountToken)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("memcache: kubernetes API: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return read(resp.Body)
+}
+
+// config returns the API server URL and namespace to use, setting up the
+// HTTP client on first use.
+func (s *KubernetesSource) config() (base, ns string, err error) {
+	if s.client == nil {
+		s.client = s.HTTPClient
+		if s.client == nil {
+			s.client, err = inClusterHTTPClient()
+			if err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	base = s.APIServer
+	if base == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return "", "", errors.New("memcache: not running in a Kubernetes cluster")
+		}
+		base = "https://" + net.JoinHostPort(host, port)
+	}
+	ns = s.Namespace
+	if ns == "" {
+		b, err := os.ReadFile(serviceAccountNamespace)
+		if err != nil {
+			return "", "", err
+		}
+		ns = strings.TrimSpace(string(b))
+	}
+	return base, ns, nil
+}
+
+// inClusterHTTPClient returns a client trusting the CA of the service
+// account.
+func inClusterHTTPClient() (*http.Client, error) {
+	pem, err := os.ReadFile(serviceAccountCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("memcache: invalid service account CA")
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: tr}, nil
+}
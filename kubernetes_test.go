@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestKubernetesSource(t *testing.T) {
+	pods := `{"addresses": ["10.1.0.1"], "conditions": {"ready": true}},
+		{"addresses": ["10.1.0.2"], "conditions": {"ready": false}}`
+	watches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/cache/endpointslices" ||
+			r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=memcached" ||
+			r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("watch") != "" {
+			if r.URL.Query().Get("resourceVersion") != "7" {
+				http.Error(w, "bad resource version", http.StatusBadRequest)
+				return
+			}
+			// The StatefulSet scales up.
+			watches++
+			pods += `, {"addresses": ["10.1.0.3"]}`
+			fmt.Fprint(w, `{"type": "MODIFIED", "object": {}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"metadata": {"resourceVersion": "7"}, "items": [{
+			"endpoints": [%s],
+			"ports": [{"name": "metrics", "port": 9150}, {"name": "memcache", "port": 11211}]
+		}]}`, pods)
+	}))
+	defer srv.Close()
+
+	src := &KubernetesSource{
+		Service:    "memcached",
+		Namespace:  "cache",
+		Port:       "memcache",
+		APIServer:  srv.URL,
+		Token:      "secret",
+		HTTPClient: srv.Client(),
+	}
+	got, err := src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.1.0.1:11211"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	got, err = src.Servers(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"10.1.0.1:11211", "10.1.0.3:11211"}; !slices.Equal(got, want) || watches != 1 {
+		t.Fatalf("expected %v after 1 watch, got %v after %d", want, got, watches)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+)
+
+// kvAttempts bounds the round trips of the KV operations that race with
+// other clients: updates of the key registry and LoadOrStore.
+const kvAttempts = 10
+
+// KV is a map of values of type V kept in the cache, for callers who would
+// rather not deal with items, flags and expirations. Its methods follow
+// those of sync.Map.
+//
+// Memcached cannot list keys, so a KV also keeps a registry of its keys,
+// updated with CAS, for Range. The registry is a single item, so it suits
+// maps of up to some thousands of keys, and like any item it can be
+// evicted, after which Range sees only the keys stored since. A KV is safe
+// for concurrent use, also by several clients.
+type KV[V any] struct {
+	// Codec encodes the values. If nil, the Codec of the client is used.
+	Codec Codec
+
+	// Expiration is the expiration of the values, as Item.Expiration.
+	// Zero means they never expire.
+	Expiration int32
+
+	client *Client
+	name   string
+}
+
+// NewKV returns the map called name kept by c. Its keys are stored as
+// "kv:<name>:<key>".
+func NewKV[V any](c *Client, name string) *KV[V] {
+	return &KV[V]{client: c, name: name}
+}
+
+// Load returns the value of key and whether there is one.
+func (m *KV[V]) Load(ctx context.Context, key string, opts ...CallOption) (V, bool, error) {
+	var v V
+	it, err := m.client.GetContext(ctx, m.key(key), opts...)
+	if errors.Is(err, ErrCacheMiss) {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, err
+	}
+	if err := m.codec().Unmarshal(it.Value, it.Flags, &v); err != nil {
+		return v, false, err
+	}
+	return v, true, nil
+}
+
+// Store sets the value of key.
+func (m *KV[V]) Store(ctx context.Context, key string, v V, opts ...CallOption) error {
+	it, err := m.item(key, v)
+	if err != nil {
+		return err
+	}
+	if err := m.client.SetContext(ctx, it, opts...); err != nil {
+		return err
+	}
+	return m.register(ctx, key, true, opts)
+}
+
+// LoadOrStore returns the value of key if there is one. Otherwise, it
+// stores v and returns it. loaded reports whether the value was loaded.
+func (m *KV[V]) LoadOrStore(ctx context.Context, key string, v V, opts ...CallOption) (actual V, loaded bool, err error) {
+	it, err := m.item(key, v)
+	if err != nil {
+		return v, false, err
+	}
+	for i := 0; i < kvAttempts; i++ {
+		err = m.client.store(ctx, "add", it, opts)
+		if err == nil {
+			return v, false, m.register(ctx, key, true, opts)
+		}
+		if err != ErrNotStored {
+			return v, false, err
+		}
+		// The value can be deleted again before it is read.
+		if actual, loaded, err = m.Load(ctx, key, opts...); loaded || err != nil {
+			return actual, loaded, err
+		}
+	}
+	return v, false, ErrNotStored
+}
+
+// Delete deletes the value of key, if any.
+func (m *KV[V]) Delete(ctx context.Context, key string, opts ...CallOption) error {
+	err := m.client.DeleteContext(ctx, m.key(key), opts...)
+	if err != nil && !errors.Is(err, ErrCacheMiss) {
+		return err
+	}
+	return m.register(ctx, key, false, opts)
+}
+
+// Range calls fn for every key of the registry that has a value, in the
+// order the keys were first stored, until fn returns false. The values
+// are read in one GetMulti, so fn sees them as they were when Range
+// started.
+func (m *KV[V]) Range(ctx context.Context, fn func(key string, v V) bool, opts ...CallOption) error {
+	reg, err := m.client.gets(ctx, m.registryKey(), opts)
+	if errors.Is(err, ErrCacheMiss) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	keys := registryKeys(reg.Value)
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = m.key(key)
+	}
+	items, err := m.client.GetMultiContext(ctx, full, opts...)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		it, ok := items[full[i]]
+		if !ok {
+			continue
+		}
+		var v V
+		if err := m.codec().Unmarshal(it.Value, it.Flags, &v); err != nil {
+			return err
+		}
+		if !fn(key, v) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// register adds key to the registry, or removes it if add is false.
+func (m *KV[V]) register(ctx context.Context, key string, add bool, opts []CallOption) error {
+	var err error
+	for i := 0; i < kvAttempts; i++ {
+		var reg *Item
+		reg, err = m.client.gets(ctx, m.registryKey(), opts)
+		if errors.Is(err, ErrCacheMiss) {
+			if !add {
+				return nil
+			}
+			err = m.client.storePrimary(ctx, "add", &Item{Key: m.registryKey(), Value: []byte(key)}, opts)
+			if err == ErrNotStored {
+				continue
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		keys := registryKeys(reg.Value)
+		found := -1
+		for j, k := range keys {
+			if k == key {
+				found = j
+				break
+			}
+		}
+		switch {
+		case add && found >= 0, !add && found < 0:
+			return nil
+		case add:
+			keys = append(keys, key)
+		default:
+			keys = append(keys[:found], keys[found+1:]...)
+		}
+		reg.Value = []byte(strings.Join(keys, "\n"))
+		err = m.client.storePrimary(ctx, "cas", reg, opts)
+		if err != ErrCASConflict && err != ErrCacheMiss {
+			return err
+		}
+	}
+	return err
+}
+
+// registryKeys parses the value of a registry, one key per line.
+func registryKeys(value []byte) []string {
+	var keys []string
+	for _, line := range bytes.Split(value, []byte("\n")) {
+		if len(line) > 0 {
+			keys = append(keys, string(line))
+		}
+	}
+	return keys
+}
+
+// item returns the item storing v under key.
+func (m *KV[V]) item(key string, v V) (*Item, error) {
+	value, flags, err := m.codec().Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Item{Key: m.key(key), Value: value, Flags: flags, Expiration: m.Expiration}, nil
+}
+
+// key returns the cache key of key.
+func (m *KV[V]) key(key string) string {
+	return "kv:" + m.name + ":" + key
+}
+
+// registryKey returns the cache key of the registry.
+func (m *KV[V]) registryKey() string {
+	return "kv:" + m.name
+}
+
+// codec returns the Codec in effect.
+func (m *KV[V]) codec() Codec {
+	if m.Codec != nil {
+		return m.Codec
+	}
+	return m.client.codec()
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestKV(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	m := NewKV[int](client, "scores")
+	ctx := context.Background()
+
+	if _, ok, err := m.Load(ctx, "alice"); ok || err != nil {
+		t.Fatalf("expected no value, got %v, %v", ok, err)
+	}
+	if err := m.Store(ctx, "alice", 3); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if v, ok, err := m.Load(ctx, "alice"); v != 3 || !ok || err != nil {
+		t.Fatalf("expected 3, got %d, %v, %v", v, ok, err)
+	}
+	if v, loaded, err := m.LoadOrStore(ctx, "alice", 5); v != 3 || !loaded || err != nil {
+		t.Fatalf("expected to load 3, got %d, %v, %v", v, loaded, err)
+	}
+	if v, loaded, err := m.LoadOrStore(ctx, "bob", 5); v != 5 || loaded || err != nil {
+		t.Fatalf("expected to store 5, got %d, %v, %v", v, loaded, err)
+	}
+	if err := m.Store(ctx, "carol", 7); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := m.Delete(ctx, "bob"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := m.Delete(ctx, "nobody"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var got []string
+	err := m.Range(ctx, func(key string, v int) bool {
+		got = append(got, fmt.Sprintf("%s=%d", key, v))
+		return true
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fmt.Sprint(got) != "[alice=3 carol=7]" {
+		t.Fatalf("unexpected entries %v", got)
+	}
+}
+
+func TestKVConcurrentStores(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	m := NewKV[string](client, "users")
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := m.Store(ctx, fmt.Sprint("user", i), "x"); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	n := 0
+	m.Range(ctx, func(string, string) bool {
+		n++
+		return true
+	})
+	if n != 10 {
+		t.Fatalf("expected 10 entries, got %d", n)
+	}
+}
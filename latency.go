@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyWindow is the number of recent round trips to each server the
+// latency percentiles of ClientStats are computed from.
+const latencyWindow = 1024
+
+// ServerLatency holds the latency percentiles of the recent round trips to
+// a server, from sending a request to reading its response.
+type ServerLatency struct {
+	P50, P95, P99 time.Duration
+
+	// Samples is the number of round trips the percentiles were computed
+	// from, up to the last 1024.
+	Samples int
+}
+
+// serverLatencies keeps the latencies of the recent round trips to each
+// server.
+type serverLatencies struct {
+	mu      sync.Mutex
+	servers map[string]*latencyRing
+}
+
+// latencyRing holds the last latencyWindow latencies of a server.
+type latencyRing struct {
+	samples [latencyWindow]time.Duration
+	n       int // latencies observed so far
+}
+
+// observe records a round trip to addr that took d.
+func (l *serverLatencies) observe(addr net.Addr, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := l.servers[addr.String()]
+	if r == nil {
+		if l.servers == nil {
+			l.servers = make(map[string]*latencyRing)
+		}
+		r = new(latencyRing)
+		l.servers[addr.String()] = r
+	}
+	r.samples[r.n%latencyWindow] = d
+	r.n++
+}
+
+// percentiles returns the latency percentiles of every server observed.
+func (l *serverLatencies) percentiles() map[string]ServerLatency {
+	l.mu.Lock()
+	samples := make(map[string][]time.Duration, len(l.servers))
+	for addr, r := range l.servers {
+		samples[addr] = append([]time.Duration(nil), r.samples[:min(r.n, latencyWindow)]...)
+	}
+	l.mu.Unlock()
+
+	res := make(map[string]ServerLatency, len(samples))
+	for addr, s := range samples {
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		res[addr] = ServerLatency{
+			P50:     percentile(s, 0.50),
+			P95:     percentile(s, 0.95),
+			P99:     percentile(s, 0.99),
+			Samples: len(s),
+		}
+	}
+	return res
+}
+
+// percentile returns the q-th quantile of the sorted, non-empty s, by the
+// nearest-rank method.
+func percentile(s []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(s)))) - 1
+	return s[max(i, 0)]
+}
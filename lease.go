@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LeasePollInterval is how often GetLease checks a missing key while
+// another client holds its lease.
+const LeasePollInterval = 50 * time.Millisecond
+
+// Lease is the right, granted by GetLease, to compute the value of a key
+// that is missing or stale. Its holder stores the value with Set, or gives
+// the lease up with Release if it cannot compute it.
+type Lease struct {
+	// Key is the key the lease is for.
+	Key string
+
+	client *Client
+	token  string
+	start  time.Time
+}
+
+// GetLease gets key, handing out a lease on it when it is missing so that
+// a single client recomputes the value while the others wait, protecting
+// the backing store from a stampede of identical queries. The outcomes are:
+//
+//   - a hit: the item and no lease;
+//   - a miss: no item and a lease, after which the caller computes the value
+//     and stores it with Lease.Set;
+//   - a stale value, kept past its expiration because of
+//     StaleWhileRevalidate: the item and a lease if no other client holds
+//     one, in which case the caller can serve the item while recomputing
+//     the value, and else the item alone.
+//
+// While another client holds the lease of a missing key, GetLease polls the
+// key until its value is stored, or until the lease is released or
+// expires, after leaseTTL seconds, and is granted to this client. Leases
+// are locks taken with TryLock on the key with a "~lease" suffix. A lease
+// that never expires could leave the waiters polling forever, so leaseTTL
+// must be positive.
+func (c *Client) GetLease(ctx context.Context, key string, leaseTTL int32, opts ...CallOption) (*Item, *Lease, error) {
+	if leaseTTL <= 0 {
+		return nil, nil, fmt.Errorf("memcache: cannot lease %q with ttl %d", key, leaseTTL)
+	}
+	for {
+		it, err := c.GetContext(ctx, key, append(opts, withRawEnvelope())...)
+		if err == nil {
+			env, err := openEnvelope(it)
+			if err != nil {
+				return nil, nil, err
+			}
+			if env.expires.IsZero() || time.Now().Before(env.expires) {
+				return it, nil, nil
+			}
+			lease, err := c.lease(ctx, key, leaseTTL, opts)
+			if err == ErrLocked {
+				return it, nil, nil
+			}
+			return it, lease, err
+		}
+		if !errors.Is(err, ErrCacheMiss) || errors.Is(err, ErrNotFound) {
+			return nil, nil, err
+		}
+
+		lease, err := c.lease(ctx, key, leaseTTL, opts)
+		if err != ErrLocked {
+			return nil, lease, err
+		}
+		t := time.NewTimer(LeasePollInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// lease takes the lease on key.
+func (c *Client) lease(ctx context.Context, key string, ttl int32, opts []CallOption) (*Lease, error) {
+	token, err := c.TryLockContext(ctx, leaseKey(key), ttl, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{Key: key, client: c, token: token, start: time.Now()}, nil
+}
+
+// Set stores item, whose Key must be that of the lease, then releases the
+// lease. The item is kept in an envelope like the values stored by Fetch,
+// so that it can be served stale and refreshed early.
+func (l *Lease) Set(ctx context.Context, item *Item, opts ...CallOption) error {
+	if item.Key != l.Key {
+		return errors.New("memcache: lease for " + l.Key + " used to set " + item.Key)
+	}
+	if err := l.client.SetContext(ctx, l.client.fetchedItem(item, item.Expiration, time.Since(l.start)), opts...); err != nil {
+		return err
+	}
+	return l.Release(ctx, opts...)
+}
+
+// Release gives the lease up, letting another client take it at once.
+// Releasing a lease that expired is not an error.
+func (l *Lease) Release(ctx context.Context, opts ...CallOption) error {
+	err := l.client.UnlockContext(ctx, leaseKey(l.Key), l.token, opts...)
+	if err == ErrLockNotHeld {
+		return nil
+	}
+	return err
+}
+
+// leaseKey returns the key of the lease on key.
+func leaseKey(key string) string {
+	return key + "~lease"
+}
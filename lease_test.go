@@ -0,0 +1,119 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetLease(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	ctx := context.Background()
+
+	it, lease, err := client.GetLease(ctx, "k", 10)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it != nil || lease == nil {
+		t.Fatalf("expected a lease on a miss, got %v, %v", it, lease)
+	}
+
+	// Another client waits for the holder to store the value.
+	done := make(chan *Item)
+	go func() {
+		it, lease, err := client.GetLease(ctx, "k", 10)
+		if err != nil || lease != nil {
+			t.Errorf("expected the stored value without a lease, got %v, %v", lease, err)
+		}
+		done <- it
+	}()
+	time.Sleep(2 * LeasePollInterval)
+	if err := lease.Set(ctx, &Item{Key: "k", Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := <-done; it == nil || string(it.Value) != "v" {
+		t.Fatalf("expected the stored value, got %v", it)
+	}
+	if srv.item(leaseKey("k")) != nil {
+		t.Fatal("expected the lease to be released")
+	}
+}
+
+func TestGetLeaseRequiresTTL(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	if _, _, err := client.GetLease(context.Background(), "k", 0); err == nil {
+		t.Fatalf("expected an error for a lease without a ttl")
+	}
+	if srv.item(leaseKey("k")) != nil {
+		t.Fatal("expected no lease to be taken")
+	}
+}
+
+func TestGetLeaseReleased(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	ctx := context.Background()
+
+	_, lease, err := client.GetLease(ctx, "k", 10)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, lease, err := client.GetLease(ctx, "k", 10); err != nil || lease == nil {
+		t.Fatalf("expected a released lease to be granted again, got %v, %v", lease, err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 3*LeasePollInterval)
+	defer cancel()
+	if _, _, err := client.GetLease(tctx, "k", 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with ctx, got %v", err)
+	}
+}
+
+func TestGetLeaseStale(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.StaleWhileRevalidate = time.Minute
+	ctx := context.Background()
+
+	_, lease, _ := client.GetLease(ctx, "k", 10)
+	if err := lease.Set(ctx, &Item{Key: "k", Value: []byte("v"), Expiration: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it, lease, err := client.GetLease(ctx, "k", 10); err != nil || lease != nil || string(it.Value) != "v" {
+		t.Fatalf("expected a fresh hit, got %v, %v, %v", it, lease, err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	it, lease, err := client.GetLease(ctx, "k", 10)
+	if err != nil || lease == nil || string(it.Value) != "v" {
+		t.Fatalf("expected the stale value with a lease, got %v, %v, %v", it, lease, err)
+	}
+	it, other, err := client.GetLease(ctx, "k", 10)
+	if err != nil || other != nil || string(it.Value) != "v" {
+		t.Fatalf("expected the stale value without a lease, got %v, %v, %v", it, other, err)
+	}
+}
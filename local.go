@@ -0,0 +1,294 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// DefaultLocalTTL is the default time items stay in a LocalCache.
+const DefaultLocalTTL = time.Second
+
+// LocalCache is an in-process LRU cache of items in front of memcached,
+// for Client.Local. It absorbs the reads of hot keys, which it answers
+// without a round trip. Sets and Deletes through the client invalidate its
+// items, but writes by other processes are only seen once its items
+// expire, so its TTL bounds how stale reads can be. It is safe for
+// concurrent use.
+type LocalCache struct {
+	// MaxBytes, if positive, bounds the size of the keys and values
+	// cached, on top of the number of items. Least recently used items
+	// are evicted to make room, and items larger than MaxBytes are never
+	// cached. It must be set before the cache is first used.
+	MaxBytes int
+
+	// Admission, if set, only caches an item that must evict others if
+	// its key was read more often than theirs, as estimated by a
+	// TinyLFU-style frequency sketch, so that the items of a scan or of
+	// rarely read keys do not push out hot ones. Keys then need a few
+	// reads before they are cached in a full cache. It must be set before
+	// the cache is first used.
+	Admission bool
+
+	size int
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	lru    *list.List // of *localEntry, most recently used first
+	items  map[string]*list.Element
+	bytes  int    // size of the entries in lru
+	gen    uint64 // incremented by every invalidation
+	sketch *frequencySketch
+}
+
+// localEntry is an item of a LocalCache.
+type localEntry struct {
+	item    Item
+	expires time.Time
+}
+
+// size returns the bytes counted against LocalCache.MaxBytes for le.
+func (le *localEntry) size() int {
+	return len(le.item.Key) + len(le.item.Value)
+}
+
+// NewLocalCache returns a LocalCache holding up to size items for ttl
+// each. If ttl is zero, DefaultLocalTTL is used.
+func NewLocalCache(size int, ttl time.Duration) *LocalCache {
+	if ttl <= 0 {
+		ttl = DefaultLocalTTL
+	}
+	return &LocalCache{
+		size:  size,
+		ttl:   ttl,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Len returns the number of items cached, including expired ones not yet
+// evicted.
+func (l *LocalCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
+
+// Purge removes all items.
+func (l *LocalCache) Purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lru.Init()
+	clear(l.items)
+	l.bytes = 0
+	l.gen++
+}
+
+// get returns a copy of the item of key, if it is cached and not expired.
+func (l *LocalCache) get(key string) (*Item, bool) {
+	if l == nil {
+		return nil, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Admission {
+		l.frequencies().add(key)
+	}
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	le := e.Value.(*localEntry)
+	if time.Now().After(le.expires) {
+		l.removeElement(e)
+		return nil, false
+	}
+	l.lru.MoveToFront(e)
+	it := le.item
+	it.Value = append([]byte(nil), it.Value...)
+	return &it, true
+}
+
+// generation returns a value to pass to add for an item about to be read
+// from the servers.
+func (l *LocalCache) generation() uint64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.gen
+}
+
+// add caches a copy of it, read from the servers after generation returned
+// gen, unless an invalidation happened since, which it may predate.
+func (l *LocalCache) add(it *Item, gen uint64) {
+	if l == nil || l.size <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.gen != gen {
+		return
+	}
+	le := &localEntry{item: *it, expires: time.Now().Add(l.ttl)}
+	le.item.Value = append([]byte(nil), it.Value...)
+	if l.MaxBytes > 0 && le.size() > l.MaxBytes {
+		return
+	}
+	if e, ok := l.items[it.Key]; ok {
+		l.bytes += le.size() - e.Value.(*localEntry).size()
+		e.Value = le
+		l.lru.MoveToFront(e)
+		l.evict()
+		return
+	}
+	if l.Admission && !l.admit(le) {
+		return
+	}
+	l.items[it.Key] = l.lru.PushFront(le)
+	l.bytes += le.size()
+	l.evict()
+}
+
+// full reports whether n entries of the given size overflow l.
+func (l *LocalCache) full(n, bytes int) bool {
+	return n > l.size || l.MaxBytes > 0 && bytes > l.MaxBytes
+}
+
+// evict removes least recently used entries until l no longer overflows.
+// l.mu must be held.
+func (l *LocalCache) evict() {
+	for l.full(l.lru.Len(), l.bytes) {
+		l.removeElement(l.lru.Back())
+	}
+}
+
+// admit reports whether le, about to be added, was read more often than
+// every entry it would evict. l.mu must be held.
+func (l *LocalCache) admit(le *localEntry) bool {
+	freq := l.frequencies().estimate(le.item.Key)
+	n, bytes := l.lru.Len()+1, l.bytes+le.size()
+	for e := l.lru.Back(); e != nil && l.full(n, bytes); e = e.Prev() {
+		victim := e.Value.(*localEntry)
+		if l.frequencies().estimate(victim.item.Key) >= freq {
+			return false
+		}
+		n--
+		bytes -= victim.size()
+	}
+	return true
+}
+
+// frequencies returns the frequency sketch of l, creating it sized for the
+// items l holds. l.mu must be held.
+func (l *LocalCache) frequencies() *frequencySketch {
+	if l.sketch == nil {
+		l.sketch = newFrequencySketch(l.size)
+	}
+	return l.sketch
+}
+
+// removeElement removes the entry e. l.mu must be held.
+func (l *LocalCache) removeElement(e *list.Element) {
+	le := l.lru.Remove(e).(*localEntry)
+	delete(l.items, le.item.Key)
+	l.bytes -= le.size()
+}
+
+// remove invalidates the item of key.
+func (l *LocalCache) remove(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		l.removeElement(e)
+	}
+	l.gen++
+}
+
+// frequencySketch estimates how often keys were read with a count-min
+// sketch of small counters. All counters are halved once the sketch has
+// counted ten reads per counter of a row, so that keys that were hot once
+// fade, as in TinyLFU.
+type frequencySketch struct {
+	rows  [4][]uint8
+	mask  uint64
+	reads int
+}
+
+// maxFrequency is the value counters of a frequencySketch saturate at.
+const maxFrequency = 15
+
+// newFrequencySketch returns a sketch sized for the keys of n items.
+func newFrequencySketch(n int) *frequencySketch {
+	width := 16
+	for width < n {
+		width <<= 1
+	}
+	s := &frequencySketch{mask: uint64(width - 1)}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// counters returns the counter of key in each row.
+func (s *frequencySketch) counters(key string) [4]*uint8 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	// Double hashing: row i uses the counter at sum + i*step.
+	step := sum>>32 | 1
+	var cs [4]*uint8
+	for i := range s.rows {
+		cs[i] = &s.rows[i][(sum+uint64(i)*step)&s.mask]
+	}
+	return cs
+}
+
+// add counts a read of key.
+func (s *frequencySketch) add(key string) {
+	for _, c := range s.counters(key) {
+		if *c < maxFrequency {
+			*c++
+		}
+	}
+	if s.reads++; s.reads >= 10*len(s.rows[0]) {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] /= 2
+			}
+		}
+		s.reads /= 2
+	}
+}
+
+// estimate returns how often key was read, possibly overestimated.
+func (s *frequencySketch) estimate(key string) uint8 {
+	f := uint8(maxFrequency)
+	for _, c := range s.counters(key) {
+		f = min(f, *c)
+	}
+	return f
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocalCache(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	client.Local = NewLocalCache(2, time.Hour)
+
+	if err := client.Set(&Item{Key: "a", Value: []byte("1")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get("a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// Reads are now answered locally, even once the server lost the item.
+	s.mu.Lock()
+	delete(s.items, "a")
+	s.mu.Unlock()
+	it, err := client.Get("a")
+	if err != nil || string(it.Value) != "1" {
+		t.Fatalf("expected the local item, got %+v and %v", it, err)
+	}
+	it.Value[0] = 'x'
+	if items, err := client.GetMulti([]string{"a"}); err != nil || string(items["a"].Value) != "1" {
+		t.Fatalf("expected the local item unchanged, got %v and %v", items, err)
+	}
+
+	// Writes through the client invalidate it.
+	if err := client.Set(&Item{Key: "a", Value: []byte("2")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it, err := client.Get("a"); err != nil || string(it.Value) != "2" {
+		t.Fatalf("expected the new value, got %+v and %v", it, err)
+	}
+	if err := client.Delete("a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get("a"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss after Delete, got %v", err)
+	}
+
+	// GetMulti fills it, and it holds the most recently used items only.
+	for _, key := range []string{"b", "c", "d"} {
+		client.Set(&Item{Key: key, Value: []byte(key)})
+	}
+	if items, err := client.GetMulti([]string{"b", "c", "d"}); err != nil || len(items) != 3 {
+		t.Fatalf("expected 3 items, got %v and %v", items, err)
+	}
+	if n := client.Local.Len(); n != 2 {
+		t.Fatalf("expected 2 local items, got %d", n)
+	}
+}
+
+func TestLocalCacheTTL(t *testing.T) {
+	l := NewLocalCache(10, 10*time.Millisecond)
+	l.add(&Item{Key: "k", Value: []byte("v")}, l.generation())
+	if _, ok := l.get("k"); !ok {
+		t.Fatalf("expected a hit")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := l.get("k"); ok {
+		t.Fatalf("expected the item to expire")
+	}
+
+	// Items read before an invalidation are not cached.
+	gen := l.generation()
+	l.remove("other")
+	l.add(&Item{Key: "k", Value: []byte("old")}, gen)
+	if _, ok := l.get("k"); ok {
+		t.Fatalf("expected an item predating an invalidation not to be cached")
+	}
+}
+
+func TestLocalCacheMaxBytes(t *testing.T) {
+	l := NewLocalCache(10, time.Hour)
+	l.MaxBytes = 10
+	for _, key := range []string{"a", "b", "c"} {
+		l.add(&Item{Key: key, Value: []byte("vvv")}, l.generation())
+	}
+	if _, ok := l.get("a"); ok {
+		t.Fatalf("expected the least recently used item to be evicted")
+	}
+	if n := l.Len(); n != 2 {
+		t.Fatalf("expected 2 items, got %d", n)
+	}
+
+	// A larger value evicts as many items as it needs, and a value larger
+	// than the cache is never cached.
+	l.add(&Item{Key: "d", Value: []byte("vvvvvvv")}, l.generation())
+	if n := l.Len(); n != 1 {
+		t.Fatalf("expected 1 item, got %d", n)
+	}
+	l.add(&Item{Key: "e", Value: []byte("vvvvvvvvvv")}, l.generation())
+	if _, ok := l.get("e"); ok || l.Len() != 1 {
+		t.Fatalf("expected an oversized item not to be cached")
+	}
+}
+
+func TestLocalCacheAdmission(t *testing.T) {
+	l := NewLocalCache(2, time.Hour)
+	l.Admission = true
+	for _, key := range []string{"a", "b"} {
+		for i := 0; i < 3; i++ {
+			l.get(key)
+		}
+		l.add(&Item{Key: key, Value: []byte(key)}, l.generation())
+	}
+
+	// A key read once does not displace hot ones.
+	l.get("c")
+	l.add(&Item{Key: "c", Value: []byte("c")}, l.generation())
+	if _, ok := l.get("c"); ok {
+		t.Fatalf("expected a cold key not to be admitted")
+	}
+	if _, ok := l.get("a"); !ok {
+		t.Fatalf("expected the hot keys to stay cached")
+	}
+
+	// Once it is read more often than the least recently used key, it is.
+	for i := 0; i < 5; i++ {
+		l.get("c")
+	}
+	l.add(&Item{Key: "c", Value: []byte("c")}, l.generation())
+	if _, ok := l.get("c"); !ok {
+		t.Fatalf("expected a hot key to be admitted")
+	}
+	if _, ok := l.get("b"); ok {
+		t.Fatalf("expected the least recently used key to be evicted")
+	}
+}
+
+func TestFrequencySketchAging(t *testing.T) {
+	s := newFrequencySketch(16)
+	for i := 0; i < 8; i++ {
+		s.add("hot")
+	}
+	if f := s.estimate("hot"); f != 8 {
+		t.Fatalf("expected a frequency of 8, got %d", f)
+	}
+	for i := 0; i < 10*16; i++ {
+		s.add("other")
+	}
+	if f := s.estimate("hot"); f >= 8 {
+		t.Fatalf("expected the frequency to be halved, got %d", f)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLocked is returned by TryLock when another owner holds the lock.
+	ErrLocked = errors.New("memcache: lock is held")
+
+	// ErrLockNotHeld is returned by Unlock and RenewLock when the lock
+	// expired or was taken over by another owner.
+	ErrLockNotHeld = errors.New("memcache: lock not held")
+)
+
+// TryLock takes the lock named by key for ttl seconds without waiting,
+// returning a token identifying the owner, or ErrLocked if the lock is held.
+//
+// Locks are best effort: they are lost if the server restarts, evicts the
+// key or fails over, so they suit jobs where a rare double run is harmless.
+func (c *Client) TryLock(key string, ttl int32, opts ...CallOption) (string, error) {
+	return c.TryLockContext(context.Background(), key, ttl, opts...)
+}
+
+// TryLockContext is like TryLock but bounded by ctx.
+func (c *Client) TryLockContext(ctx context.Context, key string, ttl int32, opts ...CallOption) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b[:])
+	err := c.storePrimary(ctx, "add", &Item{Key: key, Value: []byte(token), Expiration: ttl}, opts)
+	if err == ErrNotStored {
+		return "", ErrLocked
+	}
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Unlock releases the lock named by key if token, returned by TryLock,
+// still owns it, and returns ErrLockNotHeld otherwise.
+func (c *Client) Unlock(key, token string, opts ...CallOption) error {
+	return c.UnlockContext(context.Background(), key, token, opts...)
+}
+
+// UnlockContext is like Unlock but bounded by ctx.
+func (c *Client) UnlockContext(ctx context.Context, key, token string, opts ...CallOption) error {
+	it, err := c.lockOwner(ctx, key, token, opts)
+	if err != nil {
+		return err
+	}
+	return lockResult(c.deleteCAS(ctx, key, it.casID, opts))
+}
+
+// RenewLock extends the lock named by key to expire ttl seconds from now if
+// token still owns it, and returns ErrLockNotHeld otherwise.
+func (c *Client) RenewLock(key, token string, ttl int32, opts ...CallOption) error {
+	return c.RenewLockContext(context.Background(), key, token, ttl, opts...)
+}
+
+// RenewLockContext is like RenewLock but bounded by ctx.
+func (c *Client) RenewLockContext(ctx context.Context, key, token string, ttl int32, opts ...CallOption) error {
+	it, err := c.lockOwner(ctx, key, token, opts)
+	if err != nil {
+		return err
+	}
+	it.Expiration = ttl
+	return lockResult(c.storePrimary(ctx, "cas", it, opts))
+}
+
+// AutoRenew renews the lock named by key for ttl seconds every third of
+// ttl in the background, until stop is called or a renewal fails. stop
+// waits for the renewals to end and returns the error that ended them, if
+// any; it does not release the lock. A lock without a positive ttl never
+// needs renewing, so stop then returns an error without renewing it.
+func (c *Client) AutoRenew(key, token string, ttl int32, opts ...CallOption) (stop func() error) {
+	if ttl <= 0 {
+		err := fmt.Errorf("memcache: cannot renew lock %q with ttl %d", key, ttl)
+		return func() error { return err }
+	}
+	interval := time.Duration(ttl) * time.Second / 3
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	var err error
+	go func() {
+		defer close(exited)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err = c.RenewLock(key, token, ttl, opts...); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() error {
+		once.Do(func() { close(done) })
+		<-exited
+		return err
+	}
+}
+
+// lockOwner gets the lock named by key, returning ErrLockNotHeld unless
+// token owns it.
+func (c *Client) lockOwner(ctx context.Context, key, token string, opts []CallOption) (*Item, error) {
+	it, err := c.gets(ctx, key, opts)
+	if errors.Is(err, ErrCacheMiss) {
+		return nil, ErrLockNotHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(it.Value, []byte(token)) {
+		return nil, ErrLockNotHeld
+	}
+	return it, nil
+}
+
+// lockResult maps the errors of a CAS-checked write to a lock that changed
+// hands since it was read to ErrLockNotHeld.
+func lockResult(err error) error {
+	if err == ErrCASConflict || err == ErrCacheMiss {
+		return ErrLockNotHeld
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta, ProtocolBinary} {
+		srv := newTestServer(t)
+		client, _ := NewClient([]string{srv.addr}, false)
+
+		token, err := client.TryLock("job", 30, WithProtocol(p))
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		if _, err := client.TryLock("job", 30, WithProtocol(p)); err != ErrLocked {
+			t.Fatalf("%v: expected ErrLocked, got %v", p, err)
+		}
+		if err := client.Unlock("job", "someone else", WithProtocol(p)); err != ErrLockNotHeld {
+			t.Fatalf("%v: expected ErrLockNotHeld, got %v", p, err)
+		}
+		if err := client.RenewLock("job", token, 60, WithProtocol(p)); err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		if exp := srv.item("job").exp; exp != 60 {
+			t.Fatalf("%v: expected the lock renewed for 60s, got %d", p, exp)
+		}
+		if err := client.Unlock("job", token, WithProtocol(p)); err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		if srv.item("job") != nil {
+			t.Fatalf("%v: expected the lock to be released", p)
+		}
+		if err := client.Unlock("job", token, WithProtocol(p)); err != ErrLockNotHeld {
+			t.Fatalf("%v: expected ErrLockNotHeld, got %v", p, err)
+		}
+	}
+}
+
+// droppingConn fails writes starting with prefix, simulating a server
+// that went down.
+type droppingConn struct {
+	net.Conn
+	prefix string
+}
+
+func (c *droppingConn) Write(b []byte) (int, error) {
+	if bytes.HasPrefix(b, []byte(c.prefix)) {
+		c.Conn.Close()
+		return 0, &net.OpError{Op: "write", Net: "tcp", Err: errors.New("connection reset by peer")}
+	}
+	return c.Conn.Write(b)
+}
+
+func TestUnlockBestEffort(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.BestEffort = true
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		nc, err := d.DialContext(ctx, network, addr)
+		return &droppingConn{Conn: nc, prefix: "md "}, err
+	}
+
+	token, err := client.TryLock("job", 30, WithProtocol(ProtocolMeta))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var ne net.Error
+	if err := client.Unlock("job", token, WithProtocol(ProtocolMeta)); !errors.As(err, &ne) {
+		t.Fatalf("expected the network error despite BestEffort, got %v", err)
+	}
+	if srv.item("job") == nil {
+		t.Fatalf("expected the lock to still be held")
+	}
+}
+
+func TestLockAutoRenew(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	token, err := client.TryLock("job", 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	before := srv.item("job").cas
+	stop := client.AutoRenew("job", token, 1)
+	time.Sleep(500 * time.Millisecond)
+	if err := stop(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if srv.item("job").cas == before {
+		t.Fatal("expected the lock to be renewed")
+	}
+
+	// A renewal of a lock taken over by another owner ends the renewals.
+	srv.mu.Lock()
+	srv.items["job"].value = []byte("other")
+	srv.mu.Unlock()
+	stop = client.AutoRenew("job", token, 1)
+	time.Sleep(500 * time.Millisecond)
+	if err := stop(); err != ErrLockNotHeld {
+		t.Fatalf("expected ErrLockNotHeld, got %v", err)
+	}
+
+	// Locks without a positive ttl are refused rather than renewed.
+	if err := client.AutoRenew("job", token, 0)(); err == nil {
+		t.Fatal("expected an error for a zero ttl")
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"runtime"
+)
+
+// DefaultMemoizeJitter is the ExpirationJitter of the results cached by
+// Memoize when the client has none.
+const DefaultMemoizeJitter = 0.1
+
+// Memoize returns a function caching the results of fn in c for ttl
+// seconds, as Item.Expiration, encoded with the Codec of c. Concurrent
+// calls with the same argument missing the cache share a single call of
+// fn, as with Client.Fetch, and expirations are spread by the
+// ExpirationJitter of c, or DefaultMemoizeJitter.
+//
+// Results are keyed on the name of fn and the JSON encoding of the
+// argument, which must depend on nothing else: closures created by one
+// function literal share their results, whatever they capture. Errors of
+// fn are not cached.
+func Memoize[K, V any](c *Client, ttl int32, fn func(context.Context, K) (V, error)) func(context.Context, K) (V, error) {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	var opts []CallOption
+	if c.ExpirationJitter == 0 {
+		opts = append(opts, WithExpirationJitter(DefaultMemoizeJitter))
+	}
+
+	return func(ctx context.Context, k K) (V, error) {
+		var v V
+		arg, err := json.Marshal(k)
+		if err != nil {
+			return v, err
+		}
+		sum := sha256.Sum256(append([]byte(name+"\x00"), arg...))
+		key := "memo:" + hex.EncodeToString(sum[:16])
+
+		item, err := c.fetch(ctx, key, ttl, func(ctx context.Context) (*Item, error) {
+			v, err := fn(ctx, k)
+			if err != nil {
+				return nil, err
+			}
+			value, flags, err := c.codec().Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return &Item{Value: value, Flags: flags}, nil
+		}, false, opts)
+		if err != nil {
+			return v, err
+		}
+		err = c.codec().Unmarshal(item.Value, item.Flags, &v)
+		return v, err
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoize(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	ctx := context.Background()
+
+	calls := 0
+	lookup := Memoize(client, 1000, func(ctx context.Context, id int) (testUser, error) {
+		calls++
+		if id == 0 {
+			return testUser{}, errors.New("no such user")
+		}
+		return testUser{ID: id, Name: "user"}, nil
+	})
+	for i := 0; i < 3; i++ {
+		u, err := lookup(ctx, 7)
+		if err != nil || u.ID != 7 {
+			t.Fatalf("expected user 7, got %+v and %v", u, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected one call, got %d", calls)
+	}
+	if u, err := lookup(ctx, 8); err != nil || u.ID != 8 || calls != 2 {
+		t.Fatalf("expected user 8 from a new call, got %+v and %v after %d calls", u, err, calls)
+	}
+	if _, err := lookup(ctx, 0); err == nil {
+		t.Fatalf("expected the error of the function")
+	}
+	if _, err := lookup(ctx, 0); err == nil || calls != 4 {
+		t.Fatalf("expected errors not to be cached, got %d calls", calls)
+	}
+
+	// Results are stored with the jitter and keyed per function.
+	s.mu.Lock()
+	n := 0
+	for _, it := range s.items {
+		if it.exp < 900 || it.exp > 1100 {
+			t.Errorf("expected an expiration within 10%% of 1000, got %d", it.exp)
+		}
+		n++
+	}
+	s.mu.Unlock()
+	if n != 2 {
+		t.Fatalf("expected 2 results cached, got %d", n)
+	}
+	double := Memoize(client, 1000, func(ctx context.Context, id int) (int, error) { return 2 * id, nil })
+	if v, err := double(ctx, 7); err != nil || v != 14 {
+		t.Fatalf("expected 14, got %d and %v", v, err)
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"hash/crc32"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSampleRate is the default fraction of keys inspected by a
+// MemoryEstimator.
+const DefaultSampleRate = 0.01
+
+// MemoryEstimator attributes server memory to key namespaces, which
+// memcached itself does not track. It samples the keys listed by Metadump,
+// scales the sampled sizes to the "bytes" statistic of each server and
+// projects when the cluster will start evicting from the observed fill rate.
+type MemoryEstimator struct {
+	Client *Client
+
+	// Namespace maps a key to the namespace it is attributed to. If nil,
+	// the part of the key before the first ':' is used.
+	Namespace func(key string) string
+
+	// SampleRate is the fraction of keys inspected, in (0, 1]. Keys are
+	// sampled by hash, so repeated estimates look at the same keys. If zero,
+	// DefaultSampleRate is used.
+	SampleRate float64
+
+	// Window is the minimum interval between the two statistics snapshots
+	// used to measure the fill rate. The estimate takes at least this long.
+	Window time.Duration
+}
+
+// NamespaceUsage is the estimated memory usage of a namespace.
+type NamespaceUsage struct {
+	SampledKeys    int
+	SampledBytes   uint64
+	EstimatedKeys  uint64
+	EstimatedBytes uint64
+	Share          float64 // fraction of used memory
+}
+
+// MemoryReport is the result of MemoryEstimator.Estimate.
+type MemoryReport struct {
+	Namespaces map[string]*NamespaceUsage
+
+	UsedBytes  uint64  // sum of the servers' "bytes" statistic
+	LimitBytes uint64  // sum of the servers' "limit_maxbytes" statistic
+	FillRate   float64 // bytes per second, negative when memory is shrinking
+	Evicting   bool    // whether any server evicted items during the window
+
+	// TimeToEviction projects when the cluster runs out of memory at the
+	// current fill rate. It is zero when evictions already happen and
+	// negative when memory is not growing.
+	TimeToEviction time.Duration
+}
+
+// serverSample is what the estimator gathers from a single server.
+type serverSample struct {
+	before, after map[string]string
+	elapsed       time.Duration
+	keys          map[string]*NamespaceUsage
+}
+
+func (e *MemoryEstimator) sampleRate() float64 {
+	if e.SampleRate > 0 && e.SampleRate <= 1 {
+		return e.SampleRate
+	}
+	return DefaultSampleRate
+}
+
+func (e *MemoryEstimator) namespace(key string) string {
+	if e.Namespace != nil {
+		return e.Namespace(key)
+	}
+	ns, _, _ := strings.Cut(key, ":")
+	return ns
+}
+
+// Estimate samples every server and returns the combined report.
+func (e *MemoryEstimator) Estimate(ctx context.Context) (*MemoryReport, error) {
+	var lk sync.Mutex
+	var samples []*serverSample
+	err := e.Client.eachServer(func(addr net.Addr) error {
+		s, err := e.sampleServer(ctx, addr)
+		if err != nil {
+			return err
+		}
+		lk.Lock()
+		defer lk.Unlock()
+		samples = append(samples, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MemoryReport{Namespaces: make(map[string]*NamespaceUsage)}
+	var evicted uint64
+	for _, s := range samples {
+		used := statUint(s.after, "bytes")
+		report.UsedBytes += used
+		report.LimitBytes += statUint(s.after, "limit_maxbytes")
+		evicted += statUint(s.after, "evictions") - min(statUint(s.before, "evictions"), statUint(s.after, "evictions"))
+		if secs := s.elapsed.Seconds(); secs > 0 {
+			report.FillRate += (float64(used) - float64(statUint(s.before, "bytes"))) / secs
+		}
+
+		// Scale this server's sample to its reported usage.
+		var sampledBytes uint64
+		for _, u := range s.keys {
+			sampledBytes += u.SampledBytes
+		}
+		items := statUint(s.after, "curr_items")
+		var sampledKeys int
+		for _, u := range s.keys {
+			sampledKeys += u.SampledKeys
+		}
+		for ns, u := range s.keys {
+			total := report.Namespaces[ns]
+			if total == nil {
+				total = new(NamespaceUsage)
+				report.Namespaces[ns] = total
+			}
+			total.SampledKeys += u.SampledKeys
+			total.SampledBytes += u.SampledBytes
+			if sampledBytes > 0 {
+				total.EstimatedBytes += uint64(float64(used) * float64(u.SampledBytes) / float64(sampledBytes))
+			}
+			if sampledKeys > 0 {
+				total.EstimatedKeys += uint64(float64(items) * float64(u.SampledKeys) / float64(sampledKeys))
+			}
+		}
+	}
+
+	for _, u := range report.Namespaces {
+		if report.UsedBytes > 0 {
+			u.Share = float64(u.EstimatedBytes) / float64(report.UsedBytes)
+		}
+	}
+
+	report.Evicting = evicted > 0
+	switch {
+	case report.Evicting || report.UsedBytes >= report.LimitBytes:
+		report.TimeToEviction = 0
+	case report.FillRate <= 0:
+		report.TimeToEviction = -1
+	default:
+		secs := float64(report.LimitBytes-report.UsedBytes) / report.FillRate
+		report.TimeToEviction = time.Duration(math.Min(secs, math.MaxInt64/float64(time.Second)) * float64(time.Second))
+	}
+	return report, nil
+}
+
+// sampleServer takes a statistics snapshot, samples the keys of addr and
+// takes a second snapshot at least Window after the first.
+func (e *MemoryEstimator) sampleServer(ctx context.Context, addr net.Addr) (*serverSample, error) {
+	c := e.Client
+	start := time.Now()
+	before, err := c.statsFromAddr(addr, "")
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := uint32(e.sampleRate() * math.MaxUint32)
+	keys := make(map[string]*NamespaceUsage)
+	err = c.Metadump(addr.String(), func(km KeyMeta) bool {
+		if crc32.ChecksumIEEE([]byte(km.Key)) > threshold {
+			return ctx.Err() == nil
+		}
+		ns := e.namespace(km.Key)
+		u := keys[ns]
+		if u == nil {
+			u = new(NamespaceUsage)
+			keys[ns] = u
+		}
+		u.SampledKeys++
+		u.SampledBytes += uint64(km.Size)
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if wait := e.Window - time.Since(start); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	after, err := c.statsFromAddr(addr, "")
+	if err != nil {
+		return nil, err
+	}
+	return &serverSample{before: before, after: after, elapsed: time.Since(start), keys: keys}, nil
+}
+
+// statUint returns the named statistic as an unsigned integer, or zero.
+func statUint(st map[string]string, name string) uint64 {
+	v, _ := strconv.ParseUint(st[name], 10, 64)
+	return v
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryEstimatorNamespaces(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	for i := 0; i < 30; i++ {
+		client.Set(&Item{Key: fmt.Sprintf("user:%d", i), Value: []byte(strings.Repeat("u", 100))})
+	}
+	for i := 0; i < 10; i++ {
+		client.Set(&Item{Key: fmt.Sprintf("session:%d", i), Value: []byte("s")})
+	}
+
+	e := &MemoryEstimator{Client: client, SampleRate: 1}
+	report, err := e.Estimate(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	users, sessions := report.Namespaces["user"], report.Namespaces["session"]
+	if users == nil || sessions == nil || len(report.Namespaces) != 2 {
+		t.Fatalf("expected user and session namespaces, got %v", report.Namespaces)
+	}
+	if users.SampledKeys != 30 || users.EstimatedKeys != 30 || sessions.SampledKeys != 10 {
+		t.Fatalf("unexpected key counts: user %+v, session %+v", users, sessions)
+	}
+	if users.EstimatedBytes+sessions.EstimatedBytes > report.UsedBytes || users.Share <= sessions.Share {
+		t.Fatalf("unexpected byte estimates: user %+v, session %+v, used %d", users, sessions, report.UsedBytes)
+	}
+	if report.TimeToEviction >= 0 {
+		t.Fatalf("expected no projected eviction while idle, got %v", report.TimeToEviction)
+	}
+}
+
+func TestMemoryEstimatorTimeToEviction(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for i := 0; ctx.Err() == nil; i++ {
+			client.Set(&Item{Key: fmt.Sprintf("k:%d", i), Value: []byte("value")})
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	e := &MemoryEstimator{Client: client, Window: 50 * time.Millisecond}
+	report, err := e.Estimate(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if report.FillRate <= 0 || report.TimeToEviction <= 0 {
+		t.Fatalf("expected a positive fill rate and time to eviction, got %v and %v", report.FillRate, report.TimeToEviction)
+	}
+}
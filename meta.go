@@ -0,0 +1,198 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	metaNoop = []byte("mn\r\n")
+
+	resultMetaHeader   = []byte("HD")
+	resultMetaNotStore = []byte("NS")
+	resultMetaExists   = []byte("EX")
+	resultMetaNotFound = []byte("NF")
+	resultMetaMiss     = []byte("EN\r\n")
+	resultMetaNoop     = []byte("MN\r\n")
+	resultMetaValue    = []byte("VA ")
+)
+
+// metaStoreModes maps storage verbs to the ms mode flag.
+var metaStoreModes = map[string]byte{
+	"set":     'S',
+	"add":     'E',
+	"replace": 'R',
+	"append":  'A',
+	"prepend": 'P',
+	"cas":     'S',
+}
+
+// appendMetaGet appends quiet mg requests for keys followed by a no-op, so
+// only hits are answered and the MN marks the end of the response.
+func appendMetaGet(b []byte, keys []string) []byte {
+	for _, key := range keys {
+		b = append(b, "mg "...)
+		b = append(b, key...)
+		b = append(b, " v f k c q"...)
+		b = append(b, crlf...)
+	}
+	return append(b, metaNoop...)
+}
+
+// parseMetaGet reads the response to a request built by appendMetaGet.
+func parseMetaGet(r *bufio.Reader, cb func(*Item)) error {
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+		switch {
+		case bytes.Equal(line, resultMetaNoop):
+			return nil
+		case bytes.Equal(line, resultMetaMiss):
+			continue
+		case !bytes.HasPrefix(line, resultMetaValue):
+			return unexpectedResponse(line)
+		}
+
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 {
+			return unexpectedResponse(line)
+		}
+		size, err := strconv.Atoi(fields[1])
+		if err != nil || size < 0 {
+			return unexpectedResponse(line)
+		}
+		it := new(Item)
+		for _, tok := range fields[2:] {
+			switch tok[0] {
+			case 'k':
+				it.Key = tok[1:]
+			case 'f':
+				flags, err := strconv.ParseUint(tok[1:], 10, 32)
+				if err != nil {
+					return unexpectedResponse(line)
+				}
+				it.Flags = uint32(flags)
+			case 'c':
+				if it.casID, err = strconv.ParseUint(tok[1:], 10, 64); err != nil {
+					return unexpectedResponse(line)
+				}
+			}
+		}
+
+		it.Value = make([]byte, size+2)
+		if _, err := io.ReadFull(r, it.Value); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(it.Value, crlf) {
+			return &ProtocolError{Reason: "corrupt get result read"}
+		}
+		it.Value = it.Value[:size]
+		cb(it)
+	}
+}
+
+// appendMetaStore appends an ms request storing it with the given verb.
+func appendMetaStore(b []byte, verb string, it *Item) []byte {
+	b = append(b, "ms "...)
+	b = append(b, it.Key...)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(it.Value)), 10)
+	b = append(b, " F"...)
+	b = strconv.AppendUint(b, uint64(it.Flags), 10)
+	b = append(b, " T"...)
+	b = strconv.AppendInt(b, int64(it.Expiration), 10)
+	b = append(b, " M"...)
+	b = append(b, metaStoreModes[verb])
+	if verb == "cas" {
+		b = append(b, " C"...)
+		b = strconv.AppendUint(b, it.casID, 10)
+	}
+	b = append(b, crlf...)
+	b = append(b, it.Value...)
+	return append(b, crlf...)
+}
+
+// appendMetaArithmetic appends an ma request for key, incrementing unless
+// verb is "decr", that returns the new value.
+func appendMetaArithmetic(b []byte, verb, key string, delta uint64) []byte {
+	b = append(b, "ma "...)
+	b = append(b, key...)
+	if verb == "decr" {
+		b = append(b, " MD"...)
+	}
+	b = append(b, " D"...)
+	b = strconv.AppendUint(b, delta, 10)
+	b = append(b, " v"...)
+	return append(b, crlf...)
+}
+
+// parseMetaArithmetic reads the response to a request built by
+// appendMetaArithmetic and returns the new value.
+func parseMetaArithmetic(r *bufio.Reader) (uint64, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(line, resultMetaValue) {
+		if bytes.HasPrefix(line, resultMetaNotFound) {
+			return 0, ErrCacheMiss
+		}
+		if err := errorResponse(line); err != nil {
+			return 0, err
+		}
+		return 0, unexpectedResponse(line)
+	}
+	value, err := r.ReadSlice('\n')
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(string(bytes.TrimSpace(value)), 10, 64)
+	if err != nil {
+		return 0, unexpectedResponse(value)
+	}
+	return n, nil
+}
+
+// parseMetaStatus reads the status line answering an ms or md request.
+func parseMetaStatus(r *bufio.Reader) error {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return err
+	}
+	switch {
+	case bytes.HasPrefix(line, resultMetaHeader):
+		return nil
+	case bytes.HasPrefix(line, resultMetaNotStore):
+		return ErrNotStored
+	case bytes.HasPrefix(line, resultMetaExists):
+		return ErrCASConflict
+	case bytes.HasPrefix(line, resultMetaNotFound):
+		return ErrCacheMiss
+	}
+	if err := errorResponse(line); err != nil {
+		return err
+	}
+	return unexpectedResponse(line)
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Outcome is how an operation ended, as reported to a MetricsRecorder.
+type Outcome int
+
+const (
+	// OutcomeHit is an operation that succeeded: a read that found its
+	// key, or a write that was applied.
+	OutcomeHit Outcome = iota
+
+	// OutcomeMiss is an operation that found its key missing, or not in
+	// the state it required: ErrCacheMiss and the errors matching it,
+	// ErrNotStored and ErrCASConflict.
+	OutcomeMiss
+
+	// OutcomeError is an operation that failed.
+	OutcomeError
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeHit:
+		return "hit"
+	case OutcomeMiss:
+		return "miss"
+	case OutcomeError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// OpMetrics describes an operation that ended.
+type OpMetrics struct {
+	// Op is the name of the operation, such as "get", "set" or
+	// "get_multi".
+	Op string
+
+	// Client is the Name of the client that ran the operation.
+	Client string
+
+	// Server is the address of the server the operation talked to, or ""
+	// if it talked to none or to several, as GetMulti does.
+	Server string
+
+	// Key is the key of the operation, as sent to the server, or "" if it
+	// had none or several.
+	Key string
+
+	// Duration is the time the operation took.
+	Duration time.Duration
+
+	// Outcome is how the operation ended.
+	Outcome Outcome
+
+	// Err is the error of the operation, before the client suppressed it,
+	// if any.
+	Err error
+}
+
+// Tracer traces the operations of a Client, for example by creating an
+// OpenTelemetry span for each of them.
+type Tracer interface {
+	// StartOp is called when the operation op starts under ctx. The
+	// operation runs under the returned context, so that the operations
+	// it starts in turn, such as the chunk reads of a chunked value, are
+	// nested in it. end is called with the metrics of the operation once
+	// it ended.
+	StartOp(ctx context.Context, op string) (_ context.Context, end func(OpMetrics))
+}
+
+// MetricsRecorder receives the metrics of every operation of a Client, so
+// that they can be exported to any metrics system without this package
+// depending on one. RecordOp is called synchronously at the end of each
+// operation, from the goroutine that ran it, so it must be fast and safe
+// for concurrent use.
+type MetricsRecorder interface {
+	RecordOp(OpMetrics)
+}
+
+// MultiRecorder returns a MetricsRecorder passing the metrics of every
+// operation to each of recorders in turn, so that a client can feed
+// several metrics systems, such as Prometheus and OpenTelemetry, at once.
+func MultiRecorder(recorders ...MetricsRecorder) MetricsRecorder {
+	return multiRecorder(append([]MetricsRecorder(nil), recorders...))
+}
+
+type multiRecorder []MetricsRecorder
+
+func (mr multiRecorder) RecordOp(m OpMetrics) {
+	for _, r := range mr {
+		r.RecordOp(m)
+	}
+}
+
+// outcomeOf returns the outcome of an operation that ended with err.
+func outcomeOf(err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeHit
+	case errors.Is(err, ErrCacheMiss), err == ErrNotStored, err == ErrCASConflict:
+		return OutcomeMiss
+	}
+	return OutcomeError
+}
+
+// slowOp reports the slow operation m to OnSlowOp.
+func (c *Client) slowOp(m OpMetrics) {
+	if c.OnSlowOp != nil {
+		c.OnSlowOp(m)
+		return
+	}
+	msg := "memcache: slow " + m.Op
+	if m.Key != "" {
+		msg += " " + strconv.Quote(m.Key)
+	}
+	if m.Server != "" {
+		msg += " on " + m.Server
+	}
+	log.Printf("%s: took %v (%v)", msg, m.Duration, m.Outcome)
+}
+
+// opTargets tracks the servers and keys an operation talked to and about.
+// Copies of a call, such as those of hedged requests, share it.
+type opTargets struct {
+	mu     sync.Mutex
+	server sole
+	key    sole
+}
+
+// sole tracks the values of something seen any number of times.
+type sole struct {
+	v    string // "" until a value is seen, or once several were
+	many bool
+}
+
+func (s *sole) add(v string) {
+	switch {
+	case s.v == "" && !s.many:
+		s.v = v
+	case s.v != v:
+		s.v = ""
+		s.many = true
+	}
+}
+
+// addServer notes that the operation talked to the server at addr. It
+// does nothing on a nil *opTargets.
+func (t *opTargets) addServer(addr net.Addr) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.server.add(addr.String())
+}
+
+// addKey notes that the operation was about the transformed key. It does
+// nothing on a nil *opTargets.
+func (t *opTargets) addKey(key string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.key.add(key)
+}
+
+// opMetrics returns the metrics of cl, which ended with err.
+func (c *Client) opMetrics(cl *call, err error) OpMetrics {
+	m := OpMetrics{
+		Op:       cl.op,
+		Client:   c.name,
+		Duration: time.Since(cl.start),
+		Outcome:  outcomeOf(err),
+		Err:      err,
+	}
+	if t := cl.targets; t != nil {
+		t.mu.Lock()
+		m.Server, m.Key = t.server.v, t.key.v
+		t.mu.Unlock()
+	}
+	return m
+}
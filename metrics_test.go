@@ -0,0 +1,185 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRecorder is a MetricsRecorder keeping what it receives.
+type testRecorder struct {
+	mu  sync.Mutex
+	ops []OpMetrics
+}
+
+func (r *testRecorder) RecordOp(m OpMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, m)
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{srv.addr}, false)
+	rec := new(testRecorder)
+	client.Metrics = rec
+
+	client.Set(&Item{Key: "k", Value: []byte("v")})
+	client.Get("k")
+	client.Get("missing")
+	client.Get("k", WithServer(down))
+	client.Child("jobs").Get("k")
+
+	want := []struct {
+		op      string
+		server  string
+		outcome Outcome
+		client  string
+	}{
+		{"set", srv.addr, OutcomeHit, ""},
+		{"get", srv.addr, OutcomeHit, ""},
+		{"get", srv.addr, OutcomeMiss, ""},
+		{"get", down, OutcomeError, ""},
+		{"get", srv.addr, OutcomeHit, "jobs"},
+	}
+	if len(rec.ops) != len(want) {
+		t.Fatalf("expected %d operations, got %+v", len(want), rec.ops)
+	}
+	for i, w := range want {
+		m := rec.ops[i]
+		if m.Op != w.op || m.Server != w.server || m.Outcome != w.outcome || m.Client != w.client {
+			t.Fatalf("operation %d: expected %+v, got %+v", i, w, m)
+		}
+		if m.Duration <= 0 {
+			t.Fatalf("operation %d: expected a duration, got %v", i, m.Duration)
+		}
+		if (m.Err != nil) != (w.outcome != OutcomeHit) {
+			t.Fatalf("operation %d: unexpected error %v", i, m.Err)
+		}
+	}
+}
+
+func TestMultiRecorder(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	a, b := new(testRecorder), new(testRecorder)
+	client.Metrics = MultiRecorder(a, b)
+
+	client.Get("missing")
+	for _, r := range []*testRecorder{a, b} {
+		if len(r.ops) != 1 || r.ops[0].Op != "get" || r.ops[0].Outcome != OutcomeMiss {
+			t.Fatalf("expected a get miss, got %+v", r.ops)
+		}
+	}
+}
+
+// testTracer is a Tracer keeping the spans it ends.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []OpMetrics
+}
+
+type spanKey struct{}
+
+func (tr *testTracer) StartOp(ctx context.Context, op string) (context.Context, func(OpMetrics)) {
+	return context.WithValue(ctx, spanKey{}, op), func(m OpMetrics) {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		tr.spans = append(tr.spans, m)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.KeyTransformers = []KeyTransformer{PrefixKeys("app:")}
+	tr := new(testTracer)
+	client.Tracer = tr
+
+	var dialed interface{}
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = ctx.Value(spanKey{})
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	client.Set(&Item{Key: "k", Value: []byte("v")})
+	client.Get("missing")
+	client.GetMulti([]string{"a", "b"})
+
+	if dialed != "set" {
+		t.Fatalf("expected the dial to run under the span of set, got %v", dialed)
+	}
+	want := []struct {
+		op, key string
+		outcome Outcome
+	}{
+		{"set", "app:k", OutcomeHit},
+		{"get", "app:missing", OutcomeMiss},
+		{"get_multi", "", OutcomeHit},
+	}
+	if len(tr.spans) != len(want) {
+		t.Fatalf("expected %d spans, got %+v", len(want), tr.spans)
+	}
+	for i, w := range want {
+		m := tr.spans[i]
+		if m.Op != w.op || m.Key != w.key || m.Outcome != w.outcome || m.Server != srv.addr {
+			t.Fatalf("span %d: expected %+v on %s, got %+v", i, w, srv.addr, m)
+		}
+	}
+}
+
+func TestSlowOp(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.SlowOpThreshold = time.Hour
+	var slow []OpMetrics
+	client.OnSlowOp = func(m OpMetrics) { slow = append(slow, m) }
+
+	client.Set(&Item{Key: "k", Value: []byte("v")})
+	if len(slow) != 0 {
+		t.Fatalf("expected no slow operations, got %+v", slow)
+	}
+
+	client.SlowOpThreshold = time.Nanosecond
+	client.Get("k")
+	if len(slow) != 1 || slow[0].Op != "get" || slow[0].Key != "k" || slow[0].Server != srv.addr || slow[0].Duration <= 0 {
+		t.Fatalf("expected a slow get of k on %s, got %+v", srv.addr, slow)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	client.OnSlowOp = nil
+	client.Get("missing")
+	if want := `memcache: slow get "missing" on ` + srv.addr + ": took "; !strings.Contains(buf.String(), want) || !strings.Contains(buf.String(), "(miss)") {
+		t.Fatalf("expected a log line containing %q, got %q", want, buf.String())
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import "context"
+
+// Operation is an operation passing through the middleware of a client.
+// Middleware may rewrite its keys and items before calling the next
+// handler.
+type Operation struct {
+	// Name is the name of the operation, as in OpMetrics: "get", "gets",
+	// "get_multi", "set", "add", "replace", "append", "prepend", "cas",
+	// "delete", "delete_cas", "incr", "decr", "set_multi", "delete_multi",
+	// "invalidate", "pipeline", "flush" or "ping". "delete_cas" deletes a
+	// key only if its CAS value is unchanged, as Unlock does.
+	Name string
+
+	// Key is the key of single-key operations, before the KeyTransformers
+	// of the client rewrite it.
+	Key string
+
+	// Keys are the keys of multi-key operations. Those of "invalidate" and
+	// "pipeline" are for inspection only; rewriting them has no effect.
+	Keys []string
+
+	// Item is the item of storage operations, whose key is replaced by Key
+	// if they differ.
+	Item *Item
+
+	// Items are the items of "set_multi".
+	Items []*Item
+}
+
+// item returns the item of op under its possibly rewritten key.
+func (op *Operation) item() *Item {
+	if op.Key == op.Item.Key {
+		return op.Item
+	}
+	it := *op.Item
+	it.Key = op.Key
+	return &it
+}
+
+// OpFunc runs an operation, as the client does once the middleware
+// called it.
+type OpFunc func(ctx context.Context, op *Operation) error
+
+// Use adds middleware wrapping every operation the client sends. The
+// middleware added first runs first. A middleware can inspect or rewrite
+// the operation, return an error without calling next to fail it, or call
+// next and inspect its error, for logging, authorization, key rewriting or
+// fault injection:
+//
+//	client.Use(func(next gomcache.OpFunc) gomcache.OpFunc {
+//		return func(ctx context.Context, op *gomcache.Operation) error {
+//			start := time.Now()
+//			err := next(ctx, op)
+//			log.Printf("%s %s: %v in %v", op.Name, op.Key, err, time.Since(start))
+//			return err
+//		}
+//	})
+//
+// A chunked value is set, read and deleted as one operation. A Get skipped
+// by a middleware returning nil is a cache miss. Use must be called before
+// the client is used; clients created by Child start with the middleware
+// of their parent.
+func (c *Client) Use(mw ...func(next OpFunc) OpFunc) {
+	c.middleware = append(c.middleware, mw...)
+}
+
+// interceptedKey marks the contexts of operations running through the
+// middleware.
+type interceptedKey struct{}
+
+// intercept runs fn for op through the middleware of c. Operations run as
+// part of another one, such as the chunk writes of a chunked set, skip the
+// middleware, which already saw the operation they belong to.
+func (c *Client) intercept(ctx context.Context, op *Operation, fn OpFunc) error {
+	if len(c.middleware) == 0 || ctx.Value(interceptedKey{}) != nil {
+		return fn(ctx, op)
+	}
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		fn = c.middleware[i](fn)
+	}
+	return fn(partOfOp(ctx), op)
+}
+
+// partOfOp returns ctx for operations run as part of one that already went
+// through the middleware.
+func partOfOp(ctx context.Context) context.Context {
+	return context.WithValue(ctx, interceptedKey{}, true)
+}
+
+// run runs fn as the operation op: through the middleware, then between
+// newCall and endCall with the operation as the middleware left it.
+func (c *Client) run(ctx context.Context, op *Operation, opts []CallOption, fn func(cl *call, op *Operation) error) error {
+	name := op.Name
+	return c.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		cl, err := c.newCall(ctx, name, opts)
+		if err != nil {
+			return err
+		}
+		defer c.endCall(cl, &err)
+		return fn(cl, op)
+	})
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	var calls []string
+	trace := func(name string) func(OpFunc) OpFunc {
+		return func(next OpFunc) OpFunc {
+			return func(ctx context.Context, op *Operation) error {
+				calls = append(calls, name+" "+op.Name)
+				return next(ctx, op)
+			}
+		}
+	}
+	errDenied := errors.New("denied")
+	client.Use(trace("outer"), trace("inner"), func(next OpFunc) OpFunc {
+		return func(ctx context.Context, op *Operation) error {
+			switch {
+			case op.Key == "secret":
+				return errDenied
+			case op.Key == "skipped":
+				return nil
+			case op.Key != "":
+				op.Key = "v2:" + op.Key
+			}
+			return next(ctx, op)
+		}
+	})
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := srv.item("v2:foo"); it == nil {
+		t.Fatalf("expected the key to be rewritten to v2:foo")
+	}
+	if it, err := client.Get("foo"); err != nil || string(it.Value) != "bar" {
+		t.Fatalf("expected bar, got %v, %v", it, err)
+	}
+	if _, err := client.Get("secret"); err != errDenied {
+		t.Fatalf("expected the middleware error, got %v", err)
+	}
+	if _, err := client.Get("skipped"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+	if items, err := client.GetMulti([]string{"v2:foo"}); err != nil || len(items) != 1 {
+		t.Fatalf("expected 1 item, got %v, %v", items, err)
+	}
+	if err := client.Delete("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []string{
+		"outer set", "inner set",
+		"outer get", "inner get",
+		"outer get", "inner get",
+		"outer get", "inner get",
+		"outer get_multi", "inner get_multi",
+		"outer delete", "inner delete",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected calls %q, got %q", want, calls)
+	}
+
+	calls = nil
+	client.Child("jobs").Delete("foo")
+	if len(calls) != 2 {
+		t.Fatalf("expected the child to run the middleware of its parent, got %q", calls)
+	}
+}
+
+func TestUseEveryOperation(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.ChunkSize = 4
+
+	var calls []string
+	client.Use(func(next OpFunc) OpFunc {
+		return func(ctx context.Context, op *Operation) error {
+			calls = append(calls, op.Name+" "+op.Key)
+			if op.Key != "" {
+				op.Key = "v2:" + op.Key
+			}
+			return next(ctx, op)
+		}
+	})
+
+	ctx := context.Background()
+	if _, err := client.Counter("hits").IncrBy(ctx, 1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.TryLock("job", 10); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Update("hits", func(old []byte) ([]byte, error) { return []byte("7"), nil }, 1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Set(&Item{Key: "big", Value: []byte("chunked value")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it, err := client.Get("big"); err != nil || string(it.Value) != "chunked value" {
+		t.Fatalf("expected the chunked value, got %v, %v", it, err)
+	}
+	if err := client.Ping("job"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []string{
+		"incr hits", "add hits",
+		"add job",
+		"gets hits", "cas hits",
+		"set big",
+		"get big",
+		"ping job",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected calls %q, got %q", want, calls)
+	}
+	for _, key := range []string{"v2:hits", "v2:job", "v2:big"} {
+		if srv.item(key) == nil {
+			t.Fatalf("expected %q to be rewritten once", key)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Namespace is a group of keys that can be invalidated at once, which
+// memcached has no command for. Its keys are prefixed with its name and a
+// version stored in memcached, under "ns:" followed by its name;
+// InvalidateNamespace replaces the version, making every key written
+// before unreachable, to be evicted in time. Every operation reads the
+// version first, which Client.Local can absorb.
+type Namespace struct {
+	// ExpirationJitter, if not zero, replaces the ExpirationJitter of the
+	// client for the items written to the namespace. Negative values
+	// disable jitter.
+	ExpirationJitter float64
+
+	client *Client
+	name   string
+}
+
+// Namespace returns the namespace called name.
+func (c *Client) Namespace(name string) *Namespace {
+	return &Namespace{client: c, name: name}
+}
+
+// InvalidateNamespace makes every key of the namespace called name
+// unreachable.
+func (c *Client) InvalidateNamespace(name string, opts ...CallOption) error {
+	return c.InvalidateNamespaceContext(context.Background(), name, opts...)
+}
+
+// InvalidateNamespaceContext is like InvalidateNamespace, but gives up when
+// ctx is done.
+func (c *Client) InvalidateNamespaceContext(ctx context.Context, name string, opts ...CallOption) error {
+	return c.SetContext(ctx, &Item{Key: namespaceVersionKey(name), Value: newNamespaceVersion()}, opts...)
+}
+
+// Key returns the key under which key is stored in the namespace now.
+func (n *Namespace) Key(ctx context.Context, key string, opts ...CallOption) (string, error) {
+	version, err := n.version(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	return n.name + ":" + string(version) + ":" + key, nil
+}
+
+// version returns the current version of the namespace, setting one if
+// it has none.
+func (n *Namespace) version(ctx context.Context, opts []CallOption) ([]byte, error) {
+	vkey := namespaceVersionKey(n.name)
+	it, err := n.client.GetContext(ctx, vkey, opts...)
+	if err == nil {
+		return it.Value, nil
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		return nil, err
+	}
+
+	// The first to start the namespace, or to find its version evicted,
+	// sets it; the others read it again.
+	version := newNamespaceVersion()
+	err = n.client.store(ctx, "add", &Item{Key: vkey, Value: version}, opts)
+	if err == ErrNotStored {
+		if it, err = n.client.GetContext(ctx, vkey, opts...); err != nil {
+			return nil, err
+		}
+		return it.Value, nil
+	}
+	return version, err
+}
+
+// Get gets the item of key in the namespace. Its Key is key.
+func (n *Namespace) Get(ctx context.Context, key string, opts ...CallOption) (*Item, error) {
+	nkey, err := n.Key(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	it, err := n.client.GetContext(ctx, nkey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	it.Key = key
+	return it, nil
+}
+
+// Set writes item, whose Key is a key in the namespace.
+func (n *Namespace) Set(ctx context.Context, item *Item, opts ...CallOption) error {
+	nkey, err := n.Key(ctx, item.Key, opts...)
+	if err != nil {
+		return err
+	}
+	it := *item
+	it.Key = nkey
+	if n.ExpirationJitter != 0 {
+		opts = append([]CallOption{WithExpirationJitter(n.ExpirationJitter)}, opts...)
+	}
+	return n.client.SetContext(ctx, &it, opts...)
+}
+
+// Delete deletes key in the namespace.
+func (n *Namespace) Delete(ctx context.Context, key string, opts ...CallOption) error {
+	nkey, err := n.Key(ctx, key, opts...)
+	if err != nil {
+		return err
+	}
+	return n.client.DeleteContext(ctx, nkey, opts...)
+}
+
+// namespaceVersionKey returns the key of the version of the namespace
+// called name.
+func namespaceVersionKey(name string) string {
+	return "ns:" + name
+}
+
+// newNamespaceVersion returns a version distinct from those before it.
+func newNamespaceVersion() []byte {
+	return strconv.AppendInt(nil, time.Now().UnixNano(), 36)
+}
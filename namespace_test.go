@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	s := newTestServer(t)
+	client, _ := NewClient([]string{s.addr}, false)
+	ctx := context.Background()
+	ns := client.Namespace("user:123")
+
+	if err := ns.Set(ctx, &Item{Key: "profile", Value: []byte("ada")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	version := s.item("ns:user:123")
+	if version == nil {
+		t.Fatalf("expected the version to be stored")
+	}
+	if s.item("user:123:"+string(version.value)+":profile") == nil {
+		t.Fatalf("expected the key to be prefixed with the namespace and version")
+	}
+	it, err := ns.Get(ctx, "profile")
+	if err != nil || string(it.Value) != "ada" || it.Key != "profile" {
+		t.Fatalf("expected ada under profile, got %+v and %v", it, err)
+	}
+
+	// Other namespaces are not affected by an invalidation.
+	other := client.Namespace("user:456")
+	if err := other.Set(ctx, &Item{Key: "profile", Value: []byte("bob")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.InvalidateNamespace("user:123"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := ns.Get(ctx, "profile"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss after the invalidation, got %v", err)
+	}
+	if it, err := other.Get(ctx, "profile"); err != nil || string(it.Value) != "bob" {
+		t.Fatalf("expected bob, got %+v and %v", it, err)
+	}
+	if err := ns.Delete(ctx, "profile"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+}
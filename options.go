@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// CallOption overrides client settings for a single operation.
+type CallOption func(*callOptions)
+
+// callOptions are the settings of a single operation.
+type callOptions struct {
+	timeout     time.Duration
+	server      string
+	protocol    Protocol
+	hasProtocol bool
+	consistency Consistency
+	rawChunks   bool
+	rawEnvelope bool
+	jitter      float64
+	hasJitter   bool
+	noReply     bool
+}
+
+// WithTimeout bounds the whole operation, including waiting for and dialing
+// a connection, by d. Timeout still applies if it is shorter.
+func WithTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) { o.timeout = d }
+}
+
+// WithServer sends the operation to the server at addr instead of the one
+// chosen by the selector.
+func WithServer(addr string) CallOption {
+	return func(o *callOptions) { o.server = addr }
+}
+
+// WithProtocol speaks p for the operation instead of the server's protocol.
+// Binary operations use connections of their own, since a server reads
+// every request of a connection in the protocol of the first.
+func WithProtocol(p Protocol) CallOption {
+	return func(o *callOptions) {
+		o.protocol = p
+		o.hasProtocol = true
+	}
+}
+
+// WithExpirationJitter spreads the expiration of the items written by the
+// operation by up to fraction of it either way, instead of the client's
+// ExpirationJitter.
+func WithExpirationJitter(fraction float64) CallOption {
+	return func(o *callOptions) {
+		o.jitter = fraction
+		o.hasJitter = true
+	}
+}
+
+// call is an operation in progress.
+type call struct {
+	op      string
+	start   time.Time
+	ctx     context.Context
+	cancel  context.CancelFunc
+	opts    callOptions
+	server  net.Addr        // pinned server, if any
+	targets *opTargets      // servers and keys, if metrics are recorded
+	endSpan func(OpMetrics) // ends the span of Tracer, if any
+}
+
+// newCall starts the operation op under ctx: it applies opts and derives the
+// context of the operation. The caller must call endCall once the operation is done.
+func (c *Client) newCall(ctx context.Context, op string, opts []CallOption) (*call, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cl := &call{op: op, start: time.Now(), ctx: ctx, cancel: func() {}}
+	if c.Metrics != nil || c.Tracer != nil || c.SlowOpThreshold > 0 {
+		cl.targets = new(opTargets)
+	}
+	for _, opt := range opts {
+		opt(&cl.opts)
+	}
+	if cl.opts.server != "" {
+		addr, err := c.pinnedServer(cl.opts.server)
+		if err != nil {
+			return nil, err
+		}
+		cl.server = addr
+	}
+	if c.Tracer != nil {
+		cl.ctx, cl.endSpan = c.Tracer.StartOp(cl.ctx, op)
+	}
+	if cl.opts.timeout > 0 {
+		cl.ctx, cl.cancel = context.WithTimeout(cl.ctx, cl.opts.timeout)
+	}
+	return cl, nil
+}
+
+// endCall finishes cl with the error *err.
+func (c *Client) endCall(cl *call, err *error) {
+	cl.cancel()
+	if c.TimeoutHistogram != nil {
+		c.TimeoutHistogram.observe(cl.op, time.Since(cl.start), c.callTimeout(cl), isTimeout(*err))
+	}
+	c.count(cl, *err)
+	if cl.targets != nil {
+		m := c.opMetrics(cl, *err)
+		if c.Metrics != nil {
+			c.Metrics.RecordOp(m)
+		}
+		if cl.endSpan != nil {
+			cl.endSpan(m)
+		}
+		if c.SlowOpThreshold > 0 && m.Duration >= c.SlowOpThreshold {
+			c.slowOp(m)
+		}
+	}
+	c.suppress(cl, err)
+}
+
+// callTimeout returns the deadline in effect for cl.
+func (c *Client) callTimeout(cl *call) time.Duration {
+	d := c.netTimeout()
+	if cl.opts.timeout > 0 && cl.opts.timeout < d {
+		d = cl.opts.timeout
+	}
+	return d
+}
+
+// route returns the server for key: the pinned server, if any, or the one
+// chosen by the selector.
+func (c *Client) route(cl *call, key string) (net.Addr, error) {
+	cl.targets.addKey(key)
+	if cl.server != nil {
+		return cl.server, nil
+	}
+	addr, err := c.selector.Select(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.reroute(cl, key, addr), nil
+}
+
+// callProtocol returns the protocol settings for addr with the overrides of
+// cl applied, or a *ConformanceError if Conformance rules them out.
+func (c *Client) callProtocol(cl *call, addr net.Addr) (ServerProtocol, error) {
+	cl.targets.addServer(addr)
+	sp := c.serverProtocol(addr)
+	if cl.opts.hasProtocol {
+		sp.Protocol = cl.opts.protocol
+	}
+	return sp, c.conform(sp, c.useUDP(addr, sp))
+}
+
+// pinnedServer returns the address for server, preferring the selector's
+// own address so that connections are pooled together.
+func (c *Client) pinnedServer(server string) (net.Addr, error) {
+	var found net.Addr
+	c.selector.Each(func(addr net.Addr) error {
+		if found == nil && addr.String() == server {
+			found = addr
+		}
+		return nil
+	})
+	if found != nil {
+		return found, nil
+	}
+	return resolveServer(server)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	// A server that accepts connections but never answers.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer nc.Close()
+		}
+	}()
+
+	client, _ := NewClient([]string{ln.Addr().String()}, false)
+	client.Timeout = 5 * time.Second
+
+	start := time.Now()
+	_, err = client.Get("foo", WithTimeout(50*time.Millisecond))
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the call timeout to apply, took %v", elapsed)
+	}
+}
+
+func TestWithServer(t *testing.T) {
+	srv1 := newTestServer(t)
+	srv2 := newTestServer(t)
+	client, _ := NewClient([]string{srv1.addr, srv2.addr}, false)
+
+	for _, srv := range []*testServer{srv1, srv2} {
+		if err := client.Set(&Item{Key: "foo", Value: []byte(srv.addr)}, WithServer(srv.addr)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if srv.item("foo") == nil {
+			t.Fatalf("expected foo to be stored on %s", srv.addr)
+		}
+	}
+
+	items, err := client.GetMulti([]string{"foo"}, WithServer(srv2.addr))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(items["foo"].Value) != srv2.addr {
+		t.Fatalf("expected foo from %s, got %q", srv2.addr, items["foo"].Value)
+	}
+}
+
+func TestWithProtocol(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}, WithProtocol(ProtocolMeta)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get("foo", WithProtocol(ProtocolBinary)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cmds := srv.commands(); len(cmds) == 0 || !strings.HasPrefix(cmds[0], "ms ") {
+		t.Fatalf("expected a meta set, got commands %q", cmds)
+	}
+
+	// Binary requests get connections of their own, which the server
+	// cannot mistake for text ones.
+	if _, err := client.Get("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats := client.PoolStats()[srv.addr]; stats.Open != 2 || stats.Idle != 2 {
+		t.Fatalf("expected a text and a binary connection, got %+v", stats)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otel
+
+import (
+	"context"
+
+	"github.com/nihankhan/gomcache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Recorder records the operations of a client with OpenTelemetry
+// instruments: the memcached.operation.duration histogram, by operation,
+// server and outcome, from which the hit ratio follows, and the
+// memcached.pool.connections gauge, by server and state. Set it as the
+// Metrics of the client:
+//
+//	rec, err := otel.NewRecorder(meterProvider, client)
+//	client.Metrics = rec
+//
+// It is safe for concurrent use.
+type Recorder struct {
+	duration metric.Float64Histogram
+	reg      metric.Registration
+}
+
+// NewRecorder returns a Recorder creating its instruments with mp and
+// observing the connection pools of client.
+func NewRecorder(mp metric.MeterProvider, client *gomcache.Client) (*Recorder, error) {
+	meter := mp.Meter(ScopeName)
+	duration, err := meter.Float64Histogram("memcached.operation.duration",
+		metric.WithDescription("Latency of the operations of the client."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	pool, err := meter.Int64ObservableGauge("memcached.pool.connections",
+		metric.WithDescription("Connections to each server by state: idle or used."),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return nil, err
+	}
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for addr, st := range client.PoolStats() {
+			server := attribute.String("server.address", addr)
+			o.ObserveInt64(pool, int64(st.Idle), metric.WithAttributes(server, attribute.String("state", "idle")))
+			o.ObserveInt64(pool, int64(st.Open-st.Idle), metric.WithAttributes(server, attribute.String("state", "used")))
+		}
+		return nil
+	}, pool)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{duration: duration, reg: reg}, nil
+}
+
+// RecordOp records m. It implements gomcache.MetricsRecorder.
+func (r *Recorder) RecordOp(m gomcache.OpMetrics) {
+	attrs := []attribute.KeyValue{
+		dbSystem,
+		attribute.String("db.operation", m.Op),
+		attribute.String("outcome", m.Outcome.String()),
+	}
+	if m.Server != "" {
+		attrs = append(attrs, attribute.String("server.address", m.Server))
+	}
+	r.duration.Record(context.Background(), m.Duration.Seconds(), metric.WithAttributes(attrs...))
+}
+
+// Close stops observing the connection pools.
+func (r *Recorder) Close() error {
+	return r.reg.Unregister()
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nihankhan/gomcache"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRecorder(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	client, _ := gomcache.NewClient([]string{"127.0.0.1:11211"}, false)
+	rec, err := NewRecorder(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), client)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer rec.Close()
+
+	rec.RecordOp(gomcache.OpMetrics{Op: "get", Server: "127.0.0.1:11211", Duration: time.Millisecond, Outcome: gomcache.OutcomeHit})
+	rec.RecordOp(gomcache.OpMetrics{Op: "get", Server: "127.0.0.1:11211", Duration: time.Millisecond, Outcome: gomcache.OutcomeMiss})
+	rec.RecordOp(gomcache.OpMetrics{Op: "get", Server: "127.0.0.1:11211", Duration: time.Millisecond, Outcome: gomcache.OutcomeHit})
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	found := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			found[m.Name] = m.Data
+		}
+	}
+
+	hist, ok := found["memcached.operation.duration"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("expected the duration histogram, got %v", found)
+	}
+	counts := make(map[string]uint64)
+	for _, dp := range hist.DataPoints {
+		outcome, _ := dp.Attributes.Value(attribute.Key("outcome"))
+		counts[outcome.AsString()] += dp.Count
+	}
+	if counts["hit"] != 2 || counts["miss"] != 1 {
+		t.Fatalf("expected 2 hits and 1 miss, got %v", counts)
+	}
+
+	gauge, ok := found["memcached.pool.connections"].(metricdata.Gauge[int64])
+	if !ok || len(gauge.DataPoints) != 2 {
+		t.Fatalf("expected idle and used pool gauges, got %v", found["memcached.pool.connections"])
+	}
+}
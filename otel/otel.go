@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package otel instruments a gomcache.Client with OpenTelemetry. Tracer
+// starts a client span for every operation through the gomcache.Tracer
+// hook, and Recorder records their durations and the connection pools
+// through the gomcache.MetricsRecorder hook.
+package otel
+
+import (
+	"context"
+
+	"github.com/nihankhan/gomcache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans and instruments.
+const ScopeName = "github.com/nihankhan/gomcache/otel"
+
+// dbSystem is the db.system attribute of every span.
+var dbSystem = attribute.String("db.system", "memcached")
+
+// Tracer starts a span named after the operation for every operation of a
+// client, with the db.system, db.operation and server.address attributes,
+// and marks it as failed if the operation failed. Set it as the Tracer of
+// the client:
+//
+//	client.Tracer = otel.NewTracer(tracerProvider)
+type Tracer struct {
+	// Key, if set, returns the value of the db.memcached.key attribute for
+	// the key of single-key operations, such as a hash of it when keys are
+	// sensitive. If nil, keys are not recorded.
+	Key func(key string) string
+
+	tracer trace.Tracer
+}
+
+// NewTracer returns a Tracer creating its spans with tp.
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(ScopeName)}
+}
+
+// StartOp starts the span of the operation op. It implements
+// gomcache.Tracer.
+func (t *Tracer) StartOp(ctx context.Context, op string) (context.Context, func(gomcache.OpMetrics)) {
+	ctx, span := t.tracer.Start(ctx, "memcached "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(dbSystem, attribute.String("db.operation", op)))
+	return ctx, func(m gomcache.OpMetrics) {
+		if m.Server != "" {
+			span.SetAttributes(attribute.String("server.address", m.Server))
+		}
+		if m.Key != "" && t.Key != nil {
+			span.SetAttributes(attribute.String("db.memcached.key", t.Key(m.Key)))
+		}
+		if m.Outcome == gomcache.OutcomeError && m.Err != nil {
+			span.RecordError(m.Err)
+			span.SetStatus(codes.Error, m.Err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otel
+
+import (
+	"testing"
+
+	"github.com/nihankhan/gomcache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tr := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	tr.Key = func(key string) string { return "k:" + key }
+
+	client, _ := gomcache.NewClient([]string{"127.0.0.1:1"}, false)
+	client.Tracer = tr
+	if _, err := client.Get("foo"); err == nil {
+		t.Fatal("expected an error from an unreachable server")
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "memcached get" || span.SpanKind() != trace.SpanKindClient {
+		t.Fatalf("expected a client span named memcached get, got %q, %v", span.Name(), span.SpanKind())
+	}
+	attrs := make(map[attribute.Key]string)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	for k, want := range map[attribute.Key]string{
+		"db.system":        "memcached",
+		"db.operation":     "get",
+		"server.address":   "127.0.0.1:1",
+		"db.memcached.key": "k:foo",
+	} {
+		if attrs[k] != want {
+			t.Fatalf("expected %s=%q, got %q", k, want, attrs[k])
+		}
+	}
+	if span.Status().Code != codes.Error || len(span.Events()) == 0 {
+		t.Fatalf("expected an error status and event, got %+v", span.Status())
+	}
+}
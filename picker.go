@@ -18,8 +18,11 @@ limitations under the License.
 package gomcache
 
 import (
+	"errors"
 	"hash/crc32"
 	"net"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -31,19 +34,212 @@ type ServerSelector interface {
 	Each(func(net.Addr) error) error
 }
 
+// FailoverSelector is implemented by selectors that can name another server
+// for a key whose server cannot be reached. The retry policy uses it when
+// RetryPolicy.Failover is set.
+type FailoverSelector interface {
+	ServerSelector
+
+	// SelectFailover returns the server to try for key after attempt
+	// servers, counting from 1, could not be reached.
+	SelectFailover(key string, attempt int) (net.Addr, error)
+}
+
+// EjectingSelector is implemented by selectors that can temporarily leave a
+// server out of selection. Keys of an ejected server move to other servers
+// until it is restored; Each still visits it. HealthChecker uses it.
+type EjectingSelector interface {
+	ServerSelector
+
+	// Eject stops selecting the server at addr.
+	Eject(addr net.Addr)
+
+	// Restore undoes one Eject of the server at addr.
+	Restore(addr net.Addr)
+}
+
 // NewFromSelector returns a new Client using the provided ServerSelector and UDP mode.
 func NewFromSelector(ss ServerSelector, useUDP bool) (*Client, error) {
-	return &Client{
-		selector: ss,
-		UseUDP:   useUDP,
-		Timeout:  DefaultTimeout,
-	}, nil
+	c := &Client{
+		selector:   ss,
+		UseUDP:     useUDP,
+		Timeout:    DefaultTimeout,
+		servers:    newServerSettings(),
+		pool:       newConnPool(),
+		coalescer:  newCoalescer(),
+		fetches:    newFetchGroup(),
+		suppressed: new(suppressedErrors),
+		counters:   new(opCounters),
+		latencies:  new(serverLatencies),
+	}
+	if w, ok := ss.(WatchingSelector); ok {
+		w.Watch(c.serversChanged)
+	}
+	return c, nil
+}
+
+// WatchingSelector is implemented by selectors that report changes of
+// their servers, so that connection pools, metrics and other layers can
+// react to them instead of polling Each. ServerList, HashRing, JumpHash and
+// Replicated implement it.
+type WatchingSelector interface {
+	ServerSelector
+
+	// Watch registers fn to be called with the servers added and removed
+	// after every change of the servers. It is called by SetServers, once
+	// the change is visible to Select.
+	Watch(fn func(added, removed []net.Addr))
+}
+
+// notifier reports membership changes of a selector. It is embedded in
+// selectors to implement WatchingSelector.
+type notifier struct {
+	mu  sync.Mutex
+	fns []func(added, removed []net.Addr)
+}
+
+// Watch registers fn to be called with the servers added and removed after
+// every change of the servers.
+func (n *notifier) Watch(fn func(added, removed []net.Addr)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.fns = append(n.fns, fn)
+}
+
+// notify reports the change from the servers prev to next, if any, to
+// onChange, unless it is nil, and to the registered functions.
+func (n *notifier) notify(onChange func(added, removed []net.Addr), prev, next []net.Addr) {
+	var added, removed []net.Addr
+	for _, a := range next {
+		if !containsAddr(prev, a.String()) {
+			added = append(added, a)
+		}
+	}
+	for _, a := range prev {
+		if !containsAddr(next, a.String()) {
+			removed = append(removed, a)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	fns := n.fns
+	n.mu.Unlock()
+	for _, fn := range fns {
+		fn(added, removed)
+	}
+	if onChange != nil {
+		onChange(added, removed)
+	}
 }
 
 // ServerList manages a list of servers.
 type ServerList struct {
-	mu    sync.RWMutex
-	addrs []net.Addr
+	// Hasher hashes keys onto servers. If nil, CRC32Hasher is used. It
+	// must be set before the list is first used.
+	Hasher Hasher
+
+	// OnChange, if not nil, is called after SetServers changes the
+	// servers, with the servers added and removed. Clients using the list
+	// keep their connections to the other servers. It must be set before
+	// the list is first used.
+	OnChange func(added, removed []net.Addr)
+
+	notifier
+
+	mu      sync.RWMutex
+	addrs   []net.Addr
+	slots   []int             // indexes into addrs, each server repeated by its weight
+	zones   map[string]string // addr to zone
+	ejected ejections
+}
+
+// WeightedServer is a server with the share of keys it should receive,
+// relative to the other servers of a selector.
+type WeightedServer struct {
+	Addr   string
+	Weight int // at least 1
+
+	// Zone is the availability zone of the server, if known. See
+	// Client.Zone.
+	Zone string
+
+	// ResolveOnConnect keeps the host name of Addr and resolves it anew
+	// for every connection instead of once in SetServers, so that a DNS
+	// change of the name, such as the failover of a virtual IP, is
+	// followed. Pooled connections keep their address until closed; see
+	// Client.MaxConnLifetime.
+	ResolveOnConnect bool
+}
+
+// DefaultServerWeight is the weight of servers given without one.
+const DefaultServerWeight = 1
+
+// parseWeightedServers splits the options off servers given as
+// "host:port?weight=N&zone=name&resolve=connect".
+func parseWeightedServers(servers []string) ([]WeightedServer, error) {
+	ws := make([]WeightedServer, len(servers))
+	for i, server := range servers {
+		ws[i] = WeightedServer{Addr: server, Weight: DefaultServerWeight}
+		addr, query, ok := strings.Cut(server, "?")
+		if !ok {
+			continue
+		}
+		ws[i].Addr = addr
+		opts, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, errors.New("memcache: invalid server options in " + strconv.Quote(server))
+		}
+		for name, v := range opts {
+			switch name {
+			case "weight":
+				ws[i].Weight, err = strconv.Atoi(v[0])
+			case "zone":
+				ws[i].Zone = v[0]
+			case "resolve":
+				if v[0] != "connect" {
+					err = errors.New("unknown resolution")
+				}
+				ws[i].ResolveOnConnect = true
+			default:
+				err = errors.New("unknown option")
+			}
+			if err != nil {
+				return nil, errors.New("memcache: invalid server options in " + strconv.Quote(server))
+			}
+		}
+	}
+	return ws, nil
+}
+
+// resolveWeightedServers resolves the addresses of servers and checks their
+// weights. zones maps the addresses of the servers with a zone to it.
+func resolveWeightedServers(servers []WeightedServer) (addrs []net.Addr, weights []int, zones map[string]string, err error) {
+	addrs = make([]net.Addr, len(servers))
+	weights = make([]int, len(servers))
+	for i, server := range servers {
+		if server.Weight < 1 {
+			return nil, nil, nil, errors.New("memcache: invalid weight " + strconv.Itoa(server.Weight) + " for " + server.Addr)
+		}
+		resolve := resolveServer
+		if server.ResolveOnConnect {
+			resolve = unresolvedServer
+		}
+		addr, err := resolve(server.Addr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		addrs[i], weights[i] = addr, server.Weight
+		if server.Zone != "" {
+			if zones == nil {
+				zones = make(map[string]string)
+			}
+			zones[addr.String()] = server.Zone
+		}
+	}
+	return addrs, weights, zones, nil
 }
 
 // staticAddr caches the Network() and String() values from any net.Addr.
@@ -63,40 +259,153 @@ func (s *staticAddr) String() string  { return s.str }
 
 // SetServers sets the list of servers.
 // This method resolves server addresses and is safe for concurrent use.
+// A server given as "host:port?weight=N" receives N times the share of keys
+// of a server of weight 1, the default; "zone=name" sets its zone, as in
+// "host:port?weight=2&zone=us-east-1a". "resolve=connect" resolves its host
+// name for every new connection, as WeightedServer.ResolveOnConnect.
 func (ss *ServerList) SetServers(servers ...string) error {
-	naddr := make([]net.Addr, len(servers))
-	for i, server := range servers {
-		var addr net.Addr
-		var err error
-
-		if strings.Contains(server, "/") {
-			// Handle Unix domain sockets
-			addr, err = net.ResolveUnixAddr("unix", server)
-		} else if strings.Contains(server, ":") {
-			// Handle TCP and UDP addresses
-			// Try UDP first
-			addr, err = net.ResolveUDPAddr("udp", server)
-			if err != nil {
-				// If UDP fails, try TCP
-				addr, err = net.ResolveTCPAddr("tcp", server)
-			}
-		} else {
-			// Default to TCP if no protocol is specified and address does not contain `/` or `:`
-			addr, err = net.ResolveTCPAddr("tcp", server)
-		}
+	ws, err := parseWeightedServers(servers)
+	if err != nil {
+		return err
+	}
+	return ss.SetServersWithWeights(ws...)
+}
 
-		if err != nil {
-			return err
+// SetServersWithWeights is like SetServers, but takes the weights of the
+// servers separately.
+func (ss *ServerList) SetServersWithWeights(servers ...WeightedServer) error {
+	naddr, weights, zones, err := resolveWeightedServers(servers)
+	if err != nil {
+		return err
+	}
+	var slots []int
+	for i, w := range weights {
+		for n := 0; n < w; n++ {
+			slots = append(slots, i)
 		}
-		naddr[i] = newStaticAddr(addr)
 	}
 
 	ss.mu.Lock()
-	defer ss.mu.Unlock()
+	prev := ss.addrs
 	ss.addrs = naddr
+	ss.slots = slots
+	ss.zones = zones
+	ss.ejected.prune(naddr)
+	ss.mu.Unlock()
+
+	ss.notify(ss.OnChange, prev, naddr)
 	return nil
 }
 
+// Zone returns the zone of the server at addr, or "" if it has none.
+func (ss *ServerList) Zone(addr net.Addr) string {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.zones[addr.String()]
+}
+
+// containsAddr reports whether addrs holds an address with string form s.
+func containsAddr(addrs []net.Addr, s string) bool {
+	for _, a := range addrs {
+		if a.String() == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Eject stops selecting the server at addr. Its keys move to the servers
+// following it in the list, while the keys of other servers stay put.
+// Ejections nest: the server is selected again once every Eject has been
+// matched by a Restore.
+func (ss *ServerList) Eject(addr net.Addr) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.ejected.add(addr)
+}
+
+// Restore undoes one Eject of the server at addr.
+func (ss *ServerList) Restore(addr net.Addr) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.ejected.remove(addr)
+}
+
+// ejections counts the pending ejections of servers, by address.
+type ejections map[string]int
+
+// add records an ejection of addr.
+func (e *ejections) add(addr net.Addr) {
+	if *e == nil {
+		*e = make(ejections)
+	}
+	(*e)[addr.String()]++
+}
+
+// remove undoes one ejection of addr.
+func (e ejections) remove(addr net.Addr) {
+	switch n := e[addr.String()]; {
+	case n > 1:
+		e[addr.String()] = n - 1
+	case n == 1:
+		delete(e, addr.String())
+	}
+}
+
+// prune forgets the ejections of servers no longer in addrs.
+func (e ejections) prune(addrs []net.Addr) {
+	for s := range e {
+		if !containsAddr(addrs, s) {
+			delete(e, s)
+		}
+	}
+}
+
+// has reports whether addr is ejected.
+func (e ejections) has(addr net.Addr) bool {
+	return e[addr.String()] > 0
+}
+
+// resolveServer resolves a server address as accepted by SetServers.
+func resolveServer(server string) (net.Addr, error) {
+	var addr net.Addr
+	var err error
+
+	if strings.Contains(server, "/") {
+		// Handle Unix domain sockets
+		addr, err = net.ResolveUnixAddr("unix", server)
+	} else if strings.Contains(server, ":") {
+		// Handle TCP and UDP addresses
+		// Try UDP first
+		addr, err = net.ResolveUDPAddr("udp", server)
+		if err != nil {
+			// If UDP fails, try TCP
+			addr, err = net.ResolveTCPAddr("tcp", server)
+		}
+	} else {
+		// Default to TCP if no protocol is specified and address does not contain `/` or `:`
+		addr, err = net.ResolveTCPAddr("tcp", server)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return newStaticAddr(addr), nil
+}
+
+// unresolvedServer returns the address of server without resolving its
+// host name, which is left to every dial.
+func unresolvedServer(server string) (net.Addr, error) {
+	if strings.Contains(server, "/") {
+		// Unix domain sockets have no name to resolve.
+		return resolveServer(server)
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return nil, err
+	}
+	return &staticAddr{ntw: "tcp", str: server}, nil
+}
+
 // Each iterates over each server calling the given function
 func (ss *ServerList) Each(f func(net.Addr) error) error {
 	ss.mu.RLock()
@@ -128,18 +437,62 @@ func (sl *ServerList) Select(key string) (net.Addr, error) {
 		return nil, ErrNoServers
 	}
 
-	if len(sl.addrs) == 1 {
+	if len(sl.addrs) == 1 && len(sl.ejected) == 0 {
 		return sl.addrs[0], nil
 	}
 
-	bufp := keyBufPool.Get().(*[]byte)
-	n := copy(*bufp, []byte(key))
+	i := sl.keyIndex(key)
+	for n := 0; n < len(sl.slots); n++ {
+		addr := sl.addrs[sl.slots[(i+n)%len(sl.slots)]]
+		if !sl.ejected.has(addr) {
+			return addr, nil
+		}
+	}
+	return nil, ErrNoServers
+}
 
-	// Use consistent hashing to select a server
-	hash := crc32.ChecksumIEEE((*bufp)[:n])
-	keyBufPool.Put(bufp)
+// SelectFailover returns the server attempt distinct servers after the one
+// Select picks for key, skipping ejected servers, so retries of an
+// unreachable server spread over the others in a fixed order.
+func (sl *ServerList) SelectFailover(key string, attempt int) (net.Addr, error) {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	if len(sl.addrs) == 0 {
+		return nil, ErrNoServers
+	}
+	i := sl.keyIndex(key)
+	if len(sl.ejected) == 0 && len(sl.slots) == len(sl.addrs) {
+		// Unweighted: every server has one slot.
+		return sl.addrs[sl.slots[(i+attempt)%len(sl.slots)]], nil
+	}
+	var healthy []net.Addr
+	seen := make([]bool, len(sl.addrs))
+	for n := 0; n < len(sl.slots); n++ {
+		j := sl.slots[(i+n)%len(sl.slots)]
+		if addr := sl.addrs[j]; !seen[j] && !sl.ejected.has(addr) {
+			seen[j] = true
+			healthy = append(healthy, addr)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil, ErrNoServers
+	}
+	// Select already returns healthy[0] for key.
+	return healthy[attempt%len(healthy)], nil
+}
 
-	index := int(hash) % len(sl.addrs)
+// keyIndex hashes key onto one of the slots. sl.mu must be held.
+func (sl *ServerList) keyIndex(key string) int {
+	return int(hashKey(sl.Hasher, key) % uint32(len(sl.slots)))
+}
+
+// keyHash returns the CRC-32 checksum of key.
+func keyHash(key string) uint32 {
+	bufp := keyBufPool.Get().(*[]byte)
+	m := copy(*bufp, []byte(key))
 
-	return sl.addrs[index], nil
+	hash := crc32.ChecksumIEEE((*bufp)[:m])
+	keyBufPool.Put(bufp)
+	return hash
 }
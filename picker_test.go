@@ -18,6 +18,8 @@ limitations under the License.
 package gomcache
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"reflect"
 	"strings"
@@ -103,8 +105,8 @@ func TestSelectNoServers(t *testing.T) {
 		t.Fatalf("expected an error, got nil")
 	}
 
-	if err.Error() != "no servers available" {
-		t.Fatalf("expected error 'no servers available', got %v", err)
+	if !errors.Is(err, ErrNoServers) {
+		t.Fatalf("expected ErrNoServers, got %v", err)
 	}
 }
 
@@ -194,3 +196,126 @@ func TestSetServersWithDifferentProtocols(t *testing.T) {
 		}
 	}
 }
+
+func TestWeightedServers(t *testing.T) {
+	for _, ss := range []interface {
+		ServerSelector
+		SetServers(...string) error
+	}{new(ServerList), new(HashRing)} {
+		if err := ss.SetServers("10.0.0.1:11211?weight=3", "10.0.0.2:11211"); err != nil {
+			t.Fatalf("%T: expected no error, got %v", ss, err)
+		}
+		const keys = 20000
+		heavy := 0
+		for i := 0; i < keys; i++ {
+			addr, err := ss.Select(fmt.Sprintf("key%d", i))
+			if err != nil {
+				t.Fatalf("%T: expected no error, got %v", ss, err)
+			}
+			if addr.String() == "10.0.0.1:11211" {
+				heavy++
+			}
+		}
+		if heavy < keys*65/100 || heavy > keys*85/100 {
+			t.Fatalf("%T: expected about 75%% of the keys on the heavy server, got %d of %d", ss, heavy, keys)
+		}
+
+		for _, bad := range []string{"10.0.0.1:11211?weight=0", "10.0.0.1:11211?weight=x", "10.0.0.1:11211?w=2", "10.0.0.1:11211?weight=%"} {
+			if err := ss.SetServers(bad); err == nil {
+				t.Fatalf("%T: expected an error for %q", ss, bad)
+			}
+		}
+	}
+}
+
+func TestSetServersKeepsConnections(t *testing.T) {
+	kept := newTestServer(t)
+	removed := newTestServer(t)
+
+	var changes [][2][]net.Addr
+	ss := &ServerList{OnChange: func(added, removed []net.Addr) {
+		changes = append(changes, [2][]net.Addr{added, removed})
+	}}
+	if err := ss.SetServers(kept.addr, removed.addr); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client, _ := NewFromSelector(ss, false)
+	defer client.Close()
+	for _, addr := range []string{kept.addr, removed.addr} {
+		if err := client.Ping("", WithServer(addr)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if err := ss.SetServers(kept.addr); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(changes) != 2 || len(changes[1][0]) != 0 || len(changes[1][1]) != 1 || changes[1][1][0].String() != removed.addr {
+		t.Fatalf("expected %s to be reported removed, got %v", removed.addr, changes)
+	}
+	if open, idle := client.pool.stats(parseAddr(t, removed.addr)); open != 0 || idle != 0 {
+		t.Fatalf("expected the connections to %s to be closed, got open=%d idle=%d", removed.addr, open, idle)
+	}
+	if open, idle := client.pool.stats(parseAddr(t, kept.addr)); open != 1 || idle != 1 {
+		t.Fatalf("expected the connection to %s to be kept, got open=%d idle=%d", kept.addr, open, idle)
+	}
+
+	// Setting the same servers again is not a change.
+	ss.SetServers(kept.addr)
+	if len(changes) != 2 {
+		t.Fatalf("expected no change to be reported, got %v", changes)
+	}
+}
+
+func TestResolveOnConnect(t *testing.T) {
+	s := newTestServer(t)
+	_, port, _ := net.SplitHostPort(s.addr)
+	server := net.JoinHostPort("localhost", port)
+
+	ss := &ServerList{}
+	if err := ss.SetServers(server + "?resolve=connect"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	addr, err := ss.Select("foo")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if addr.String() != server {
+		t.Fatalf("expected the host name to be kept, got %s", addr)
+	}
+
+	client, _ := NewFromSelector(ss, false)
+	defer client.Close()
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if s.item("foo") == nil {
+		t.Fatalf("expected the item to be stored")
+	}
+
+	if err := ss.SetServers(server + "?resolve=never"); err == nil {
+		t.Fatalf("expected an error for an unknown resolution")
+	}
+}
+
+func TestWatchingSelector(t *testing.T) {
+	for _, sel := range []interface {
+		WatchingSelector
+		ServerSetter
+	}{&ServerList{}, &HashRing{}, &JumpHash{}} {
+		var got []string
+		sel.Watch(func(added, removed []net.Addr) {
+			got = append(got, fmt.Sprint(added, removed))
+		})
+		sel.SetServers("127.0.0.1:11211", "127.0.0.1:11212")
+		sel.SetServers("127.0.0.1:11211", "127.0.0.1:11212")
+		sel.SetServers("127.0.0.1:11212", "127.0.0.1:11213")
+		want := []string{
+			"[127.0.0.1:11211 127.0.0.1:11212] []",
+			"[127.0.0.1:11213] [127.0.0.1:11211]",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%T: expected changes %v, got %v", sel, want, got)
+		}
+	}
+}
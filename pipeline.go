@@ -0,0 +1,227 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+)
+
+// Pipeline queues operations of different kinds and sends them together
+// with Exec, in one round trip per server. Each operation goes to the
+// primary server of its key only, bypassing replicas, hedging and the
+// Local cache. A Pipeline is not safe for concurrent use.
+//
+//	p := client.Pipeline()
+//	p.Get("user:1")
+//	p.Incr("views", 1)
+//	p.Delete("draft:1")
+//	results, err := p.Exec(ctx)
+type Pipeline struct {
+	client *Client
+	ops    []pipelineOp
+}
+
+// pipelineOp is an operation queued on a Pipeline.
+type pipelineOp struct {
+	verb  string // get, set, delete or incr
+	item  *Item  // for set
+	key   string
+	delta uint64 // for incr
+}
+
+// PipelineResult is the outcome of an operation queued on a Pipeline.
+type PipelineResult struct {
+	// Item is the item read by a Get.
+	Item *Item
+
+	// Value is the new value of the counter of an Incr.
+	Value uint64
+
+	// Err is the error of the operation, such as ErrCacheMiss, or the
+	// error of its server.
+	Err error
+}
+
+// Pipeline returns an empty pipeline.
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// Len returns the number of operations queued.
+func (p *Pipeline) Len() int {
+	return len(p.ops)
+}
+
+// Get queues a Get of key.
+func (p *Pipeline) Get(key string) {
+	p.ops = append(p.ops, pipelineOp{verb: "get", key: key})
+}
+
+// Set queues a Set of item.
+func (p *Pipeline) Set(item *Item) {
+	p.ops = append(p.ops, pipelineOp{verb: "set", item: item, key: item.Key})
+}
+
+// Delete queues a Delete of key.
+func (p *Pipeline) Delete(key string) {
+	p.ops = append(p.ops, pipelineOp{verb: "delete", key: key})
+}
+
+// Incr queues an increment of the decimal counter stored under key by
+// delta. Unlike Counter, it fails with ErrCacheMiss if there is none.
+func (p *Pipeline) Incr(key string, delta uint64) {
+	p.ops = append(p.ops, pipelineOp{verb: "incr", key: key, delta: delta})
+}
+
+// Exec sends the queued operations and returns their results in the order
+// they were queued, emptying the pipeline. The operations of a server are
+// applied in order. They are not retried, since a failed round trip may
+// have applied some of them; their results then carry the error of the
+// server, which is also reported in a MultiError keyed by address.
+func (p *Pipeline) Exec(ctx context.Context, opts ...CallOption) (results []PipelineResult, err error) {
+	c := p.client
+	ops := p.ops
+	p.ops = nil
+
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = op.key
+	}
+	err = c.run(ctx, &Operation{Name: "pipeline", Keys: keys}, opts, func(cl *call, _ *Operation) (err error) {
+		results = make([]PipelineResult, len(ops))
+		tkeys := make([]string, len(ops))
+		encoded := make([]Item, len(ops))
+		byAddr := make(map[net.Addr][]int)
+		for i, op := range ops {
+			if op.verb != "get" {
+				if c.CoalesceWindow > 0 {
+					c.dropWrite(op.key)
+				}
+				c.Local.remove(op.key)
+			}
+			if tkeys[i], err = c.transformKey(op.key); err != nil {
+				results[i].Err = err
+				continue
+			}
+			if op.verb == "set" {
+				if encoded[i], err = c.encodeItem(op.key, *op.item); err != nil {
+					results[i].Err = err
+					continue
+				}
+				encoded[i].Key = tkeys[i]
+			}
+			addr, err := c.route(cl, tkeys[i])
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			byAddr[addr] = append(byAddr[addr], i)
+		}
+
+		var lk sync.Mutex
+		var merr MultiError
+		var wg sync.WaitGroup
+		for addr, idx := range byAddr {
+			wg.Add(1)
+			go func(addr net.Addr, idx []int) {
+				defer wg.Done()
+				err := c.pipelineTo(cl, addr, ops, tkeys, encoded, idx, results)
+				if err == nil {
+					return
+				}
+				for _, i := range idx {
+					results[i] = PipelineResult{Err: err}
+				}
+				lk.Lock()
+				defer lk.Unlock()
+				if merr == nil {
+					merr = make(MultiError)
+				}
+				merr[addr.String()] = err
+			}(addr, idx)
+		}
+		wg.Wait()
+
+		for i, op := range ops {
+			r := &results[i]
+			switch {
+			case op.verb == "get" && r.Err == nil:
+				r.Item, r.Err = c.resolveItem(cl, op.key, r.Item, opts)
+				if r.Err == nil && r.Item.Flags&(FlagEnvelope|FlagChunked) == FlagEnvelope && !cl.opts.rawEnvelope {
+					_, r.Err = openEnvelope(r.Item)
+				}
+				if r.Err != nil {
+					r.Item = nil
+				}
+			case op.verb == "set" && r.Err == nil && c.Journal != nil:
+				c.Journal.Record(op.key)
+			}
+		}
+		if merr != nil {
+			return merr
+		}
+		return nil
+	})
+	return results, err
+}
+
+// pipelineTo sends the operations at indexes idx to addr in one round
+// trip and stores their outcomes in results.
+func (c *Client) pipelineTo(cl *call, addr net.Addr, ops []pipelineOp, tkeys []string, encoded []Item, idx []int, results []PipelineResult) error {
+	sp, err := c.callProtocol(cl, addr)
+	if err != nil {
+		return err
+	}
+	var req []byte
+	for _, i := range idx {
+		switch ops[i].verb {
+		case "get":
+			req = sp.Protocol.appendGet(req, []string{tkeys[i]})
+		case "set":
+			req = sp.Protocol.appendStore(req, "set", &encoded[i])
+		case "delete":
+			req = sp.Protocol.appendDelete(req, tkeys[i])
+		case "incr":
+			req = sp.Protocol.appendIncr(req, "incr", tkeys[i], ops[i].delta)
+		}
+	}
+	return cl.opError(addr, "", c.roundTrip(cl.ctx, addr, sp.Protocol, false, req, func(r *bufio.Reader) error {
+		for _, i := range idx {
+			res := &results[i]
+			var err error
+			switch ops[i].verb {
+			case "get":
+				err = sp.Protocol.parseGet(r, func(it *Item) { res.Item = it })
+			case "set":
+				err = sp.Protocol.parseStore(r)
+			case "delete":
+				err = sp.Protocol.parseDelete(r)
+			case "incr":
+				res.Value, err = sp.Protocol.parseIncr(r)
+			}
+			if err != nil && !resumableError(err) {
+				return err
+			}
+			res.Err = err
+		}
+		return nil
+	}))
+}
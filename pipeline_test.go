@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta} {
+		a := newTestServer(t)
+		b := newTestServer(t)
+		client, _ := NewClient([]string{a.addr, b.addr}, false)
+		for _, key := range []string{"k1", "draft"} {
+			if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		if err := client.Set(&Item{Key: "views", Value: []byte("41")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		pl := client.Pipeline()
+		pl.Get("k1")
+		pl.Set(&Item{Key: "k2", Value: []byte("v2")})
+		pl.Get("k2")
+		pl.Incr("views", 1)
+		pl.Delete("draft")
+		pl.Get("missing")
+		pl.Incr("missing", 1)
+		results, err := pl.Exec(context.Background(), WithProtocol(p))
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", p, err)
+		}
+		if pl.Len() != 0 {
+			t.Fatalf("%v: expected Exec to empty the pipeline", p)
+		}
+		if len(results) != 7 {
+			t.Fatalf("%v: expected 7 results, got %d", p, len(results))
+		}
+		if r := results[0]; r.Err != nil || string(r.Item.Value) != "v" || r.Item.Key != "k1" {
+			t.Fatalf("%v: unexpected result of Get: %+v", p, r)
+		}
+		if r := results[1]; r.Err != nil {
+			t.Fatalf("%v: unexpected result of Set: %+v", p, r)
+		}
+		if r := results[2]; r.Err != nil || string(r.Item.Value) != "v2" {
+			t.Fatalf("%v: expected Get to see the Set queued before it, got %+v", p, r)
+		}
+		if r := results[3]; r.Err != nil || r.Value != 42 {
+			t.Fatalf("%v: unexpected result of Incr: %+v", p, r)
+		}
+		if r := results[4]; r.Err != nil {
+			t.Fatalf("%v: unexpected result of Delete: %+v", p, r)
+		}
+		if r := results[5]; r.Err != ErrCacheMiss || r.Item != nil {
+			t.Fatalf("%v: expected ErrCacheMiss, got %+v", p, r)
+		}
+		if r := results[6]; r.Err != ErrCacheMiss {
+			t.Fatalf("%v: expected ErrCacheMiss, got %+v", p, r)
+		}
+		if _, err := client.Get("draft"); err != ErrCacheMiss {
+			t.Fatalf("%v: expected draft to be deleted, got %v", p, err)
+		}
+	}
+}
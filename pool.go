@@ -0,0 +1,584 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrPoolExhausted is returned when MaxOpenConns connections to a server are
+// in use and none was released within PoolTimeout.
+var ErrPoolExhausted = errors.New("memcache: connection pool exhausted")
+
+// conn is a pooled stream connection to a server.
+type conn struct {
+	nc   net.Conn
+	rw   *bufio.ReadWriter
+	read *countingReader // under rw, for ClientStats
+	addr net.Addr
+	key  poolKey
+	c    *Client
+
+	createdAt time.Time
+	idleSince time.Time // when the connection was last returned to the pool
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += uint64(n)
+	return n, err
+}
+
+// expired reports whether cn has outlived MaxConnLifetime or sat idle for
+// longer than MaxConnIdleTime.
+func (cn *conn) expired(now time.Time) bool {
+	c := cn.c
+	if c.MaxConnLifetime > 0 && now.Sub(cn.createdAt) >= c.MaxConnLifetime {
+		return true
+	}
+	if c.MaxConnIdleTime > 0 && now.Sub(cn.idleSince) >= c.MaxConnIdleTime {
+		return true
+	}
+	return false
+}
+
+// release returns this connection back to the client's free pool.
+func (cn *conn) release() {
+	cn.c.putFreeConn(cn)
+}
+
+// setDeadline sets the deadline of the operation about to use cn from ctx.
+// Pooled connections keep the deadline of their previous user, which has
+// usually passed, so it must be called every time cn is handed out.
+func (cn *conn) setDeadline(ctx context.Context) error {
+	return cn.nc.SetDeadline(cn.c.deadline(ctx))
+}
+
+// condRelease releases this connection if it is still in sync after an
+// exchange that ended with *err; otherwise the connection is closed, since
+// unread or partially written data would desynchronize the next user.
+func (cn *conn) condRelease(err *error) {
+	if cn.reusable(*err) {
+		cn.release()
+	} else {
+		cn.c.closeConn(cn)
+	}
+}
+
+// reusable reports whether cn may serve another request after an exchange
+// that ended with err. Network errors, parse failures and server errors
+// leave the state of the stream unknown, so only cache-level results are
+// safe, and only when no data is left unread: the server sends nothing
+// unsolicited, so leftover bytes would be taken for the response to the
+// next request.
+func (cn *conn) reusable(err error) bool {
+	if err != nil && !resumableError(err) {
+		return false
+	}
+	return cn.rw.Reader.Buffered() == 0
+}
+
+// resumableError reports whether err is a cache-level result after which
+// the connection is still in a known state.
+func resumableError(err error) bool {
+	switch err {
+	case ErrCacheMiss, ErrTombstone, ErrNotFound, ErrCASConflict, ErrNotStored, ErrMalformedKey:
+		return true
+	}
+	return false
+}
+
+// connPool tracks the connections to every server, keyed by address and
+// protocol family.
+type connPool struct {
+	mu    sync.Mutex
+	addrs map[poolKey]*addrConns
+
+	reaperOnce sync.Once
+	done       chan struct{} // closed to stop background goroutines
+	closed     bool
+}
+
+// poolKey identifies the connections to a server that speak one protocol
+// family. Memcached picks the protocol of a connection from its first byte,
+// so text and meta requests share connections while binary ones need their
+// own.
+type poolKey struct {
+	addr   string
+	binary bool
+}
+
+// newPoolKey returns the key of the connections to addr that carry
+// requests in protocol p.
+func newPoolKey(addr net.Addr, p Protocol) poolKey {
+	return poolKey{addr: addr.String(), binary: p == ProtocolBinary}
+}
+
+// families returns the keys of the connections to addr in every protocol
+// family.
+func families(addr net.Addr) [2]poolKey {
+	return [2]poolKey{newPoolKey(addr, ProtocolText), newPoolKey(addr, ProtocolBinary)}
+}
+
+// addrConns tracks the connections to a single server in one protocol
+// family.
+type addrConns struct {
+	free    []*conn // idle connections, most recently used last
+	open    int     // open connections, idle or in use
+	retired bool    // the server left the selector
+
+	// conns are the open connections, idle or in use, that were dialed
+	// successfully.
+	conns map[*conn]struct{}
+
+	// waiters are callers blocked on MaxOpenConns, oldest first. A waiter
+	// receives either an idle connection or nil, meaning a slot was freed
+	// and reserved for it to dial a new connection.
+	waiters []chan *conn
+}
+
+func newConnPool() *connPool {
+	return &connPool{
+		addrs: make(map[poolKey]*addrConns),
+		done:  make(chan struct{}),
+	}
+}
+
+// get returns the connection state for key. p.mu must be held.
+func (p *connPool) get(key poolKey) *addrConns {
+	ac, ok := p.addrs[key]
+	if !ok {
+		ac = new(addrConns)
+		p.addrs[key] = ac
+	}
+	return ac
+}
+
+// stats returns the number of open and idle connections to addr, across
+// protocol families.
+func (p *connPool) stats(addr net.Addr) (open, idle int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, key := range families(addr) {
+		if ac, ok := p.addrs[key]; ok {
+			open += ac.open
+			idle += len(ac.free)
+		}
+	}
+	return open, idle
+}
+
+// PoolStats is the state of the connection pool of a server.
+type PoolStats struct {
+	Open int // open connections, idle or in use
+	Idle int // idle connections
+}
+
+// PoolStats returns the state of the connection pools of the servers,
+// keyed by address.
+func (c *Client) PoolStats() map[string]PoolStats {
+	stats := make(map[string]PoolStats)
+	c.selector.Each(func(addr net.Addr) error {
+		open, idle := c.pool.stats(addr)
+		stats[addr.String()] = PoolStats{Open: open, Idle: idle}
+		return nil
+	})
+	return stats
+}
+
+// isClosed reports whether the client owning p was closed.
+func (p *connPool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// maxIdleConns returns the idle connection limit per address in effect.
+func (c *Client) maxIdleConns() int {
+	if c.MaxIdleConns > 0 {
+		return c.MaxIdleConns
+	}
+	return DefaultMaxIdleConns
+}
+
+// poolTimeout returns how long getConn waits for a connection when
+// MaxOpenConns is reached.
+func (c *Client) poolTimeout() time.Duration {
+	if c.PoolTimeout > 0 {
+		return c.PoolTimeout
+	}
+	return c.netTimeout()
+}
+
+// putFreeConn hands cn to the oldest waiter, or keeps it idle if there is
+// room under MaxIdleConns and closes it otherwise.
+func (c *Client) putFreeConn(cn *conn) {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	ac := c.pool.get(cn.key)
+	if c.pool.closed {
+		c.closeConnLocked(ac, cn)
+		return
+	}
+	if len(ac.waiters) > 0 {
+		w := ac.waiters[0]
+		ac.waiters = ac.waiters[1:]
+		w <- cn
+		return
+	}
+	if ac.retired {
+		c.closeConnLocked(ac, cn)
+		if ac.open == 0 {
+			delete(c.pool.addrs, cn.key)
+		}
+		return
+	}
+	cn.idleSince = time.Now()
+	if len(ac.free) >= c.maxIdleConns() || cn.expired(cn.idleSince) {
+		c.closeConnLocked(ac, cn)
+		return
+	}
+	ac.free = append(ac.free, cn)
+
+	if c.MaxConnIdleTime > 0 || c.MaxConnLifetime > 0 {
+		c.pool.reaperOnce.Do(func() { go c.reapConns() })
+	}
+}
+
+// serversChanged keeps the pool in line with the servers of the selector:
+// idle connections to removed servers are closed and those in use are
+// closed once released, or after DrainTimeout, while connections to other
+// servers are untouched.
+func (c *Client) serversChanged(added, removed []net.Addr) {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	for _, addr := range added {
+		for _, key := range families(addr) {
+			if ac, ok := c.pool.addrs[key]; ok {
+				ac.retired = false
+			}
+		}
+	}
+	for _, addr := range removed {
+		for _, key := range families(addr) {
+			ac, ok := c.pool.addrs[key]
+			if !ok {
+				continue
+			}
+			ac.retired = true
+			for _, cn := range ac.free {
+				c.closeConnLocked(ac, cn)
+			}
+			ac.free = nil
+			if ac.open == 0 {
+				delete(c.pool.addrs, key)
+			} else if c.DrainTimeout > 0 {
+				key := key
+				time.AfterFunc(c.DrainTimeout, func() { c.drainExpired(key, ac) })
+			}
+		}
+	}
+}
+
+// drainExpired closes the connections with key still in use to a removed
+// server once DrainTimeout has passed, unless it was added back meanwhile.
+// Their users fail and free the slots.
+func (c *Client) drainExpired(key poolKey, ac *addrConns) {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	if c.pool.addrs[key] != ac || !ac.retired {
+		return
+	}
+	for cn := range ac.conns {
+		cn.nc.Close()
+	}
+}
+
+// closeConn closes cn and frees its slot.
+func (c *Client) closeConn(cn *conn) {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	ac := c.pool.get(cn.key)
+	c.closeConnLocked(ac, cn)
+	if ac.retired && ac.open == 0 {
+		delete(c.pool.addrs, cn.key)
+	}
+}
+
+// closeConnLocked closes cn and passes its slot on to the oldest waiter, if
+// any. c.pool.mu must be held.
+func (c *Client) closeConnLocked(ac *addrConns, cn *conn) {
+	cn.nc.Close()
+	delete(ac.conns, cn)
+	c.releaseSlotLocked(ac)
+}
+
+// discardConn closes cn, keeping its slot for a replacement.
+func (c *Client) discardConn(cn *conn) {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	cn.nc.Close()
+	delete(c.pool.get(cn.key).conns, cn)
+}
+
+// releaseSlotLocked frees a connection slot. c.pool.mu must be held.
+func (c *Client) releaseSlotLocked(ac *addrConns) {
+	if len(ac.waiters) > 0 {
+		w := ac.waiters[0]
+		ac.waiters = ac.waiters[1:]
+		w <- nil
+		return
+	}
+	ac.open--
+}
+
+// getConn returns an idle connection to addr for requests in protocol p or
+// dials a new one. When MaxOpenConns connections of the protocol family to
+// addr are already open it waits up to PoolTimeout for one to be released
+// before failing with ErrPoolExhausted, or until ctx is done. The
+// connection deadline is set from ctx.
+func (c *Client) getConn(ctx context.Context, addr net.Addr, p Protocol) (*conn, error) {
+	c.pool.mu.Lock()
+	if c.pool.closed {
+		c.pool.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	ac := c.pool.get(newPoolKey(addr, p))
+	for n := len(ac.free); n > 0; n-- {
+		cn := ac.free[n-1]
+		ac.free = ac.free[:n-1]
+		if cn.expired(time.Now()) {
+			c.closeConnLocked(ac, cn)
+			continue
+		}
+		c.pool.mu.Unlock()
+		if err := cn.setDeadline(ctx); err != nil {
+			// The connection broke while idle; dial a replacement in its
+			// slot.
+			c.discardConn(cn)
+			return c.dialConn(ctx, addr, p)
+		}
+		return cn, nil
+	}
+	if c.MaxOpenConns <= 0 || ac.open < c.MaxOpenConns {
+		ac.open++
+		c.pool.mu.Unlock()
+		return c.dialConn(ctx, addr, p)
+	}
+
+	w := make(chan *conn, 1)
+	ac.waiters = append(ac.waiters, w)
+	c.pool.mu.Unlock()
+
+	// The wait counts against the operation deadline.
+	timer := time.NewTimer(min(c.poolTimeout(), time.Until(c.deadline(ctx))))
+	defer timer.Stop()
+
+	err := ErrPoolExhausted
+	select {
+	case cn := <-w:
+		return c.takeHandoff(ctx, addr, p, cn)
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.pool.mu.Lock()
+	for i, other := range ac.waiters {
+		if other == w {
+			ac.waiters = append(ac.waiters[:i], ac.waiters[i+1:]...)
+			c.pool.mu.Unlock()
+			return nil, err
+		}
+	}
+	c.pool.mu.Unlock()
+
+	// We were handed a connection or slot while giving up.
+	return c.takeHandoff(ctx, addr, p, <-w)
+}
+
+// takeHandoff completes a getConn that waited: cn is a released connection,
+// or nil if a slot was reserved for dialing a new one.
+func (c *Client) takeHandoff(ctx context.Context, addr net.Addr, p Protocol, cn *conn) (*conn, error) {
+	if cn == nil {
+		return c.dialConn(ctx, addr, p)
+	}
+	if err := cn.setDeadline(ctx); err != nil {
+		c.discardConn(cn)
+		return c.dialConn(ctx, addr, p)
+	}
+	return cn, nil
+}
+
+// dialConn dials a new connection to addr for requests in protocol p into
+// a slot already reserved by the caller, freeing the slot if the dial fails.
+func (c *Client) dialConn(ctx context.Context, addr net.Addr, p Protocol) (*conn, error) {
+	key := newPoolKey(addr, p)
+	nc, err := c.connect(ctx, addr, p)
+	if err != nil {
+		c.pool.mu.Lock()
+		c.releaseSlotLocked(c.pool.get(key))
+		c.pool.mu.Unlock()
+		return nil, err
+	}
+	cn := &conn{
+		nc:        nc,
+		read:      &countingReader{r: nc},
+		addr:      addr,
+		key:       key,
+		c:         c,
+		createdAt: time.Now(),
+	}
+	cn.rw = bufio.NewReadWriter(bufio.NewReader(cn.read), bufio.NewWriter(nc))
+	c.pool.mu.Lock()
+	ac := c.pool.get(key)
+	if ac.conns == nil {
+		ac.conns = make(map[*conn]struct{})
+	}
+	ac.conns[cn] = struct{}{}
+	c.pool.mu.Unlock()
+
+	if err := cn.setDeadline(ctx); err != nil {
+		c.closeConn(cn)
+		return nil, err
+	}
+	return cn, nil
+}
+
+// reapInterval returns how often the reaper scans for stale connections.
+func (c *Client) reapInterval() time.Duration {
+	d := c.MaxConnIdleTime
+	if d <= 0 || (c.MaxConnLifetime > 0 && c.MaxConnLifetime < d) {
+		d = c.MaxConnLifetime
+	}
+	return max(d/2, time.Millisecond)
+}
+
+// reapConns periodically closes idle connections that have expired, so
+// long-lived clients do not hold sockets a load balancer has already dropped.
+func (c *Client) reapConns() {
+	ticker := time.NewTicker(c.reapInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.pool.done:
+			return
+		case now := <-ticker.C:
+			c.reapExpired(now)
+		}
+	}
+}
+
+// reapExpired closes every idle connection that has expired by now.
+func (c *Client) reapExpired(now time.Time) {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	for _, ac := range c.pool.addrs {
+		live := ac.free[:0]
+		for _, cn := range ac.free {
+			if cn.expired(now) {
+				c.closeConnLocked(ac, cn)
+			} else {
+				live = append(live, cn)
+			}
+		}
+		clear(ac.free[len(live):])
+		ac.free = live
+	}
+}
+
+// Warmup opens connections to every stream server until connsPerServer of
+// them are pooled, so the first requests after startup do not pay the dial
+// and handshake latency. connsPerServer is capped by MaxIdleConns and
+// MaxOpenConns, since extra connections would be closed or block. Servers
+// reached over UDP are skipped.
+func (c *Client) Warmup(ctx context.Context, connsPerServer int) error {
+	n := min(connsPerServer, c.maxIdleConns())
+	if c.MaxOpenConns > 0 {
+		n = min(n, c.MaxOpenConns)
+	}
+
+	return c.eachServer(func(addr net.Addr) error {
+		sp := c.serverProtocol(addr)
+		if c.useUDP(addr, sp) {
+			return nil
+		}
+
+		var conns []*conn
+		defer func() {
+			for _, cn := range conns {
+				cn.release()
+			}
+		}()
+		for len(conns) < n {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			cn, err := c.getConn(ctx, addr, sp.Protocol)
+			if err != nil {
+				return err
+			}
+			conns = append(conns, cn)
+		}
+		return nil
+	})
+}
+
+// Close closes all idle connections and stops background goroutines.
+// Connections in use are closed when their operation completes, and callers
+// waiting for a connection fail. Subsequent operations return
+// ErrClientClosed, as does a second call to Close.
+func (c *Client) Close() error {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	if c.pool.closed {
+		return ErrClientClosed
+	}
+	c.pool.closed = true
+	close(c.pool.done)
+
+	for _, ac := range c.pool.addrs {
+		for _, cn := range ac.free {
+			cn.nc.Close()
+			ac.open--
+		}
+		ac.free = nil
+		// Waiters are handed an empty slot; dialing then fails with
+		// ErrClientClosed and frees it.
+		for len(ac.waiters) > 0 {
+			c.releaseSlotLocked(ac)
+		}
+	}
+	return nil
+}
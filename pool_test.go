@@ -0,0 +1,396 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnectionReuse(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	for i := 0; i < 5; i++ {
+		if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// A miss leaves the connection usable.
+		if _, err := client.Get("missing"); err != ErrCacheMiss {
+			t.Fatalf("expected ErrCacheMiss, got %v", err)
+		}
+	}
+
+	if n := srv.accepted(); n != 1 {
+		t.Fatalf("expected 1 connection, got %d", n)
+	}
+}
+
+func TestConnectionDiscardedOnError(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	addr, _ := client.selector.Select("foo")
+
+	cn, err := client.getConn(context.Background(), addr, ProtocolText)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	err = ErrCacheMiss
+	cn.condRelease(&err)
+	if open, idle := client.pool.stats(addr); open != 1 || idle != 1 {
+		t.Fatalf("expected the connection to be kept after a miss, got open=%d idle=%d", open, idle)
+	}
+
+	cn, _ = client.getConn(context.Background(), addr, ProtocolText)
+	err = errUDPFrame
+	cn.condRelease(&err)
+	if open, idle := client.pool.stats(addr); open != 0 || idle != 0 {
+		t.Fatalf("expected the connection to be discarded after a protocol error, got open=%d idle=%d", open, idle)
+	}
+}
+
+func TestConnectionDiscardedOnUnreadData(t *testing.T) {
+	// A server answering every request twice.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				r := bufio.NewReader(nc)
+				for {
+					if _, err := r.ReadString('\n'); err != nil {
+						return
+					}
+					if _, err := r.ReadString('\n'); err != nil {
+						return
+					}
+					nc.Write([]byte("STORED\r\nSTORED\r\n"))
+				}
+			}()
+		}
+	}()
+
+	client, _ := NewClient([]string{ln.Addr().String()}, false)
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	addr, _ := client.selector.Select("foo")
+	if open, idle := client.pool.stats(addr); open != 0 || idle != 0 {
+		t.Fatalf("expected the desynchronized connection to be discarded, got open=%d idle=%d", open, idle)
+	}
+}
+
+func TestMaxIdleConns(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.MaxIdleConns = 1
+	addr, _ := client.selector.Select("foo")
+
+	var conns []*conn
+	for i := 0; i < 3; i++ {
+		cn, err := client.getConn(context.Background(), addr, ProtocolText)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		conns = append(conns, cn)
+	}
+	for _, cn := range conns {
+		cn.release()
+	}
+
+	if open, idle := client.pool.stats(addr); open != 1 || idle != 1 {
+		t.Fatalf("expected 1 open and idle connection, got open=%d idle=%d", open, idle)
+	}
+}
+
+func TestMaxOpenConns(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.MaxOpenConns = 1
+	client.PoolTimeout = 50 * time.Millisecond
+	addr, _ := client.selector.Select("foo")
+
+	cn, err := client.getConn(context.Background(), addr, ProtocolText)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.getConn(context.Background(), addr, ProtocolText); err != ErrPoolExhausted {
+		t.Fatalf("expected ErrPoolExhausted, got %v", err)
+	}
+
+	// A waiter is handed the connection once it is released.
+	client.PoolTimeout = 5 * time.Second
+	got := make(chan *conn)
+	go func() {
+		cn, _ := client.getConn(context.Background(), addr, ProtocolText)
+		got <- cn
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cn.release()
+	if waited := <-got; waited != cn {
+		t.Fatalf("expected the released connection to be handed over")
+	}
+
+	// A waiter dials a new connection once the open one is closed.
+	go func() {
+		cn, _ := client.getConn(context.Background(), addr, ProtocolText)
+		got <- cn
+	}()
+	time.Sleep(10 * time.Millisecond)
+	client.closeConn(cn)
+	waited := <-got
+	if waited == nil || waited == cn {
+		t.Fatalf("expected a new connection, got %v", waited)
+	}
+	if open, _ := client.pool.stats(addr); open != 1 {
+		t.Fatalf("expected 1 open connection, got %d", open)
+	}
+}
+
+func TestDeadlineRefreshedOnReuse(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.Timeout = 50 * time.Millisecond
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// The pooled connection's deadline has passed by now.
+	time.Sleep(2 * client.Timeout)
+	if _, err := client.Get("foo"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n := srv.accepted(); n != 1 {
+		t.Fatalf("expected the connection to be reused, got %d connections", n)
+	}
+}
+
+func TestPoolWaitCountsAgainstTimeout(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.MaxOpenConns = 1
+	client.PoolTimeout = 5 * time.Second
+	client.Timeout = 50 * time.Millisecond
+	addr, _ := client.selector.Select("foo")
+
+	cn, err := client.getConn(context.Background(), addr, ProtocolText)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.release()
+
+	start := time.Now()
+	if _, err := client.Get("foo"); err != ErrPoolExhausted {
+		t.Fatalf("expected ErrPoolExhausted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the wait to end with Timeout, took %v", elapsed)
+	}
+}
+
+func TestMaxConnIdleTime(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.MaxConnIdleTime = 20 * time.Millisecond
+	addr, _ := client.selector.Select("foo")
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if open, idle := client.pool.stats(addr); open != 1 || idle != 1 {
+		t.Fatalf("expected 1 idle connection, got open=%d idle=%d", open, idle)
+	}
+
+	// The reaper closes the connection in the background.
+	deadline := time.Now().Add(time.Second)
+	for {
+		open, _ := client.pool.stats(addr)
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the idle connection to be reaped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMaxConnLifetime(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.MaxConnLifetime = time.Hour
+	addr, _ := client.selector.Select("foo")
+
+	cn, err := client.getConn(context.Background(), addr, ProtocolText)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cn.createdAt = time.Now().Add(-2 * time.Hour)
+	cn.release()
+
+	// An expired connection is never handed out again.
+	if got, _ := client.getConn(context.Background(), addr, ProtocolText); got == cn {
+		t.Fatalf("expected an expired connection to be replaced")
+	}
+	if open, _ := client.pool.stats(addr); open != 1 {
+		t.Fatalf("expected 1 open connection, got %d", open)
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.MaxConnIdleTime = time.Minute
+	addr, _ := client.selector.Select("foo")
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if open, idle := client.pool.stats(addr); open != 0 || idle != 0 {
+		t.Fatalf("expected all connections to be closed, got open=%d idle=%d", open, idle)
+	}
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != ErrClientClosed {
+		t.Fatalf("expected ErrClientClosed, got %v", err)
+	}
+	client.UseUDP = true
+	if _, err := client.Get("foo"); err != ErrClientClosed {
+		t.Fatalf("expected ErrClientClosed over UDP, got %v", err)
+	}
+	if err := client.Close(); err != ErrClientClosed {
+		t.Fatalf("expected ErrClientClosed from a second Close, got %v", err)
+	}
+}
+
+func TestCloseReleasesInUseConns(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	addr, _ := client.selector.Select("foo")
+
+	cn, err := client.getConn(context.Background(), addr, ProtocolText)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client.Close()
+	cn.release()
+	if open, idle := client.pool.stats(addr); open != 0 || idle != 0 {
+		t.Fatalf("expected the released connection to be closed, got open=%d idle=%d", open, idle)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.MaxIdleConns = 3
+	addr, _ := client.selector.Select("foo")
+
+	if err := client.Warmup(context.Background(), 5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if open, idle := client.pool.stats(addr); open != 3 || idle != 3 {
+		t.Fatalf("expected 3 warm connections, got open=%d idle=%d", open, idle)
+	}
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n := srv.accepted(); n != 3 {
+		t.Fatalf("expected no new connections after warmup, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Warmup(ctx, 3); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	// The removed server accepts requests but never answers them.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		nc, err := ln.Accept()
+		if err == nil {
+			accepted <- nc
+		}
+	}()
+	kept := newTestServer(t)
+
+	ss := &ServerList{}
+	if err := ss.SetServers(ln.Addr().String(), kept.addr); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client, _ := NewFromSelector(ss, false)
+	client.Timeout = 10 * time.Second
+	client.DrainTimeout = 50 * time.Millisecond
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Ping("", WithServer(ln.Addr().String()))
+	}()
+	nc := <-accepted
+	defer nc.Close()
+
+	start := time.Now()
+	if err := ss.SetServers(kept.addr); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected the operation to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the connection to be closed after the drain timeout")
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("expected the operation to be left to finish for 50ms, got %v", d)
+	}
+	if open, _ := client.pool.stats(parseAddr(t, ln.Addr().String())); open != 0 {
+		t.Fatalf("expected no open connections, got %d", open)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	if err := client.Set(&Item{Key: "k", Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	stats := client.PoolStats()
+	if ps := stats[srv.addr]; len(stats) != 1 || ps.Open != 1 || ps.Idle != 1 {
+		t.Fatalf("expected one idle connection, got %+v", stats)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package prommetrics exports the metrics of a gomcache.Client to
+// Prometheus. A Collector receives every operation through the
+// gomcache.MetricsRecorder hook and, as a prometheus.Collector, reports
+// what it counted along with the state of the connection pools and the
+// latency of each server to the registries it is registered with.
+package prommetrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nihankhan/gomcache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultBuckets are the default upper bounds, in seconds, of the buckets
+// of the operation latency histogram, suited to the sub-millisecond
+// latencies of a cache.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Collector counts the operations of a client. Set it as the Metrics of
+// the client, then register it:
+//
+//	col := prommetrics.NewCollector(client)
+//	client.Metrics = col
+//	prometheus.MustRegister(col)
+//
+// It is safe for concurrent use.
+type Collector struct {
+	// Namespace prefixes the names of the metrics. If empty, "gomcache" is
+	// used. It must be set before the Collector is first used.
+	Namespace string
+
+	// Buckets are the upper bounds of the latency histogram buckets, in
+	// increasing order. If nil, DefaultBuckets are used. They must be set
+	// before the Collector is first used.
+	Buckets []float64
+
+	client *gomcache.Client
+
+	once      sync.Once
+	latencies *prometheus.HistogramVec
+	ops       *prometheus.CounterVec
+	errs      *prometheus.CounterVec
+	servers   *prometheus.CounterVec
+	pools     *prometheus.Desc
+	serverLat *prometheus.Desc
+
+	handlerOnce sync.Once
+	handler     http.Handler
+}
+
+// NewCollector returns a Collector reporting the connection pools of
+// client. Operations are only counted once it is set as the Metrics of
+// the client.
+func NewCollector(client *gomcache.Client) *Collector {
+	return &Collector{client: client}
+}
+
+// init creates the metrics from Namespace and Buckets on first use.
+func (c *Collector) init() {
+	c.once.Do(func() {
+		ns := c.Namespace
+		if ns == "" {
+			ns = "gomcache"
+		}
+		buckets := c.Buckets
+		if buckets == nil {
+			buckets = DefaultBuckets
+		}
+		c.latencies = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of the operations of the client.",
+			Buckets:   buckets,
+		}, []string{"client", "op"})
+		c.ops = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "operations_total",
+			Help:      "Operations of the client by outcome: hit, miss or error.",
+		}, []string{"client", "op", "outcome"})
+		c.errs = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "errors_total",
+			Help:      "Failed operations of the client by kind of error.",
+		}, []string{"client", "op", "kind"})
+		c.servers = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "server_operations_total",
+			Help:      "Operations that talked to a single server, by server and outcome.",
+		}, []string{"server", "outcome"})
+		c.pools = prometheus.NewDesc(ns+"_pool_connections",
+			"Connections to each server by state: idle or in use.",
+			[]string{"server", "state"}, nil)
+		c.serverLat = prometheus.NewDesc(ns+"_server_latency_seconds",
+			"Latency percentiles of the recent round trips to each server.",
+			[]string{"server", "quantile"}, nil)
+	})
+}
+
+// RecordOp counts m. It implements gomcache.MetricsRecorder.
+func (c *Collector) RecordOp(m gomcache.OpMetrics) {
+	c.init()
+	outcome := m.Outcome.String()
+	c.latencies.WithLabelValues(m.Client, m.Op).Observe(m.Duration.Seconds())
+	c.ops.WithLabelValues(m.Client, m.Op, outcome).Inc()
+	if m.Outcome == gomcache.OutcomeError {
+		c.errs.WithLabelValues(m.Client, m.Op, ErrorKind(m.Err)).Inc()
+	}
+	if m.Server != "" {
+		c.servers.WithLabelValues(m.Server, outcome).Inc()
+	}
+}
+
+// Describe sends the descriptors of the metrics to ch. It implements
+// prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.init()
+	c.latencies.Describe(ch)
+	c.ops.Describe(ch)
+	c.errs.Describe(ch)
+	c.servers.Describe(ch)
+	ch <- c.pools
+	ch <- c.serverLat
+}
+
+// Collect sends the metrics to ch, reading the connection pools and the
+// server latencies of the client at the time. It implements
+// prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.init()
+	c.latencies.Collect(ch)
+	c.ops.Collect(ch)
+	c.errs.Collect(ch)
+	c.servers.Collect(ch)
+
+	pools := c.client.PoolStats()
+	for _, addr := range sortedAddrs(pools) {
+		ps := pools[addr]
+		ch <- prometheus.MustNewConstMetric(c.pools, prometheus.GaugeValue, float64(ps.Idle), addr, "idle")
+		ch <- prometheus.MustNewConstMetric(c.pools, prometheus.GaugeValue, float64(ps.Open-ps.Idle), addr, "in_use")
+	}
+
+	latencies := c.client.ClientStats().Servers
+	for _, addr := range sortedAddrs(latencies) {
+		sl := latencies[addr]
+		for _, q := range []struct {
+			quantile string
+			d        time.Duration
+		}{{"0.5", sl.P50}, {"0.95", sl.P95}, {"0.99", sl.P99}} {
+			ch <- prometheus.MustNewConstMetric(c.serverLat, prometheus.GaugeValue, q.d.Seconds(), addr, q.quantile)
+		}
+	}
+}
+
+// ServeHTTP serves the metrics of c alone in the Prometheus exposition
+// format, for services without a registry of their own.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.handlerOnce.Do(func() {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(c)
+		c.handler = promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	})
+	c.handler.ServeHTTP(w, r)
+}
+
+// ErrorKind classifies err for the kind label of the errors metric:
+// "timeout", "canceled", "no_servers", "server", "protocol", "network" or
+// "other".
+func ErrorKind(err error) string {
+	var ne net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, gomcache.ErrNoServers):
+		return "no_servers"
+	case errors.Is(err, gomcache.ErrServerError):
+		return "server"
+	case errors.Is(err, gomcache.ErrProtocol):
+		return "protocol"
+	case errors.As(err, &ne):
+		return "network"
+	}
+	return "other"
+}
+
+// sortedAddrs returns the server addresses keying m in order.
+func sortedAddrs[V any](m map[string]V) []string {
+	addrs := make([]string, 0, len(m))
+	for addr := range m {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prommetrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nihankhan/gomcache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	client, _ := gomcache.NewClient([]string{"127.0.0.1:11211"}, false)
+	col := NewCollector(client)
+	col.Buckets = []float64{0.001, 0.01}
+
+	col.RecordOp(gomcache.OpMetrics{Op: "get", Server: "127.0.0.1:11211", Duration: 500 * time.Microsecond, Outcome: gomcache.OutcomeHit})
+	col.RecordOp(gomcache.OpMetrics{Op: "get", Server: "127.0.0.1:11211", Duration: 5 * time.Millisecond, Outcome: gomcache.OutcomeMiss})
+	col.RecordOp(gomcache.OpMetrics{Op: "set", Duration: time.Second, Outcome: gomcache.OutcomeError, Err: context.DeadlineExceeded})
+
+	body := scrape(t, col)
+	for _, want := range []string{
+		"# TYPE gomcache_operation_duration_seconds histogram\n",
+		`gomcache_operation_duration_seconds_bucket{client="",op="get",le="0.001"} 1` + "\n",
+		`gomcache_operation_duration_seconds_bucket{client="",op="get",le="0.01"} 2` + "\n",
+		`gomcache_operation_duration_seconds_bucket{client="",op="set",le="0.01"} 0` + "\n",
+		`gomcache_operation_duration_seconds_bucket{client="",op="set",le="+Inf"} 1` + "\n",
+		`gomcache_operation_duration_seconds_count{client="",op="get"} 2` + "\n",
+		`gomcache_operations_total{client="",op="get",outcome="hit"} 1` + "\n",
+		`gomcache_operations_total{client="",op="get",outcome="miss"} 1` + "\n",
+		`gomcache_errors_total{client="",kind="timeout",op="set"} 1` + "\n",
+		`gomcache_server_operations_total{outcome="miss",server="127.0.0.1:11211"} 1` + "\n",
+		`gomcache_pool_connections{server="127.0.0.1:11211",state="idle"} 0` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in\n%s", want, body)
+		}
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	for err, want := range map[error]string{
+		context.Canceled:        "canceled",
+		gomcache.ErrNoServers:   "no_servers",
+		gomcache.ErrServerError: "server",
+		gomcache.ErrProtocol:    "protocol",
+		gomcache.ErrCacheMiss:   "other",
+	} {
+		if got := ErrorKind(err); got != want {
+			t.Fatalf("%v: expected %s, got %s", err, want, got)
+		}
+	}
+}
+
+func TestCollectorAsMetrics(t *testing.T) {
+	client, _ := gomcache.NewClient([]string{"127.0.0.1:1"}, false)
+	col := NewCollector(client)
+	client.Metrics = col
+	client.Get("k")
+
+	body := scrape(t, col)
+	if !strings.Contains(body, `gomcache_operations_total{client="",op="get",outcome="error"} 1`) {
+		t.Fatalf("expected the failed get to be counted, got\n%s", body)
+	}
+}
+
+func TestCollectorRegister(t *testing.T) {
+	client, _ := gomcache.NewClient([]string{"127.0.0.1:11211"}, false)
+	col := NewCollector(client)
+	col.Namespace = "cache"
+	col.RecordOp(gomcache.OpMetrics{Op: "get", Duration: time.Millisecond, Outcome: gomcache.OutcomeHit})
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(col); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	names := make(map[string]bool)
+	for _, f := range families {
+		names[f.GetName()] = true
+	}
+	for _, want := range []string{"cache_operation_duration_seconds", "cache_operations_total", "cache_pool_connections"} {
+		if !names[want] {
+			t.Fatalf("expected %s among %v", want, names)
+		}
+	}
+}
+
+func TestServerLatency(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer nc.Close()
+		r := bufio.NewReader(nc)
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+			nc.Write([]byte("END\r\n"))
+		}
+	}()
+
+	client, _ := gomcache.NewClient([]string{ln.Addr().String()}, false)
+	client.Get("foo")
+	body := scrape(t, NewCollector(client))
+	for _, q := range []string{"0.5", "0.95", "0.99"} {
+		want := fmt.Sprintf("gomcache_server_latency_seconds{quantile=%q,server=%q} ", q, ln.Addr().String())
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in\n%s", want, body)
+		}
+	}
+}
+
+// scrape returns the metrics col serves over HTTP.
+func scrape(t *testing.T, col *Collector) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	col.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	return rec.Body.String()
+}
@@ -0,0 +1,349 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Protocol selects the wire dialect used to talk to a server.
+type Protocol int
+
+const (
+	// ProtocolText is the classic ASCII protocol understood by every
+	// memcached version and proxy.
+	ProtocolText Protocol = iota
+
+	// ProtocolMeta uses the meta commands (mg, ms, md) added in memcached 1.6.
+	ProtocolMeta
+
+	// ProtocolBinary is the binary protocol.
+	ProtocolBinary
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolText:
+		return "text"
+	case ProtocolMeta:
+		return "meta"
+	case ProtocolBinary:
+		return "binary"
+	}
+	return "Protocol(" + strconv.Itoa(int(p)) + ")"
+}
+
+// Transport selects the network used to reach a server.
+type Transport int
+
+const (
+	// TransportDefault follows Client.UseUDP.
+	TransportDefault Transport = iota
+	TransportTCP
+	TransportUDP
+)
+
+// ServerProtocol describes how the client talks to a single server.
+type ServerProtocol struct {
+	Protocol  Protocol
+	Transport Transport
+}
+
+// serverSettings holds per-server overrides keyed by resolved address.
+type serverSettings struct {
+	mu        sync.RWMutex
+	protocols map[string]ServerProtocol
+	auth      map[string]ServerAuth
+}
+
+func newServerSettings() *serverSettings {
+	return &serverSettings{
+		protocols: make(map[string]ServerProtocol),
+		auth:      make(map[string]ServerAuth),
+	}
+}
+
+// SetServerProtocol forces the protocol and transport used for the server at
+// addr, which is resolved the same way as by ServerList.SetServers. This is
+// useful in mixed fleets where some nodes run old versions or sit behind
+// proxies that only speak the text protocol. Servers without an override use
+// ProtocolText and follow Client.UseUDP.
+func (c *Client) SetServerProtocol(addr string, p ServerProtocol) error {
+	a, err := resolveServer(addr)
+	if err != nil {
+		return err
+	}
+
+	c.servers.mu.Lock()
+	defer c.servers.mu.Unlock()
+	c.servers.protocols[a.String()] = p
+	return nil
+}
+
+// serverProtocol returns the protocol settings in effect for addr.
+func (c *Client) serverProtocol(addr net.Addr) ServerProtocol {
+	c.servers.mu.RLock()
+	defer c.servers.mu.RUnlock()
+	return c.servers.protocols[addr.String()]
+}
+
+// useUDP reports whether requests to addr should be sent over UDP.
+func (c *Client) useUDP(addr net.Addr, sp ServerProtocol) bool {
+	if addr.Network() == "unix" {
+		return false
+	}
+	switch sp.Transport {
+	case TransportTCP:
+		return false
+	case TransportUDP:
+		return true
+	}
+	return c.UseUDP
+}
+
+// appendGet appends a request fetching keys to b.
+func (p Protocol) appendGet(b []byte, keys []string) []byte {
+	switch p {
+	case ProtocolMeta:
+		return appendMetaGet(b, keys)
+	case ProtocolBinary:
+		return appendBinaryGet(b, keys)
+	}
+	b = append(b, "get"...)
+	for _, key := range keys {
+		b = append(b, ' ')
+		b = append(b, key...)
+	}
+	return append(b, crlf...)
+}
+
+// appendGets appends a request fetching keys with their CAS values to b.
+// The meta and binary protocols always return them.
+func (p Protocol) appendGets(b []byte, keys []string) []byte {
+	if p != ProtocolText {
+		return p.appendGet(b, keys)
+	}
+	b = append(b, "gets"...)
+	for _, key := range keys {
+		b = append(b, ' ')
+		b = append(b, key...)
+	}
+	return append(b, crlf...)
+}
+
+// parseGet reads the response to a request built by appendGet, calling cb
+// for every item found.
+func (p Protocol) parseGet(r *bufio.Reader, cb func(*Item)) error {
+	switch p {
+	case ProtocolMeta:
+		return parseMetaGet(r, cb)
+	case ProtocolBinary:
+		return parseBinaryGet(r, cb)
+	}
+	return parseGetResponse(r, cb)
+}
+
+// appendStore appends a storage command (set, add, replace, append,
+// prepend or cas) for it to b.
+func (p Protocol) appendStore(b []byte, verb string, it *Item) []byte {
+	switch p {
+	case ProtocolMeta:
+		return appendMetaStore(b, verb, it)
+	case ProtocolBinary:
+		return appendBinaryStore(b, verb, it)
+	}
+	b = append(b, verb...)
+	b = append(b, ' ')
+	b = append(b, it.Key...)
+	b = append(b, ' ')
+	b = strconv.AppendUint(b, uint64(it.Flags), 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(it.Expiration), 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(it.Value)), 10)
+	if verb == "cas" {
+		b = append(b, ' ')
+		b = strconv.AppendUint(b, it.casID, 10)
+	}
+	b = append(b, crlf...)
+	b = append(b, it.Value...)
+	return append(b, crlf...)
+}
+
+// parseStore reads the response to a storage command.
+func (p Protocol) parseStore(r *bufio.Reader) error {
+	switch p {
+	case ProtocolMeta:
+		return parseMetaStatus(r)
+	case ProtocolBinary:
+		return parseBinaryStatus(r)
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return err
+	}
+	switch {
+	case bytes.Equal(line, resultStored):
+		return nil
+	case bytes.Equal(line, resultNotStored):
+		return ErrNotStored
+	case bytes.Equal(line, resultNotFound):
+		return ErrCacheMiss
+	case bytes.Equal(line, resultExists):
+		return ErrCASConflict
+	}
+	if err := errorResponse(line); err != nil {
+		return err
+	}
+	return unexpectedResponse(line)
+}
+
+// appendDelete appends a request deleting key to b.
+func (p Protocol) appendDelete(b []byte, key string) []byte {
+	switch p {
+	case ProtocolMeta:
+		b = append(b, "md "...)
+	case ProtocolBinary:
+		return appendBinaryRequest(b, opDelete, key, nil, nil)
+	default:
+		b = append(b, "delete "...)
+	}
+	b = append(b, key...)
+	return append(b, crlf...)
+}
+
+// parseDelete reads the response to a delete request.
+func (p Protocol) parseDelete(r *bufio.Reader) error {
+	switch p {
+	case ProtocolMeta:
+		return parseMetaStatus(r)
+	case ProtocolBinary:
+		return parseBinaryStatus(r)
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return err
+	}
+	switch {
+	case bytes.Equal(line, resultDeleted):
+		return nil
+	case bytes.Equal(line, resultNotFound):
+		return ErrCacheMiss
+	}
+	return unexpectedResponse(line)
+}
+
+// appendIncr appends a request adding delta to the decimal value of key to
+// b, or subtracting it if verb is "decr".
+func (p Protocol) appendIncr(b []byte, verb, key string, delta uint64) []byte {
+	switch p {
+	case ProtocolMeta:
+		return appendMetaArithmetic(b, verb, key, delta)
+	case ProtocolBinary:
+		return appendBinaryIncr(b, verb, key, delta)
+	}
+	b = append(b, verb...)
+	b = append(b, ' ')
+	b = append(b, key...)
+	b = append(b, ' ')
+	b = strconv.AppendUint(b, delta, 10)
+	return append(b, crlf...)
+}
+
+// parseIncr reads the response to an incr or decr request and returns the
+// new value.
+func (p Protocol) parseIncr(r *bufio.Reader) (uint64, error) {
+	switch p {
+	case ProtocolMeta:
+		return parseMetaArithmetic(r)
+	case ProtocolBinary:
+		return parseBinaryIncr(r)
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return 0, err
+	}
+	if bytes.Equal(line, resultNotFound) {
+		return 0, ErrCacheMiss
+	}
+	if err := errorResponse(line); err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(string(bytes.TrimSpace(line)), 10, 64)
+	if err != nil {
+		return 0, unexpectedResponse(line)
+	}
+	return n, nil
+}
+
+// appendFlush appends a request invalidating every item to b. Meta
+// connections use the text command.
+func (p Protocol) appendFlush(b []byte) []byte {
+	if p == ProtocolBinary {
+		return appendBinaryRequest(b, opFlush, "", nil, nil)
+	}
+	b = append(b, "flush_all"...)
+	return append(b, crlf...)
+}
+
+// parseFlush reads the response to a flush request.
+func (p Protocol) parseFlush(r *bufio.Reader) error {
+	if p == ProtocolBinary {
+		return parseBinaryStatus(r)
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(line, resultOK) {
+		if err := errorResponse(line); err != nil {
+			return err
+		}
+		return unexpectedResponse(line)
+	}
+	return nil
+}
+
+// appendVersion appends a version request to b. Meta connections use the
+// text command, which memcached accepts on the same connection.
+func (p Protocol) appendVersion(b []byte) []byte {
+	if p == ProtocolBinary {
+		return appendBinaryRequest(b, opVersion, "", nil, nil)
+	}
+	b = append(b, "version"...)
+	return append(b, crlf...)
+}
+
+// parseVersion reads the response to a version request.
+func (p Protocol) parseVersion(r *bufio.Reader) error {
+	if p == ProtocolBinary {
+		return parseBinaryStatus(r)
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(line, versionPrefix) {
+		return unexpectedResponse(line)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestServerProtocols(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta, ProtocolBinary} {
+		for tr, name := range map[Transport]string{TransportTCP: "tcp", TransportUDP: "udp"} {
+			p, tr := p, tr
+			t.Run(p.String()+"/"+name, func(t *testing.T) {
+				srv := newTestServer(t)
+				client, _ := NewClient([]string{srv.addr}, false)
+				if err := client.SetServerProtocol(srv.addr, ServerProtocol{Protocol: p, Transport: tr}); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if err := client.Ping(""); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if err := client.Set(&Item{Key: "foo", Value: []byte("bar"), Flags: 7, Expiration: 60}); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				item, err := client.Get("foo")
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if item.Key != "foo" || string(item.Value) != "bar" || item.Flags != 7 {
+					t.Fatalf("unexpected item %+v", item)
+				}
+				if _, err := client.Get("missing"); err != ErrCacheMiss {
+					t.Fatalf("expected ErrCacheMiss, got %v", err)
+				}
+				if err := client.Delete("foo"); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if err := client.Delete("foo"); err != ErrCacheMiss {
+					t.Fatalf("expected ErrCacheMiss, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestServerProtocolOverrideIsPerServer(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.SetServerProtocol("127.0.0.1:1", ServerProtocol{Protocol: ProtocolMeta})
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cmds := srv.commands(); len(cmds) != 1 || !strings.HasPrefix(cmds[0], "set foo") {
+		t.Fatalf("expected a text set command, got %q", cmds)
+	}
+}
+
+func TestParseMetaGetShortValueLine(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("VA\r\n"))
+	err := parseMetaGet(r, func(*Item) {})
+	if err == nil || !strings.Contains(err.Error(), "unexpected response") {
+		t.Fatalf("expected an unexpected response error, got %v", err)
+	}
+}
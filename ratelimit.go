@@ -0,0 +1,122 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// RateAlgorithm is the way a RateLimiter counts requests.
+type RateAlgorithm int
+
+const (
+	// FixedWindow counts the requests of each window, aligned to multiples
+	// of its length, with one incr. It is cheap, but lets up to twice the
+	// limit through around the boundary between two windows.
+	FixedWindow RateAlgorithm = iota
+
+	// SlidingWindow keeps the times of the requests allowed in the last
+	// window under the key and updates them with CAS, so the limit holds
+	// over every window. Each request costs two round trips and up to
+	// 8 bytes per allowed request of storage, so it suits small limits.
+	SlidingWindow
+)
+
+// rateAttempts bounds the CAS round trips of one sliding window Allow,
+// which only repeat while other clients update the same key.
+const rateAttempts = 10
+
+// RateLimiter limits the rate of requests shared by every client of the
+// cache cluster. It fails closed: when the servers cannot be reached,
+// Allow returns an error and callers decide whether to let requests
+// through.
+type RateLimiter struct {
+	// Algorithm is the way requests are counted.
+	Algorithm RateAlgorithm
+
+	client *Client
+}
+
+// RateLimiter returns a rate limiter using algorithm.
+func (c *Client) RateLimiter(algorithm RateAlgorithm) *RateLimiter {
+	return &RateLimiter{Algorithm: algorithm, client: c}
+}
+
+// Allow reports whether one more request under key fits in limit requests
+// per window. Nothing fits in a limit or window of zero. Windows are
+// rounded up to whole seconds when stored, as memcached expirations are.
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration, opts ...CallOption) (bool, error) {
+	if limit <= 0 || window <= 0 {
+		return false, nil
+	}
+	expiration := int32((window+time.Second-1)/time.Second) + 1
+	if l.Algorithm == SlidingWindow {
+		return l.allowSliding(ctx, key, limit, window, expiration, opts)
+	}
+
+	start := time.Now().UnixNano() / int64(window)
+	counter := l.client.Counter(key + ":" + strconv.FormatInt(start, 10))
+	counter.Expiration = expiration
+	n, err := counter.IncrBy(ctx, 1, opts...)
+	if err != nil {
+		return false, err
+	}
+	return n <= uint64(limit), nil
+}
+
+// allowSliding implements Allow for SlidingWindow. The value of key is the
+// Unix times in nanoseconds of the allowed requests, 8 bytes each.
+func (l *RateLimiter) allowSliding(ctx context.Context, key string, limit int, window time.Duration, expiration int32, opts []CallOption) (bool, error) {
+	var err error
+	for i := 0; i < rateAttempts; i++ {
+		now := time.Now().UnixNano()
+		var it *Item
+		it, err = l.client.gets(ctx, key, opts)
+		if errors.Is(err, ErrCacheMiss) {
+			it = &Item{Key: key, Value: binary.BigEndian.AppendUint64(nil, uint64(now)), Expiration: expiration}
+			if err = l.client.storePrimary(ctx, "add", it, opts); err == ErrNotStored {
+				continue
+			}
+			return err == nil, err
+		}
+		if err != nil {
+			return false, err
+		}
+
+		var times []byte
+		for b := it.Value; len(b) >= 8; b = b[8:] {
+			if int64(binary.BigEndian.Uint64(b)) > now-int64(window) {
+				times = append(times, b[:8]...)
+			}
+		}
+		if len(times)/8 >= limit {
+			return false, nil
+		}
+		it.Value = binary.BigEndian.AppendUint64(times, uint64(now))
+		it.Expiration = expiration
+		if err = l.client.storePrimary(ctx, "cas", it, opts); err == ErrCASConflict || err == ErrCacheMiss {
+			continue
+		}
+		return err == nil, err
+	}
+	return false, err
+}
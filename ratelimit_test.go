@@ -0,0 +1,67 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterFixedWindow(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	limiter := client.RateLimiter(FixedWindow)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		ok, err := limiter.Allow(ctx, "api:alice", 3, time.Hour)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if ok != (i < 3) {
+			t.Fatalf("request %d: expected allowed %v, got %v", i, i < 3, ok)
+		}
+	}
+	if ok, _ := limiter.Allow(ctx, "api:bob", 3, time.Hour); !ok {
+		t.Fatal("expected other keys to be limited separately")
+	}
+}
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	for _, p := range []Protocol{ProtocolText, ProtocolMeta, ProtocolBinary} {
+		srv := newTestServer(t)
+		client, _ := NewClient([]string{srv.addr}, false)
+		limiter := client.RateLimiter(SlidingWindow)
+		ctx := context.Background()
+
+		for i := 0; i < 3; i++ {
+			ok, err := limiter.Allow(ctx, "api:alice", 2, time.Second, WithProtocol(p))
+			if err != nil {
+				t.Fatalf("%v: expected no error, got %v", p, err)
+			}
+			if ok != (i < 2) {
+				t.Fatalf("%v: request %d: expected allowed %v, got %v", p, i, i < 2, ok)
+			}
+		}
+		time.Sleep(1100 * time.Millisecond)
+		if ok, err := limiter.Allow(ctx, "api:alice", 2, time.Second, WithProtocol(p)); err != nil || !ok {
+			t.Fatalf("%v: expected the request allowed once the window slid, got %v, %v", p, ok, err)
+		}
+	}
+}
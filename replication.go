@@ -0,0 +1,295 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+)
+
+// ReplicaSelector is implemented by selectors that keep every key on
+// several servers. A client using one writes to and reads from the replicas
+// according to the Consistency of each call.
+type ReplicaSelector interface {
+	ServerSelector
+
+	// SelectReplicas returns the servers holding key, primary first.
+	SelectReplicas(key string) ([]net.Addr, error)
+}
+
+// Consistency trades consistency against latency for a single call when
+// the selector is a ReplicaSelector. It has no effect otherwise.
+type Consistency int
+
+const (
+	// ConsistencyDefault behaves as WriteAll for writes and ReadFallback
+	// for reads.
+	ConsistencyDefault Consistency = iota
+
+	// WritePrimaryOnly writes to the primary only, leaving replicas to
+	// expire or be repaired later.
+	WritePrimaryOnly
+
+	// WriteAll writes to every replica and fails unless all succeed.
+	WriteAll
+
+	// ReadPrimary reads from the primary, falling back to another replica
+	// only if the primary is in the zone of the client and fails.
+	ReadPrimary
+
+	// ReadAnyReplica reads from a random replica, spreading hot keys over
+	// all copies at the risk of reading a stale one.
+	ReadAnyReplica
+
+	// WriteAsync writes to the primary and returns its result, writing the
+	// other replicas in the background. Replicas the write fails to reach
+	// serve the previous value until it expires.
+	WriteAsync
+
+	// ReadFallback reads from the primary and, when it misses or fails,
+	// from the other replicas in turn.
+	ReadFallback
+)
+
+// Replicated is a ReplicaSelector keeping every key on Replicas servers:
+// the one the underlying selector picks and the next ones it would fail
+// over to. With it, writes reach every copy and reads fall back to another
+// copy when one is missing or its server is down.
+type Replicated struct {
+	FailoverSelector
+
+	// Replicas is the number of copies of every key, capped at the number
+	// of servers. If less than 1, keys have a single copy.
+	Replicas int
+}
+
+// SelectReplicas returns the servers holding key, primary first.
+func (r *Replicated) SelectReplicas(key string) ([]net.Addr, error) {
+	n := max(r.Replicas, 1)
+	addrs := make([]net.Addr, 0, n)
+	for attempt := 0; attempt < n; attempt++ {
+		addr, err := r.SelectFailover(key, attempt)
+		if err != nil {
+			return nil, err
+		}
+		if containsAddr(addrs, addr.String()) {
+			// Fewer servers than replicas.
+			break
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// Eject ejects the server at addr from the underlying selector, if it is an
+// EjectingSelector.
+func (r *Replicated) Eject(addr net.Addr) {
+	if es, ok := r.FailoverSelector.(EjectingSelector); ok {
+		es.Eject(addr)
+	}
+}
+
+// Restore restores the server at addr in the underlying selector, if it is
+// an EjectingSelector.
+func (r *Replicated) Restore(addr net.Addr) {
+	if es, ok := r.FailoverSelector.(EjectingSelector); ok {
+		es.Restore(addr)
+	}
+}
+
+// Zone returns the zone of the server at addr from the underlying selector,
+// if it is a ZoneSelector.
+func (r *Replicated) Zone(addr net.Addr) string {
+	if zs, ok := r.FailoverSelector.(ZoneSelector); ok {
+		return zs.Zone(addr)
+	}
+	return ""
+}
+
+// Watch registers fn with the underlying selector, if it is a
+// WatchingSelector.
+func (r *Replicated) Watch(fn func(added, removed []net.Addr)) {
+	if w, ok := r.FailoverSelector.(WatchingSelector); ok {
+		w.Watch(fn)
+	}
+}
+
+// WithConsistency sets the consistency of a call in replicated mode.
+func WithConsistency(c Consistency) CallOption {
+	return func(o *callOptions) { o.consistency = c }
+}
+
+// routeRead returns the server to read key from, preferring replicas in
+// the zone of the client.
+func (c *Client) routeRead(cl *call, key string) (net.Addr, error) {
+	cl.targets.addKey(key)
+	rs, ok := c.selector.(ReplicaSelector)
+	if cl.server != nil || !ok {
+		return c.route(cl, key)
+	}
+	addrs, err := rs.SelectReplicas(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, ErrNoServers
+	}
+	if local := c.localReplicas(addrs); len(local) > 0 {
+		addrs = local
+	}
+	if cl.opts.consistency == ReadAnyReplica {
+		return addrs[rand.Intn(len(addrs))], nil
+	}
+	return addrs[0], nil
+}
+
+// routeWrite returns the servers to write key to.
+func (c *Client) routeWrite(cl *call, key string) ([]net.Addr, error) {
+	cl.targets.addKey(key)
+	rs, ok := c.selector.(ReplicaSelector)
+	if cl.server != nil || !ok {
+		addr, err := c.route(cl, key)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Addr{addr}, nil
+	}
+	addrs, err := rs.SelectReplicas(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, ErrNoServers
+	}
+	if cl.opts.consistency == WritePrimaryOnly {
+		return addrs[:1], nil
+	}
+	return addrs, nil
+}
+
+// writeReplicas calls write for every address concurrently. A replica
+// missing the key does not fail the write as long as another one had it;
+// ErrCacheMiss is returned only if every replica missed. Other failures are
+// reported in a MultiError. With WriteAsync, only the write to the primary
+// is waited for.
+func (c *Client) writeReplicas(cl *call, addrs []net.Addr, write func(*call, net.Addr) error) error {
+	if len(addrs) == 1 {
+		return write(cl, addrs[0])
+	}
+	if cl.opts.consistency == WriteAsync {
+		// The background writes outlive the call.
+		bcl := *cl
+		bcl.ctx = context.WithoutCancel(cl.ctx)
+		for _, addr := range addrs[1:] {
+			go write(&bcl, addr)
+		}
+		return write(cl, addrs[0])
+	}
+
+	var lk sync.Mutex
+	var merr MultiError
+	var wg sync.WaitGroup
+	misses := 0
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr net.Addr) {
+			defer wg.Done()
+			err := write(cl, addr)
+			lk.Lock()
+			defer lk.Unlock()
+			switch {
+			case err == nil:
+			case errors.Is(err, ErrCacheMiss):
+				misses++
+			default:
+				if merr == nil {
+					merr = make(MultiError)
+				}
+				merr[addr.String()] = err
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	switch {
+	case merr != nil:
+		return merr
+	case misses == len(addrs):
+		return ErrCacheMiss
+	}
+	return nil
+}
+
+// getFallback completes a Get of key from addr that ended with item and
+// err: with ReadFallback, a miss or failure is retried on the other
+// replicas in turn, and otherwise a failure in the zone of the client is
+// retried in another zone. A hit wins, then a miss, then the first error.
+func (c *Client) getFallback(cl *call, key string, addr net.Addr, item *Item, err error) (*Item, error) {
+	miss := err == nil && item == nil
+	if !miss && (err == nil || resumableError(err)) {
+		return item, err
+	}
+
+	var next []net.Addr
+	switch cl.opts.consistency {
+	case ConsistencyDefault, ReadFallback:
+		next = c.otherReplicas(cl, key, addr)
+	default:
+		if remote := c.zoneFallback(cl, key, addr); remote != nil && !miss {
+			next = []net.Addr{remote}
+		}
+	}
+	for _, a := range next {
+		nitem, nerr := c.getFrom(cl, key, a)
+		switch {
+		case nerr == nil && nitem != nil:
+			return nitem, nil
+		case nerr == nil:
+			item, err = nil, nil
+		}
+	}
+	return item, err
+}
+
+// otherReplicas returns the replicas of key other than addr, those in the
+// zone of the client first.
+func (c *Client) otherReplicas(cl *call, key string, addr net.Addr) []net.Addr {
+	rs, ok := c.selector.(ReplicaSelector)
+	if cl.server != nil || !ok {
+		return nil
+	}
+	addrs, err := rs.SelectReplicas(key)
+	if err != nil {
+		return nil
+	}
+	var others []net.Addr
+	for _, a := range c.localReplicas(addrs) {
+		if a.String() != addr.String() {
+			others = append(others, a)
+		}
+	}
+	for _, a := range addrs {
+		if a.String() != addr.String() && !containsAddr(others, a.String()) {
+			others = append(others, a)
+		}
+	}
+	return others
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testReplicas keeps every key on all of its servers, primary first.
+type testReplicas struct {
+	ServerList
+}
+
+func (r *testReplicas) SelectReplicas(key string) ([]net.Addr, error) {
+	var addrs []net.Addr
+	err := r.Each(func(addr net.Addr) error {
+		addrs = append(addrs, addr)
+		return nil
+	})
+	return addrs, err
+}
+
+func TestConsistencyHints(t *testing.T) {
+	primary := newTestServer(t)
+	replica := newTestServer(t)
+
+	sel := &testReplicas{}
+	if err := sel.SetServers(primary.addr, replica.addr); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client, _ := NewFromSelector(sel, false)
+
+	if err := client.Set(&Item{Key: "all", Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if primary.item("all") == nil || replica.item("all") == nil {
+		t.Fatalf("expected the default write to reach every replica")
+	}
+
+	if err := client.Set(&Item{Key: "one", Value: []byte("v")}, WithConsistency(WritePrimaryOnly)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if primary.item("one") == nil || replica.item("one") != nil {
+		t.Fatalf("expected WritePrimaryOnly to write the primary only")
+	}
+
+	// Reads go to the primary unless any replica is allowed.
+	for i := 0; i < 10; i++ {
+		if _, err := client.Get("one"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	misses := 0
+	for i := 0; i < 50; i++ {
+		_, err := client.Get("one", WithConsistency(ReadAnyReplica))
+		if err == ErrCacheMiss {
+			misses++
+		} else if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if misses == 0 || misses == 50 {
+		t.Fatalf("expected ReadAnyReplica to read from both servers, got %d misses of 50", misses)
+	}
+
+	// A delete succeeds if any replica held the key.
+	if err := client.Delete("one"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Delete("one"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+}
+
+func TestReplicated(t *testing.T) {
+	a := newTestServer(t)
+	b := newTestServer(t)
+
+	sl := &ServerList{}
+	if err := sl.SetServers(a.addr, b.addr); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	sel := &Replicated{FailoverSelector: sl, Replicas: 3}
+	addrs, err := sel.SelectReplicas("k")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(addrs) != 2 || addrs[0].String() == addrs[1].String() {
+		t.Fatalf("expected both servers as replicas, got %v", addrs)
+	}
+	primary, replica := a, b
+	if addrs[0].String() != a.addr {
+		primary, replica = b, a
+	}
+	client, _ := NewFromSelector(sel, false)
+
+	// A miss on the primary falls back to the replica.
+	if err := client.Set(&Item{Key: "k", Value: []byte("v")}, WithServer(replica.addr)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	it, err := client.Get("k")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(it.Value) != "v" {
+		t.Fatalf("expected v, got %q", it.Value)
+	}
+	if _, err := client.Get("k", WithConsistency(ReadPrimary)); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss reading the primary only, got %v", err)
+	}
+
+	// Async writes reach the primary before returning and the replica
+	// eventually.
+	if err := client.Set(&Item{Key: "k", Value: []byte("w")}, WithConsistency(WriteAsync)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if it := primary.item("k"); it == nil || string(it.value) != "w" {
+		t.Fatalf("expected the primary to be written synchronously")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if it := replica.item("k"); it != nil && string(it.value) == "w" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the replica to be written asynchronously")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplicatedReadFallbackOnDownServer(t *testing.T) {
+	up := newTestServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+
+	sl := &ServerList{}
+	if err := sl.SetServers(up.addr, down); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	sel := &Replicated{FailoverSelector: sl, Replicas: 2}
+	client, _ := NewFromSelector(sel, false)
+
+	// Find a key whose primary is down.
+	var key string
+	for i := 0; key == ""; i++ {
+		addrs, err := sel.SelectReplicas("k" + strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if addrs[0].String() == down {
+			key = "k" + strconv.Itoa(i)
+		}
+	}
+	if err := client.Set(&Item{Key: key, Value: []byte("v")}, WithServer(up.addr)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get(key); err != nil {
+		t.Fatalf("expected the read to fall back to the replica, got %v", err)
+	}
+}
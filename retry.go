@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultRetryBackoff is the default delay before the first retry.
+	DefaultRetryBackoff = 10 * time.Millisecond
+
+	// DefaultMaxRetryBackoff is the default cap on the delay between
+	// retries.
+	DefaultMaxRetryBackoff = time.Second
+)
+
+// NodeFailurePolicy is the behavior of operations whose server cannot be
+// reached.
+type NodeFailurePolicy int
+
+const (
+	// NodeFailureFail returns the error, leaving retries to RetryPolicy.
+	NodeFailureFail NodeFailurePolicy = iota
+
+	// NodeFailureRehash immediately sends the operation to the next
+	// reachable server named by a FailoverSelector, so that reads of the
+	// keys of a dead server degrade to misses instead of errors. Operations
+	// pinned with WithServer, conditional writes and arithmetic never
+	// rehash.
+	NodeFailureRehash
+)
+
+// RetryPolicy retries idempotent operations (Get, GetMulti, Set, Delete and
+// Ping) that failed with a transient error, waiting an exponentially
+// growing, jittered delay between attempts. Retries stop early when the
+// operation's context is done.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry; it doubles with every
+	// further retry. If zero, DefaultRetryBackoff is used.
+	Backoff time.Duration
+
+	// MaxBackoff caps the delay between retries. If zero,
+	// DefaultMaxRetryBackoff is used.
+	MaxBackoff time.Duration
+
+	// Jitter randomizes each delay down by up to this fraction, in [0, 1],
+	// so that clients failing together do not retry in lockstep.
+	Jitter float64
+
+	// Retryable classifies errors worth retrying. If nil, network errors
+	// and ErrPoolExhausted are retried, while cache results such as
+	// ErrCacheMiss and errors caused by the request itself are not.
+	Retryable func(error) bool
+
+	// Failover retries operations whose server could not be reached on
+	// another server, if the selector implements FailoverSelector.
+	// Operations pinned with WithServer never fail over.
+	Failover bool
+}
+
+// retryable reports whether err is worth another attempt.
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, ErrPoolExhausted), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// backoff returns the delay before retry number n, counting from 1.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	limit := p.MaxBackoff
+	if limit <= 0 {
+		limit = DefaultMaxRetryBackoff
+	}
+	for i := 1; i < n && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * min(p.Jitter, 1) * float64(d))
+	}
+	return d
+}
+
+// isDialError reports whether err means the server could not be reached.
+func isDialError(err error) bool {
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+// isUnreachable reports whether err means the operation never got to talk
+// to its server: the dial failed or the server's circuit breaker is open.
+func isUnreachable(err error) bool {
+	return isDialError(err) || errors.Is(err, ErrCircuitOpen)
+}
+
+// rehash reports whether an operation that failed with err should move to
+// another server under NodeFailureRehash.
+func (c *Client) rehash(cl *call, err error) bool {
+	if c.NodeFailurePolicy != NodeFailureRehash || cl.server != nil || !isUnreachable(err) {
+		return false
+	}
+	_, ok := c.selector.(FailoverSelector)
+	return ok
+}
+
+// serverCount returns the number of servers of the selector.
+func (c *Client) serverCount() int {
+	n := 0
+	c.selector.Each(func(net.Addr) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+// withRetry runs attempt, retrying it according to the client RetryPolicy
+// and moving it to other servers under NodeFailureRehash. attempt receives
+// the number of the attempt, counting from 1, and the error of the previous
+// one.
+func (c *Client) withRetry(cl *call, attempt func(n int, prev error) error) error {
+	p := c.Retry
+	var err error
+	hops, tries := 0, 0
+	for n := 1; ; n++ {
+		err = attempt(n, err)
+		if err == nil {
+			return nil
+		}
+		// Rehashing to another server does not wait or count as a retry.
+		if c.rehash(cl, err) && hops < c.serverCount()-1 && cl.ctx.Err() == nil {
+			hops++
+			continue
+		}
+		tries++
+		if p == nil || tries >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(p.backoff(tries))
+		select {
+		case <-t.C:
+		case <-cl.ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
+
+// failover returns the server to use for key after attempt n-1 failed with
+// prev: another server if the previous one could not be reached and the
+// retry or node failure policy allows it, and addr otherwise.
+func (c *Client) failover(cl *call, key string, addr net.Addr, n int, prev error) net.Addr {
+	retry := c.Retry != nil && c.Retry.Failover && isDialError(prev)
+	if !retry && !c.rehash(cl, prev) || cl.server != nil {
+		return addr
+	}
+	fs, ok := c.selector.(FailoverSelector)
+	if !ok {
+		return addr
+	}
+	if next, err := fs.SelectFailover(key, n-1); err == nil {
+		return next
+	}
+	return addr
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientErrors(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	var dials int
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		if dials < 3 {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("connection refused")}
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dials != 3 {
+		t.Fatalf("expected 3 attempts, got %d", dials)
+	}
+
+	// Cache results are not retried.
+	if _, err := client.Get("missing"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+	if n := len(srv.commands()); n != 2 {
+		t.Fatalf("expected 2 commands, got %q", srv.commands())
+	}
+}
+
+func TestRetryFailover(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{srv.addr, down}, false)
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key%d", i)
+		if addr, _ := client.selector.Select(key); addr.String() == down {
+			break
+		}
+	}
+
+	if err := client.Set(&Item{Key: key, Value: []byte("v")}); err == nil {
+		t.Fatalf("expected an error without a retry policy")
+	}
+
+	client.Retry = &RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond, Failover: true}
+	if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if srv.item(key) == nil {
+		t.Fatalf("expected %s to fail over to %s", key, srv.addr)
+	}
+	if _, err := client.Get(key); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := client.Set(&Item{Key: key, Value: []byte("v")}, WithServer(down)); err == nil {
+		t.Fatalf("expected pinned operations not to fail over")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for n, want := range map[int]time.Duration{1: 10 * time.Millisecond, 3: 40 * time.Millisecond, 10: 50 * time.Millisecond} {
+		if got := p.backoff(n); got != want {
+			t.Fatalf("expected backoff %v for retry %d, got %v", want, n, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(1); d < 5*time.Millisecond || d > 10*time.Millisecond {
+			t.Fatalf("expected a jittered backoff within [5ms, 10ms], got %v", d)
+		}
+	}
+}
+
+func TestNodeFailureRehash(t *testing.T) {
+	srv := newTestServer(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+
+	client, _ := NewClient([]string{srv.addr, down}, false)
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key%d", i)
+		if addr, _ := client.selector.Select(key); addr.String() == down {
+			break
+		}
+	}
+
+	if _, err := client.Get(key); err == nil || err == ErrCacheMiss {
+		t.Fatalf("expected a dial error, got %v", err)
+	}
+
+	client.NodeFailurePolicy = NodeFailureRehash
+	if _, err := client.Get(key); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+	if err := client.Set(&Item{Key: key, Value: []byte("v")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if srv.item(key) == nil {
+		t.Fatalf("expected %q to be rehashed to the reachable server", key)
+	}
+	items, err := client.GetMulti([]string{key, "other"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if items[key] == nil {
+		t.Fatalf("expected %q to be fetched from the reachable server", key)
+	}
+
+	// Conditional writes must stay on the key's own server.
+	lock := key + "-lock"
+	for i := 0; ; i++ {
+		if addr, _ := client.selector.Select(lock); addr.String() == down {
+			break
+		}
+		lock = fmt.Sprintf("%s-lock%d", key, i)
+	}
+	if _, err := client.TryLock(lock, 10); err == nil {
+		t.Fatalf("expected a dial error")
+	}
+	if srv.item(lock) != nil {
+		t.Fatalf("expected %q not to be rehashed", lock)
+	}
+
+	// Pinned operations are not rehashed.
+	if err := client.Ping("", WithServer(down)); err == nil {
+		t.Fatalf("expected a dial error")
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultVirtualNodes is the default number of points per server on a
+// HashRing.
+const DefaultVirtualNodes = 160
+
+// HashRing is a ServerSelector using consistent hashing: every server owns
+// VirtualNodes points on a ring of 32-bit hashes, and a key goes to the
+// owner of the first point at or after the hash of the key. Adding or
+// removing a server only moves the keys of the points involved, about 1/n
+// of all keys, where a ServerList remaps most of them. It implements
+// FailoverSelector and EjectingSelector and is safe for concurrent use.
+type HashRing struct {
+	// Hasher hashes keys onto the ring. If nil, CRC32Hasher is used. The
+	// points of the servers are placed with MD5 regardless. It must be
+	// set before the ring is first used.
+	Hasher Hasher
+
+	// VirtualNodes is the number of points per server. More points spread
+	// keys more evenly, at the cost of a larger ring to build and search.
+	// If zero, DefaultVirtualNodes is used. Changes take effect at the
+	// next SetServers.
+	VirtualNodes int
+
+	// Compat, if not RingNative, builds the ring and hashes keys like
+	// another client library, so that a Go service can share a cluster
+	// with it without keys mapping to different servers. VirtualNodes and
+	// Hasher are then ignored. Changes take effect at the next SetServers.
+	Compat RingCompat
+
+	// OnChange, if not nil, is called after SetServers changes the
+	// servers, with the servers added and removed. It must be set before
+	// the ring is first used.
+	OnChange func(added, removed []net.Addr)
+
+	notifier
+
+	mu      sync.RWMutex
+	addrs   []net.Addr
+	points  []ringPoint // sorted by hash
+	compat  RingCompat  // Compat the points were placed with
+	zones   map[string]string
+	ejected ejections
+}
+
+// ringPoint is a point on the ring owned by the server addrs[server].
+type ringPoint struct {
+	hash   uint32
+	server int
+}
+
+// SetServers sets the servers on the ring, parsing and resolving them as
+// ServerList.SetServers does, and rebuilds the ring.
+func (r *HashRing) SetServers(servers ...string) error {
+	ws, err := parseWeightedServers(servers)
+	if err != nil {
+		return err
+	}
+	return r.SetServersWithWeights(ws...)
+}
+
+// SetServersWithWeights is like SetServers, but takes the weights of the
+// servers separately. A server of weight N owns N times VirtualNodes
+// points.
+func (r *HashRing) SetServersWithWeights(servers ...WeightedServer) error {
+	naddr, weights, zones, err := resolveWeightedServers(servers)
+	if err != nil {
+		return err
+	}
+
+	vnodes := r.VirtualNodes
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+	var points []ringPoint
+	if r.Compat != RingNative {
+		points = ketamaPoints(r.Compat, servers, naddr)
+	} else {
+		// CRC-32 spreads the similar names of the points of a server
+		// poorly, so they are placed with MD5, as ketama does.
+		for i, addr := range naddr {
+			for v := 0; v < vnodes*weights[i]; v++ {
+				points = append(points, ringPoint{hash: md5Hash(addr.String() + "-" + strconv.Itoa(v)), server: i})
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	r.mu.Lock()
+	prev := r.addrs
+	r.addrs = naddr
+	r.points = points
+	r.zones = zones
+	r.compat = r.Compat
+	r.ejected.prune(naddr)
+	r.mu.Unlock()
+
+	r.notify(r.OnChange, prev, naddr)
+	return nil
+}
+
+// hashKey places key on the ring. r.mu must be held.
+func (r *HashRing) hashKey(key string) uint32 {
+	if r.compat != RingNative {
+		return md5Hash(key)
+	}
+	return hashKey(r.Hasher, key)
+}
+
+// Zone returns the zone of the server at addr, or "" if it has none.
+func (r *HashRing) Zone(addr net.Addr) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.zones[addr.String()]
+}
+
+// Each iterates over each server calling the given function.
+func (r *HashRing) Each(f func(net.Addr) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.addrs {
+		if err := f(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Select returns the server owning key, skipping ejected servers.
+func (r *HashRing) Select(key string) (net.Addr, error) {
+	return r.SelectFailover(key, 0)
+}
+
+// SelectFailover returns the server attempt distinct servers after the one
+// Select picks for key, walking the ring clockwise and skipping ejected
+// servers.
+func (r *HashRing) SelectFailover(key string, attempt int) (net.Addr, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	healthy := 0
+	for _, addr := range r.addrs {
+		if !r.ejected.has(addr) {
+			healthy++
+		}
+	}
+	if healthy == 0 {
+		return nil, ErrNoServers
+	}
+	if len(r.addrs) == 1 {
+		return r.addrs[0], nil
+	}
+	attempt %= healthy
+
+	h := r.hashKey(key)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	var seen []bool
+	if attempt > 0 {
+		seen = make([]bool, len(r.addrs))
+	}
+	for n := 0; n < len(r.points); n++ {
+		p := r.points[(start+n)%len(r.points)]
+		addr := r.addrs[p.server]
+		if r.ejected.has(addr) || seen != nil && seen[p.server] {
+			continue
+		}
+		if attempt == 0 {
+			return addr, nil
+		}
+		seen[p.server] = true
+		attempt--
+	}
+	return nil, ErrNoServers
+}
+
+// Eject stops selecting the server at addr. Its keys move to the owners of
+// the following points on the ring, while the keys of other servers stay
+// put. Ejections nest like those of ServerList.
+func (r *HashRing) Eject(addr net.Addr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ejected.add(addr)
+}
+
+// Restore undoes one Eject of the server at addr.
+func (r *HashRing) Restore(addr net.Addr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ejected.remove(addr)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"crypto/md5"
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+var ringServers = []string{"10.0.0.1:11211", "10.0.0.2:11211", "10.0.0.3:11211", "10.0.0.4:11211"}
+
+func TestHashRingVirtualNodes(t *testing.T) {
+	r := &HashRing{VirtualNodes: 500}
+	if err := r.SetServers(ringServers...); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(r.points) != 500*len(ringServers) {
+		t.Fatalf("expected %d points, got %d", 500*len(ringServers), len(r.points))
+	}
+
+	const keys = 40000
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		addr, err := r.Select("key" + strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		counts[addr.String()]++
+	}
+	for _, s := range ringServers {
+		if n := counts[s]; n < keys/4*8/10 || n > keys/4*12/10 {
+			t.Fatalf("expected about %d keys on %s, got %d", keys/4, s, n)
+		}
+	}
+}
+
+func TestHashRingMinimalDisruption(t *testing.T) {
+	before, after := new(HashRing), new(HashRing)
+	before.SetServers(ringServers...)
+	after.SetServers(append(ringServers, "10.0.0.5:11211")...)
+
+	const keys = 10000
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := "key" + strconv.Itoa(i)
+		a, _ := before.Select(key)
+		b, _ := after.Select(key)
+		if a.String() != b.String() {
+			if b.String() != "10.0.0.5:11211" {
+				t.Fatalf("expected %s to stay on %s or move to the new server, got %s", key, a, b)
+			}
+			moved++
+		}
+	}
+	if moved > keys*3/10 {
+		t.Fatalf("expected about a fifth of the keys to move, got %d of %d", moved, keys)
+	}
+}
+
+func TestHashRingFailoverAndEject(t *testing.T) {
+	r := new(HashRing)
+	r.SetServers(ringServers...)
+
+	seen := make(map[string]bool)
+	for attempt := 0; attempt < len(ringServers); attempt++ {
+		addr, err := r.SelectFailover("foo", attempt)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		seen[addr.String()] = true
+	}
+	if len(seen) != len(ringServers) {
+		t.Fatalf("expected failover to visit every server, got %v", seen)
+	}
+
+	primary, _ := r.Select("foo")
+	next, _ := r.SelectFailover("foo", 1)
+	r.Eject(primary)
+	if addr, _ := r.Select("foo"); addr.String() != next.String() {
+		t.Fatalf("expected foo to move to %s, got %s", next, addr)
+	}
+	r.Restore(primary)
+	if addr, _ := r.Select("foo"); addr.String() != primary.String() {
+		t.Fatalf("expected foo back on %s, got %s", primary, addr)
+	}
+
+	for _, s := range ringServers {
+		r.Eject(parseAddr(t, s))
+	}
+	if _, err := r.Select("foo"); !errors.Is(err, ErrNoServers) {
+		t.Fatalf("expected ErrNoServers, got %v", err)
+	}
+}
+
+func TestHashRingCompat(t *testing.T) {
+	for _, tt := range []struct {
+		compat       RingCompat
+		server, addr string
+		want         string
+	}{
+		{RingLibmemcached, "10.0.0.1:11211", "10.0.0.1:11211", "10.0.0.1"},
+		{RingLibmemcached, "10.0.0.1:11212", "10.0.0.1:11212", "10.0.0.1:11212"},
+		{RingLibmemcached, "cache1:11211", "10.0.0.1:11211", "cache1"},
+		{RingSpymemcached, "10.0.0.1:11211", "10.0.0.1:11211", "10.0.0.1:11211"},
+		{RingSpymemcached, "cache1:11211", "10.0.0.1:11211", "cache1/10.0.0.1:11211"},
+	} {
+		addr := &staticAddr{ntw: "tcp", str: tt.addr}
+		if got := ketamaName(tt.compat, tt.server, addr); got != tt.want {
+			t.Errorf("%d: expected %s to be named %q, got %q", tt.compat, tt.server, tt.want, got)
+		}
+	}
+
+	// libmemcached gives servers points in proportion to their weights,
+	// four per MD5 digest of their name.
+	r := &HashRing{Compat: RingLibmemcached}
+	if err := r.SetServersWithWeights(WeightedServer{Addr: "10.0.0.1:11211", Weight: 1}, WeightedServer{Addr: "10.0.0.2:11211", Weight: 3}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	counts := make(map[int]int)
+	for _, p := range r.points {
+		counts[p.server]++
+	}
+	if counts[0] != 80 || counts[1] != 240 {
+		t.Fatalf("expected 80 and 240 points, got %v", counts)
+	}
+	sum := md5.Sum([]byte("10.0.0.1-0"))
+	for h := 0; h < 4; h++ {
+		want := uint32(sum[h*4]) | uint32(sum[h*4+1])<<8 | uint32(sum[h*4+2])<<16 | uint32(sum[h*4+3])<<24
+		i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= want })
+		if i == len(r.points) || r.points[i].hash != want || r.points[i].server != 0 {
+			t.Fatalf("expected a point of 10.0.0.1 at %#x", want)
+		}
+	}
+
+	// Keys are hashed with MD5 whatever the Hasher.
+	r.Hasher = CRC32Hasher()
+	key := "foo"
+	h := md5Hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h }) % len(r.points)
+	if addr, _ := r.Select(key); addr.String() != r.addrs[r.points[i].server].String() {
+		t.Fatalf("expected %s on %s, got %s", key, r.addrs[r.points[i].server], addr)
+	}
+}
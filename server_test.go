@@ -0,0 +1,639 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testItem is an item stored by testServer.
+type testItem struct {
+	value []byte
+	flags uint32
+	exp   int32
+	cas   uint64
+}
+
+// testServer is an in-memory server speaking enough of the memcached text
+// protocol, over TCP and UDP on the same port, to exercise the client.
+type testServer struct {
+	t    *testing.T
+	addr string
+
+	mu    sync.Mutex
+	items map[string]*testItem
+	cas   uint64
+	cmds  []string
+	conns int // TCP connections accepted
+
+	// requireAuth, if set, is the "username password" token connections
+	// must authenticate with before issuing commands.
+	requireAuth string
+
+	// itemSizeMax, if set, is the largest value text stores accept.
+	itemSizeMax int
+}
+
+// testConnState is the per-connection state of testServer.
+type testConnState struct {
+	authed bool
+
+	// Like memcached, the first byte of a connection decides whether all
+	// of its requests are binary.
+	sniffed, binary bool
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	s := &testServer{t: t, items: make(map[string]*testItem)}
+
+	var ln net.Listener
+	var pc net.PacketConn
+	for i := 0; ; i++ {
+		var err error
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		pc, err = net.ListenPacket("udp", ln.Addr().String())
+		if err == nil {
+			break
+		}
+		ln.Close()
+		if i == 10 {
+			t.Fatalf("failed to listen on UDP: %v", err)
+		}
+	}
+	s.addr = ln.Addr().String()
+	t.Cleanup(func() {
+		ln.Close()
+		pc.Close()
+	})
+
+	go s.serveTCP(ln)
+	go s.serveUDP(pc)
+	return s
+}
+
+func (s *testServer) serveTCP(ln net.Listener) {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.mu.Unlock()
+		go func() {
+			defer nc.Close()
+			r := bufio.NewReader(nc)
+			s.mu.Lock()
+			st := &testConnState{authed: s.requireAuth == ""}
+			s.mu.Unlock()
+			for {
+				resp, ok := s.handle(r, st)
+				if !ok {
+					return
+				}
+				if _, err := nc.Write(resp); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *testServer) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, udpMaxDatagram)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		f, err := parseUDPFrame(buf[:n])
+		if err != nil {
+			continue
+		}
+		var resp []byte
+		r := bufio.NewReader(bytes.NewReader(buf[udpHeaderLen:n]))
+		for {
+			out, ok := s.handle(r, &testConnState{authed: true})
+			if !ok {
+				break
+			}
+			resp = append(resp, out...)
+		}
+
+		const maxPayload = 1400
+		total := (len(resp) + maxPayload - 1) / maxPayload
+		for seq := 0; seq < total; seq++ {
+			part := resp[seq*maxPayload : min((seq+1)*maxPayload, len(resp))]
+			dgram := make([]byte, udpHeaderLen+len(part))
+			udpFrame{requestID: f.requestID, seq: uint16(seq), total: uint16(total)}.marshal(dgram)
+			copy(dgram[udpHeaderLen:], part)
+			pc.WriteTo(dgram, addr)
+		}
+	}
+}
+
+// commands returns the command lines received so far.
+func (s *testServer) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.cmds...)
+}
+
+// setAuth requires new connections to authenticate with the given
+// "username password" token.
+func (s *testServer) setAuth(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requireAuth = token
+}
+
+// accepted returns the number of TCP connections accepted so far.
+func (s *testServer) accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// item returns the stored item for key, or nil.
+func (s *testServer) item(key string) *testItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.items[key]
+}
+
+// handle reads one command from r and returns the response to send. It
+// reports false when the connection should be closed.
+func (s *testServer) handle(r *bufio.Reader, st *testConnState) ([]byte, bool) {
+	if !st.sniffed {
+		b, err := r.Peek(1)
+		if err != nil {
+			return nil, false
+		}
+		st.sniffed, st.binary = true, b[0] == magicRequest
+	}
+	if st.binary {
+		return s.handleBinary(r, st)
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, false
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return []byte("ERROR\r\n"), true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmds = append(s.cmds, line)
+
+	noreply := f[len(f)-1] == "noreply"
+	if noreply {
+		f = f[:len(f)-1]
+	}
+	reply := func(resp string) ([]byte, bool) {
+		// Like memcached, errors are answered even to noreply requests.
+		if noreply && !strings.Contains(resp, "ERROR") {
+			return nil, true
+		}
+		return []byte(resp), true
+	}
+
+	if !st.authed {
+		if f[0] != "set" || len(f) < 5 {
+			return []byte("CLIENT_ERROR unauthenticated\r\n"), true
+		}
+		size, _ := strconv.Atoi(f[4])
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, false
+		}
+		if string(data[:size]) != s.requireAuth {
+			return []byte("CLIENT_ERROR authentication failure\r\n"), true
+		}
+		st.authed = true
+		return []byte("STORED\r\n"), true
+	}
+
+	switch f[0] {
+	case "get", "gets":
+		var b bytes.Buffer
+		for _, key := range f[1:] {
+			it, ok := s.items[key]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(&b, "VALUE %s %d %d", key, it.flags, len(it.value))
+			if f[0] == "gets" {
+				fmt.Fprintf(&b, " %d", it.cas)
+			}
+			fmt.Fprintf(&b, "\r\n%s\r\n", it.value)
+		}
+		b.WriteString("END\r\n")
+		return b.Bytes(), true
+
+	case "set", "add", "replace", "append", "prepend", "cas":
+		if len(f) < 5 {
+			return []byte("ERROR\r\n"), true
+		}
+		flags, _ := strconv.ParseUint(f[2], 10, 32)
+		exp, _ := strconv.ParseInt(f[3], 10, 32)
+		size, err := strconv.Atoi(f[4])
+		if err != nil {
+			return []byte("CLIENT_ERROR bad command line format\r\n"), true
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, false
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			return reply("CLIENT_ERROR bad data chunk\r\n")
+		}
+		data = data[:size]
+		if s.itemSizeMax > 0 && size > s.itemSizeMax {
+			return reply("SERVER_ERROR object too large for cache\r\n")
+		}
+
+		old, exists := s.items[f[1]]
+		switch {
+		case f[0] == "add" && exists:
+			return reply("NOT_STORED\r\n")
+		case (f[0] == "replace" || f[0] == "append" || f[0] == "prepend") && !exists:
+			return reply("NOT_STORED\r\n")
+		case f[0] == "cas" && !exists:
+			return reply("NOT_FOUND\r\n")
+		case f[0] == "cas" && len(f) > 5 && f[5] != strconv.FormatUint(old.cas, 10):
+			return reply("EXISTS\r\n")
+		case f[0] == "append":
+			data = append(append([]byte{}, old.value...), data...)
+			flags, exp = uint64(old.flags), int64(old.exp)
+		case f[0] == "prepend":
+			data = append(data, old.value...)
+			flags, exp = uint64(old.flags), int64(old.exp)
+		}
+		s.cas++
+		s.items[f[1]] = &testItem{value: data, flags: uint32(flags), exp: int32(exp), cas: s.cas}
+		if exp < 0 {
+			// Negative expiration times expire the item immediately.
+			delete(s.items, f[1])
+		}
+		return reply("STORED\r\n")
+
+	case "delete":
+		if _, ok := s.items[f[1]]; !ok {
+			return reply("NOT_FOUND\r\n")
+		}
+		delete(s.items, f[1])
+		return reply("DELETED\r\n")
+
+	case "incr", "decr":
+		delta, _ := strconv.ParseUint(f[2], 10, 64)
+		n, err := s.arithmetic(f[1], f[0] == "decr", delta)
+		if err != nil {
+			return reply(err.Error())
+		}
+		return reply(n + "\r\n")
+
+	case "ma":
+		var delta uint64 = 1
+		decr := false
+		for _, tok := range f[2:] {
+			switch tok[0] {
+			case 'D':
+				delta, _ = strconv.ParseUint(tok[1:], 10, 64)
+			case 'M':
+				decr = tok[1:] == "D"
+			}
+		}
+		n, err := s.arithmetic(f[1], decr, delta)
+		if err == errTestNotFound {
+			return []byte("NF\r\n"), true
+		}
+		if err != nil {
+			return []byte(err.Error()), true
+		}
+		return []byte(fmt.Sprintf("VA %d\r\n%s\r\n", len(n), n)), true
+
+	case "mg":
+		it, ok := s.items[f[1]]
+		if !ok {
+			if hasMetaFlag(f, "q") {
+				return nil, true
+			}
+			return []byte("EN\r\n"), true
+		}
+		return []byte(fmt.Sprintf("VA %d f%d k%s c%d\r\n%s\r\n", len(it.value), it.flags, f[1], it.cas, it.value)), true
+
+	case "ms":
+		size, _ := strconv.Atoi(f[2])
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, false
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			return []byte("CLIENT_ERROR bad data chunk\r\n"), true
+		}
+		it := &testItem{value: data[:size]}
+		mode := "S"
+		cas := ""
+		for _, tok := range f[3:] {
+			switch tok[0] {
+			case 'C':
+				cas = tok[1:]
+			case 'F':
+				flags, _ := strconv.ParseUint(tok[1:], 10, 32)
+				it.flags = uint32(flags)
+			case 'T':
+				exp, _ := strconv.ParseInt(tok[1:], 10, 32)
+				it.exp = int32(exp)
+			case 'M':
+				mode = tok[1:]
+			}
+		}
+		if _, exists := s.items[f[1]]; mode == "E" && exists {
+			return []byte("NS\r\n"), true
+		}
+		if cas != "" {
+			old, ok := s.items[f[1]]
+			if !ok {
+				return []byte("NF\r\n"), true
+			}
+			if cas != strconv.FormatUint(old.cas, 10) {
+				return []byte("EX\r\n"), true
+			}
+		}
+		s.cas++
+		it.cas = s.cas
+		s.items[f[1]] = it
+		return []byte("HD\r\n"), true
+
+	case "md":
+		it, ok := s.items[f[1]]
+		if !ok {
+			return []byte("NF\r\n"), true
+		}
+		for _, tok := range f[2:] {
+			if tok[0] == 'C' && tok[1:] != strconv.FormatUint(it.cas, 10) {
+				return []byte("EX\r\n"), true
+			}
+		}
+		delete(s.items, f[1])
+		return []byte("HD\r\n"), true
+
+	case "mn":
+		return []byte("MN\r\n"), true
+
+	case "version":
+		return []byte("VERSION 1.6.21\r\n"), true
+
+	case "flush_all":
+		s.items = make(map[string]*testItem)
+		return reply("OK\r\n")
+
+	case "stats":
+		switch {
+		case len(f) > 1 && f[1] == "items":
+			return []byte("STAT items:1:number 3\r\nSTAT items:1:age 120\r\nSTAT items:1:evicted 7\r\n" +
+				"STAT items:5:number 1\r\nSTAT items:5:outofmemory 2\r\nEND\r\n"), true
+		case len(f) > 1 && f[1] == "slabs":
+			return []byte("STAT 1:chunk_size 96\r\nSTAT 1:chunks_per_page 10922\r\nSTAT 1:total_pages 1\r\n" +
+				"STAT 1:used_chunks 3\r\nSTAT 1:get_hits 12\r\nSTAT active_slabs 1\r\nSTAT total_malloced 1048576\r\nEND\r\n"), true
+		case len(f) > 1 && f[1] == "settings":
+			return []byte("STAT maxbytes 67108864\r\nSTAT item_size_max 1048576\r\nSTAT evictions on\r\nEND\r\n"), true
+		}
+		var used uint64
+		for key, it := range s.items {
+			used += uint64(testItemSize(key, it))
+		}
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "STAT pid 1\r\nSTAT curr_items %d\r\nSTAT bytes %d\r\n", len(s.items), used)
+		fmt.Fprintf(&b, "STAT limit_maxbytes %d\r\nSTAT evictions 0\r\nEND\r\n", 64<<20)
+		return b.Bytes(), true
+
+	case "watch":
+		for _, class := range f[1:] {
+			if class != "fetchers" && class != "mutations" && class != "evictions" {
+				return reply("CLIENT_ERROR watch: unknown logger class\r\n")
+			}
+		}
+		return []byte("OK\r\n" +
+			"ts=1700000000.250000 gid=1 type=item_get key=foo status=found clsid=1 cfd=20\r\n" +
+			"garbage\r\n" +
+			"ts=1700000001.000000 gid=2 type=item_store key=a%20b status=stored cmd=set ttl=60 clsid=2 cfd=20\r\n"), true
+
+	case "lru_crawler":
+		if len(f) < 3 || f[1] != "metadump" {
+			break
+		}
+		var b bytes.Buffer
+		for key, it := range s.items {
+			fmt.Fprintf(&b, "key=%s exp=%d la=0 cas=%d fetch=no cls=1 size=%d\r\n",
+				url.QueryEscape(key), it.exp, it.cas, testItemSize(key, it))
+		}
+		b.WriteString("END\r\n")
+		return b.Bytes(), true
+	}
+
+	return []byte("ERROR\r\n"), true
+}
+
+// testItemSize approximates the memory used by an item, as reported by the
+// "bytes" statistic.
+func testItemSize(key string, it *testItem) int {
+	return 48 + len(key) + len(it.value)
+}
+
+// hasMetaFlag reports whether the meta command f carries the given flag.
+func hasMetaFlag(f []string, flag string) bool {
+	for _, tok := range f[2:] {
+		if tok == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// handleBinary answers binary protocol requests until a non-quiet response
+// has to be sent.
+var errTestNotFound = errors.New("NOT_FOUND\r\n")
+
+// arithmetic applies an incr or decr to the decimal value of key, as
+// memcached does: decrements stop at zero. s.mu must be held.
+func (s *testServer) arithmetic(key string, decr bool, delta uint64) (string, error) {
+	it, ok := s.items[key]
+	if !ok {
+		return "", errTestNotFound
+	}
+	n, err := strconv.ParseUint(string(it.value), 10, 64)
+	if err != nil {
+		return "", errors.New("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+	}
+	switch {
+	case !decr:
+		n += delta
+	case delta > n:
+		n = 0
+	default:
+		n -= delta
+	}
+	it.value = []byte(strconv.FormatUint(n, 10))
+	s.cas++
+	it.cas = s.cas
+	return string(it.value), nil
+}
+
+func (s *testServer) handleBinary(r *bufio.Reader, st *testConnState) ([]byte, bool) {
+	var out []byte
+	for {
+		var hdr [binaryHeaderLen]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, false
+		}
+		opcode := hdr[1]
+		keyLen := int(binary.BigEndian.Uint16(hdr[2:4]))
+		extrasLen := int(hdr[4])
+		body := make([]byte, binary.BigEndian.Uint32(hdr[8:12]))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, false
+		}
+		extras := body[:extrasLen]
+		key := string(body[extrasLen : extrasLen+keyLen])
+		value := body[extrasLen+keyLen:]
+		reqCAS := binary.BigEndian.Uint64(hdr[16:24])
+		var resCAS uint64
+
+		s.mu.Lock()
+		s.cmds = append(s.cmds, fmt.Sprintf("binary %#x %s", opcode, key))
+		status, resExtras, resKey, resValue := statusOK, []byte(nil), "", []byte(nil)
+		switch {
+		case opcode == opSASLAuth:
+			parts := strings.Split(string(value), "\x00")
+			if len(parts) != 3 || parts[1]+" "+parts[2] != s.requireAuth {
+				status = 0x20
+				break
+			}
+			st.authed = true
+		case !st.authed:
+			status = 0x20
+		}
+		switch opcode {
+		case opGetKQ:
+			it, ok := s.items[key]
+			if status != statusOK {
+				break
+			}
+			if !ok {
+				s.mu.Unlock()
+				continue
+			}
+			resExtras = binary.BigEndian.AppendUint32(nil, it.flags)
+			resKey, resValue, resCAS = key, it.value, it.cas
+		case opSet, opAdd, opReplace:
+			if status != statusOK {
+				break
+			}
+			// Like memcached, a failed add reports the key existing and a
+			// failed replace or cas reports it missing.
+			it, exists := s.items[key]
+			switch {
+			case opcode == opAdd && exists:
+				status = statusExists
+			case (opcode == opReplace || reqCAS != 0) && !exists:
+				status = statusNotFound
+			case reqCAS != 0 && it.cas != reqCAS:
+				status = statusExists
+			}
+			if status != statusOK {
+				break
+			}
+			s.cas++
+			resCAS = s.cas
+			s.items[key] = &testItem{
+				value: value,
+				flags: binary.BigEndian.Uint32(extras[0:4]),
+				exp:   int32(binary.BigEndian.Uint32(extras[4:8])),
+				cas:   s.cas,
+			}
+		case opDelete:
+			if status != statusOK {
+				break
+			}
+			it, ok := s.items[key]
+			switch {
+			case !ok:
+				status = statusNotFound
+			case reqCAS != 0 && it.cas != reqCAS:
+				status = statusExists
+			default:
+				delete(s.items, key)
+			}
+		case opIncr, opDecr:
+			if status != statusOK {
+				break
+			}
+			v, err := s.arithmetic(key, opcode == opDecr, binary.BigEndian.Uint64(extras[0:8]))
+			if err != nil {
+				status = statusNotFound
+				if err != errTestNotFound {
+					status = 0x06 // non-numeric value
+				}
+				break
+			}
+			n, _ := strconv.ParseUint(v, 10, 64)
+			resValue = binary.BigEndian.AppendUint64(nil, n)
+			resCAS = s.items[key].cas
+		case opVersion:
+			resValue = []byte("1.6.21")
+		}
+		s.mu.Unlock()
+
+		var res [binaryHeaderLen]byte
+		res[0] = magicResponse
+		res[1] = opcode
+		binary.BigEndian.PutUint16(res[2:4], uint16(len(resKey)))
+		res[4] = uint8(len(resExtras))
+		binary.BigEndian.PutUint16(res[6:8], status)
+		binary.BigEndian.PutUint32(res[8:12], uint32(len(resExtras)+len(resKey)+len(resValue)))
+		binary.BigEndian.PutUint64(res[16:24], resCAS)
+		out = append(out, res[:]...)
+		out = append(out, resExtras...)
+		out = append(out, resKey...)
+		out = append(out, resValue...)
+		if opcode != opGetKQ {
+			return out, true
+		}
+	}
+}
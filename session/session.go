@@ -0,0 +1,278 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package session stores HTTP sessions in Memcached, so that every
+// instance of a web service shares them. A Store has the Get, New and Save
+// methods of the gorilla/sessions Store interface, taking the request and
+// response in the same order, so it can stand in for one with a thin
+// wrapper, without this package depending on gorilla.
+//
+// Session IDs are 256-bit random values. They are only accepted in the
+// form they are issued in, and the cache holds a hash of them rather than
+// the IDs themselves, so keys listed from the servers cannot be replayed
+// as cookies.
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nihankhan/gomcache"
+)
+
+const (
+	// DefaultMaxAge is the default lifetime of an idle session in seconds.
+	DefaultMaxAge = 24 * 60 * 60
+
+	// DefaultCookieName is the default name of the session cookie.
+	DefaultCookieName = "session"
+
+	// DefaultKeyPrefix is the default prefix of the cache keys of sessions.
+	DefaultKeyPrefix = "session:"
+)
+
+// idLen is the length of the encoded session IDs.
+var idLen = base64.RawURLEncoding.EncodedLen(32)
+
+// Session is the data of one visitor.
+type Session struct {
+	// ID identifies the session. It is empty until the session is saved.
+	ID string
+
+	// Values are the data of the session. They are encoded with the Codec
+	// of the Store, so with the default JSON codec, numbers read back as
+	// float64.
+	Values map[string]any
+
+	// IsNew reports whether the session was created by this request.
+	IsNew bool
+
+	refreshed time.Time
+}
+
+// record is the value stored for a session.
+type record struct {
+	Values    map[string]any `json:"values"`
+	Refreshed int64          `json:"refreshed"` // Unix time of the last write
+}
+
+// Store keeps sessions in a Memcached cluster. Its fields must be set
+// before it is first used; it is then safe for concurrent use.
+type Store struct {
+	// Client is the client of the cluster holding the sessions.
+	Client *gomcache.Client
+
+	// Codec encodes the sessions. If nil, gomcache.JSONCodec is used.
+	Codec gomcache.Codec
+
+	// MaxAge is the lifetime of an idle session in seconds. Reading a
+	// session extends it once a quarter of MaxAge has passed since it was
+	// last written, so active sessions do not expire. If zero,
+	// DefaultMaxAge is used.
+	MaxAge int32
+
+	// KeyPrefix is prepended to the cache keys of sessions. If empty,
+	// DefaultKeyPrefix is used.
+	KeyPrefix string
+
+	// Cookie is the template of the session cookie. Its Value, MaxAge and
+	// Expires are ignored. If its Name is empty, DefaultCookieName is used.
+	Cookie http.Cookie
+}
+
+// NewStore returns a Store keeping sessions with client, using a cookie
+// that is only sent over HTTPS and hidden from scripts.
+func NewStore(client *gomcache.Client) *Store {
+	return &Store{
+		Client: client,
+		Cookie: http.Cookie{
+			Name:     DefaultCookieName,
+			Path:     "/",
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+	}
+}
+
+// Get returns the session of r, or a new session if r has none or its
+// session expired. Errors reading the cache are returned with a new
+// session, and errors extending the session with the session read, so
+// handlers can carry on regardless.
+func (s *Store) Get(r *http.Request) (*Session, error) {
+	c, err := r.Cookie(s.cookieName())
+	if err != nil || !validID(c.Value) {
+		return s.New(r)
+	}
+	it, err := s.Client.GetContext(r.Context(), s.key(c.Value))
+	if errors.Is(err, gomcache.ErrCacheMiss) {
+		return s.New(r)
+	}
+	if err != nil {
+		sess, _ := s.New(r)
+		return sess, err
+	}
+	var rec record
+	if err := s.codec().Unmarshal(it.Value, it.Flags, &rec); err != nil {
+		sess, _ := s.New(r)
+		return sess, err
+	}
+	if rec.Values == nil {
+		rec.Values = make(map[string]any)
+	}
+	sess := &Session{ID: c.Value, Values: rec.Values, refreshed: time.Unix(rec.Refreshed, 0)}
+
+	if time.Since(sess.refreshed) > time.Duration(s.maxAge())*time.Second/4 {
+		err = s.write(r, sess)
+	}
+	return sess, err
+}
+
+// New returns a new, empty session. It is stored, and given an ID, by
+// Save.
+func (s *Store) New(r *http.Request) (*Session, error) {
+	return &Session{Values: make(map[string]any), IsNew: true}, nil
+}
+
+// Save stores sess and sets the session cookie on w.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, sess *Session) error {
+	if sess.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		sess.ID = id
+	}
+	if err := s.write(r, sess); err != nil {
+		return err
+	}
+	c := s.Cookie
+	c.Name = s.cookieName()
+	c.Value = sess.ID
+	c.MaxAge = int(s.maxAge())
+	http.SetCookie(w, &c)
+	return nil
+}
+
+// Regenerate moves sess to a new ID and saves it, deleting the old one.
+// Call it when the privileges of a session change, such as at login, so
+// that an ID planted in the browser before cannot be used to take over
+// the session.
+func (s *Store) Regenerate(r *http.Request, w http.ResponseWriter, sess *Session) error {
+	if sess.ID != "" {
+		if err := s.deleteID(r, sess.ID); err != nil {
+			return err
+		}
+	}
+	sess.ID = ""
+	return s.Save(r, w, sess)
+}
+
+// Destroy deletes sess and expires the session cookie on w.
+func (s *Store) Destroy(r *http.Request, w http.ResponseWriter, sess *Session) error {
+	if sess.ID != "" {
+		if err := s.deleteID(r, sess.ID); err != nil {
+			return err
+		}
+	}
+	c := s.Cookie
+	c.Name = s.cookieName()
+	c.Value = ""
+	c.MaxAge = -1
+	http.SetCookie(w, &c)
+	sess.ID = ""
+	sess.Values = make(map[string]any)
+	return nil
+}
+
+// write stores sess for MaxAge seconds.
+func (s *Store) write(r *http.Request, sess *Session) error {
+	sess.refreshed = time.Now()
+	value, flags, err := s.codec().Marshal(record{Values: sess.Values, Refreshed: sess.refreshed.Unix()})
+	if err != nil {
+		return err
+	}
+	return s.Client.SetContext(r.Context(), &gomcache.Item{
+		Key:        s.key(sess.ID),
+		Value:      value,
+		Flags:      flags,
+		Expiration: s.maxAge(),
+	})
+}
+
+// deleteID deletes the session with the given ID, which may already be
+// gone.
+func (s *Store) deleteID(r *http.Request, id string) error {
+	err := s.Client.DeleteContext(r.Context(), s.key(id))
+	if errors.Is(err, gomcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
+
+// key returns the cache key of the session with the given ID.
+func (s *Store) key(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	prefix := s.KeyPrefix
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+func (s *Store) codec() gomcache.Codec {
+	if s.Codec == nil {
+		return gomcache.JSONCodec()
+	}
+	return s.Codec
+}
+
+func (s *Store) maxAge() int32 {
+	if s.MaxAge <= 0 {
+		return DefaultMaxAge
+	}
+	return s.MaxAge
+}
+
+func (s *Store) cookieName() string {
+	if s.Cookie.Name == "" {
+		return DefaultCookieName
+	}
+	return s.Cookie.Name
+}
+
+// newID returns a new random session ID.
+func newID() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+// validID reports whether id has the form of the IDs made by newID.
+func validID(id string) bool {
+	if len(id) != idLen {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nihankhan/gomcache"
+)
+
+// fakeServer answers get, set and delete commands.
+type fakeServer struct {
+	addr string
+
+	mu    sync.Mutex
+	items map[string]string
+	exps  map[string]string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeServer{
+		addr:  ln.Addr().String(),
+		items: make(map[string]string),
+		exps:  make(map[string]string),
+	}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(nc)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+
+		s.mu.Lock()
+		switch f[0] {
+		case "get":
+			if v, ok := s.items[f[1]]; ok {
+				fmt.Fprintf(nc, "VALUE %s %d %d\r\n%s\r\n", f[1], gomcache.FlagJSON, len(v), v)
+			}
+			io.WriteString(nc, "END\r\n")
+		case "set":
+			size, _ := strconv.Atoi(f[4])
+			data := make([]byte, size+2)
+			io.ReadFull(r, data)
+			s.items[f[1]] = string(data[:size])
+			s.exps[f[1]] = f[3]
+			io.WriteString(nc, "STORED\r\n")
+		case "delete":
+			delete(s.items, f[1])
+			io.WriteString(nc, "DELETED\r\n")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *fakeServer) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// roundTrip runs h on a request carrying cookies and returns the cookies
+// it set.
+func roundTrip(h http.HandlerFunc, cookies []*http.Cookie) []*http.Cookie {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w.Result().Cookies()
+}
+
+func TestStore(t *testing.T) {
+	srv := newFakeServer(t)
+	client, _ := gomcache.NewClient([]string{srv.addr}, false)
+	store := NewStore(client)
+	store.MaxAge = 600
+
+	cookies := roundTrip(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := store.Get(r)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !sess.IsNew {
+			t.Fatal("expected a new session")
+		}
+		sess.Values["user"] = "alice"
+		if err := store.Save(r, w, sess); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}, nil)
+	if len(cookies) != 1 || cookies[0].MaxAge != 600 || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+
+	srv.mu.Lock()
+	for key, exp := range srv.exps {
+		if strings.Contains(key, cookies[0].Value) {
+			t.Fatalf("expected the session ID not to appear in key %q", key)
+		}
+		if exp != "600" {
+			t.Fatalf("expected the session to expire in 600s, got %s", exp)
+		}
+	}
+	srv.mu.Unlock()
+
+	var id string
+	roundTrip(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := store.Get(r)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if sess.IsNew || sess.Values["user"] != "alice" {
+			t.Fatalf("expected the saved session, got %+v", sess)
+		}
+		id = sess.ID
+		if err := store.Regenerate(r, w, sess); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if sess.ID == id {
+			t.Fatal("expected a new session ID")
+		}
+	}, cookies)
+	if srv.len() != 1 {
+		t.Fatalf("expected the old session to be deleted, got %d sessions", srv.len())
+	}
+
+	roundTrip(func(w http.ResponseWriter, r *http.Request) {
+		if sess, _ := store.Get(r); !sess.IsNew {
+			t.Fatal("expected a regenerated ID to be rejected")
+		}
+	}, cookies)
+}
+
+func TestStoreRejectsMalformedIDs(t *testing.T) {
+	srv := newFakeServer(t)
+	client, _ := gomcache.NewClient([]string{srv.addr}, false)
+	store := NewStore(client)
+
+	roundTrip(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := store.Get(r)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !sess.IsNew {
+			t.Fatal("expected a new session")
+		}
+	}, []*http.Cookie{{Name: DefaultCookieName, Value: "../../etc/passwd"}})
+}
+
+func TestStoreDestroy(t *testing.T) {
+	srv := newFakeServer(t)
+	client, _ := gomcache.NewClient([]string{srv.addr}, false)
+	store := NewStore(client)
+
+	cookies := roundTrip(func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := store.Get(r)
+		if err := store.Save(r, w, sess); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}, nil)
+	cookies = roundTrip(func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := store.Get(r)
+		if err := store.Destroy(r, w, sess); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}, cookies)
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("expected the cookie to be expired, got %v", cookies)
+	}
+	if srv.len() != 0 {
+		t.Fatalf("expected the session to be deleted, got %d sessions", srv.len())
+	}
+}
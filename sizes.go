@@ -0,0 +1,267 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultItemSizeMax is memcached's default item_size_max, 1 MiB.
+	DefaultItemSizeMax = 1 << 20
+
+	// DefaultSizeAlertFraction is the default fraction of ItemSizeMax at
+	// which values are reported as approaching the limit.
+	DefaultSizeAlertFraction = 0.8
+
+	// DefaultSizeGrowth is the default growth of a namespace's P99 value
+	// size over its baseline that raises an alert.
+	DefaultSizeGrowth = 2.0
+
+	// DefaultSizeMinSamples is the default number of values a namespace
+	// must have seen before its growth is compared to the baseline.
+	DefaultSizeMinSamples = 100
+)
+
+// sizeBuckets is the number of histogram buckets. Bucket i counts values
+// of fewer than 2^i bytes that did not fit in bucket i-1; the last bucket
+// counts everything larger.
+const sizeBuckets = 32
+
+// SizeAlertKind is the reason for a SizeAlert.
+type SizeAlertKind int
+
+const (
+	// SizeNearLimit reports a value approaching ItemSizeMax, beyond which
+	// memcached answers SERVER_ERROR object too large.
+	SizeNearLimit SizeAlertKind = iota
+
+	// SizeGrowth reports a namespace whose P99 value size grew by Growth
+	// over its baseline.
+	SizeGrowth
+)
+
+// SizeAlert is passed to SizeHistogram.OnAlert.
+type SizeAlert struct {
+	Kind      SizeAlertKind
+	Namespace string
+
+	// Key and Size are the value that raised a SizeNearLimit alert.
+	Key  string
+	Size int
+
+	// Baseline and P99 are the P99 value sizes of the namespace in the
+	// baseline and now, for SizeGrowth alerts.
+	Baseline, P99 int
+}
+
+// SizeReport summarizes the value sizes of one namespace. Reports can be
+// saved and passed back as the Baseline of the next release.
+type SizeReport struct {
+	Namespace string
+	Count     uint64
+	Bytes     uint64
+	Max       int
+
+	// P50 and P99 are upper bounds of the value sizes, in bytes.
+	P50, P99 int
+}
+
+// SizeHistogram records the distribution of the sizes of values stored and
+// fetched, per key namespace, in exponential buckets. It calls OnAlert when
+// values approach ItemSizeMax or a namespace's values grow significantly
+// compared to a baseline, such as the report of the previous release,
+// catching payload bloat before writes start failing. Each kind of alert
+// fires at most once per namespace. Only the exported fields may be set,
+// before the histogram is first used; it is safe for concurrent use.
+type SizeHistogram struct {
+	// Namespace maps a key to its namespace. If nil, the part of the key
+	// before the first ':' is used.
+	Namespace func(key string) string
+
+	// ItemSizeMax is the item_size_max of the servers. If zero,
+	// DefaultItemSizeMax is used.
+	ItemSizeMax int
+
+	// AlertFraction is the fraction of ItemSizeMax from which values are
+	// reported. If zero, DefaultSizeAlertFraction is used.
+	AlertFraction float64
+
+	// Baseline holds earlier reports to compare namespaces to.
+	Baseline []SizeReport
+
+	// Growth is the factor by which the P99 of a namespace must exceed its
+	// baseline to raise an alert. If zero, DefaultSizeGrowth is used.
+	Growth float64
+
+	// MinSamples is the number of values a namespace must have seen before
+	// it is compared to its baseline. If zero, DefaultSizeMinSamples is
+	// used.
+	MinSamples uint64
+
+	// OnAlert, if not nil, is called with every alert. It must not block.
+	OnAlert func(SizeAlert)
+
+	mu  sync.Mutex
+	nss map[string]*nsSizes
+}
+
+// clone returns an empty histogram configured like h, or nil if h is nil.
+func (h *SizeHistogram) clone() *SizeHistogram {
+	if h == nil {
+		return nil
+	}
+	return &SizeHistogram{
+		Namespace:     h.Namespace,
+		ItemSizeMax:   h.ItemSizeMax,
+		AlertFraction: h.AlertFraction,
+		Baseline:      h.Baseline,
+		Growth:        h.Growth,
+		MinSamples:    h.MinSamples,
+		OnAlert:       h.OnAlert,
+	}
+}
+
+// nsSizes is the histogram of a single namespace.
+type nsSizes struct {
+	buckets [sizeBuckets]uint64
+	count   uint64
+	bytes   uint64
+	max     int
+	alerted [2]bool // by SizeAlertKind
+}
+
+func (h *SizeHistogram) namespace(key string) string {
+	if h.Namespace != nil {
+		return h.Namespace(key)
+	}
+	ns, _, _ := strings.Cut(key, ":")
+	return ns
+}
+
+func (h *SizeHistogram) itemSizeMax() int {
+	if h.ItemSizeMax > 0 {
+		return h.ItemSizeMax
+	}
+	return DefaultItemSizeMax
+}
+
+// observe records a value of size bytes stored or fetched under key.
+func (h *SizeHistogram) observe(key string, size int) {
+	if h == nil {
+		return
+	}
+	ns := h.namespace(key)
+	frac := h.AlertFraction
+	if frac <= 0 {
+		frac = DefaultSizeAlertFraction
+	}
+
+	var alerts []SizeAlert
+	h.mu.Lock()
+	if h.nss == nil {
+		h.nss = make(map[string]*nsSizes)
+	}
+	s := h.nss[ns]
+	if s == nil {
+		s = new(nsSizes)
+		h.nss[ns] = s
+	}
+	s.buckets[min(bits.Len(uint(size)), sizeBuckets-1)]++
+	s.count++
+	s.bytes += uint64(size)
+	s.max = max(s.max, size)
+
+	if !s.alerted[SizeNearLimit] && float64(size) >= frac*float64(h.itemSizeMax()) {
+		s.alerted[SizeNearLimit] = true
+		alerts = append(alerts, SizeAlert{Kind: SizeNearLimit, Namespace: ns, Key: key, Size: size})
+	}
+	if !s.alerted[SizeGrowth] && s.count >= h.minSamples() {
+		if base, ok := h.baseline(ns); ok && base.P99 > 0 {
+			growth := h.Growth
+			if growth <= 0 {
+				growth = DefaultSizeGrowth
+			}
+			if p99 := s.quantile(0.99); float64(p99) >= growth*float64(base.P99) {
+				s.alerted[SizeGrowth] = true
+				alerts = append(alerts, SizeAlert{Kind: SizeGrowth, Namespace: ns, Baseline: base.P99, P99: p99})
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	if h.OnAlert != nil {
+		for _, a := range alerts {
+			h.OnAlert(a)
+		}
+	}
+}
+
+func (h *SizeHistogram) minSamples() uint64 {
+	if h.MinSamples > 0 {
+		return h.MinSamples
+	}
+	return DefaultSizeMinSamples
+}
+
+// baseline returns the baseline report of ns.
+func (h *SizeHistogram) baseline(ns string) (SizeReport, bool) {
+	for _, r := range h.Baseline {
+		if r.Namespace == ns {
+			return r, true
+		}
+	}
+	return SizeReport{}, false
+}
+
+// Report returns a summary per namespace, sorted by namespace.
+func (h *SizeHistogram) Report() []SizeReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	reports := make([]SizeReport, 0, len(h.nss))
+	for ns, s := range h.nss {
+		reports = append(reports, SizeReport{
+			Namespace: ns,
+			Count:     s.count,
+			Bytes:     s.bytes,
+			Max:       s.max,
+			P50:       s.quantile(0.5),
+			P99:       s.quantile(0.99),
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Namespace < reports[j].Namespace })
+	return reports
+}
+
+// quantile returns the upper bound of the bucket holding quantile q, capped
+// at the largest value seen.
+func (s *nsSizes) quantile(q float64) int {
+	target := uint64(q * float64(s.count))
+	var seen uint64
+	for i, n := range s.buckets {
+		seen += n
+		if seen > target || seen == s.count {
+			return min(1<<i-1, s.max)
+		}
+	}
+	return 0
+}
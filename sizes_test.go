@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	var alerts []SizeAlert
+	client.ValueSizes = &SizeHistogram{
+		ItemSizeMax: 1000,
+		MinSamples:  10,
+		Baseline:    []SizeReport{{Namespace: "user", P99: 15}},
+		OnAlert:     func(a SizeAlert) { alerts = append(alerts, a) },
+	}
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		if err := client.Set(&Item{Key: key, Value: bytes.Repeat([]byte("x"), 10)}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := client.Get(key); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("expected no alerts, got %+v", alerts)
+	}
+
+	big := &Item{Key: "blob:1", Value: bytes.Repeat([]byte("x"), 900)}
+	for i := 0; i < 2; i++ {
+		if err := client.Set(big); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if len(alerts) != 1 || alerts[0].Kind != SizeNearLimit || alerts[0].Key != "blob:1" || alerts[0].Size != 900 {
+		t.Fatalf("expected one near-limit alert, got %+v", alerts)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := client.Set(&Item{Key: "user:big", Value: bytes.Repeat([]byte("x"), 100)}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if len(alerts) != 2 || alerts[1].Kind != SizeGrowth || alerts[1].Namespace != "user" || alerts[1].Baseline != 15 {
+		t.Fatalf("expected a growth alert, got %+v", alerts)
+	}
+
+	report := client.ValueSizes.Report()
+	if len(report) != 2 || report[1].Namespace != "user" || report[1].Count != 30 || report[1].Max != 100 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report[1].P50 != 15 || report[1].P99 != 100 {
+		t.Fatalf("expected P50 15 and P99 100, got %d and %d", report[1].P50, report[1].P99)
+	}
+}
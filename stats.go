@@ -0,0 +1,371 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats returns the general-purpose statistics reported by every server,
+// keyed by server address.
+func (c *Client) Stats() (map[string]map[string]string, error) {
+	return c.statsAll("")
+}
+
+// StatsSettings returns the settings of every server, such as maxbytes or
+// item_size_max, keyed by server address.
+func (c *Client) StatsSettings() (map[string]map[string]string, error) {
+	return c.statsAll("settings")
+}
+
+// statsAll issues "stats [sub]" to every server and returns the reported
+// values keyed by server address.
+func (c *Client) statsAll(sub string) (map[string]map[string]string, error) {
+	var lk sync.Mutex
+	all := make(map[string]map[string]string)
+	err := c.eachServer(func(addr net.Addr) error {
+		st, err := c.statsFromAddr(addr, sub)
+		if err != nil {
+			return err
+		}
+		lk.Lock()
+		defer lk.Unlock()
+		all[addr.String()] = st
+		return nil
+	})
+	return all, err
+}
+
+// statsFromAddr issues "stats [sub]" to addr and returns the reported
+// values. It returns ErrNoStats if the server reported none.
+func (c *Client) statsFromAddr(addr net.Addr, sub string) (map[string]string, error) {
+	if err := c.conformFeature(featureStats); err != nil {
+		return nil, err
+	}
+	req := "stats\r\n"
+	if sub != "" {
+		req = "stats " + sub + "\r\n"
+	}
+
+	st := make(map[string]string)
+	err := c.roundTrip(context.Background(), addr, ProtocolText, false, []byte(req), func(r *bufio.Reader) error {
+		for {
+			line, err := r.ReadSlice('\n')
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(line, resultEnd) {
+				return nil
+			}
+			fields := strings.Fields(string(line))
+			if len(fields) < 3 || fields[0] != "STAT" {
+				return unexpectedResponse(line)
+			}
+			st[fields[1]] = strings.Join(fields[2:], " ")
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(st) == 0 {
+		return nil, ErrNoStats
+	}
+	return st, nil
+}
+
+// ItemStats holds the statistics of the items of a slab class, as
+// reported by "stats items".
+type ItemStats struct {
+	Number           uint64 // items stored
+	NumberHot        uint64 // items in the HOT LRU
+	NumberWarm       uint64 // items in the WARM LRU
+	NumberCold       uint64 // items in the COLD LRU
+	Age              uint64 // age in seconds of the oldest item
+	MemRequested     uint64 // bytes requested by the items
+	Evicted          uint64 // items evicted to make room for others
+	EvictedNonzero   uint64 // evicted items that had an expiration
+	EvictedTime      uint64 // seconds since the last evicted item was accessed
+	EvictedUnfetched uint64 // evicted items that were never fetched
+	ExpiredUnfetched uint64 // expired items that were never fetched
+	OutOfMemory      uint64 // stores that failed for lack of memory
+	Reclaimed        uint64 // stores that reused the memory of an expired item
+	CrawlerReclaimed uint64 // expired items freed by the LRU crawler
+}
+
+// fields maps the names of the statistics to the fields of s.
+func (s *ItemStats) fields() map[string]*uint64 {
+	return map[string]*uint64{
+		"number":            &s.Number,
+		"number_hot":        &s.NumberHot,
+		"number_warm":       &s.NumberWarm,
+		"number_cold":       &s.NumberCold,
+		"age":               &s.Age,
+		"mem_requested":     &s.MemRequested,
+		"evicted":           &s.Evicted,
+		"evicted_nonzero":   &s.EvictedNonzero,
+		"evicted_time":      &s.EvictedTime,
+		"evicted_unfetched": &s.EvictedUnfetched,
+		"expired_unfetched": &s.ExpiredUnfetched,
+		"outofmemory":       &s.OutOfMemory,
+		"reclaimed":         &s.Reclaimed,
+		"crawler_reclaimed": &s.CrawlerReclaimed,
+	}
+}
+
+// SlabStats holds the statistics of a slab class, as reported by "stats
+// slabs".
+type SlabStats struct {
+	ChunkSize     uint64 // bytes of each chunk
+	ChunksPerPage uint64 // chunks in each page
+	TotalPages    uint64 // pages assigned to the class
+	TotalChunks   uint64 // chunks assigned to the class
+	UsedChunks    uint64 // chunks holding items
+	FreeChunks    uint64 // chunks free to store items
+	FreeChunksEnd uint64 // free chunks at the end of the last page
+	GetHits       uint64 // gets that found an item of the class
+	CmdSet        uint64 // stores into the class
+	DeleteHits    uint64 // deletes that found an item of the class
+	IncrHits      uint64 // increments of items of the class
+	DecrHits      uint64 // decrements of items of the class
+	CasHits       uint64 // successful CAS stores into the class
+	CasBadval     uint64 // CAS stores that failed on a changed item
+	TouchHits     uint64 // touches of items of the class
+}
+
+func (s *SlabStats) fields() map[string]*uint64 {
+	return map[string]*uint64{
+		"chunk_size":      &s.ChunkSize,
+		"chunks_per_page": &s.ChunksPerPage,
+		"total_pages":     &s.TotalPages,
+		"total_chunks":    &s.TotalChunks,
+		"used_chunks":     &s.UsedChunks,
+		"free_chunks":     &s.FreeChunks,
+		"free_chunks_end": &s.FreeChunksEnd,
+		"get_hits":        &s.GetHits,
+		"cmd_set":         &s.CmdSet,
+		"delete_hits":     &s.DeleteHits,
+		"incr_hits":       &s.IncrHits,
+		"decr_hits":       &s.DecrHits,
+		"cas_hits":        &s.CasHits,
+		"cas_badval":      &s.CasBadval,
+		"touch_hits":      &s.TouchHits,
+	}
+}
+
+// SlabsStats holds the statistics of the slab allocator of a server.
+type SlabsStats struct {
+	Classes       map[int]SlabStats // keyed by slab class
+	ActiveSlabs   uint64            // slab classes with memory assigned
+	TotalMalloced uint64            // bytes of memory assigned to slabs
+}
+
+// StatsItems returns the item statistics of every server, keyed by server
+// address and slab class, to see where evictions happen.
+func (c *Client) StatsItems() (map[string]map[int]ItemStats, error) {
+	all, err := c.statsAll("items")
+	res := make(map[string]map[int]ItemStats, len(all))
+	for addr, st := range all {
+		classes := make(map[int]ItemStats)
+		for name, v := range st {
+			// Names are "items:<class>:<stat>".
+			parts := strings.SplitN(name, ":", 3)
+			if len(parts) != 3 || parts[0] != "items" {
+				continue
+			}
+			class, err := strconv.Atoi(parts[1])
+			if err != nil {
+				continue
+			}
+			is := classes[class]
+			if f := is.fields()[parts[2]]; f != nil {
+				*f, _ = strconv.ParseUint(v, 10, 64)
+			}
+			classes[class] = is
+		}
+		res[addr] = classes
+	}
+	return res, err
+}
+
+// StatsSlabs returns the slab statistics of every server, keyed by server
+// address, to see the chunk sizes and how memory is spread over them.
+func (c *Client) StatsSlabs() (map[string]SlabsStats, error) {
+	all, err := c.statsAll("slabs")
+	res := make(map[string]SlabsStats, len(all))
+	for addr, st := range all {
+		ss := SlabsStats{
+			Classes:       make(map[int]SlabStats),
+			ActiveSlabs:   statUint(st, "active_slabs"),
+			TotalMalloced: statUint(st, "total_malloced"),
+		}
+		for name, v := range st {
+			// Names are "<class>:<stat>" apart from the totals.
+			class, stat, ok := strings.Cut(name, ":")
+			if !ok {
+				continue
+			}
+			n, err := strconv.Atoi(class)
+			if err != nil {
+				continue
+			}
+			s := ss.Classes[n]
+			if f := s.fields()[stat]; f != nil {
+				*f, _ = strconv.ParseUint(v, 10, 64)
+			}
+			ss.Classes[n] = s
+		}
+		res[addr] = ss
+	}
+	return res, err
+}
+
+// eachServer calls fn concurrently for every server and returns the last
+// error encountered.
+func (c *Client) eachServer(fn func(net.Addr) error) error {
+	var addrs []net.Addr
+	err := c.selector.Each(func(addr net.Addr) error {
+		addrs = append(addrs, addr)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return ErrNoServers
+	}
+
+	ch := make(chan error, len(addrs))
+	for _, addr := range addrs {
+		go func(addr net.Addr) {
+			ch <- fn(addr)
+		}(addr)
+	}
+	for range addrs {
+		if e := <-ch; e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// KeyMeta describes an item listed by Metadump.
+type KeyMeta struct {
+	Key        string
+	Expiration time.Time // zero if the item never expires
+	LastAccess time.Time
+	CAS        uint64
+	Fetched    bool // whether the item was read since it was stored
+	Class      int  // slab class
+	Size       int  // total size of the item in memory, in bytes
+}
+
+// Metadump streams the metadata of every item held by the server at addr,
+// as reported by "lru_crawler metadump all", calling fn for each. Returning
+// false from fn stops the dump. The read deadline is extended as items
+// arrive, so a dump may take longer than Timeout overall.
+func (c *Client) Metadump(addr string, fn func(KeyMeta) bool) error {
+	if err := c.conformFeature(featureMetadump); err != nil {
+		return err
+	}
+	a, err := resolveServer(addr)
+	if err != nil {
+		return err
+	}
+
+	nc, err := c.connect(context.Background(), a, ProtocolText)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	nc.SetDeadline(time.Now().Add(c.netTimeout()))
+	if _, err := nc.Write([]byte("lru_crawler metadump all\r\n")); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(nc)
+	for {
+		nc.SetReadDeadline(time.Now().Add(c.netTimeout()))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if line == string(resultEnd) {
+			return nil
+		}
+		if !strings.HasPrefix(line, "key=") {
+			return unexpectedResponse([]byte(line))
+		}
+
+		km, err := parseKeyMeta(line)
+		if err != nil {
+			return err
+		}
+		if !fn(km) {
+			return nil
+		}
+	}
+}
+
+// parseKeyMeta parses a metadump line such as
+//
+//	key=foo exp=-1 la=1700000000 cas=12 fetch=no cls=1 size=63
+func parseKeyMeta(line string) (KeyMeta, error) {
+	var km KeyMeta
+	for _, field := range strings.Fields(line) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		var err error
+		switch k {
+		case "key":
+			km.Key, err = url.QueryUnescape(v)
+		case "exp":
+			var exp int64
+			if exp, err = strconv.ParseInt(v, 10, 64); err == nil && exp > 0 {
+				km.Expiration = time.Unix(exp, 0)
+			}
+		case "la":
+			var la int64
+			if la, err = strconv.ParseInt(v, 10, 64); err == nil {
+				km.LastAccess = time.Unix(la, 0)
+			}
+		case "cas":
+			km.CAS, err = strconv.ParseUint(v, 10, 64)
+		case "fetch":
+			km.Fetched = v == "yes"
+		case "cls":
+			km.Class, err = strconv.Atoi(v)
+		case "size":
+			km.Size, err = strconv.Atoi(v)
+		}
+		if err != nil {
+			return km, unexpectedResponse([]byte(line))
+		}
+	}
+	return km, nil
+}
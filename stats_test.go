@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.Set(&Item{Key: "foo", Value: []byte("bar")})
+
+	all, err := client.Stats()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("expected stats for 1 server, got %d", len(all))
+	}
+	for _, st := range all {
+		if st["curr_items"] != "1" {
+			t.Fatalf("expected curr_items 1, got %q", st["curr_items"])
+		}
+	}
+}
+
+func TestMetadump(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.Set(&Item{Key: "a", Value: []byte("bar")})
+	client.Set(&Item{Key: "c", Value: []byte("baz")})
+
+	var keys []KeyMeta
+	err := client.Metadump(srv.addr, func(km KeyMeta) bool {
+		keys = append(keys, km)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+
+	var n int
+	err = client.Metadump(srv.addr, func(km KeyMeta) bool {
+		n++
+		return false
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("expected the dump to stop after 1 key, got %d keys, err %v", n, err)
+	}
+}
+
+func TestParseKeyMeta(t *testing.T) {
+	km, err := parseKeyMeta("key=a%20b exp=1700000100 la=1700000000 cas=12 fetch=yes cls=3 size=63\r\n")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := KeyMeta{
+		Key:        "a b",
+		Expiration: time.Unix(1700000100, 0),
+		LastAccess: time.Unix(1700000000, 0),
+		CAS:        12,
+		Fetched:    true,
+		Class:      3,
+		Size:       63,
+	}
+	if km != want {
+		t.Fatalf("expected %+v, got %+v", want, km)
+	}
+
+	km, _ = parseKeyMeta("key=b exp=-1 la=0 cas=1 fetch=no cls=1 size=50\r\n")
+	if !km.Expiration.IsZero() {
+		t.Fatalf("expected no expiration, got %v", km.Expiration)
+	}
+}
+
+func TestStatsItems(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	all, err := client.StatsItems()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := map[int]ItemStats{
+		1: {Number: 3, Age: 120, Evicted: 7},
+		5: {Number: 1, OutOfMemory: 2},
+	}
+	if !reflect.DeepEqual(all[srv.addr], want) {
+		t.Fatalf("expected %+v, got %+v", want, all)
+	}
+}
+
+func TestStatsSlabs(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	all, err := client.StatsSlabs()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := SlabsStats{
+		Classes:       map[int]SlabStats{1: {ChunkSize: 96, ChunksPerPage: 10922, TotalPages: 1, UsedChunks: 3, GetHits: 12}},
+		ActiveSlabs:   1,
+		TotalMalloced: 1 << 20,
+	}
+	if !reflect.DeepEqual(all[srv.addr], want) {
+		t.Fatalf("expected %+v, got %+v", want, all)
+	}
+}
+
+func TestStatsSettings(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	all, err := client.StatsSettings()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if st := all[srv.addr]; st["item_size_max"] != "1048576" || st["evictions"] != "on" {
+		t.Fatalf("unexpected settings %v", all)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// timeoutBuckets are the upper bounds of the histogram buckets, as fractions
+// of the deadline consumed by an operation. A final bucket counts anything
+// above 1.
+var timeoutBuckets = []float64{0.01, 0.02, 0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 0.9, 1}
+
+// TimeoutHistogram records, per operation, how much of its deadline each
+// call consumed and how often the deadline was hit. Its Report suggests a
+// Timeout that fits the observed latencies. The zero value is ready to use
+// and safe for concurrent use.
+type TimeoutHistogram struct {
+	mu  sync.Mutex
+	ops map[string]*opTimeouts
+}
+
+// opTimeouts is the histogram of a single operation.
+type opTimeouts struct {
+	buckets  [11]uint64 // len(timeoutBuckets) + 1
+	count    uint64
+	timeouts uint64
+	budget   time.Duration // most recent deadline
+}
+
+// TimeoutReport summarizes the deadline usage of one operation.
+type TimeoutReport struct {
+	Op       string
+	Count    uint64
+	Timeouts uint64
+	Budget   time.Duration // the deadline most recently in effect
+
+	// P50, P99 and P999 are upper bounds of the fraction of Budget used.
+	P50, P99, P999 float64
+
+	// Suggested is a Timeout fitting the observed distribution: looser when
+	// more than 0.1% of calls time out, tighter when 99.9% of calls use
+	// less than a quarter of the budget, and Budget otherwise.
+	Suggested time.Duration
+}
+
+// observe records a call of op that took elapsed out of budget.
+func (h *TimeoutHistogram) observe(op string, elapsed, budget time.Duration, timedOut bool) {
+	if budget <= 0 {
+		return
+	}
+	frac := float64(elapsed) / float64(budget)
+	i := sort.SearchFloat64s(timeoutBuckets, frac)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ops == nil {
+		h.ops = make(map[string]*opTimeouts)
+	}
+	ot := h.ops[op]
+	if ot == nil {
+		ot = new(opTimeouts)
+		h.ops[op] = ot
+	}
+	ot.buckets[i]++
+	ot.count++
+	if timedOut {
+		ot.timeouts++
+	}
+	ot.budget = budget
+}
+
+// Report returns a summary per operation, sorted by operation name.
+func (h *TimeoutHistogram) Report() []TimeoutReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	reports := make([]TimeoutReport, 0, len(h.ops))
+	for op, ot := range h.ops {
+		r := TimeoutReport{
+			Op:       op,
+			Count:    ot.count,
+			Timeouts: ot.timeouts,
+			Budget:   ot.budget,
+			P50:      ot.quantile(0.5),
+			P99:      ot.quantile(0.99),
+			P999:     ot.quantile(0.999),
+		}
+		switch {
+		case float64(ot.timeouts) > 0.001*float64(ot.count):
+			r.Suggested = 2 * ot.budget
+		case r.P999 <= 0.25:
+			// Leave twice the observed tail as headroom.
+			r.Suggested = time.Duration(2 * r.P999 * float64(ot.budget))
+		default:
+			r.Suggested = ot.budget
+		}
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Op < reports[j].Op })
+	return reports
+}
+
+// quantile returns the upper bound of the bucket holding quantile q.
+func (ot *opTimeouts) quantile(q float64) float64 {
+	target := uint64(q * float64(ot.count))
+	var seen uint64
+	for i, n := range ot.buckets {
+		seen += n
+		if seen > target || seen == ot.count {
+			if i == len(timeoutBuckets) {
+				return 2 // beyond the deadline
+			}
+			return timeoutBuckets[i]
+		}
+	}
+	return 0
+}
+
+// isTimeout reports whether err is a deadline being hit.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout()
+}
+
+// ConnectTimeoutError reports that connecting to a server, including the TLS
+// and authentication handshake, did not finish within the deadline. It
+// implements net.Error.
+type ConnectTimeoutError struct {
+	Addr net.Addr
+	Err  error
+}
+
+func (e *ConnectTimeoutError) Error() string {
+	return "memcache: connect to " + e.Addr.String() + " timed out: " + e.Err.Error()
+}
+
+func (e *ConnectTimeoutError) Unwrap() error   { return e.Err }
+func (e *ConnectTimeoutError) Timeout() bool   { return true }
+func (e *ConnectTimeoutError) Temporary() bool { return true }
+
+// OpTimeoutError reports that a server did not answer a request within the
+// deadline. The request may or may not have been applied. It implements
+// net.Error.
+type OpTimeoutError struct {
+	Addr net.Addr
+	Err  error
+}
+
+func (e *OpTimeoutError) Error() string {
+	return "memcache: request to " + e.Addr.String() + " timed out: " + e.Err.Error()
+}
+
+func (e *OpTimeoutError) Unwrap() error   { return e.Err }
+func (e *OpTimeoutError) Timeout() bool   { return true }
+func (e *OpTimeoutError) Temporary() bool { return true }
+
+// connectTimeout returns err as a ConnectTimeoutError if it is a deadline
+// being hit while connecting to addr. Context errors are returned as is.
+func connectTimeout(addr net.Addr, err error) error {
+	if err == context.DeadlineExceeded || !isTimeout(err) {
+		return err
+	}
+	return &ConnectTimeoutError{Addr: addr, Err: err}
+}
+
+// opTimeout returns err as an OpTimeoutError if it is a deadline being hit
+// while waiting for addr to answer. Context errors and connect timeouts are
+// returned as is.
+func opTimeout(addr net.Addr, err error) error {
+	var cte *ConnectTimeoutError
+	if err == context.DeadlineExceeded || !isTimeout(err) || errors.As(err, &cte) {
+		return err
+	}
+	return &OpTimeoutError{Addr: addr, Err: err}
+}
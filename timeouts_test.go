@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTimeoutHistogramRecordsOperations(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+	client.TimeoutHistogram = &TimeoutHistogram{}
+
+	client.Set(&Item{Key: "foo", Value: []byte("bar")})
+	client.Get("foo", WithTimeout(100*time.Millisecond))
+	client.Get("missing")
+
+	reports := client.TimeoutHistogram.Report()
+	if len(reports) != 2 || reports[0].Op != "get" || reports[1].Op != "set" {
+		t.Fatalf("expected reports for get and set, got %+v", reports)
+	}
+	if r := reports[0]; r.Count != 2 || r.Timeouts != 0 || r.Budget != DefaultTimeout {
+		t.Fatalf("unexpected get report %+v", r)
+	}
+}
+
+func TestTimeoutHistogramSuggestions(t *testing.T) {
+	var h TimeoutHistogram
+	budget := time.Second
+	for i := 0; i < 1000; i++ {
+		h.observe("fast", 10*time.Millisecond, budget, false)
+		h.observe("slow", 500*time.Millisecond, budget, false)
+	}
+	h.observe("timing-out", budget, budget, true)
+
+	for _, r := range h.Report() {
+		switch r.Op {
+		case "fast":
+			if r.P999 != 0.01 || r.Suggested != 20*time.Millisecond {
+				t.Fatalf("expected a tighter suggestion, got %+v", r)
+			}
+		case "slow":
+			if r.P50 != 0.5 || r.Suggested != budget {
+				t.Fatalf("expected the budget to be kept, got %+v", r)
+			}
+		case "timing-out":
+			if r.Suggested != 2*budget {
+				t.Fatalf("expected a looser suggestion, got %+v", r)
+			}
+		}
+	}
+}
+
+func TestTimeoutErrors(t *testing.T) {
+	// A server that accepts connections but never answers.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer nc.Close()
+		}
+	}()
+
+	client, _ := NewClient([]string{ln.Addr().String()}, false)
+	client.Timeout = 20 * time.Millisecond
+	_, err := client.Get("foo")
+	var ote *OpTimeoutError
+	var ne net.Error
+	if !errors.As(err, &ote) || !errors.As(err, &ne) || !ne.Timeout() || errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expected an OpTimeoutError, got %v", err)
+	}
+
+	// A dial that hangs until the deadline.
+	client, _ = NewClient([]string{ln.Addr().String()}, false)
+	client.Timeout = 20 * time.Millisecond
+	client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+	}
+	err = client.Set(&Item{Key: "foo", Value: []byte("bar")})
+	var cte *ConnectTimeoutError
+	if !errors.As(err, &cte) || !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expected a ConnectTimeoutError, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync/atomic"
+)
+
+// udpHeaderLen is the size of the frame header memcached prepends to every
+// UDP datagram.
+const udpHeaderLen = 8
+
+// udpMaxDatagram bounds the size of a single datagram read from the server.
+const udpMaxDatagram = 65535
+
+// udpMaxRequest is the largest request that fits in a single datagram.
+const udpMaxRequest = 65507 - udpHeaderLen
+
+var errUDPFrame = errors.New("memcache: malformed UDP frame")
+
+// ErrUDPRequestTooLarge is returned when a request sent over UDP does not fit
+// in a single datagram, typically because the item value is too large. Such
+// items must be written over TCP.
+var ErrUDPRequestTooLarge = errors.New("memcache: request too large for UDP")
+
+// udpRequestID is the last request ID handed out. It is seeded randomly so
+// that concurrent processes sharing a host are unlikely to collide.
+var udpRequestID atomic.Uint32
+
+func init() {
+	udpRequestID.Store(rand.Uint32())
+}
+
+// nextUDPRequestID returns the request ID for a new UDP request.
+func nextUDPRequestID() uint16 {
+	return uint16(udpRequestID.Add(1))
+}
+
+// udpFrame is the header memcached uses to correlate UDP requests and
+// responses and to order multi-datagram responses.
+type udpFrame struct {
+	requestID uint16
+	seq       uint16
+	total     uint16
+}
+
+func (f udpFrame) marshal(b []byte) {
+	binary.BigEndian.PutUint16(b[0:2], f.requestID)
+	binary.BigEndian.PutUint16(b[2:4], f.seq)
+	binary.BigEndian.PutUint16(b[4:6], f.total)
+	binary.BigEndian.PutUint16(b[6:8], 0) // Reserved
+}
+
+func parseUDPFrame(b []byte) (udpFrame, error) {
+	if len(b) < udpHeaderLen {
+		return udpFrame{}, errUDPFrame
+	}
+	f := udpFrame{
+		requestID: binary.BigEndian.Uint16(b[0:2]),
+		seq:       binary.BigEndian.Uint16(b[2:4]),
+		total:     binary.BigEndian.Uint16(b[4:6]),
+	}
+	if f.total == 0 || f.seq >= f.total {
+		return udpFrame{}, errUDPFrame
+	}
+	return f, nil
+}
+
+// roundTripUDP sends req as a single datagram and returns the reassembled
+// response. Memcached does not accept requests spanning several datagrams.
+func roundTripUDP(conn net.Conn, req []byte) ([]byte, error) {
+	if len(req) > udpMaxRequest {
+		return nil, ErrUDPRequestTooLarge
+	}
+
+	id := nextUDPRequestID()
+	pkt := make([]byte, udpHeaderLen+len(req))
+	udpFrame{requestID: id, total: 1}.marshal(pkt)
+	copy(pkt[udpHeaderLen:], req)
+
+	if _, err := conn.Write(pkt); err != nil {
+		return nil, fmt.Errorf("memcache: writing to UDP: %w", err)
+	}
+	return readUDPResponse(conn, id)
+}
+
+// readUDPResponse reads datagrams until every part of the response to the
+// request identified by id has arrived, then joins the parts in sequence
+// order. Datagrams belonging to other (e.g. timed out) requests are dropped.
+func readUDPResponse(conn net.Conn, id uint16) ([]byte, error) {
+	buf := make([]byte, udpMaxDatagram)
+	var parts [][]byte
+	received := 0
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("memcache: reading from UDP: %w", err)
+		}
+
+		f, err := parseUDPFrame(buf[:n])
+		if err != nil || f.requestID != id {
+			continue
+		}
+
+		if parts == nil {
+			parts = make([][]byte, f.total)
+		} else if int(f.total) != len(parts) {
+			return nil, errUDPFrame
+		}
+		if parts[f.seq] != nil {
+			// Duplicate datagram.
+			continue
+		}
+		parts[f.seq] = append([]byte{}, buf[udpHeaderLen:n]...)
+
+		received++
+		if received == len(parts) {
+			return bytes.Join(parts, nil), nil
+		}
+	}
+}
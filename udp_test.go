@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+)
+
+// serveUDP answers every request received on pc with the datagrams built by
+// respond, which receives the request ID and payload of the request.
+func serveUDP(t *testing.T, respond func(id uint16, req []byte) [][]byte) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		buf := make([]byte, udpMaxDatagram)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			f, err := parseUDPFrame(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, dgram := range respond(f.requestID, buf[udpHeaderLen:n]) {
+				pc.WriteTo(dgram, addr)
+			}
+		}
+	}()
+
+	return pc.LocalAddr().String()
+}
+
+func datagram(id, seq, total uint16, payload string) []byte {
+	b := make([]byte, udpHeaderLen+len(payload))
+	udpFrame{requestID: id, seq: seq, total: total}.marshal(b)
+	copy(b[udpHeaderLen:], payload)
+	return b
+}
+
+func TestUDPGetReassemblesOutOfOrderDatagrams(t *testing.T) {
+	value := bytes.Repeat([]byte("x"), 3000)
+	resp := "VALUE foo 42 3000\r\n" + string(value) + "\r\nEND\r\n"
+
+	addr := serveUDP(t, func(id uint16, req []byte) [][]byte {
+		if string(req) != "get foo\r\n" {
+			t.Errorf("unexpected request %q", req)
+		}
+		return [][]byte{
+			// A late answer to some earlier request must be ignored.
+			datagram(id-1, 0, 1, "END\r\n"),
+			datagram(id, 2, 3, resp[2000:]),
+			datagram(id, 0, 3, resp[:1000]),
+			datagram(id, 0, 3, resp[:1000]),
+			datagram(id, 1, 3, resp[1000:2000]),
+		}
+	})
+
+	client, err := NewClient([]string{addr}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	item, err := client.Get("foo")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if item.Key != "foo" || item.Flags != 42 || !bytes.Equal(item.Value, value) {
+		t.Fatalf("unexpected item %q flags=%d len=%d", item.Key, item.Flags, len(item.Value))
+	}
+}
+
+func TestUDPGetMiss(t *testing.T) {
+	addr := serveUDP(t, func(id uint16, req []byte) [][]byte {
+		return [][]byte{datagram(id, 0, 1, "END\r\n")}
+	})
+
+	client, _ := NewClient([]string{addr}, true)
+	if _, err := client.Get("foo"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+}
+
+func TestParseUDPFrame(t *testing.T) {
+	if _, err := parseUDPFrame([]byte{0, 1, 0}); err == nil {
+		t.Fatalf("expected an error for a short frame")
+	}
+	if _, err := parseUDPFrame(datagram(1, 3, 3, "")); err == nil {
+		t.Fatalf("expected an error for a sequence number past the total")
+	}
+
+	f, err := parseUDPFrame(datagram(7, 1, 2, "END\r\n"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if f.requestID != 7 || f.seq != 1 || f.total != 2 {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+}
+
+func TestUDPSetAndDelete(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	addr := serveUDP(t, func(id uint16, req []byte) [][]byte {
+		mu.Lock()
+		requests = append(requests, string(req))
+		mu.Unlock()
+		switch {
+		case bytes.HasPrefix(req, []byte("set ")):
+			return [][]byte{datagram(id, 0, 1, "STORED\r\n")}
+		case bytes.HasPrefix(req, []byte("delete ")):
+			return [][]byte{datagram(id, 0, 1, "NOT_FOUND\r\n")}
+		}
+		return [][]byte{datagram(id, 0, 1, "ERROR\r\n")}
+	})
+
+	client, _ := NewClient([]string{addr}, true)
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar"), Flags: 1, Expiration: 10}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Delete("foo"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"set foo 1 10 3\r\nbar\r\n", "delete foo\r\n"}
+	if len(requests) != len(want) || requests[0] != want[0] || requests[1] != want[1] {
+		t.Fatalf("expected requests %q, got %q", want, requests)
+	}
+}
+
+func TestUDPSetTooLarge(t *testing.T) {
+	addr := serveUDP(t, func(id uint16, req []byte) [][]byte {
+		return [][]byte{datagram(id, 0, 1, "STORED\r\n")}
+	})
+
+	client, _ := NewClient([]string{addr}, true)
+	err := client.Set(&Item{Key: "foo", Value: make([]byte, udpMaxRequest)})
+	if !errors.Is(err, ErrUDPRequestTooLarge) {
+		t.Fatalf("expected ErrUDPRequestTooLarge, got %v", err)
+	}
+}
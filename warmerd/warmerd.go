@@ -0,0 +1,240 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package warmerd keeps a standby Memcached cluster warm by replaying the
+// mutations observed on a primary cluster, so the standby is ready to take
+// over on failover.
+//
+// Mutations are tailed with Client.Watch on the "mutations" and
+// "deletions" log classes of memcached 1.6, dialed like every other
+// connection of the primary client. The watch stream carries keys but not
+// values, so stored keys are re-read from the primary and written to the
+// standby, and deleted keys are deleted from the standby.
+package warmerd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nihankhan/gomcache"
+)
+
+const (
+	// DefaultWorkers is the default number of goroutines applying mutations.
+	DefaultWorkers = 4
+
+	// DefaultReconnectDelay is the default delay before re-establishing a
+	// watch connection that failed.
+	DefaultReconnectDelay = time.Second
+)
+
+// Config configures a Daemon.
+type Config struct {
+	// PrimaryAddrs are the primary servers whose mutations are tailed.
+	PrimaryAddrs []string
+
+	// Primary tails and reads current values from the primary cluster.
+	Primary *gomcache.Client
+
+	// Standby receives the replayed writes.
+	Standby *gomcache.Client
+
+	// Workers is the number of goroutines applying mutations. Mutations of
+	// the same key are always applied in order by the same worker. If zero,
+	// DefaultWorkers is used.
+	Workers int
+
+	// ReconnectDelay is the delay before re-establishing a failed watch
+	// connection. If zero, DefaultReconnectDelay is used.
+	ReconnectDelay time.Duration
+
+	// OnError, if not nil, is called with errors that do not stop the
+	// daemon, such as a failed replay or a dropped watch connection.
+	OnError func(error)
+}
+
+// Stats are cumulative counters of a Daemon.
+type Stats struct {
+	Stored  uint64 // keys copied to the standby
+	Deleted uint64 // keys deleted from the standby
+	Skipped uint64 // stored keys already gone from the primary
+	Errors  uint64
+}
+
+// Daemon replays mutations from a primary cluster onto a standby cluster.
+type Daemon struct {
+	cfg Config
+
+	stored, deleted, skipped, errors atomic.Uint64
+}
+
+// New returns a Daemon for cfg.
+func New(cfg Config) *Daemon {
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.ReconnectDelay <= 0 {
+		cfg.ReconnectDelay = DefaultReconnectDelay
+	}
+	return &Daemon{cfg: cfg}
+}
+
+// Stats returns a snapshot of the daemon counters.
+func (d *Daemon) Stats() Stats {
+	return Stats{
+		Stored:  d.stored.Load(),
+		Deleted: d.deleted.Load(),
+		Skipped: d.skipped.Load(),
+		Errors:  d.errors.Load(),
+	}
+}
+
+// Run tails every primary server and applies mutations until ctx is done.
+// It always returns ctx.Err().
+func (d *Daemon) Run(ctx context.Context) error {
+	if len(d.cfg.PrimaryAddrs) == 0 || d.cfg.Primary == nil || d.cfg.Standby == nil {
+		return errors.New("warmerd: primary addresses and both clients are required")
+	}
+
+	queues := make([]chan gomcache.LogEvent, d.cfg.Workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan gomcache.LogEvent, 1024)
+		wg.Add(1)
+		go func(q <-chan gomcache.LogEvent) {
+			defer wg.Done()
+			for ev := range q {
+				d.apply(ev)
+			}
+		}(queues[i])
+	}
+
+	var tails sync.WaitGroup
+	for _, addr := range d.cfg.PrimaryAddrs {
+		tails.Add(1)
+		go func(addr string) {
+			defer tails.Done()
+			d.tail(ctx, addr, func(ev gomcache.LogEvent) {
+				q := queues[crc32.ChecksumIEEE([]byte(ev.Key))%uint32(len(queues))]
+				select {
+				case q <- ev:
+				case <-ctx.Done():
+				}
+			})
+		}(addr)
+	}
+
+	tails.Wait()
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// tail watches addr, reconnecting after failures, until ctx is done.
+func (d *Daemon) tail(ctx context.Context, addr string, emit func(gomcache.LogEvent)) {
+	for {
+		err := d.watch(ctx, addr, emit)
+		if ctx.Err() != nil {
+			return
+		}
+		d.report(fmt.Errorf("warmerd: watch %s: %w", addr, err))
+
+		select {
+		case <-time.After(d.cfg.ReconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watch runs a single watch connection to addr, passing the events worth
+// replaying to emit.
+func (d *Daemon) watch(ctx context.Context, addr string, emit func(gomcache.LogEvent)) error {
+	events, err := d.cfg.Primary.Watch(ctx, addr, "mutations", "deletions")
+	if err != nil {
+		return err
+	}
+	for ev := range events {
+		if replayable(ev) {
+			emit(ev)
+		}
+	}
+	return errors.New("connection closed")
+}
+
+// replayable reports whether ev is a mutation worth replaying: a stored or
+// deleted key.
+func replayable(ev gomcache.LogEvent) bool {
+	if ev.Key == "" {
+		return false
+	}
+	switch ev.Type {
+	case "item_store":
+		return ev.Status == "stored"
+	case "deleted":
+		return true
+	}
+	return false
+}
+
+// apply replays ev onto the standby.
+func (d *Daemon) apply(ev gomcache.LogEvent) {
+	if ev.Type == "deleted" {
+		err := d.cfg.Standby.Delete(ev.Key)
+		if err != nil && !errors.Is(err, gomcache.ErrCacheMiss) {
+			d.fail(fmt.Errorf("warmerd: delete %q: %w", ev.Key, err))
+			return
+		}
+		d.deleted.Add(1)
+		return
+	}
+
+	it, err := d.cfg.Primary.Get(ev.Key)
+	if errors.Is(err, gomcache.ErrCacheMiss) {
+		// Already overwritten or deleted; a later event will cover it.
+		d.skipped.Add(1)
+		return
+	}
+	if err != nil {
+		d.fail(fmt.Errorf("warmerd: read %q: %w", ev.Key, err))
+		return
+	}
+
+	it.Expiration = max(ev.TTL, 0)
+	if err := d.cfg.Standby.Set(it); err != nil {
+		d.fail(fmt.Errorf("warmerd: write %q: %w", ev.Key, err))
+		return
+	}
+	d.stored.Add(1)
+}
+
+func (d *Daemon) fail(err error) {
+	d.errors.Add(1)
+	d.report(err)
+}
+
+func (d *Daemon) report(err error) {
+	if d.cfg.OnError != nil {
+		d.cfg.OnError(err)
+	}
+}
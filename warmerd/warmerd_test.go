@@ -0,0 +1,183 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package warmerd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nihankhan/gomcache"
+)
+
+// fakeServer answers get, set, delete and watch commands. Watch streams
+// receive the lines sent on events.
+type fakeServer struct {
+	addr   string
+	events chan string
+
+	mu    sync.Mutex
+	items map[string]string
+	log   []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeServer{
+		addr:   ln.Addr().String(),
+		events: make(chan string, 16),
+		items:  make(map[string]string),
+	}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(nc)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+
+		s.mu.Lock()
+		switch f[0] {
+		case "watch":
+			s.mu.Unlock()
+			io.WriteString(nc, "OK\r\n")
+			for ev := range s.events {
+				io.WriteString(nc, ev+"\r\n")
+			}
+			return
+		case "get":
+			if v, ok := s.items[f[1]]; ok {
+				fmt.Fprintf(nc, "VALUE %s 3 %d\r\n%s\r\n", f[1], len(v), v)
+			}
+			io.WriteString(nc, "END\r\n")
+		case "set":
+			size, _ := strconv.Atoi(f[4])
+			data := make([]byte, size+2)
+			io.ReadFull(r, data)
+			s.items[f[1]] = string(data[:size])
+			s.log = append(s.log, strings.Join(f[:4], " "))
+			io.WriteString(nc, "STORED\r\n")
+		case "delete":
+			delete(s.items, f[1])
+			s.log = append(s.log, "delete "+f[1])
+			io.WriteString(nc, "DELETED\r\n")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *fakeServer) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.log...)
+}
+
+func TestDaemonReplaysMutations(t *testing.T) {
+	primary := newFakeServer(t)
+	standby := newFakeServer(t)
+	primary.items["foo"] = "bar"
+
+	pc, _ := gomcache.NewClient([]string{primary.addr}, false)
+	var dials atomic.Int32
+	pc.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	sc, _ := gomcache.NewClient([]string{standby.addr}, false)
+	d := New(Config{PrimaryAddrs: []string{primary.addr}, Primary: pc, Standby: sc, Workers: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	primary.events <- "ts=1.1 gid=1 type=item_store key=foo status=stored cmd=set ttl=60 clsid=1"
+	primary.events <- "ts=1.2 gid=2 type=item_store key=gone status=stored cmd=set ttl=-1 clsid=1"
+	primary.events <- "ts=1.3 gid=3 type=item_store key=foo status=not_stored cmd=add ttl=-1 clsid=1"
+	primary.events <- "ts=1.4 gid=4 type=deleted key=old cmd=delete clsid=1"
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Stats().Deleted == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for mutations, stats %+v", d.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	want := []string{"set foo 3 60", "delete old"}
+	got := standby.commands()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected standby commands %q, got %q", want, got)
+	}
+	if st := d.Stats(); st.Stored != 1 || st.Skipped != 1 || st.Deleted != 1 || st.Errors != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if n := dials.Load(); n < 2 {
+		t.Fatalf("expected the watch and the reads to dial with the primary client, got %d dials", n)
+	}
+}
+
+func TestReplayable(t *testing.T) {
+	tests := []struct {
+		ev   gomcache.LogEvent
+		want bool
+	}{
+		{gomcache.LogEvent{Type: "item_store", Key: "a b", Status: "stored"}, true},
+		{gomcache.LogEvent{Type: "item_store", Key: "a", Status: "not_stored"}, false},
+		{gomcache.LogEvent{Type: "deleted", Key: "a"}, true},
+		{gomcache.LogEvent{Type: "item_get", Key: "a", Status: "found"}, false},
+		{gomcache.LogEvent{Type: "item_store", Status: "stored"}, false},
+	}
+	for _, tt := range tests {
+		if got := replayable(tt.ev); got != tt.want {
+			t.Fatalf("replayable(%+v) = %v, expected %v", tt.ev, got, tt.want)
+		}
+	}
+}
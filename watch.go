@@ -0,0 +1,155 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWatchClasses are the log classes Watch subscribes to if given none.
+var DefaultWatchClasses = []string{"fetchers", "mutations", "evictions"}
+
+// LogEvent is an event streamed by the watch command of memcached, such as
+//
+//	ts=1700000000.123456 gid=7 type=item_store key=foo status=stored cmd=set ttl=-1 clsid=1
+type LogEvent struct {
+	Time      time.Time // when the event happened, from ts
+	Type      string    // such as "item_get", "item_store", "deleted" or "eviction"
+	Key       string    // key of the item, unescaped, if any
+	Status    string    // such as "found", "not_found" or "stored"
+	Command   string    // command of mutations, such as "set" or "incr"
+	TTL       int32     // seconds left to live, -1 for none
+	SlabClass int       // slab class of the item, from clsid
+
+	// Fields holds every field of the line, unparsed, including those not
+	// above, such as la, the last access time of evicted items.
+	Fields map[string]string
+}
+
+// Watch opens a dedicated connection to the server at addr, subscribes it
+// to the given log classes of the watch command of memcached 1.6, such as
+// "fetchers", "mutations", "evictions" or "deletions", or to
+// DefaultWatchClasses if none are given, and streams the events it logs,
+// to debug hot keys and evictions.
+//
+// The returned channel is closed once ctx is done or the connection fails;
+// call Watch again to resume. The server drops events rather than block
+// when they are not read fast enough, so the reader should keep up.
+func (c *Client) Watch(ctx context.Context, addr string, classes ...string) (<-chan LogEvent, error) {
+	if err := c.conformFeature(featureWatch); err != nil {
+		return nil, err
+	}
+	a, err := resolveServer(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(classes) == 0 {
+		classes = DefaultWatchClasses
+	}
+
+	nc, err := c.connect(ctx, a, ProtocolText)
+	if err != nil {
+		return nil, err
+	}
+	nc.SetDeadline(c.deadline(ctx))
+	r := bufio.NewReader(nc)
+	_, err = nc.Write([]byte("watch " + strings.Join(classes, " ") + "\r\n"))
+	if err == nil {
+		var line []byte
+		if line, err = r.ReadSlice('\n'); err == nil && string(line) != string(resultOK) {
+			err = errorResponse(line)
+			if err == nil {
+				err = unexpectedResponse(line)
+			}
+		}
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+
+	ch := make(chan LogEvent, 64)
+	go func() {
+		defer close(ch)
+		defer nc.Close()
+		stop := context.AfterFunc(ctx, func() { nc.Close() })
+		defer stop()
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			ev, ok := parseLogEvent(line)
+			if !ok {
+				continue
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// parseLogEvent parses a line streamed by the watch command and reports
+// whether it was an event.
+func parseLogEvent(line string) (LogEvent, bool) {
+	ev := LogEvent{Fields: make(map[string]string), TTL: -1}
+	for _, field := range strings.Fields(line) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		ev.Fields[k] = v
+		switch k {
+		case "ts":
+			if ts, err := strconv.ParseFloat(v, 64); err == nil {
+				sec, frac := math.Modf(ts)
+				ev.Time = time.Unix(int64(sec), int64(frac*1e9))
+			}
+		case "type":
+			ev.Type = v
+		case "key":
+			if key, err := url.PathUnescape(v); err == nil {
+				ev.Key = key
+			} else {
+				ev.Key = v
+			}
+		case "status":
+			ev.Status = v
+		case "cmd":
+			ev.Command = v
+		case "ttl":
+			if ttl, err := strconv.ParseInt(v, 10, 32); err == nil {
+				ev.TTL = int32(ttl)
+			}
+		case "clsid":
+			ev.SlabClass, _ = strconv.Atoi(v)
+		}
+	}
+	return ev, ev.Type != ""
+}
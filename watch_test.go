@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	srv := newTestServer(t)
+	client, _ := NewClient([]string{srv.addr}, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := client.Watch(ctx, srv.addr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ev := <-ch
+	if ev.Type != "item_get" || ev.Key != "foo" || ev.Status != "found" || ev.SlabClass != 1 || ev.TTL != -1 ||
+		!ev.Time.Equal(time.Unix(1700000000, 250000000)) || ev.Fields["cfd"] != "20" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	ev = <-ch
+	if ev.Type != "item_store" || ev.Key != "a b" || ev.Command != "set" || ev.TTL != 60 || ev.SlabClass != 2 {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatalf("expected no more events")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the channel to be closed once the context is done")
+	}
+
+	if _, err := client.Watch(context.Background(), srv.addr, "bogus"); !errors.Is(err, ErrServerError) {
+		t.Fatalf("expected ErrServerError, got %v", err)
+	}
+	client.Conformance = TargetTwemproxy
+	var ce *ConformanceError
+	if _, err := client.Watch(context.Background(), srv.addr); !errors.As(err, &ce) {
+		t.Fatalf("expected a ConformanceError, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"net"
+)
+
+// ZoneSelector is implemented by selectors that know the availability zone
+// of their servers, such as ServerList and HashRing given servers as
+// "host:port?zone=name". A client with a Zone reads replicated keys from a
+// replica in its own zone when there is one.
+type ZoneSelector interface {
+	ServerSelector
+
+	// Zone returns the zone of the server at addr, or "" if unknown.
+	Zone(addr net.Addr) string
+}
+
+// localReplicas returns the replicas in addrs that are in the zone of the
+// client, or nil if zones do not apply.
+func (c *Client) localReplicas(addrs []net.Addr) []net.Addr {
+	zs, ok := c.selector.(ZoneSelector)
+	if c.Zone == "" || !ok {
+		return nil
+	}
+	var local []net.Addr
+	for _, addr := range addrs {
+		if zs.Zone(addr) == c.Zone {
+			local = append(local, addr)
+		}
+	}
+	return local
+}
+
+// zoneFallback returns the replica of key in another zone to read from when
+// reading it from addr, in the zone of the client, failed, or nil if there
+// is none.
+func (c *Client) zoneFallback(cl *call, key string, addr net.Addr) net.Addr {
+	zs, ok := c.selector.(ZoneSelector)
+	rs, _ := c.selector.(ReplicaSelector)
+	if c.Zone == "" || cl.server != nil || !ok || rs == nil || zs.Zone(addr) != c.Zone {
+		return nil
+	}
+	addrs, err := rs.SelectReplicas(key)
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if zs.Zone(a) != c.Zone {
+			return a
+		}
+	}
+	return nil
+}
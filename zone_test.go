@@ -0,0 +1,62 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"net"
+	"testing"
+)
+
+func TestZoneAwareReads(t *testing.T) {
+	remote := newTestServer(t)
+	local := newTestServer(t)
+
+	sel := &testReplicas{}
+	if err := sel.SetServers(remote.addr+"?zone=a", local.addr+"?zone=b"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client, _ := NewFromSelector(sel, false)
+	client.Zone = "b"
+	if err := client.Set(&Item{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	local.item("foo").value = []byte("local")
+
+	item, err := client.Get("foo")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(item.Value) != "local" {
+		t.Fatalf("expected the read to stay in zone b, got %q", item.Value)
+	}
+
+	// With the replica of its zone down, the client reads across zones.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := ln.Addr().String()
+	ln.Close()
+	if err := sel.SetServers(remote.addr+"?zone=a", down+"?zone=b"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	item, err = client.Get("foo")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(item.Value) != "bar" {
+		t.Fatalf("expected the read to fall back to zone a, got %q", item.Value)
+	}
+}
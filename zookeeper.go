@@ -0,0 +1,405 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultZooKeeperSessionTimeout is the default session timeout requested
+// by a ZooKeeperSource.
+const DefaultZooKeeperSessionTimeout = 10 * time.Second
+
+// ZooKeeper opcodes and special transaction ids.
+const (
+	zkOpGetData     int32 = 4
+	zkOpGetChildren int32 = 8
+	zkOpPing        int32 = 11
+
+	zkXidWatch int32 = -1
+	zkXidPing  int32 = -2
+
+	zkErrNoNode int32 = -101
+)
+
+// ZooKeeperSource is a ServerSource reading the servers from a znode. By
+// default the data of the znode lists them, separated by newlines or
+// commas; with Children, the servers are the names of its children, such
+// as the ephemeral znodes memcached hosts register.
+//
+// The source keeps a session open between lookups and watches the znode:
+// after the first lookup, every lookup waits for the znode to change, so
+// that a Discovery applies changes as they are made. A ZooKeeperSource
+// must not be used by several Discoveries at once.
+type ZooKeeperSource struct {
+	// Addrs are the host:port addresses of the ZooKeeper servers, tried
+	// in order.
+	Addrs []string
+
+	// Path is the path of the znode.
+	Path string
+
+	// Children reads the servers from the names of the children of the
+	// znode rather than from its data.
+	Children bool
+
+	// SessionTimeout is the session timeout to request. If zero,
+	// DefaultZooKeeperSessionTimeout is used.
+	SessionTimeout time.Duration
+
+	mu sync.Mutex
+	zc *zkConn // session with a watch set on the znode
+}
+
+// Servers reads the servers, after waiting for a change of the znode if
+// the previous lookup succeeded.
+func (s *ZooKeeperSource) Servers(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.zc != nil {
+		if err := s.zc.waitWatch(ctx); err != nil {
+			s.zc.close()
+			s.zc = nil
+			return nil, err
+		}
+	} else {
+		zc, err := s.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.zc = zc
+	}
+
+	servers, err := s.read(ctx)
+	if err != nil {
+		s.zc.close()
+		s.zc = nil
+	}
+	return servers, err
+}
+
+// read reads the servers from the znode, leaving a watch on it.
+func (s *ZooKeeperSource) read(ctx context.Context) ([]string, error) {
+	req := zkAppendString(nil, s.Path)
+	req = append(req, 1) // watch
+	if s.Children {
+		resp, err := s.zc.call(ctx, zkOpGetChildren, req)
+		if err != nil {
+			return nil, err
+		}
+		d := zkDecoder{b: resp}
+		n := d.int32()
+		var servers []string
+		for i := int32(0); i < n && d.err == nil; i++ {
+			servers = append(servers, d.string())
+		}
+		return servers, d.err
+	}
+
+	resp, err := s.zc.call(ctx, zkOpGetData, req)
+	if err != nil {
+		return nil, err
+	}
+	d := zkDecoder{b: resp}
+	data := d.string()
+	if d.err != nil {
+		return nil, d.err
+	}
+	var servers []string
+	for _, f := range strings.FieldsFunc(data, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if f = strings.TrimSpace(f); f != "" {
+			servers = append(servers, f)
+		}
+	}
+	return servers, nil
+}
+
+// connect opens a session with the first ZooKeeper server that accepts one.
+func (s *ZooKeeperSource) connect(ctx context.Context) (*zkConn, error) {
+	if len(s.Addrs) == 0 {
+		return nil, errors.New("memcache: no ZooKeeper servers")
+	}
+	timeout := s.SessionTimeout
+	if timeout <= 0 {
+		timeout = DefaultZooKeeperSessionTimeout
+	}
+	var err error
+	for _, addr := range s.Addrs {
+		var zc *zkConn
+		zc, err = dialZooKeeper(ctx, addr, timeout)
+		if err == nil || ctx.Err() != nil {
+			return zc, err
+		}
+	}
+	return nil, err
+}
+
+// zkConn is a ZooKeeper session. Its frames are read by a goroutine, so
+// that waiting for a watch can be interleaved with pings.
+type zkConn struct {
+	nc        net.Conn
+	frames    chan []byte
+	err       error         // why frames was closed
+	done      chan struct{} // closed by close
+	xid       int32
+	pingEvery time.Duration
+	fired     bool // a watch event arrived during a call
+}
+
+// dialZooKeeper connects to the ZooKeeper server at addr and opens a new
+// session.
+func dialZooKeeper(ctx context.Context, addr string, timeout time.Duration) (*zkConn, error) {
+	var dialer net.Dialer
+	nc, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	nc.SetDeadline(time.Now().Add(timeout))
+
+	// ConnectRequest: protocol version, last zxid seen, timeout, session
+	// id, password and read-only flag.
+	req := binary.BigEndian.AppendUint32(nil, 0)
+	req = binary.BigEndian.AppendUint64(req, 0)
+	req = binary.BigEndian.AppendUint32(req, uint32(timeout/time.Millisecond))
+	req = binary.BigEndian.AppendUint64(req, 0)
+	req = binary.BigEndian.AppendUint32(req, 16)
+	req = append(req, make([]byte, 16)...)
+	req = append(req, 0)
+	br := bufio.NewReader(nc)
+	if _, err := nc.Write(zkFrame(req)); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	resp, err := zkReadFrame(br)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	d := zkDecoder{b: resp}
+	d.int32() // protocol version
+	negotiated := d.int32()
+	if d.err != nil || negotiated <= 0 {
+		nc.Close()
+		return nil, errors.New("memcache: ZooKeeper refused the session")
+	}
+	nc.SetDeadline(time.Time{})
+
+	zc := &zkConn{
+		nc:        nc,
+		frames:    make(chan []byte, 16),
+		done:      make(chan struct{}),
+		pingEvery: time.Duration(negotiated) * time.Millisecond / 3,
+	}
+	go zc.readFrames(br)
+	return zc, nil
+}
+
+// readFrames passes the frames read from the connection to zc.frames until
+// it fails or the session is closed.
+func (zc *zkConn) readFrames(r *bufio.Reader) {
+	defer close(zc.frames)
+	for {
+		frame, err := zkReadFrame(r)
+		if err != nil {
+			zc.err = err
+			return
+		}
+		select {
+		case zc.frames <- frame:
+		case <-zc.done:
+			zc.err = net.ErrClosed
+			return
+		}
+	}
+}
+
+// close ends the session by closing the connection, which also removes the
+// watches, and stops reading frames nobody will receive.
+func (zc *zkConn) close() {
+	close(zc.done)
+	zc.nc.Close()
+}
+
+// call sends a request and returns the body of its reply, answering pings
+// in between.
+func (zc *zkConn) call(ctx context.Context, op int32, body []byte) ([]byte, error) {
+	zc.xid++
+	xid := zc.xid
+	if err := zc.send(xid, op, body); err != nil {
+		return nil, err
+	}
+	for {
+		h, resp, err := zc.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch h.xid {
+		case zkXidWatch:
+			zc.fired = true
+		case xid:
+			if h.err == zkErrNoNode {
+				return nil, errors.New("memcache: ZooKeeper node does not exist")
+			} else if h.err != 0 {
+				return nil, fmt.Errorf("memcache: ZooKeeper error %d", h.err)
+			}
+			return resp, nil
+		}
+	}
+}
+
+// waitWatch waits for the watch left by the last read to fire, pinging the
+// server to keep the session alive.
+func (zc *zkConn) waitWatch(ctx context.Context) error {
+	if zc.fired {
+		zc.fired = false
+		return nil
+	}
+	for {
+		h, _, err := zc.next(ctx)
+		if err != nil {
+			return err
+		}
+		if h.xid == zkXidWatch {
+			return nil
+		}
+	}
+}
+
+// zkReplyHeader is the header of every reply and watch event.
+type zkReplyHeader struct {
+	xid int32
+	err int32
+}
+
+// next returns the next frame other than a ping reply, sending pings while
+// waiting for it.
+func (zc *zkConn) next(ctx context.Context) (zkReplyHeader, []byte, error) {
+	t := time.NewTicker(zc.pingEvery)
+	defer t.Stop()
+	for {
+		select {
+		case frame, ok := <-zc.frames:
+			if !ok {
+				return zkReplyHeader{}, nil, zc.err
+			}
+			d := zkDecoder{b: frame}
+			h := zkReplyHeader{xid: d.int32()}
+			d.int64() // zxid
+			h.err = d.int32()
+			if d.err != nil {
+				return h, nil, d.err
+			}
+			if h.xid != zkXidPing {
+				return h, d.b, nil
+			}
+		case <-t.C:
+			if err := zc.send(zkXidPing, zkOpPing, nil); err != nil {
+				return zkReplyHeader{}, nil, err
+			}
+		case <-ctx.Done():
+			return zkReplyHeader{}, nil, ctx.Err()
+		}
+	}
+}
+
+// send writes a request.
+func (zc *zkConn) send(xid, op int32, body []byte) error {
+	req := binary.BigEndian.AppendUint32(nil, uint32(xid))
+	req = binary.BigEndian.AppendUint32(req, uint32(op))
+	req = append(req, body...)
+	zc.nc.SetWriteDeadline(time.Now().Add(zc.pingEvery))
+	_, err := zc.nc.Write(zkFrame(req))
+	return err
+}
+
+// zkFrame prefixes b with its length.
+func zkFrame(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+}
+
+// zkReadFrame reads a length-prefixed frame.
+func zkReadFrame(r *bufio.Reader) ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size > 1<<20 {
+		return nil, errors.New("memcache: ZooKeeper frame too large")
+	}
+	frame := make([]byte, size)
+	_, err := io.ReadFull(r, frame)
+	return frame, err
+}
+
+// zkAppendString appends s as a length-prefixed string.
+func zkAppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// zkDecoder reads the fields of a reply, recording the first error.
+type zkDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *zkDecoder) int32() int32 {
+	if len(d.b) < 4 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := int32(binary.BigEndian.Uint32(d.b))
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *zkDecoder) int64() int64 {
+	if len(d.b) < 8 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := int64(binary.BigEndian.Uint64(d.b))
+	d.b = d.b[8:]
+	return v
+}
+
+// string reads a length-prefixed string or buffer; -1 is the empty one.
+func (d *zkDecoder) string() string {
+	n := d.int32()
+	if n < 0 || d.err != nil {
+		return ""
+	}
+	if int(n) > len(d.b) {
+		d.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
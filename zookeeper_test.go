@@ -0,0 +1,184 @@
+/*
+Copyright 2024 The gomcache AUTHORS
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gomcache provides a client for the Memcached cache server using TCP and UDP.
+package gomcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testZooKeeper is a ZooKeeper server holding a single znode, with data
+// and children, that fires a watch on every change.
+type testZooKeeper struct {
+	addr string
+
+	mu       sync.Mutex
+	data     string
+	children []string
+	watchers []net.Conn
+}
+
+func newTestZooKeeper(t *testing.T) *testZooKeeper {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	zk := &testZooKeeper{addr: ln.Addr().String()}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { nc.Close() })
+			go zk.serve(nc)
+		}
+	}()
+	return zk
+}
+
+func (zk *testZooKeeper) serve(nc net.Conn) {
+	r := bufio.NewReader(nc)
+	if _, err := zkReadFrame(r); err != nil {
+		return
+	}
+	resp := binary.BigEndian.AppendUint32(nil, 0)
+	resp = binary.BigEndian.AppendUint32(resp, 6000)
+	resp = binary.BigEndian.AppendUint64(resp, 1)
+	resp = zkAppendString(resp, string(make([]byte, 16)))
+	nc.Write(zkFrame(resp))
+
+	for {
+		req, err := zkReadFrame(r)
+		if err != nil {
+			return
+		}
+		d := zkDecoder{b: req}
+		xid, op := d.int32(), d.int32()
+		d.string() // path
+		reply := binary.BigEndian.AppendUint32(nil, uint32(xid))
+		reply = binary.BigEndian.AppendUint64(reply, 1)
+		reply = binary.BigEndian.AppendUint32(reply, 0)
+
+		zk.mu.Lock()
+		switch op {
+		case zkOpGetData:
+			reply = zkAppendString(reply, zk.data)
+			zk.watchers = append(zk.watchers, nc)
+		case zkOpGetChildren:
+			reply = binary.BigEndian.AppendUint32(reply, uint32(len(zk.children)))
+			for _, c := range zk.children {
+				reply = zkAppendString(reply, c)
+			}
+			zk.watchers = append(zk.watchers, nc)
+		}
+		nc.Write(zkFrame(reply))
+		zk.mu.Unlock()
+	}
+}
+
+// set changes the znode and fires the watches.
+func (zk *testZooKeeper) set(data string, children ...string) {
+	zk.mu.Lock()
+	defer zk.mu.Unlock()
+	zk.data, zk.children = data, children
+	xid := zkXidWatch
+	for _, nc := range zk.watchers {
+		event := binary.BigEndian.AppendUint32(nil, uint32(xid))
+		event = binary.BigEndian.AppendUint64(event, 0)
+		event = binary.BigEndian.AppendUint32(event, 0)
+		event = binary.BigEndian.AppendUint32(event, 3) // NodeDataChanged
+		event = binary.BigEndian.AppendUint32(event, 3) // SyncConnected
+		event = zkAppendString(event, "/memcached")
+		nc.Write(zkFrame(event))
+	}
+	zk.watchers = nil
+}
+
+func TestZooKeeperSource(t *testing.T) {
+	zk := newTestZooKeeper(t)
+	zk.set("10.4.0.1:11211,10.4.0.2:11211\n", "10.4.0.1:11211")
+
+	for _, children := range []bool{false, true} {
+		src := &ZooKeeperSource{Addrs: []string{zk.addr}, Path: "/memcached", Children: children}
+		got, err := src.Servers(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := []string{"10.4.0.1:11211", "10.4.0.2:11211"}
+		if children {
+			want = want[:1]
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+
+		done := make(chan []string)
+		go func() {
+			got, err := src.Servers(context.Background())
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			done <- got
+		}()
+		zk.set("10.4.0.3:11211", "10.4.0.3:11211")
+		if got := <-done; !slices.Equal(got, []string{"10.4.0.3:11211"}) {
+			t.Fatalf("expected the changed servers, got %v", got)
+		}
+		zk.set("10.4.0.1:11211,10.4.0.2:11211\n", "10.4.0.1:11211")
+	}
+}
+
+func TestZooKeeperCloseUnread(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	zc := &zkConn{nc: client, frames: make(chan []byte, 16), done: make(chan struct{})}
+	go zc.readFrames(bufio.NewReader(client))
+
+	// Queue more frames than the session buffers, and never read them.
+	go func() {
+		for i := 0; i < 32; i++ {
+			if _, err := server.Write(zkFrame(make([]byte, 16))); err != nil {
+				return
+			}
+		}
+	}()
+	for len(zc.frames) < cap(zc.frames) {
+		time.Sleep(time.Millisecond)
+	}
+	zc.close()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-zc.frames:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("expected the frame reader to stop once the session is closed")
+		}
+	}
+}